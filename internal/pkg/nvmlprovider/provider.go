@@ -19,6 +19,7 @@ package nvmlprovider
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,18 +36,31 @@ type MIGDeviceInfo struct {
 	ComputeInstanceID int
 }
 
-// GetMIGDeviceInfoByID returns information about MIG DEVICE by ID
-func GetMIGDeviceInfoByID(uuid string) (*MIGDeviceInfo, error) {
-	var err error
+// ProcessMemory is the framebuffer memory used by a compute process, as reported by nvidia-smi
+type ProcessMemory struct {
+	PID        uint
+	UsedMemory uint64 // In bytes
+	Available  bool   // False when the driver doesn't report the memory of the process
+}
+
+var nvmlInitErr error
 
+// initNVML initializes the NVML library on first use
+func initNVML() error {
 	nvmlOnce.Do(func() {
 		ret := nvml.Init()
 		if ret != nvml.SUCCESS {
-			err = errors.New(nvml.ErrorString(ret))
+			nvmlInitErr = errors.New(nvml.ErrorString(ret))
 			logrus.Error("Can not init NVML library.")
 		}
 	})
-	if err != nil {
+
+	return nvmlInitErr
+}
+
+// GetMIGDeviceInfoByID returns information about MIG DEVICE by ID
+func GetMIGDeviceInfoByID(uuid string) (*MIGDeviceInfo, error) {
+	if err := initNVML(); err != nil {
 		return nil, err
 	}
 
@@ -112,3 +126,46 @@ func GetMIGDeviceInfoByID(uuid string) (*MIGDeviceInfo, error) {
 		ComputeInstanceID: ci,
 	}, nil
 }
+
+// GetRunningProcessIDs returns the PIDs of the compute processes running on the device with the given UUID
+func GetRunningProcessIDs(uuid string) ([]uint, error) {
+	processes, err := GetRunningProcesses(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	pids := make([]uint, 0, len(processes))
+	for _, process := range processes {
+		pids = append(pids, process.PID)
+	}
+
+	return pids, nil
+}
+
+// GetRunningProcesses returns the compute processes running on the device with the given UUID and their memory
+func GetRunningProcesses(uuid string) ([]ProcessMemory, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	processes, ret := device.GetComputeRunningProcesses()
+	if ret != nvml.SUCCESS {
+		return nil, errors.New(nvml.ErrorString(ret))
+	}
+
+	res := make([]ProcessMemory, 0, len(processes))
+	for _, process := range processes {
+		res = append(res, ProcessMemory{
+			PID:        uint(process.Pid),
+			UsedMemory: process.UsedGpuMemory,
+			Available:  process.UsedGpuMemory != math.MaxUint64,
+		})
+	}
+
+	return res, nil
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"slices"
@@ -19,6 +23,7 @@ import (
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
 
 	"github.com/NVIDIA/dcgm-exporter/pkg/dcgmexporter"
 	"github.com/NVIDIA/dcgm-exporter/pkg/stdout"
@@ -50,31 +55,124 @@ const (
 		and therefore reporting must occur at the GPU instance level.`
 )
 
+// Interval at which the connection to the remote nv-hostengine is checked, see watchHostengine
+const hostengineCheckInterval = 5 * time.Second
+
+// Hooks initializing DCGM, replaced by the tests
+var (
+	initEmbeddedDCGMHook  = func() (func(), error) { return dcgm.Init(dcgm.Embedded) }
+	connectHostengineHook = dcgmexporter.ConnectHostengine
+)
+
+// Environment variables holding the secrets of the metrics endpoint, when they aren't read from a file
+const (
+	envAuthPassword    = "DCGM_EXPORTER_AUTH_PASSWORD"
+	envAuthBearerToken = "DCGM_EXPORTER_AUTH_BEARER_TOKEN"
+)
+
 const (
-	CLIFieldsFile                 = "collectors"
-	CLIAddress                    = "address"
-	CLICollectInterval            = "collect-interval"
-	CLIKubernetes                 = "kubernetes"
-	CLIKubernetesGPUIDType        = "kubernetes-gpu-id-type"
-	CLIUseOldNamespace            = "use-old-namespace"
-	CLIRemoteHEInfo               = "remote-hostengine-info"
-	CLIGPUDevices                 = "devices"
-	CLISwitchDevices              = "switch-devices"
-	CLICPUDevices                 = "cpu-devices"
-	CLINoHostname                 = "no-hostname"
-	CLIUseFakeGPUs                = "fake-gpus"
-	CLIConfigMapData              = "configmap-data"
-	CLIWebSystemdSocket           = "web-systemd-socket"
-	CLIWebConfigFile              = "web-config-file"
-	CLIXIDCountWindowSize         = "xid-count-window-size"
-	CLIReplaceBlanksInModelName   = "replace-blanks-in-model-name"
-	CLIDebugMode                  = "debug"
-	CLIClockEventsCountWindowSize = "clock-events-count-window-size"
-	CLIEnableDCGMLog              = "enable-dcgm-log"
-	CLIDCGMLogLevel               = "dcgm-log-level"
-	CLIPodResourcesKubeletSocket  = "pod-resources-kubelet-socket"
-	CLIHPCJobMappingDir           = "hpc-job-mapping-dir"
-	CLINvidiaResourceNames        = "nvidia-resource-names"
+	CLIFieldsFile                     = "collectors"
+	CLIAddress                        = "address"
+	CLICollectInterval                = "collect-interval"
+	CLICollectIntervalOverrides       = "collect-interval-overrides"
+	CLICollectIntervalJitter          = "collect-interval-jitter"
+	CLICollectTimeout                 = "collect-timeout"
+	CLIMaxSeries                      = "max-series"
+	CLIDCGMUpdateFrequency            = "dcgm-update-frequency"
+	CLIDCGMMaxKeepAge                 = "dcgm-max-keep-age"
+	CLISamplingInterval               = "sampling-interval"
+	CLIKubernetes                     = "kubernetes"
+	CLISlurm                          = "slurm"
+	CLINodeLabelAllowlist             = "node-label-allowlist"
+	CLITransformOrder                 = "transform-order"
+	CLIKubernetesGPUIDType            = "kubernetes-gpu-id-type"
+	CLIUseOldNamespace                = "use-old-namespace"
+	CLIRemoteHEInfo                   = "remote-hostengine-info"
+	CLIGPUDevices                     = "devices"
+	CLISwitchDevices                  = "switch-devices"
+	CLICPUDevices                     = "cpu-devices"
+	CLINoHostname                     = "no-hostname"
+	CLIGPULabelStrategy               = "gpu-label-strategy"
+	CLIUUIDLabelSource                = "uuid-label-source"
+	CLIHostnameSource                 = "hostname-source"
+	CLIHostname                       = "hostname"
+	CLIUseFakeGPUs                    = "fake-gpus"
+	CLIEnableGPU                      = "enable-gpu"
+	CLIEnableSwitch                   = "enable-switch"
+	CLIEnableLink                     = "enable-link"
+	CLIEnableCPU                      = "enable-cpu"
+	CLIEnableCPUCore                  = "enable-cpu-core"
+	CLIConfigMapData                  = "configmap-data"
+	CLIWebSystemdSocket               = "web-systemd-socket"
+	CLIWebConfigFile                  = "web-config-file"
+	CLIAuthUsername                   = "auth-username"
+	CLIAuthPasswordFile               = "auth-password-file"
+	CLIAuthBearerTokenFile            = "auth-bearer-token-file"
+	CLITLSCertFile                    = "tls-cert-file"
+	CLITLSKeyFile                     = "tls-key-file"
+	CLITLSClientCAFile                = "tls-client-ca-file"
+	CLIEnablePprof                    = "enable-pprof"
+	CLIAdminAddress                   = "admin-address"
+	CLIXIDCountWindowSize             = "xid-count-window-size"
+	CLIReplaceBlanksInModelName       = "replace-blanks-in-model-name"
+	CLIDebugMode                      = "debug"
+	CLILogFormat                      = "log-format"
+	CLILogLevel                       = "log-level"
+	CLIClockEventsCountWindowSize     = "clock-events-count-window-size"
+	CLIEnableDCGMLog                  = "enable-dcgm-log"
+	CLIDCGMLogLevel                   = "dcgm-log-level"
+	CLIPodResourcesKubeletSocket      = "pod-resources-kubelet-socket"
+	CLIHPCJobMappingDir               = "hpc-job-mapping-dir"
+	CLINvidiaResourceNames            = "nvidia-resource-names"
+	CLIUseSampleTimestamp             = "use-sample-timestamp"
+	CLIFormat                         = "format"
+	CLIStaticLabels                   = "static-labels"
+	CLIHelpVars                       = "help-vars"
+	CLILabelRename                    = "label-rename"
+	CLILabelDrop                      = "label-drop"
+	CLIMetricNamePrefix               = "metric-name-prefix"
+	CLIPodMappingNamespaceAllow       = "pod-mapping-namespace-allow"
+	CLIPodMappingNamespaceDeny        = "pod-mapping-namespace-deny"
+	CLIKubernetesRemoveContainerLabel = "kubernetes-remove-container-label"
+	CLISharingStrategy                = "sharing-strategy"
+	CLIInitRetryInterval              = "init-retry-interval"
+	CLIInitRetryTimeout               = "init-retry-timeout"
+	CLIEnableCompression              = "enable-compression"
+	CLIEnableProcessMetrics           = "enable-process-metrics"
+	CLIEnableProcessMemoryMetrics     = "enable-process-memory-metrics"
+	CLIDiagLevel                      = "diag-level"
+	CLIDiagInterval                   = "diag-interval"
+	CLIDeviceRescanInterval           = "device-rescan-interval"
+	CLIEnableTopologyLabels           = "enable-topology-labels"
+	CLIEnableDriverLabels             = "enable-driver-labels"
+	CLIEnableCPUAffinityLabel         = "enable-cpu-affinity-label"
+	CLIEnableComputeInstanceMetrics   = "enable-compute-instance-metrics"
+	CLIEnableVGPU                     = "enable-vgpu"
+	CLIEnableRollups                  = "enable-rollups"
+	CLIOnce                           = "once"
+	CLIFieldPreflight                 = "field-preflight"
+	CLIMissingValuePolicy             = "missing-value-policy"
+	CLIMissingValueDefault            = "missing-value-default"
+	CLIDeviceFilter                   = "device-filter"
+	CLICounterAllowRegex              = "counter-allow-regex"
+	CLICounterDenyRegex               = "counter-deny-regex"
+	CLIStrictCounterTypes             = "strict-counter-types"
+	CLIRemoteWriteURL                 = "remote-write-url"
+	CLIRemoteWriteUsername            = "remote-write-username"
+	CLIRemoteWritePassword            = "remote-write-password"
+	CLIRemoteWriteBearerToken         = "remote-write-bearer-token"
+	CLIEnableOTLP                     = "enable-otlp"
+	CLIOTLPEndpoint                   = "otlp-endpoint"
+	CLIOTLPHeaders                    = "otlp-headers"
+	CLIOTLPInsecure                   = "otlp-insecure"
+	CLIOTLPCAFile                     = "otlp-ca-file"
+	CLIOTLPCertFile                   = "otlp-cert-file"
+	CLIOTLPKeyFile                    = "otlp-key-file"
+	CLIStatsDAddress                  = "statsd-address"
+	CLIStatsDTagFormat                = "statsd-tag-format"
+	CLIPushSuppressUnchanged          = "push-suppress-unchanged"
+	CLIPushSuppressEpsilon            = "push-suppress-epsilon"
+	CLIPushMaxSuppression             = "push-max-suppression"
 )
 
 func NewApp(buildVersion ...string) *cli.App {
@@ -95,7 +193,7 @@ func NewApp(buildVersion ...string) *cli.App {
 		&cli.StringFlag{
 			Name:    CLIFieldsFile,
 			Aliases: []string{"f"},
-			Usage:   "Path to the file, that contains the DCGM fields to collect",
+			Usage:   "Path to the file, that contains the DCGM fields to collect. Accepts a comma-separated list of files and directories of *.csv files",
 			Value:   "/etc/dcgm-exporter/default-counters.csv",
 			EnvVars: []string{"DCGM_EXPORTER_COLLECTORS"},
 		},
@@ -103,7 +201,7 @@ func NewApp(buildVersion ...string) *cli.App {
 			Name:    CLIAddress,
 			Aliases: []string{"a"},
 			Value:   ":9400",
-			Usage:   "Address",
+			Usage:   "Address the metrics server listens on, specified as [<HOST>]:<PORT>, e.g. '[::]:9400' or '127.0.0.1:9400'. An empty host listens on all interfaces.",
 			EnvVars: []string{"DCGM_EXPORTER_LISTEN"},
 		},
 		&cli.IntFlag{
@@ -113,6 +211,49 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Interval of time at which point metrics are collected. Unit is milliseconds (ms).",
 			EnvVars: []string{"DCGM_EXPORTER_INTERVAL"},
 		},
+		&cli.StringSliceFlag{
+			Name:  CLICollectIntervalOverrides,
+			Value: cli.NewStringSlice(),
+			Usage: fmt.Sprintf("Override the collect interval for an entity as <ENTITY>=<INTERVAL_MS>. Possible entities: %s",
+				strings.Join(dcgmexporter.PipelineEntities, ", ")),
+			EnvVars: []string{"DCGM_EXPORTER_INTERVAL_OVERRIDES"},
+		},
+		&cli.Float64Flag{
+			Name:    CLICollectIntervalJitter,
+			Value:   0,
+			Usage:   "Delays the first collection by a random fraction of the collect interval, between 0 and this value, to spread the collections of several instances. Must be in [0, 1).",
+			EnvVars: []string{"DCGM_EXPORTER_INTERVAL_JITTER"},
+		},
+		&cli.IntFlag{
+			Name:    CLICollectTimeout,
+			Value:   0,
+			Usage:   "Time after which a collection that didn't complete fails, so a stuck hostengine doesn't block the exporter. Unit is milliseconds (ms), 0 waits indefinitely.",
+			EnvVars: []string{"DCGM_EXPORTER_COLLECT_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    CLIMaxSeries,
+			Value:   0,
+			Usage:   "Maximum number of series exported by the collectors, the series above it are dropped and counted by dcgm_exporter_series_dropped_total. 0 is unlimited.",
+			EnvVars: []string{"DCGM_EXPORTER_MAX_SERIES"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDCGMUpdateFrequency,
+			Value:   0,
+			Usage:   "Interval at which DCGM samples the watched fields. 0 samples them at the collect interval of each entity. Unit is milliseconds (ms).",
+			EnvVars: []string{"DCGM_EXPORTER_DCGM_UPDATE_FREQUENCY"},
+		},
+		&cli.Float64Flag{
+			Name:    CLIDCGMMaxKeepAge,
+			Value:   0,
+			Usage:   "Age after which DCGM discards the samples of the watched fields. 0 keeps the latest sample whatever its age. Unit is seconds (s).",
+			EnvVars: []string{"DCGM_EXPORTER_DCGM_MAX_KEEP_AGE"},
+		},
+		&cli.IntFlag{
+			Name:    CLISamplingInterval,
+			Value:   1000,
+			Usage:   "Interval at which DCGM samples the fields of the counters aggregating their samples over the collect interval. Unit is milliseconds (ms).",
+			EnvVars: []string{"DCGM_EXPORTER_SAMPLING_INTERVAL"},
+		},
 		&cli.BoolFlag{
 			Name:    CLIKubernetes,
 			Aliases: []string{"k"},
@@ -120,6 +261,24 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Enable kubernetes mapping metrics to kubernetes pods",
 			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES"},
 		},
+		&cli.BoolFlag{
+			Name:    CLISlurm,
+			Value:   false,
+			Usage:   "Enable SLURM mapping of the GPU metrics to the jobs of the processes running on the GPUs. Requires access to the host PID namespace.",
+			EnvVars: []string{"DCGM_EXPORTER_SLURM"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLINodeLabelAllowlist,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Labels of the Kubernetes node, named by NODE_NAME, added to the GPU metrics, e.g. topology.kubernetes.io/zone. Requires the permission to get the node.",
+			EnvVars: []string{"DCGM_EXPORTER_NODE_LABEL_ALLOWLIST"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLITransformOrder,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Transforms applied first, in order, among podMapper, nodeLabelMapper, slurmMapper and hpcMapper. The last transform writing a label wins.",
+			EnvVars: []string{"DCGM_EXPORTER_TRANSFORM_ORDER"},
+		},
 		&cli.BoolFlag{
 			Name:    CLIUseOldNamespace,
 			Aliases: []string{"o"},
@@ -145,7 +304,7 @@ func NewApp(buildVersion ...string) *cli.App {
 			Name:    CLIRemoteHEInfo,
 			Aliases: []string{"r"},
 			Value:   "localhost:5555",
-			Usage:   "Connect to remote hostengine at <HOST>:<PORT>",
+			Usage:   "Connect to remote hostengine at <HOST>:<PORT>, or at the first answering one of a comma-separated list that is failed over in order",
 			EnvVars: []string{"DCGM_REMOTE_HOSTENGINE_INFO"},
 		},
 		&cli.StringFlag{
@@ -169,6 +328,36 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Omit the hostname information from the output, matching older versions.",
 			EnvVars: []string{"DCGM_EXPORTER_NO_HOSTNAME"},
 		},
+		&cli.StringFlag{
+			Name:  CLIGPULabelStrategy,
+			Value: dcgmexporter.GPULabelIndex,
+			Usage: fmt.Sprintf("Value of the gpu label: the index of the GPU on the host, its UUID, or the hostname "+
+				"and the index to identify the GPU across hosts. Possible values: '%s', '%s', '%s'",
+				dcgmexporter.GPULabelIndex, dcgmexporter.GPULabelUUID, dcgmexporter.GPULabelHostnameIndex),
+			EnvVars: []string{"DCGM_EXPORTER_GPU_LABEL_STRATEGY"},
+		},
+		&cli.StringFlag{
+			Name:  CLIUUIDLabelSource,
+			Value: dcgmexporter.UUIDLabelGPU,
+			Usage: fmt.Sprintf("UUID of the UUID label of the MIG instances: the UUID of their parent GPU or of their "+
+				"MIG device. Possible values: '%s', '%s'", dcgmexporter.UUIDLabelGPU, dcgmexporter.UUIDLabelMIG),
+			EnvVars: []string{"DCGM_EXPORTER_UUID_LABEL_SOURCE"},
+		},
+		&cli.StringFlag{
+			Name:  CLIHostnameSource,
+			Value: dcgmexporter.HostnameSourceAuto,
+			Usage: fmt.Sprintf("Source of the Hostname label. Possible values: '%s' (NODE_NAME, or the OS hostname when unset), "+
+				"'%s' (the OS hostname), '%s' (the NODE_NAME environment variable), '%s' (the value of --%s).",
+				dcgmexporter.HostnameSourceAuto, dcgmexporter.HostnameSourceOS, dcgmexporter.HostnameSourceNodeName,
+				dcgmexporter.HostnameSourceFixed, CLIHostname),
+			EnvVars: []string{"DCGM_EXPORTER_HOSTNAME_SOURCE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIHostname,
+			Value:   "",
+			Usage:   fmt.Sprintf("Hostname label of the '%s' hostname source.", dcgmexporter.HostnameSourceFixed),
+			EnvVars: []string{"DCGM_EXPORTER_HOSTNAME"},
+		},
 		&cli.StringFlag{
 			Name:    CLISwitchDevices,
 			Aliases: []string{"s"},
@@ -182,12 +371,93 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Accept GPUs that are fake, for testing purposes only",
 			EnvVars: []string{"DCGM_EXPORTER_USE_FAKE_GPUS"},
 		},
+		&cli.BoolFlag{
+			Name:    CLIEnableGPU,
+			Value:   true,
+			Usage:   "Collect the metrics of the GPUs and their MIG instances. When disabled, their collector isn't created.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_GPU"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableSwitch,
+			Value:   true,
+			Usage:   "Collect the metrics of the NvSwitches. When disabled, their collector isn't created.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_SWITCH"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableLink,
+			Value:   true,
+			Usage:   "Collect the metrics of the NvLinks. When disabled, their collector isn't created.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_LINK"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableCPU,
+			Value:   true,
+			Usage:   "Collect the metrics of the CPUs. When disabled, their collector isn't created.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_CPU"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableCPUCore,
+			Value:   true,
+			Usage:   "Collect the metrics of the CPU cores. When disabled, their collector isn't created.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_CPU_CORE"},
+		},
 		&cli.StringFlag{
 			Name:    CLIWebConfigFile,
 			Value:   "",
 			Usage:   "TLS config file following webConfig spec.",
 			EnvVars: []string{"DCGM_EXPORTER_WEB_CONFIG_FILE"},
 		},
+		&cli.StringFlag{
+			Name:    CLIAuthUsername,
+			Value:   "",
+			Usage:   "Username required to scrape /metrics with basic authentication.",
+			EnvVars: []string{"DCGM_EXPORTER_AUTH_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:  CLIAuthPasswordFile,
+			Value: "",
+			Usage: "File holding the password of --auth-username. " +
+				"Read from the " + envAuthPassword + " environment variable when unset.",
+			EnvVars: []string{"DCGM_EXPORTER_AUTH_PASSWORD_FILE"},
+		},
+		&cli.StringFlag{
+			Name:  CLIAuthBearerTokenFile,
+			Value: "",
+			Usage: "File holding the bearer token required to scrape /metrics. " +
+				"Read from the " + envAuthBearerToken + " environment variable when unset.",
+			EnvVars: []string{"DCGM_EXPORTER_AUTH_BEARER_TOKEN_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLITLSCertFile,
+			Value:   "",
+			Usage:   "Certificate used to serve the metrics over HTTPS. It is reloaded on SIGHUP.",
+			EnvVars: []string{"DCGM_EXPORTER_TLS_CERT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLITLSKeyFile,
+			Value:   "",
+			Usage:   "Private key of --tls-cert-file.",
+			EnvVars: []string{"DCGM_EXPORTER_TLS_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLITLSClientCAFile,
+			Value:   "",
+			Usage:   "CA certificates verifying the client certificates. Clients without a valid certificate are rejected.",
+			EnvVars: []string{"DCGM_EXPORTER_TLS_CLIENT_CA_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnablePprof,
+			Value:   false,
+			Usage:   "Serve the Go runtime profiles under /debug/pprof.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_PPROF"},
+		},
+		&cli.StringFlag{
+			Name:  CLIAdminAddress,
+			Value: "",
+			Usage: "Address of a separate plain HTTP listener serving /health, /ready, /counters, the self-metrics " +
+				"of dcgm-exporter and the profiles, so only the device metrics are exposed on the scrape port.",
+			EnvVars: []string{"DCGM_EXPORTER_ADMIN_ADDRESS"},
+		},
 		&cli.IntFlag{
 			Name:    CLIXIDCountWindowSize,
 			Aliases: []string{"x"},
@@ -208,6 +478,19 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Enable debug output",
 			EnvVars: []string{"DCGM_EXPORTER_DEBUG"},
 		},
+		&cli.StringFlag{
+			Name:  CLILogFormat,
+			Value: dcgmexporter.LogFormatText,
+			Usage: fmt.Sprintf("Format of the logs. Possible values: '%s', '%s'",
+				dcgmexporter.LogFormatText, dcgmexporter.LogFormatJSON),
+			EnvVars: []string{"DCGM_EXPORTER_LOG_FORMAT"},
+		},
+		&cli.StringFlag{
+			Name:    CLILogLevel,
+			Value:   logrus.InfoLevel.String(),
+			Usage:   "Minimum level of the logs. Possible values: trace, debug, info, warning, error, fatal and panic. --debug sets it to debug.",
+			EnvVars: []string{"DCGM_EXPORTER_LOG_LEVEL"},
+		},
 		&cli.IntFlag{
 			Name:    CLIClockEventsCountWindowSize,
 			Value:   int((5 * time.Minute).Milliseconds()),
@@ -244,6 +527,310 @@ func NewApp(buildVersion ...string) *cli.App {
 			Usage:   "Nvidia resource names for specified GPU type like nvidia.com/a100, nvidia.com/a10.",
 			EnvVars: []string{"NVIDIA_RESOURCE_NAMES"},
 		},
+		&cli.BoolFlag{
+			Name:    CLIUseSampleTimestamp,
+			Value:   false,
+			Usage:   "Append the DCGM sample timestamp to each metric line instead of relying on the scrape time.",
+			EnvVars: []string{"DCGM_EXPORTER_USE_SAMPLE_TIMESTAMP"},
+		},
+		&cli.StringFlag{
+			Name:  CLIFormat,
+			Value: dcgmexporter.FormatPrometheus,
+			Usage: fmt.Sprintf("Output format of the metrics endpoint. Possible values: '%s', '%s'",
+				dcgmexporter.FormatPrometheus, dcgmexporter.FormatJSON),
+			EnvVars: []string{"DCGM_EXPORTER_FORMAT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIStaticLabels,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Labels added to every metric, specified as <NAME>=<VALUE>.",
+			EnvVars: []string{"DCGM_EXPORTER_STATIC_LABELS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIHelpVars,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Values of the {<NAME>} variables of the help of the counters, specified as <NAME>=<VALUE>.",
+			EnvVars: []string{"DCGM_EXPORTER_HELP_VARS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLILabelRename,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Labels renamed before the metrics are exported, specified as <NAME>=<NEW_NAME>.",
+			EnvVars: []string{"DCGM_EXPORTER_LABEL_RENAME"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLILabelDrop,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Labels dropped before the metrics are exported. Renames are applied first.",
+			EnvVars: []string{"DCGM_EXPORTER_LABEL_DROP"},
+		},
+		&cli.StringFlag{
+			Name:    CLIMetricNamePrefix,
+			Value:   "",
+			Usage:   "Prefix prepended to the name of every exported counter, e.g. 'gpu_' exports 'gpu_DCGM_FI_DEV_GPU_TEMP'.",
+			EnvVars: []string{"DCGM_EXPORTER_METRIC_NAME_PREFIX"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIPodMappingNamespaceAllow,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Only pods in these namespaces are mapped to GPU metrics. An empty list allows all namespaces.",
+			EnvVars: []string{"DCGM_EXPORTER_POD_MAPPING_NAMESPACE_ALLOW"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIPodMappingNamespaceDeny,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Pods in these namespaces are never mapped to GPU metrics. Takes precedence over the allow list.",
+			EnvVars: []string{"DCGM_EXPORTER_POD_MAPPING_NAMESPACE_DENY"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIKubernetesRemoveContainerLabel,
+			Value:   false,
+			Usage:   "Don't add the name of the container holding the GPU as a label when Kubernetes mapping is enabled.",
+			EnvVars: []string{"DCGM_EXPORTER_KUBERNETES_REMOVE_CONTAINER_LABEL"},
+		},
+		&cli.StringFlag{
+			Name:  CLISharingStrategy,
+			Value: "",
+			Usage: fmt.Sprintf("GPU sharing strategy of the device plugin, reported with the sharing_strategy label when "+
+				"Kubernetes mapping is enabled. Possible values: '%s', '%s', '%s'. Empty only labels the shared devices.",
+				dcgmexporter.SharingStrategyNone, dcgmexporter.SharingStrategyTimeSlicing, dcgmexporter.SharingStrategyMPS),
+			EnvVars: []string{"DCGM_EXPORTER_SHARING_STRATEGY"},
+		},
+		&cli.IntFlag{
+			Name:    CLIInitRetryInterval,
+			Value:   1000,
+			Usage:   "Initial delay between attempts to initialize DCGM or create a collector; doubled after each failed attempt. Unit is milliseconds (ms).",
+			EnvVars: []string{"DCGM_EXPORTER_INIT_RETRY_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    CLIInitRetryTimeout,
+			Value:   60000,
+			Usage:   "How long to keep retrying the initialization of DCGM, or the creation of a collector, before giving up. Unit is milliseconds (ms). 0 disables retries.",
+			EnvVars: []string{"DCGM_EXPORTER_INIT_RETRY_TIMEOUT"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableCompression,
+			Value:   true,
+			Usage:   "Compress the metrics response with gzip when the scraper accepts it.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_COMPRESSION"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableProcessMetrics,
+			Value:   false,
+			Usage:   "Export per-process GPU utilization and memory labeled with the process ID. Requires access to the host PID namespace.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_PROCESS_METRICS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableProcessMemoryMetrics,
+			Value:   false,
+			Usage:   "Export the GPU memory used by each process, read from NVML, as DCGM_EXP_PROCESS_MEM_USED_BYTES, labeled with the process ID and, with --kubernetes, the pod of its GPU.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_PROCESS_MEMORY_METRICS"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDiagLevel,
+			Value:   1,
+			Usage:   "Level of the DCGM diagnostic reported by DCGM_EXP_DIAG_RESULT, from 1 (quick) to 4 (extended). Levels above 1 stress the GPUs and slow down the workloads running on them.",
+			EnvVars: []string{"DCGM_EXPORTER_DIAG_LEVEL"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDiagInterval,
+			Value:   86400000,
+			Usage:   "Interval between the DCGM diagnostics reported by DCGM_EXP_DIAG_RESULT, independent of the collect interval. Unit is milliseconds (ms).",
+			EnvVars: []string{"DCGM_EXPORTER_DIAG_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    CLIDeviceRescanInterval,
+			Value:   0,
+			Usage:   "Interval between the re-enumerations of the GPUs; the collectors are rebuilt when GPUs were added or removed. Unit is milliseconds (ms), 0 disables the re-enumeration.",
+			EnvVars: []string{"DCGM_EXPORTER_DEVICE_RESCAN_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableTopologyLabels,
+			Value:   false,
+			Usage:   "Add the numa_node label of the GPU to the GPU metrics.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_TOPOLOGY_LABELS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableDriverLabels,
+			Value:   false,
+			Usage:   "Add the driver_version and vbios_version labels of the GPU to the GPU metrics.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_DRIVER_LABELS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableCPUAffinityLabel,
+			Value:   true,
+			Usage:   "Add the cpu_affinity label, the CPUs local to the GPU such as 0-23,48-71, to the GPU metrics.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_CPU_AFFINITY_LABEL"},
+		},
+		&cli.StringFlag{
+			Name:  CLIMissingValuePolicy,
+			Value: dcgmexporter.MissingValueSkip,
+			Usage: fmt.Sprintf("Handling of the fields DCGM has no value for. Possible values: '%s' drops the series, "+
+				"'%s' reports NaN, '%s' reports the value of --%s",
+				dcgmexporter.MissingValueSkip, dcgmexporter.MissingValueNaN, dcgmexporter.MissingValueDefault,
+				CLIMissingValueDefault),
+			EnvVars: []string{"DCGM_EXPORTER_MISSING_VALUE_POLICY"},
+		},
+		&cli.Float64Flag{
+			Name:  CLIMissingValueDefault,
+			Value: 0,
+			Usage: fmt.Sprintf("Value reported for the fields DCGM has no value for, with --%s=%s.",
+				CLIMissingValuePolicy, dcgmexporter.MissingValueDefault),
+			EnvVars: []string{"DCGM_EXPORTER_MISSING_VALUE_DEFAULT"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableComputeInstanceMetrics,
+			Value:   false,
+			Usage:   "Collect the metrics of MIG GPU instances per compute instance, labeled with GPU_CI_ID.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_COMPUTE_INSTANCE_METRICS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableVGPU,
+			Value:   false,
+			Usage:   "Collect the vGPU fields per vGPU instance, labeled with vgpu_instance.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_VGPU"},
+		},
+		&cli.BoolFlag{
+			Name:  CLIEnableRollups,
+			Value: false,
+			Usage: "Export node-level gauges derived from the GPU metrics: the mean, max and sum of the GPU " +
+				"utilization and the total framebuffer used. They aren't DCGM fields.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_ROLLUPS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIOnce,
+			Value:   false,
+			Usage:   "Collect the metrics once, print them to stdout and exit, without serving them.",
+			EnvVars: []string{"DCGM_EXPORTER_ONCE"},
+		},
+		&cli.BoolFlag{
+			Name:  CLIFieldPreflight,
+			Value: false,
+			Usage: "Check the fields supported by each GPU when the collectors are created, and don't collect " +
+				"the counters of the unsupported ones on it.",
+			EnvVars: []string{"DCGM_EXPORTER_FIELD_PREFLIGHT"},
+		},
+		&cli.StringFlag{
+			Name:    CLIDeviceFilter,
+			Value:   "",
+			Usage:   "Comma-separated GPU indices, index ranges like 0-3, or GPU UUIDs to monitor. Other GPUs are ignored. Empty means all GPUs.",
+			EnvVars: []string{"DCGM_EXPORTER_DEVICE_FILTER"},
+		},
+		&cli.StringFlag{
+			Name:    CLICounterAllowRegex,
+			Value:   "",
+			Usage:   "Only export the counters whose field name matches this regular expression.",
+			EnvVars: []string{"DCGM_EXPORTER_COUNTER_ALLOW_REGEX"},
+		},
+		&cli.StringFlag{
+			Name:    CLICounterDenyRegex,
+			Value:   "",
+			Usage:   "Do not export the counters whose field name matches this regular expression. Takes precedence over the allow regex.",
+			EnvVars: []string{"DCGM_EXPORTER_COUNTER_DENY_REGEX"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIStrictCounterTypes,
+			Value:   false,
+			Usage:   "Fail to start when a field that only grows is declared as a gauge instead of a counter.",
+			EnvVars: []string{"DCGM_EXPORTER_STRICT_COUNTER_TYPES"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteURL,
+			Value:   "",
+			Usage:   "Push the metrics to this Prometheus remote-write URL after every collection, in addition to serving them.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_URL"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteUsername,
+			Value:   "",
+			Usage:   "Username for basic authentication to the remote-write URL.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWritePassword,
+			Value:   "",
+			Usage:   "Password for basic authentication to the remote-write URL.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_PASSWORD"},
+		},
+		&cli.StringFlag{
+			Name:    CLIRemoteWriteBearerToken,
+			Value:   "",
+			Usage:   "Bearer token sent to the remote-write URL. Cannot be combined with basic authentication.",
+			EnvVars: []string{"DCGM_EXPORTER_REMOTE_WRITE_BEARER_TOKEN"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIEnableOTLP,
+			Value:   false,
+			Usage:   "Push the metrics to an OpenTelemetry collector over OTLP/gRPC after every collection.",
+			EnvVars: []string{"DCGM_EXPORTER_ENABLE_OTLP"},
+		},
+		&cli.StringFlag{
+			Name:    CLIOTLPEndpoint,
+			Value:   dcgmexporter.DefaultOTLPEndpoint,
+			Usage:   "Address of the OTLP/gRPC endpoint, specified as <HOST>:<PORT>.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_ENDPOINT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    CLIOTLPHeaders,
+			Value:   cli.NewStringSlice(),
+			Usage:   "Headers sent with every OTLP export, specified as <NAME>=<VALUE>.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_HEADERS"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIOTLPInsecure,
+			Value:   false,
+			Usage:   "Connect to the OTLP endpoint without TLS.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_INSECURE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIOTLPCAFile,
+			Value:   "",
+			Usage:   "CA certificate used to verify the OTLP endpoint. The system roots are used when empty.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_CA_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIOTLPCertFile,
+			Value:   "",
+			Usage:   "Client certificate presented to the OTLP endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_CERT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIOTLPKeyFile,
+			Value:   "",
+			Usage:   "Private key of the client certificate presented to the OTLP endpoint.",
+			EnvVars: []string{"DCGM_EXPORTER_OTLP_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    CLIStatsDAddress,
+			Value:   "",
+			Usage:   "Send the metrics as StatsD gauges after every collection, to <HOST>:<PORT>, udp://<HOST>:<PORT> or unix://<PATH>.",
+			EnvVars: []string{"DCGM_EXPORTER_STATSD_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:  CLIStatsDTagFormat,
+			Value: dcgmexporter.StatsDTagFormatDogStatsD,
+			Usage: fmt.Sprintf("Format of the labels of the StatsD gauges. Possible values: '%s', '%s', '%s'",
+				dcgmexporter.StatsDTagFormatDogStatsD, dcgmexporter.StatsDTagFormatInflux, dcgmexporter.StatsDTagFormatNone),
+			EnvVars: []string{"DCGM_EXPORTER_STATSD_TAG_FORMAT"},
+		},
+		&cli.BoolFlag{
+			Name:    CLIPushSuppressUnchanged,
+			Value:   false,
+			Usage:   "Skip pushing the gauges whose value didn't change since the last push to remote write, OTLP and StatsD. The /metrics endpoint is unaffected.",
+			EnvVars: []string{"DCGM_EXPORTER_PUSH_SUPPRESS_UNCHANGED"},
+		},
+		&cli.Float64Flag{
+			Name:    CLIPushSuppressEpsilon,
+			Value:   0,
+			Usage:   "Largest difference between two values of a gauge considered unchanged.",
+			EnvVars: []string{"DCGM_EXPORTER_PUSH_SUPPRESS_EPSILON"},
+		},
+		&cli.IntFlag{
+			Name:    CLIPushMaxSuppression,
+			Value:   60000,
+			Usage:   "Time in milliseconds after which an unchanged gauge is pushed again.",
+			EnvVars: []string{"DCGM_EXPORTER_PUSH_MAX_SUPPRESSION"},
+		},
 	}
 
 	if runtime.GOOS == "linux" {
@@ -263,6 +850,14 @@ func NewApp(buildVersion ...string) *cli.App {
 		return action(c)
 	}
 
+	c.Commands = []*cli.Command{
+		{
+			Name:   "validate",
+			Usage:  "Validate the counters and print the series they export, without connecting to DCGM",
+			Action: validate,
+		},
+	}
+
 	return c
 }
 
@@ -275,7 +870,10 @@ func newOSWatcher(sigs ...os.Signal) chan os.Signal {
 
 func action(c *cli.Context) (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	return stdout.Capture(ctx, func() error {
+
+	// The metrics printed with --once are buffered, the standard output is redirected to the logs until Capture returns
+	var once bytes.Buffer
+	err = stdout.Capture(ctx, func() error {
 		// The purpose of this function is to capture any panic that may occur
 		// during initialization and return an error.
 		defer func() {
@@ -284,13 +882,43 @@ func action(c *cli.Context) (err error) {
 				err = fmt.Errorf("encountered a failure; err: %v", r)
 			}
 		}()
-		return startDCGMExporter(c, cancel)
+		return startDCGMExporter(c, cancel, &once)
 	})
+	if err != nil {
+		return err
+	}
+
+	_, err = once.WriteTo(c.App.Writer)
+	return err
 }
 
-func startDCGMExporter(c *cli.Context, cancel context.CancelFunc) error {
-restart:
+// validate checks the counters of the collectors file and prints the name and type of every series they export.
+// Every invalid counter is reported, and any of them makes it fail.
+func validate(c *cli.Context) error {
+	config, err := contextToConfig(c)
+	if err != nil {
+		return err
+	}
+
+	cs, errs := dcgmexporter.ValidateCounters(config)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			logrus.Error(err)
+		}
+		return fmt.Errorf("%d invalid counter(s) in '%s'", len(errs), config.CollectorsFile)
+	}
+
+	for _, counter := range append(cs.DCGMCounters, cs.ExporterCounters...) {
+		for _, name := range dcgmexporter.SeriesNames(counter) {
+			fmt.Fprintf(c.App.Writer, "%s%s %s\n", config.MetricNamePrefix, name, counter.PromType)
+		}
+	}
+
+	return nil
+}
 
+// startDCGMExporter serves the metrics until it is signaled to stop, or writes them to once with --once
+func startDCGMExporter(c *cli.Context, cancel context.CancelFunc, once io.Writer) error {
 	logrus.Info("Starting dcgm-exporter")
 
 	config, err := contextToConfig(c)
@@ -298,13 +926,18 @@ restart:
 		return err
 	}
 
-	enableDebugLogging(config)
+	configureLogging(config)
 
-	cleanupDCGM := initDCGM(config)
+	cleanupDCGM, hostengine := initDCGM(config)
 	defer cleanupDCGM()
 
 	logrus.Info("DCGM successfully initialized!")
 
+	config.DCGMVersion, err = dcgmexporter.DCGMVersion()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to get the DCGM version; dcgm_exporter_build_info reports it as empty")
+	}
+
 	dcgm.FieldsInit()
 	defer dcgm.FieldsTerm()
 
@@ -319,27 +952,44 @@ restart:
 		return err
 	}
 
-	pipeline, cleanup, err := dcgmexporter.NewMetricsPipeline(config,
+	pipeline, pipelineCleanup, err := dcgmexporter.NewMetricsPipeline(config,
 		cs.DCGMCounters,
 		hostname,
-		dcgmexporter.NewDCGMCollector,
+		dcgmexporter.NewDCGMEntityCollector,
 		fieldEntityGroupTypeSystemInfo,
 	)
-	defer cleanup()
+	defer func() {
+		pipelineCleanup()
+	}()
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	cRegistry := dcgmexporter.NewRegistry()
-
-	enableDCGMExpXIDErrorsCountCollector(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
-
-	enableDCGMExpClockEventsCount(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry)
+	cRegistry, err := newRegistry(cs, fieldEntityGroupTypeSystemInfo, hostname, config)
+	if err != nil {
+		logrus.Fatal(err)
+	}
 
 	defer func() {
 		cRegistry.Cleanup()
 	}()
 
+	if hostengine != nil {
+		pipeline.SetHostengine(hostengine)
+		cRegistry.SetHostengine(hostengine)
+	}
+
+	if c.Bool(CLIOnce) {
+		defer cancel()
+
+		// The fields were just watched, they are sampled so that the single collection has values
+		if err := dcgm.UpdateAllFields(); err != nil {
+			logrus.WithError(err).Warn("Failed to sample the watched fields; some metrics may be missing")
+		}
+
+		return dcgmexporter.WriteMetrics(once, config, cRegistry, pipeline)
+	}
+
 	ch := make(chan string, 10)
 
 	var wg sync.WaitGroup
@@ -350,7 +1000,7 @@ restart:
 
 	wg.Add(1)
 
-	server, cleanup, err := dcgmexporter.NewMetricsServer(config, ch, cRegistry)
+	server, cleanup, err := dcgmexporter.NewMetricsServer(config, ch, cRegistry, pipeline)
 	defer cleanup()
 	if err != nil {
 		return err
@@ -358,56 +1008,335 @@ restart:
 
 	go server.Run(stop, &wg)
 
+	rescans := watchDevices(config, stop)
+	failovers := watchHostengine(hostengine, stop)
+
 	sigs := newOSWatcher(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
-	sig := <-sigs
-	close(stop)
-	cancel()
-	err = dcgmexporter.WaitWithTimeout(&wg, time.Second*2)
-	if err != nil {
-		logrus.Fatal(err)
-	}
+loop:
+	for {
+		select {
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				break loop
+			}
 
-	if sig == syscall.SIGHUP {
-		goto restart
-	}
+			logrus.Info("Received SIGHUP, reloading the TLS certificate and counters")
 
-	return nil
-}
+			if err := server.ReloadTLS(); err != nil {
+				logrus.WithError(err).Error("Failed to reload the TLS certificate; keeping the current one")
+			}
 
-func enableDCGMExpClockEventsCount(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
-	if dcgmexporter.IsDCGMExpClockEventsCountEnabled(cs.ExporterCounters) {
-		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
-		if !exists {
-			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMClockEventsCount.String())
-		}
-		clocksThrottleReasonsCollector, err := dcgmexporter.NewClockEventsCollector(
+			cleanup, err := reloadCounters(config, hostname, pipeline, cRegistry)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to reload counters; keeping the current configuration")
+				continue
+			}
+
+			pipelineCleanup()
+			pipelineCleanup = cleanup
+
+			logrus.Info("Counters reloaded")
+		case <-rescans:
+			logrus.Info("The GPUs changed, rebuilding the collectors")
+
+			cleanup, err := reloadCounters(config, hostname, pipeline, cRegistry)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to rebuild the collectors; keeping the current ones")
+				continue
+			}
+
+			pipelineCleanup()
+			pipelineCleanup = cleanup
+
+			logrus.Info("Collectors rebuilt")
+		case <-failovers:
+			logrus.Info("The nv-hostengine changed, watching the fields again")
+
+			cleanup, err := reloadCounters(config, hostname, pipeline, cRegistry)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to rebuild the collectors after the failover")
+				continue
+			}
+
+			// The previous collectors skip their DCGM cleanups, the groups went away with the previous connection
+			pipelineCleanup()
+			pipelineCleanup = cleanup
+
+			logrus.Info("Collectors rebuilt")
+		}
+	}
+
+	close(stop)
+	cancel()
+	err = dcgmexporter.WaitWithTimeout(&wg, time.Second*2)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	return nil
+}
+
+// newRegistry creates a registry with the collectors of the enabled DCGM_EXP_* counters. The collectors created
+// before one fails are cleaned up.
+func newRegistry(cs *dcgmexporter.CounterSet,
+	fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo,
+	hostname string,
+	config *dcgmexporter.Config,
+) (*dcgmexporter.Registry, error) {
+	cRegistry := dcgmexporter.NewRegistry()
+	cRegistry.SetCounters(cs.ExporterCounters)
+
+	for _, enable := range []func(*dcgmexporter.CounterSet, *dcgmexporter.FieldEntityGroupTypeSystemInfo, string,
+		*dcgmexporter.Config, *dcgmexporter.Registry) error{
+		enableDCGMExpXIDErrorsCountCollector,
+		enableDCGMExpClockEventsCount,
+		enableDCGMExpGPUHealthCollector,
+		enableDCGMExpXIDErrorsTotalCollector,
+		enableDCGMExpClockThrottleReasonsCollector,
+		enableDCGMExpDiagResultCollector,
+	} {
+		if err := enable(cs, fieldEntityGroupTypeSystemInfo, hostname, config, cRegistry); err != nil {
+			cRegistry.Cleanup()
+			return nil, err
+		}
+	}
+
+	return cRegistry, nil
+}
+
+// watchDevices re-enumerates the GPUs every Config.DeviceRescanInterval and notifies the returned channel when they
+// changed. The channel is never notified when the re-enumeration is disabled.
+func watchDevices(config *dcgmexporter.Config, stop chan interface{}) <-chan struct{} {
+	rescans := make(chan struct{}, 1)
+	if config.DeviceRescanInterval == 0 {
+		return rescans
+	}
+
+	scanner, err := dcgmexporter.NewDeviceScanner(config)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to enumerate the GPUs; the GPUs won't be re-enumerated")
+		return rescans
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.DeviceRescanInterval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				changed, err := scanner.Changed()
+				if err != nil {
+					logrus.WithError(err).Warn("Failed to re-enumerate the GPUs")
+					continue
+				}
+
+				if !changed {
+					continue
+				}
+
+				select {
+				case rescans <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return rescans
+}
+
+// watchHostengine checks the connection to the remote nv-hostengine every hostengineCheckInterval and notifies the
+// returned channel when it failed over to another endpoint. The channel is never notified when DCGM is embedded.
+func watchHostengine(hostengine *dcgmexporter.Hostengine, stop chan interface{}) <-chan struct{} {
+	failovers := make(chan struct{}, 1)
+	if hostengine == nil {
+		return failovers
+	}
+
+	go func() {
+		ticker := time.NewTicker(hostengineCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				changed, err := hostengine.Check()
+				if err != nil {
+					logrus.WithError(err).Error("Failed to reconnect to nv-hostengine; retrying")
+					continue
+				}
+
+				if !changed {
+					continue
+				}
+
+				select {
+				case failovers <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return failovers
+}
+
+// reloadCounters re-reads the counters and swaps the collectors of the pipeline and the registry.
+// Nothing is swapped when the counters cannot be loaded or a collector cannot be created. The returned
+// function cleans up the new pipeline collectors, the caller is responsible for cleaning up the previous ones.
+func reloadCounters(config *dcgmexporter.Config,
+	hostname string,
+	pipeline *dcgmexporter.MetricsPipeline,
+	cRegistry *dcgmexporter.Registry,
+) (func(), error) {
+	cs, err := loadCounters(config)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldEntityGroupTypeSystemInfo := getFieldEntityGroupTypeSystemInfo(cs, config)
+
+	next, err := newRegistry(cs, fieldEntityGroupTypeSystemInfo, hostname, config)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup, err := pipeline.Reload(cs.DCGMCounters, hostname, dcgmexporter.NewDCGMEntityCollector,
+		fieldEntityGroupTypeSystemInfo)
+	if err != nil {
+		next.Cleanup()
+		return nil, err
+	}
+
+	cRegistry.Replace(next)
+
+	return cleanup, nil
+}
+
+func enableDCGMExpClockEventsCount(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) error {
+	if dcgmexporter.IsDCGMExpClockEventsCountEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			return fmt.Errorf("%s collector cannot be initialized", dcgmexporter.DCGMClockEventsCount.String())
+		}
+		clocksThrottleReasonsCollector, err := dcgmexporter.NewClockEventsCollector(
 			cs.ExporterCounters, hostname, config, item)
 		if err != nil {
-			logrus.Fatal(err)
+			return err
 		}
 
 		cRegistry.Register(clocksThrottleReasonsCollector)
 
 		logrus.Infof("%s collector initialized", dcgmexporter.DCGMClockEventsCount.String())
 	}
+
+	return nil
 }
 
-func enableDCGMExpXIDErrorsCountCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) {
+func enableDCGMExpXIDErrorsCountCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) error {
 	if dcgmexporter.IsDCGMExpXIDErrorsCountEnabled(cs.ExporterCounters) {
 		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
 		if !exists {
-			logrus.Fatalf("%s collector cannot be initialized", dcgmexporter.DCGMXIDErrorsCount.String())
+			return fmt.Errorf("%s collector cannot be initialized", dcgmexporter.DCGMXIDErrorsCount.String())
 		}
 
 		xidCollector, err := dcgmexporter.NewXIDCollector(cs.ExporterCounters, hostname, config, item)
 		if err != nil {
-			logrus.Fatal(err)
+			return err
 		}
 
 		cRegistry.Register(xidCollector)
 
 		logrus.Infof("%s collector initialized", dcgmexporter.DCGMXIDErrorsCount.String())
 	}
+
+	return nil
+}
+
+func enableDCGMExpGPUHealthCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) error {
+	if dcgmexporter.IsDCGMExpGPUHealthEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			return fmt.Errorf("%s collector cannot be initialized", dcgmexporter.DCGMGPUHealth.String())
+		}
+
+		healthCollector, err := dcgmexporter.NewGPUHealthCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			return err
+		}
+
+		cRegistry.Register(healthCollector)
+
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMGPUHealth.String())
+	}
+
+	return nil
+}
+
+func enableDCGMExpXIDErrorsTotalCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) error {
+	if dcgmexporter.IsDCGMExpXIDErrorsTotalEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			return fmt.Errorf("%s collector cannot be initialized", dcgmexporter.DCGMXIDErrorsTotal.String())
+		}
+
+		xidEventsCollector, err := dcgmexporter.NewXIDEventsCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			return err
+		}
+
+		cRegistry.Register(xidEventsCollector)
+
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMXIDErrorsTotal.String())
+	}
+
+	return nil
+}
+
+func enableDCGMExpClockThrottleReasonsCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) error {
+	if dcgmexporter.IsDCGMExpClockThrottleReasonsEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			return fmt.Errorf("%s collector cannot be initialized", dcgmexporter.DCGMClockThrottleReasons.String())
+		}
+
+		throttleReasonsCollector, err := dcgmexporter.NewClockThrottleReasonsCollector(cs.ExporterCounters, hostname,
+			config, item)
+		if err != nil {
+			return err
+		}
+
+		cRegistry.Register(throttleReasonsCollector)
+
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMClockThrottleReasons.String())
+	}
+
+	return nil
+}
+
+func enableDCGMExpDiagResultCollector(cs *dcgmexporter.CounterSet, fieldEntityGroupTypeSystemInfo *dcgmexporter.FieldEntityGroupTypeSystemInfo, hostname string, config *dcgmexporter.Config, cRegistry *dcgmexporter.Registry) error {
+	if dcgmexporter.IsDCGMExpDiagResultEnabled(cs.ExporterCounters) {
+		item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU)
+		if !exists {
+			return fmt.Errorf("%s collector cannot be initialized", dcgmexporter.DCGMDiagResult.String())
+		}
+
+		diagCollector, err := dcgmexporter.NewDiagCollector(cs.ExporterCounters, hostname, config, item)
+		if err != nil {
+			return err
+		}
+
+		cRegistry.Register(diagCollector)
+
+		logrus.Infof("%s collector initialized", dcgmexporter.DCGMDiagResult.String())
+	}
+
+	return nil
 }
 
 func getFieldEntityGroupTypeSystemInfo(cs *dcgmexporter.CounterSet, config *dcgmexporter.Config) *dcgmexporter.FieldEntityGroupTypeSystemInfo {
@@ -421,6 +1350,11 @@ func getFieldEntityGroupTypeSystemInfo(cs *dcgmexporter.CounterSet, config *dcgm
 	fieldEntityGroupTypeSystemInfo := dcgmexporter.NewEntityGroupTypeSystemInfo(allCounters, config)
 
 	for _, egt := range dcgmexporter.FieldEntityGroupTypeToMonitor {
+		if !config.EntityEnabled(egt) {
+			logrus.Debugf("Not collecting %s metrics; disabled", egt.String())
+			continue
+		}
+
 		err := fieldEntityGroupTypeSystemInfo.Load(egt)
 		if err != nil {
 			logrus.Infof("Not collecting %s metrics; %s", egt.String(), err)
@@ -429,10 +1363,12 @@ func getFieldEntityGroupTypeSystemInfo(cs *dcgmexporter.CounterSet, config *dcgm
 	return fieldEntityGroupTypeSystemInfo
 }
 
-// appendDCGMXIDErrorsCountDependency appends DCGM counters required for the DCGM_EXP_CLOCK_EVENTS_COUNT metric
+// appendDCGMClockEventsCountDependency appends DCGM counters required for the DCGM_EXP_CLOCK_EVENTS_COUNT and
+// DCGM_EXP_CLOCK_THROTTLE_REASONS metrics
 func appendDCGMClockEventsCountDependency(cs *dcgmexporter.CounterSet, allCounters []dcgmexporter.Counter) []dcgmexporter.Counter {
 	if len(cs.ExporterCounters) > 0 {
-		if containsField(cs.ExporterCounters, dcgmexporter.DCGMClockEventsCount) &&
+		if (containsField(cs.ExporterCounters, dcgmexporter.DCGMClockEventsCount) ||
+			containsField(cs.ExporterCounters, dcgmexporter.DCGMClockThrottleReasons)) &&
 			!containsField(allCounters, dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS) {
 			allCounters = append(allCounters,
 				dcgmexporter.Counter{
@@ -464,18 +1400,27 @@ func containsField(slice []dcgmexporter.Counter, fieldID dcgmexporter.ExporterCo
 }
 
 func getCounters(config *dcgmexporter.Config) *dcgmexporter.CounterSet {
-	cs, err := dcgmexporter.GetCounterSet(config)
+	cs, err := loadCounters(config)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
+	return cs
+}
+
+func loadCounters(config *dcgmexporter.Config) (*dcgmexporter.CounterSet, error) {
+	cs, err := dcgmexporter.GetCounterSet(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Copy labels from DCGM Counters to ExporterCounters
 	for i := range cs.DCGMCounters {
 		if cs.DCGMCounters[i].PromType == "label" {
 			cs.ExporterCounters = append(cs.ExporterCounters, cs.DCGMCounters[i])
 		}
 	}
-	return cs
+	return cs, nil
 }
 
 func fillConfigMetricGroups(config *dcgmexporter.Config) {
@@ -490,7 +1435,16 @@ func fillConfigMetricGroups(config *dcgmexporter.Config) {
 	}
 }
 
-func enableDebugLogging(config *dcgmexporter.Config) {
+// configureLogging applies the format and level of the logs, the values are validated by contextToConfig
+func configureLogging(config *dcgmexporter.Config) {
+	if config.LogFormat == dcgmexporter.LogFormatJSON {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	}
+
+	if level, err := logrus.ParseLevel(config.LogLevel); err == nil {
+		logrus.SetLevel(level)
+	}
+
 	if config.Debug {
 		// enable debug logging
 		logrus.SetLevel(logrus.DebugLevel)
@@ -502,15 +1456,22 @@ func enableDebugLogging(config *dcgmexporter.Config) {
 	logrus.WithField(dcgmexporter.LoggerDumpKey, fmt.Sprintf("%+v", config)).Debug("Loaded configuration")
 }
 
-func initDCGM(config *dcgmexporter.Config) func() {
+// initDCGM starts the embedded hostengine, or connects to the remote one. The connection is returned in the latter
+// case, so that it can fail over to the other endpoints of Config.RemoteHEInfo. Both are retried with backoff, so
+// that a hostengine starting after dcgm-exporter is waited for, see dcgmexporter.RetryWithBackoff.
+func initDCGM(config *dcgmexporter.Config) (func(), *dcgmexporter.Hostengine) {
 	if config.UseRemoteHE {
 		logrus.Info("Attemping to connect to remote hostengine at ", config.RemoteHEInfo)
-		cleanup, err := dcgm.Init(dcgm.Standalone, config.RemoteHEInfo, "0")
+		var hostengine *dcgmexporter.Hostengine
+		err := dcgmexporter.RetryWithBackoff(config, "connect to the remote hostengine", func() error {
+			var err error
+			hostengine, err = connectHostengineHook(dcgmexporter.ParseRemoteHEInfo(config.RemoteHEInfo))
+			return err
+		})
 		if err != nil {
-			cleanup()
 			logrus.Fatal(err)
 		}
-		return cleanup
+		return hostengine.Close, hostengine
 	} else {
 
 		if config.EnableDCGMLog {
@@ -518,13 +1479,20 @@ func initDCGM(config *dcgmexporter.Config) func() {
 			os.Setenv("__DCGM_DBG_LVL", config.DCGMLogLevel)
 		}
 
-		cleanup, err := dcgm.Init(dcgm.Embedded)
+		var cleanup func()
+		err := dcgmexporter.RetryWithBackoff(config, "initialize DCGM", func() error {
+			var err error
+			cleanup, err = initEmbeddedDCGMHook()
+			if err != nil {
+				cleanup()
+			}
+			return err
+		})
 		if err != nil {
-			cleanup()
 			logrus.Fatal(err)
 		}
 
-		return cleanup
+		return cleanup, nil
 	}
 }
 
@@ -591,7 +1559,201 @@ func parseDeviceOptions(devices string) (dcgmexporter.DeviceOptions, error) {
 	return dOpt, nil
 }
 
+// parseDeviceFilter parses a comma-separated list of GPU indices, index ranges and GPU UUIDs
+func parseDeviceFilter(filter string) (dcgmexporter.DeviceFilter, error) {
+	var res dcgmexporter.DeviceFilter
+
+	for _, entry := range strings.Split(filter, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.HasPrefix(entry, "GPU-") {
+			res.UUIDs = append(res.UUIDs, entry)
+			continue
+		}
+
+		start, end, isRange := strings.Cut(entry, "-")
+
+		first, err := strconv.Atoi(start)
+		if err != nil || first < 0 {
+			return res, fmt.Errorf("device filter entry must be a GPU index, a range '<index>-<index>' or a GPU UUID, but found '%s'", entry)
+		}
+
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(end)
+			if err != nil || last < first {
+				return res, fmt.Errorf("invalid device filter range '%s'", entry)
+			}
+		}
+
+		for i := first; i <= last; i++ {
+			res.Indices = append(res.Indices, i)
+		}
+	}
+
+	return res, nil
+}
+
+// parseListenAddress checks that the address is a host and port the metrics server can listen on, IPv6 hosts must be
+// enclosed in brackets
+func parseListenAddress(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("listen address must be specified as [<HOST>]:<PORT>, but found '%s'; err: %w", address, err)
+	}
+
+	if strings.ContainsAny(host, "[]") {
+		return "", fmt.Errorf("invalid host in listen address '%s'", address)
+	}
+
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid port in listen address '%s'", address)
+	}
+
+	return address, nil
+}
+
+// parseRegex compiles a regular expression, an empty expression yields nil
+func parseRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(expr)
+}
+
+func parseCollectIntervalOverrides(overrides []string) (map[string]int, error) {
+	res := map[string]int{}
+
+	for _, override := range overrides {
+		entity, interval, found := strings.Cut(override, "=")
+		if !found {
+			return nil, fmt.Errorf("collect interval override must be '<ENTITY>=<INTERVAL_MS>', but found '%s'", override)
+		}
+
+		entity = strings.TrimSpace(entity)
+		if !slices.Contains(dcgmexporter.PipelineEntities, entity) {
+			return nil, fmt.Errorf("unknown entity '%s' in collect interval override; possible values: %s",
+				entity, strings.Join(dcgmexporter.PipelineEntities, ", "))
+		}
+
+		value, err := strconv.Atoi(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("invalid collect interval override '%s'; err: %w", override, err)
+		}
+
+		if value <= 0 {
+			return nil, fmt.Errorf("collect interval override must be positive, but found '%s'", override)
+		}
+
+		res[entity] = value
+	}
+
+	return res, nil
+}
+
+func parseStaticLabels(labels []string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, label := range labels {
+		name, value, found := strings.Cut(label, "=")
+		if !found {
+			return nil, fmt.Errorf("static label must be '<NAME>=<VALUE>', but found '%s'", label)
+		}
+
+		res[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	return res, dcgmexporter.ValidateStaticLabels(res)
+}
+
+func parseHelpVars(vars []string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, v := range vars {
+		name, value, found := strings.Cut(v, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("help variable must be '<NAME>=<VALUE>', but found '%s'", v)
+		}
+
+		res[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	return res, nil
+}
+
+func parseLabelRename(renames []string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, rename := range renames {
+		from, to, found := strings.Cut(rename, "=")
+		if !found || strings.TrimSpace(from) == "" {
+			return nil, fmt.Errorf("label rename must be '<NAME>=<NEW_NAME>', but found '%s'", rename)
+		}
+
+		res[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+
+	return res, nil
+}
+
+// webConfigHasBasicAuth reports whether the web config file declares users. Their basic auth would apply on top of
+// the auth flags, to the same Authorization header.
+func webConfigHasBasicAuth(file string) (bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read web config file '%s'; err: %w", file, err)
+	}
+
+	var webConfig struct {
+		Users map[string]string `yaml:"basic_auth_users"`
+	}
+	if err := yaml.Unmarshal(data, &webConfig); err != nil {
+		return false, fmt.Errorf("failed to parse web config file '%s'; err: %w", file, err)
+	}
+
+	return len(webConfig.Users) > 0, nil
+}
+
+// readSecret reads a secret from the file, or from the environment variable when no file is given.
+// Secrets aren't read from flags, so they don't show up in the process list.
+func readSecret(file, envVar string) (string, error) {
+	if file == "" {
+		return os.Getenv(envVar), nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file '%s'; err: %w", file, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func parseOTLPHeaders(headers []string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, header := range headers {
+		name, value, found := strings.Cut(header, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("OTLP header must be '<NAME>=<VALUE>', but found '%s'", header)
+		}
+
+		res[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	return res, nil
+}
+
 func contextToConfig(c *cli.Context) (*dcgmexporter.Config, error) {
+	address, err := parseListenAddress(c.String(CLIAddress))
+	if err != nil {
+		return nil, err
+	}
+
 	gOpt, err := parseDeviceOptions(c.String(CLIGPUDevices))
 	if err != nil {
 		return nil, err
@@ -607,37 +1769,351 @@ func contextToConfig(c *cli.Context) (*dcgmexporter.Config, error) {
 		return nil, err
 	}
 
+	deviceFilter, err := parseDeviceFilter(c.String(CLIDeviceFilter))
+	if err != nil {
+		return nil, err
+	}
+
+	counterAllowRegex, err := parseRegex(c.String(CLICounterAllowRegex))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter value: %w", CLICounterAllowRegex, err)
+	}
+
+	counterDenyRegex, err := parseRegex(c.String(CLICounterDenyRegex))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter value: %w", CLICounterDenyRegex, err)
+	}
+
+	remoteWriteURL := c.String(CLIRemoteWriteURL)
+	if remoteWriteURL != "" {
+		u, err := url.ParseRequestURI(remoteWriteURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", CLIRemoteWriteURL, remoteWriteURL)
+		}
+	}
+
+	if c.String(CLIRemoteWriteUsername) != "" && c.String(CLIRemoteWriteBearerToken) != "" {
+		return nil, fmt.Errorf("%s and %s cannot be used together", CLIRemoteWriteUsername, CLIRemoteWriteBearerToken)
+	}
+
+	authPassword, err := readSecret(c.String(CLIAuthPasswordFile), envAuthPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	authBearerToken, err := readSecret(c.String(CLIAuthBearerTokenFile), envAuthBearerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if (c.String(CLIAuthUsername) == "") != (authPassword == "") {
+		return nil, fmt.Errorf("%s and its password must be set together", CLIAuthUsername)
+	}
+
+	if c.String(CLIWebConfigFile) != "" && (c.String(CLIAuthUsername) != "" || authBearerToken != "") {
+		hasBasicAuth, err := webConfigHasBasicAuth(c.String(CLIWebConfigFile))
+		if err != nil {
+			return nil, err
+		}
+
+		if hasBasicAuth {
+			return nil, fmt.Errorf("the auth flags cannot be used along with the basic_auth_users of %s",
+				CLIWebConfigFile)
+		}
+	}
+
+	if (c.String(CLITLSCertFile) == "") != (c.String(CLITLSKeyFile) == "") {
+		return nil, fmt.Errorf("%s and %s must be set together", CLITLSCertFile, CLITLSKeyFile)
+	}
+
+	if c.String(CLITLSCertFile) != "" {
+		if c.String(CLIWebConfigFile) != "" {
+			return nil, fmt.Errorf("%s and %s cannot be used together", CLITLSCertFile, CLIWebConfigFile)
+		}
+	} else if c.String(CLITLSClientCAFile) != "" {
+		return nil, fmt.Errorf("%s requires %s", CLITLSClientCAFile, CLITLSCertFile)
+	}
+
+	adminAddress := c.String(CLIAdminAddress)
+	if adminAddress != "" {
+		if _, err := parseListenAddress(adminAddress); err != nil {
+			return nil, err
+		}
+
+		if adminAddress == address {
+			return nil, fmt.Errorf("%s and %s must be different", CLIAdminAddress, CLIAddress)
+		}
+	}
+
+	otlpHeaders, err := parseOTLPHeaders(c.StringSlice(CLIOTLPHeaders))
+	if err != nil {
+		return nil, err
+	}
+
+	if (c.String(CLIOTLPCertFile) == "") != (c.String(CLIOTLPKeyFile) == "") {
+		return nil, fmt.Errorf("%s and %s must be set together", CLIOTLPCertFile, CLIOTLPKeyFile)
+	}
+
+	statsDAddress := c.String(CLIStatsDAddress)
+	if statsDAddress != "" {
+		if _, _, err := dcgmexporter.ParseStatsDAddress(statsDAddress); err != nil {
+			return nil, fmt.Errorf("invalid %s parameter value: %s; err: %w", CLIStatsDAddress, statsDAddress, err)
+		}
+	}
+
+	statsDTagFormat := c.String(CLIStatsDTagFormat)
+	switch statsDTagFormat {
+	case dcgmexporter.StatsDTagFormatDogStatsD, dcgmexporter.StatsDTagFormatInflux, dcgmexporter.StatsDTagFormatNone:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIStatsDTagFormat, statsDTagFormat)
+	}
+
+	if epsilon := c.Float64(CLIPushSuppressEpsilon); epsilon < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %g", CLIPushSuppressEpsilon, epsilon)
+	}
+
+	if c.Int(CLIPushMaxSuppression) <= 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIPushMaxSuppression, c.Int(CLIPushMaxSuppression))
+	}
+
+	if c.Bool(CLIOTLPInsecure) && (c.String(CLIOTLPCAFile) != "" || c.String(CLIOTLPCertFile) != "") {
+		return nil, fmt.Errorf("%s cannot be combined with TLS files", CLIOTLPInsecure)
+	}
+
+	collectIntervalOverrides, err := parseCollectIntervalOverrides(c.StringSlice(CLICollectIntervalOverrides))
+	if err != nil {
+		return nil, err
+	}
+
+	if jitter := c.Float64(CLICollectIntervalJitter); jitter < 0 || jitter >= 1 {
+		return nil, fmt.Errorf("invalid %s parameter value: %g", CLICollectIntervalJitter, jitter)
+	}
+
+	if c.Int(CLIMaxSeries) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIMaxSeries, c.Int(CLIMaxSeries))
+	}
+
+	if c.Int(CLICollectTimeout) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLICollectTimeout, c.Int(CLICollectTimeout))
+	}
+
+	if c.Int(CLIDiagLevel) < 1 || c.Int(CLIDiagLevel) > 4 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDiagLevel, c.Int(CLIDiagLevel))
+	}
+
+	if c.Int(CLIDiagInterval) <= 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDiagInterval, c.Int(CLIDiagInterval))
+	}
+
+	if c.Int(CLIDeviceRescanInterval) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDeviceRescanInterval, c.Int(CLIDeviceRescanInterval))
+	}
+
+	if c.Int(CLIDCGMUpdateFrequency) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLIDCGMUpdateFrequency, c.Int(CLIDCGMUpdateFrequency))
+	}
+
+	if c.Float64(CLIDCGMMaxKeepAge) < 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %g", CLIDCGMMaxKeepAge, c.Float64(CLIDCGMMaxKeepAge))
+	}
+
+	if c.Int(CLISamplingInterval) <= 0 {
+		return nil, fmt.Errorf("invalid %s parameter value: %d", CLISamplingInterval, c.Int(CLISamplingInterval))
+	}
+
 	dcgmLogLevel := c.String(CLIDCGMLogLevel)
 	if !slices.Contains(dcgmexporter.DCGMDbgLvlValues, dcgmLogLevel) {
 		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIDCGMLogLevel, dcgmLogLevel)
 	}
 
+	staticLabels, err := parseStaticLabels(c.StringSlice(CLIStaticLabels))
+	if err != nil {
+		return nil, err
+	}
+
+	helpVars, err := parseHelpVars(c.StringSlice(CLIHelpVars))
+	if err != nil {
+		return nil, err
+	}
+
+	labelRename, err := parseLabelRename(c.StringSlice(CLILabelRename))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dcgmexporter.ValidateLabelRemapping(labelRename, staticLabels); err != nil {
+		return nil, err
+	}
+
+	if err := dcgmexporter.ValidateTransformOrder(c.StringSlice(CLITransformOrder)); err != nil {
+		return nil, err
+	}
+
+	if err := dcgmexporter.ValidateMetricNamePrefix(c.String(CLIMetricNamePrefix)); err != nil {
+		return nil, err
+	}
+
+	logFormat := c.String(CLILogFormat)
+	if logFormat != dcgmexporter.LogFormatText && logFormat != dcgmexporter.LogFormatJSON {
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLILogFormat, logFormat)
+	}
+
+	if _, err := logrus.ParseLevel(c.String(CLILogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid %s parameter value: %w", CLILogLevel, err)
+	}
+
+	gpuLabelStrategy := c.String(CLIGPULabelStrategy)
+	switch gpuLabelStrategy {
+	case dcgmexporter.GPULabelIndex, dcgmexporter.GPULabelUUID:
+	case dcgmexporter.GPULabelHostnameIndex:
+		if c.Bool(CLINoHostname) {
+			return nil, fmt.Errorf("%s parameter value %s requires the hostname, it cannot be used with %s",
+				CLIGPULabelStrategy, gpuLabelStrategy, CLINoHostname)
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIGPULabelStrategy, gpuLabelStrategy)
+	}
+
+	uuidLabelSource := c.String(CLIUUIDLabelSource)
+	if uuidLabelSource != dcgmexporter.UUIDLabelGPU && uuidLabelSource != dcgmexporter.UUIDLabelMIG {
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIUUIDLabelSource, uuidLabelSource)
+	}
+
+	format := c.String(CLIFormat)
+	if format != dcgmexporter.FormatPrometheus && format != dcgmexporter.FormatJSON {
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIFormat, format)
+	}
+
+	missingValuePolicy := c.String(CLIMissingValuePolicy)
+	switch missingValuePolicy {
+	case dcgmexporter.MissingValueSkip, dcgmexporter.MissingValueNaN, dcgmexporter.MissingValueDefault:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIMissingValuePolicy, missingValuePolicy)
+	}
+
+	hostnameSource := c.String(CLIHostnameSource)
+	switch hostnameSource {
+	case dcgmexporter.HostnameSourceAuto, dcgmexporter.HostnameSourceOS, dcgmexporter.HostnameSourceNodeName,
+		dcgmexporter.HostnameSourceFixed:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLIHostnameSource, hostnameSource)
+	}
+
+	if hostnameSource == dcgmexporter.HostnameSourceFixed && c.String(CLIHostname) == "" {
+		return nil, fmt.Errorf("%s is required with the '%s' hostname source", CLIHostname, dcgmexporter.HostnameSourceFixed)
+	}
+
+	sharingStrategy := c.String(CLISharingStrategy)
+	switch sharingStrategy {
+	case "", dcgmexporter.SharingStrategyNone, dcgmexporter.SharingStrategyTimeSlicing, dcgmexporter.SharingStrategyMPS:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter value: %s", CLISharingStrategy, sharingStrategy)
+	}
+
 	return &dcgmexporter.Config{
-		CollectorsFile:             c.String(CLIFieldsFile),
-		Address:                    c.String(CLIAddress),
-		CollectInterval:            c.Int(CLICollectInterval),
-		Kubernetes:                 c.Bool(CLIKubernetes),
-		KubernetesGPUIdType:        dcgmexporter.KubernetesGPUIDType(c.String(CLIKubernetesGPUIDType)),
-		CollectDCP:                 true,
-		UseOldNamespace:            c.Bool(CLIUseOldNamespace),
-		UseRemoteHE:                c.IsSet(CLIRemoteHEInfo),
-		RemoteHEInfo:               c.String(CLIRemoteHEInfo),
-		GPUDevices:                 gOpt,
-		SwitchDevices:              sOpt,
-		CPUDevices:                 cOpt,
-		NoHostname:                 c.Bool(CLINoHostname),
-		UseFakeGPUs:                c.Bool(CLIUseFakeGPUs),
-		ConfigMapData:              c.String(CLIConfigMapData),
-		WebSystemdSocket:           c.Bool(CLIWebSystemdSocket),
-		WebConfigFile:              c.String(CLIWebConfigFile),
-		XIDCountWindowSize:         c.Int(CLIXIDCountWindowSize),
-		ReplaceBlanksInModelName:   c.Bool(CLIReplaceBlanksInModelName),
-		Debug:                      c.Bool(CLIDebugMode),
-		ClockEventsCountWindowSize: c.Int(CLIClockEventsCountWindowSize),
-		EnableDCGMLog:              c.Bool(CLIEnableDCGMLog),
-		DCGMLogLevel:               dcgmLogLevel,
-		PodResourcesKubeletSocket:  c.String(CLIPodResourcesKubeletSocket),
-		HPCJobMappingDir:           c.String(CLIHPCJobMappingDir),
-		NvidiaResourceNames:        c.StringSlice(CLINvidiaResourceNames),
+		CollectorsFile:                 c.String(CLIFieldsFile),
+		Address:                        address,
+		CollectInterval:                c.Int(CLICollectInterval),
+		CollectIntervalOverrides:       collectIntervalOverrides,
+		CollectIntervalJitter:          c.Float64(CLICollectIntervalJitter),
+		CollectTimeout:                 c.Int(CLICollectTimeout),
+		MaxSeries:                      c.Int(CLIMaxSeries),
+		DCGMUpdateFreq:                 c.Int(CLIDCGMUpdateFrequency),
+		DCGMMaxKeepAge:                 c.Float64(CLIDCGMMaxKeepAge),
+		SamplingInterval:               c.Int(CLISamplingInterval),
+		Kubernetes:                     c.Bool(CLIKubernetes),
+		Slurm:                          c.Bool(CLISlurm),
+		NodeLabelAllowlist:             c.StringSlice(CLINodeLabelAllowlist),
+		TransformOrder:                 c.StringSlice(CLITransformOrder),
+		KubernetesGPUIdType:            dcgmexporter.KubernetesGPUIDType(c.String(CLIKubernetesGPUIDType)),
+		CollectDCP:                     true,
+		UseOldNamespace:                c.Bool(CLIUseOldNamespace),
+		UseRemoteHE:                    c.IsSet(CLIRemoteHEInfo),
+		RemoteHEInfo:                   c.String(CLIRemoteHEInfo),
+		GPUDevices:                     gOpt,
+		SwitchDevices:                  sOpt,
+		CPUDevices:                     cOpt,
+		NoHostname:                     c.Bool(CLINoHostname),
+		HostnameSource:                 hostnameSource,
+		FixedHostname:                  c.String(CLIHostname),
+		UseFakeGPUs:                    c.Bool(CLIUseFakeGPUs),
+		DisableGPU:                     !c.Bool(CLIEnableGPU),
+		DisableSwitch:                  !c.Bool(CLIEnableSwitch),
+		DisableLink:                    !c.Bool(CLIEnableLink),
+		DisableCPU:                     !c.Bool(CLIEnableCPU),
+		DisableCPUCore:                 !c.Bool(CLIEnableCPUCore),
+		ConfigMapData:                  c.String(CLIConfigMapData),
+		WebSystemdSocket:               c.Bool(CLIWebSystemdSocket),
+		WebConfigFile:                  c.String(CLIWebConfigFile),
+		AuthUsername:                   c.String(CLIAuthUsername),
+		AuthPassword:                   authPassword,
+		AuthBearerToken:                authBearerToken,
+		TLSCertFile:                    c.String(CLITLSCertFile),
+		TLSKeyFile:                     c.String(CLITLSKeyFile),
+		TLSClientCAFile:                c.String(CLITLSClientCAFile),
+		EnablePprof:                    c.Bool(CLIEnablePprof),
+		AdminListenAddress:             adminAddress,
+		XIDCountWindowSize:             c.Int(CLIXIDCountWindowSize),
+		ReplaceBlanksInModelName:       c.Bool(CLIReplaceBlanksInModelName),
+		Debug:                          c.Bool(CLIDebugMode),
+		LogFormat:                      logFormat,
+		GPULabelStrategy:               gpuLabelStrategy,
+		UUIDLabelSource:                uuidLabelSource,
+		LogLevel:                       c.String(CLILogLevel),
+		ClockEventsCountWindowSize:     c.Int(CLIClockEventsCountWindowSize),
+		EnableDCGMLog:                  c.Bool(CLIEnableDCGMLog),
+		DCGMLogLevel:                   dcgmLogLevel,
+		PodResourcesKubeletSocket:      c.String(CLIPodResourcesKubeletSocket),
+		HPCJobMappingDir:               c.String(CLIHPCJobMappingDir),
+		NvidiaResourceNames:            c.StringSlice(CLINvidiaResourceNames),
+		UseSampleTimestamp:             c.Bool(CLIUseSampleTimestamp),
+		Format:                         format,
+		StaticLabels:                   staticLabels,
+		HelpVars:                       helpVars,
+		LabelRename:                    labelRename,
+		LabelDrop:                      c.StringSlice(CLILabelDrop),
+		MetricNamePrefix:               c.String(CLIMetricNamePrefix),
+		PodMappingNamespaceAllow:       c.StringSlice(CLIPodMappingNamespaceAllow),
+		PodMappingNamespaceDeny:        c.StringSlice(CLIPodMappingNamespaceDeny),
+		KubernetesRemoveContainerLabel: c.Bool(CLIKubernetesRemoveContainerLabel),
+		InitRetryInterval:              c.Int(CLIInitRetryInterval),
+		InitRetryTimeout:               c.Int(CLIInitRetryTimeout),
+		EnableCompression:              c.Bool(CLIEnableCompression),
+		EnableProcessMetrics:           c.Bool(CLIEnableProcessMetrics),
+		EnableProcessMemoryMetrics:     c.Bool(CLIEnableProcessMemoryMetrics),
+		DiagLevel:                      c.Int(CLIDiagLevel),
+		DiagInterval:                   c.Int(CLIDiagInterval),
+		DeviceRescanInterval:           c.Int(CLIDeviceRescanInterval),
+		EnableTopologyLabels:           c.Bool(CLIEnableTopologyLabels),
+		EnableDriverLabels:             c.Bool(CLIEnableDriverLabels),
+		EnableCPUAffinityLabel:         c.Bool(CLIEnableCPUAffinityLabel),
+		MissingValuePolicy:             missingValuePolicy,
+		MissingValueDefault:            c.Float64(CLIMissingValueDefault),
+		SharingStrategy:                sharingStrategy,
+		EnableComputeInstanceMetrics:   c.Bool(CLIEnableComputeInstanceMetrics),
+		EnableVGPU:                     c.Bool(CLIEnableVGPU),
+		EnableRollups:                  c.Bool(CLIEnableRollups),
+		FieldPreflight:                 c.Bool(CLIFieldPreflight),
+		DeviceFilter:                   deviceFilter,
+		CounterAllowRegex:              counterAllowRegex,
+		CounterDenyRegex:               counterDenyRegex,
+		StrictCounterTypes:             c.Bool(CLIStrictCounterTypes),
+		RemoteWriteURL:                 remoteWriteURL,
+		RemoteWriteUsername:            c.String(CLIRemoteWriteUsername),
+		RemoteWritePassword:            c.String(CLIRemoteWritePassword),
+		RemoteWriteBearerToken:         c.String(CLIRemoteWriteBearerToken),
+		EnableOTLP:                     c.Bool(CLIEnableOTLP),
+		OTLPEndpoint:                   c.String(CLIOTLPEndpoint),
+		OTLPHeaders:                    otlpHeaders,
+		OTLPInsecure:                   c.Bool(CLIOTLPInsecure),
+		OTLPCAFile:                     c.String(CLIOTLPCAFile),
+		OTLPCertFile:                   c.String(CLIOTLPCertFile),
+		OTLPKeyFile:                    c.String(CLIOTLPKeyFile),
+		StatsDAddress:                  statsDAddress,
+		StatsDTagFormat:                statsDTagFormat,
+		PushSuppressUnchanged:          c.Bool(CLIPushSuppressUnchanged),
+		PushSuppressEpsilon:            c.Float64(CLIPushSuppressEpsilon),
+		PushMaxSuppression:             c.Int(CLIPushMaxSuppression),
+		Version:                        c.App.Version,
 	}, nil
 }
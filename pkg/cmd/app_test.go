@@ -17,9 +17,13 @@
 package cmd
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -180,7 +184,7 @@ func Test_getFieldEntityGroupTypeSystemInfo(t *testing.T) {
 		},
 	}
 
-	cleanupDCGM := initDCGM(config)
+	cleanupDCGM, _ := initDCGM(config)
 	defer cleanupDCGM()
 
 	for _, tt := range tests {
@@ -193,3 +197,354 @@ func Test_getFieldEntityGroupTypeSystemInfo(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseCollectIntervalOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides []string
+		want      map[string]int
+		wantErr   bool
+	}{
+		{
+			name:      "When no overrides",
+			overrides: nil,
+			want:      map[string]int{},
+		},
+		{
+			name:      "When valid overrides",
+			overrides: []string{"switch=60000", " link = 30000 "},
+			want:      map[string]int{"switch": 60000, "link": 30000},
+		},
+		{
+			name:      "When separator is missing",
+			overrides: []string{"switch:60000"},
+			wantErr:   true,
+		},
+		{
+			name:      "When entity is unknown",
+			overrides: []string{"fan=60000"},
+			wantErr:   true,
+		},
+		{
+			name:      "When interval is not a number",
+			overrides: []string{"gpu=fast"},
+			wantErr:   true,
+		},
+		{
+			name:      "When interval is not positive",
+			overrides: []string{"gpu=0"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCollectIntervalOverrides(tt.overrides)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseStaticLabels(t *testing.T) {
+	got, err := parseStaticLabels([]string{"cluster=prod", " region = us-east-1 "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cluster": "prod", "region": "us-east-1"}, got)
+
+	_, err = parseStaticLabels([]string{"cluster"})
+	require.Error(t, err)
+
+	_, err = parseStaticLabels([]string{"gpu=0"})
+	require.Error(t, err)
+}
+
+func Test_parseHelpVars(t *testing.T) {
+	got, err := parseHelpVars([]string{"runbook=https://runbooks.example.com/gpu", " team = sre "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"runbook": "https://runbooks.example.com/gpu", "team": "sre"}, got)
+
+	_, err = parseHelpVars([]string{"runbook"})
+	require.Error(t, err)
+}
+
+func Test_parseLabelRename(t *testing.T) {
+	got, err := parseLabelRename([]string{"pod=k8s_pod", " DCGM_FI_DRIVER_VERSION = driver_version "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pod": "k8s_pod", "DCGM_FI_DRIVER_VERSION": "driver_version"}, got)
+
+	_, err = parseLabelRename([]string{"pod"})
+	require.Error(t, err)
+
+	_, err = parseLabelRename([]string{"=k8s_pod"})
+	require.Error(t, err)
+}
+
+func Test_readSecret(t *testing.T) {
+	t.Setenv("DCGM_EXPORTER_TEST_SECRET", "from-env")
+
+	got, err := readSecret("", "DCGM_EXPORTER_TEST_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", got)
+
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0o600))
+
+	got, err = readSecret(file, "DCGM_EXPORTER_TEST_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", got)
+
+	_, err = readSecret(filepath.Join(t.TempDir(), "missing"), "DCGM_EXPORTER_TEST_SECRET")
+	require.Error(t, err)
+}
+
+func Test_webConfigHasBasicAuth(t *testing.T) {
+	dir := t.TempDir()
+
+	withUsers := filepath.Join(dir, "with-users.yml")
+	require.NoError(t, os.WriteFile(withUsers, []byte("basic_auth_users:\n  alice: $2y$10$hash\n"), 0o600))
+	got, err := webConfigHasBasicAuth(withUsers)
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	tlsOnly := filepath.Join(dir, "tls-only.yml")
+	require.NoError(t, os.WriteFile(tlsOnly, []byte("tls_server_config:\n  cert_file: tls.crt\n"), 0o600))
+	got, err = webConfigHasBasicAuth(tlsOnly)
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	_, err = webConfigHasBasicAuth(filepath.Join(dir, "missing.yml"))
+	require.Error(t, err)
+}
+
+func Test_initDCGM(t *testing.T) {
+	tests := []struct {
+		name        string
+		useRemoteHE bool
+	}{
+		{
+			name: "When the embedded hostengine fails to start, DCGM is initialized once it starts",
+		},
+		{
+			name:        "When the remote hostengine is not ready, it is connected to once it is",
+			useRemoteHE: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			const failures = 3
+			attempts := 0
+			hostengine := &dcgmexporter.Hostengine{}
+
+			initEmbeddedDCGM, connectHostengine := initEmbeddedDCGMHook, connectHostengineHook
+			defer func() { initEmbeddedDCGMHook, connectHostengineHook = initEmbeddedDCGM, connectHostengine }()
+
+			initEmbeddedDCGMHook = func() (func(), error) {
+				attempts++
+				if attempts <= failures {
+					return func() {}, errors.New("hostengine is not ready")
+				}
+				return func() {}, nil
+			}
+			connectHostengineHook = func([]string) (*dcgmexporter.Hostengine, error) {
+				attempts++
+				if attempts <= failures {
+					return nil, errors.New("connection refused")
+				}
+				return hostengine, nil
+			}
+
+			config := &dcgmexporter.Config{
+				UseRemoteHE:       tc.useRemoteHE,
+				RemoteHEInfo:      "localhost:5555",
+				InitRetryInterval: 1,
+				InitRetryTimeout:  10000,
+			}
+			cleanup, got := initDCGM(config)
+			require.NotNil(t, cleanup)
+			assert.Equal(t, failures+1, attempts)
+			if tc.useRemoteHE {
+				assert.Same(t, hostengine, got)
+			} else {
+				assert.Nil(t, got)
+			}
+		})
+	}
+}
+
+func Test_parseOTLPHeaders(t *testing.T) {
+	got, err := parseOTLPHeaders([]string{"Authorization=Bearer a=b", " x-scope = tenant "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer a=b", "x-scope": "tenant"}, got)
+
+	_, err = parseOTLPHeaders([]string{"authorization"})
+	require.Error(t, err)
+
+	_, err = parseOTLPHeaders([]string{"=value"})
+	require.Error(t, err)
+}
+
+func Test_parseDeviceFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    dcgmexporter.DeviceFilter
+		wantErr bool
+	}{
+		{
+			name:   "When the filter is empty",
+			filter: "",
+			want:   dcgmexporter.DeviceFilter{},
+		},
+		{
+			name:   "When the filter is an index list",
+			filter: "0, 2,3",
+			want:   dcgmexporter.DeviceFilter{Indices: []int{0, 2, 3}},
+		},
+		{
+			name:   "When the filter is a range",
+			filter: "0-3",
+			want:   dcgmexporter.DeviceFilter{Indices: []int{0, 1, 2, 3}},
+		},
+		{
+			name:   "When the filter has UUIDs",
+			filter: "GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5,1",
+			want: dcgmexporter.DeviceFilter{
+				Indices: []int{1},
+				UUIDs:   []string{"GPU-b8ea3855-276c-c9cb-b366-c6fa655957c5"},
+			},
+		},
+		{
+			name:    "When an index is negative",
+			filter:  "-1",
+			wantErr: true,
+		},
+		{
+			name:    "When a range is reversed",
+			filter:  "3-0",
+			wantErr: true,
+		},
+		{
+			name:    "When an entry is neither an index nor a UUID",
+			filter:  "gpu0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDeviceFilter(tt.filter)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseListenAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{
+			name:    "When the host is empty",
+			address: ":9400",
+		},
+		{
+			name:    "When the host is an IPv4 address",
+			address: "127.0.0.1:9400",
+		},
+		{
+			name:    "When the host is an IPv6 address",
+			address: "[::]:9400",
+		},
+		{
+			name:    "When the host is a hostname",
+			address: "localhost:9400",
+		},
+		{
+			name:    "When the IPv6 address has no brackets",
+			address: "::1:9400",
+			wantErr: true,
+		},
+		{
+			name:    "When the port is missing",
+			address: "127.0.0.1",
+			wantErr: true,
+		},
+		{
+			name:    "When the port is out of range",
+			address: ":65536",
+			wantErr: true,
+		},
+		{
+			name:    "When the port is not a number",
+			address: "[::1]:metrics",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListenAddress(tt.address)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.address, got)
+		})
+	}
+}
+
+func Test_configureLogging(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *dcgmexporter.Config
+		wantFormatter logrus.Formatter
+		wantLevel     logrus.Level
+	}{
+		{
+			name:          "When the defaults are used, the logs are text at info level",
+			config:        &dcgmexporter.Config{LogFormat: dcgmexporter.LogFormatText, LogLevel: "info"},
+			wantFormatter: &logrus.TextFormatter{},
+			wantLevel:     logrus.InfoLevel,
+		},
+		{
+			name:          "When the format is json, the logs are structured",
+			config:        &dcgmexporter.Config{LogFormat: dcgmexporter.LogFormatJSON, LogLevel: "warning"},
+			wantFormatter: &logrus.JSONFormatter{},
+			wantLevel:     logrus.WarnLevel,
+		},
+		{
+			name:          "When debug is enabled, it takes precedence over the level",
+			config:        &dcgmexporter.Config{LogFormat: dcgmexporter.LogFormatText, LogLevel: "error", Debug: true},
+			wantFormatter: &logrus.TextFormatter{},
+			wantLevel:     logrus.DebugLevel,
+		},
+	}
+
+	logger := logrus.StandardLogger()
+	formatter, level := logger.Formatter, logger.Level
+	defer func() {
+		logrus.SetFormatter(formatter)
+		logrus.SetLevel(level)
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logrus.SetFormatter(&logrus.TextFormatter{})
+			configureLogging(tt.config)
+			assert.IsType(t, tt.wantFormatter, logger.Formatter)
+			assert.Equal(t, tt.wantLevel, logger.GetLevel())
+		})
+	}
+}
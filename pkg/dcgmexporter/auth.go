@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	authRealm    = "dcgm-exporter"
+	bearerPrefix = "Bearer "
+)
+
+// authenticator restricts the access to an endpoint to the requests carrying the configured basic auth
+// credentials or bearer token. Either of them is enough when both are configured, none allows every request.
+type authenticator struct {
+	username    string
+	password    string
+	bearerToken string
+}
+
+func newAuthenticator(c *Config) authenticator {
+	return authenticator{
+		username:    c.AuthUsername,
+		password:    c.AuthPassword,
+		bearerToken: c.AuthBearerToken,
+	}
+}
+
+func (a authenticator) basicAuthEnabled() bool {
+	return a.username != ""
+}
+
+func (a authenticator) bearerAuthEnabled() bool {
+	return a.bearerToken != ""
+}
+
+func (a authenticator) authorized(r *http.Request) bool {
+	if !a.basicAuthEnabled() && !a.bearerAuthEnabled() {
+		return true
+	}
+
+	if a.basicAuthEnabled() {
+		username, password, ok := r.BasicAuth()
+		if ok && secureEqual(username, a.username) && secureEqual(password, a.password) {
+			return true
+		}
+	}
+
+	if a.bearerAuthEnabled() {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+		if found && secureEqual(token, a.bearerToken) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wrap rejects the unauthorized requests with a 401 challenging for every configured scheme
+func (a authenticator) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.authorized(r) {
+			next(w, r)
+			return
+		}
+
+		if a.basicAuthEnabled() {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", authRealm))
+		}
+		if a.bearerAuthEnabled() {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+		}
+
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// secureEqual compares the strings in constant time, hashing them first so their length doesn't leak either
+func secureEqual(a, b string) bool {
+	hashA := sha256.Sum256([]byte(a))
+	hashB := sha256.Sum256([]byte(b))
+
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:]) == 1
+}
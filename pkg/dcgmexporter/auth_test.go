@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsServer_Auth(t *testing.T) {
+	basic := func(r *http.Request) { r.SetBasicAuth("prometheus", "s3cret") }
+	bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }
+
+	tests := []struct {
+		name          string
+		config        Config
+		authenticate  func(r *http.Request)
+		wantCode      int
+		wantChallenge []string
+	}{
+		{
+			name:     "When no auth is configured, every request is allowed",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "When basic auth is configured and the credentials match, the request is allowed",
+			config:       Config{AuthUsername: "prometheus", AuthPassword: "s3cret"},
+			authenticate: basic,
+			wantCode:     http.StatusOK,
+		},
+		{
+			name:   "When basic auth is configured and the password doesn't match, the request is rejected",
+			config: Config{AuthUsername: "prometheus", AuthPassword: "s3cret"},
+			authenticate: func(r *http.Request) {
+				r.SetBasicAuth("prometheus", "wrong")
+			},
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: []string{`Basic realm="dcgm-exporter", charset="UTF-8"`},
+		},
+		{
+			name:          "When a bearer token is configured and none is sent, the request is rejected",
+			config:        Config{AuthBearerToken: "t0ken"},
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: []string{`Bearer realm="dcgm-exporter"`},
+		},
+		{
+			name:         "When a bearer token is configured and it matches, the request is allowed",
+			config:       Config{AuthBearerToken: "t0ken"},
+			authenticate: bearer,
+			wantCode:     http.StatusOK,
+		},
+		{
+			name:         "When both are configured, the bearer token is enough",
+			config:       Config{AuthUsername: "prometheus", AuthPassword: "s3cret", AuthBearerToken: "t0ken"},
+			authenticate: bearer,
+			wantCode:     http.StatusOK,
+		},
+		{
+			name:   "When both are configured and nothing matches, both schemes are challenged",
+			config: Config{AuthUsername: "prometheus", AuthPassword: "s3cret", AuthBearerToken: "t0ken"},
+			authenticate: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer wrong")
+			},
+			wantCode: http.StatusUnauthorized,
+			wantChallenge: []string{
+				`Basic realm="dcgm-exporter", charset="UTF-8"`,
+				`Bearer realm="dcgm-exporter"`,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, cleanup, err := NewMetricsServer(&tc.config, make(chan string), NewRegistry(),
+				&MetricsPipeline{config: &Config{}})
+			require.NoError(t, err)
+			defer cleanup()
+
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.authenticate != nil {
+				tc.authenticate(request)
+			}
+			recorder := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantChallenge, recorder.Header().Values("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestMetricsServer_AuthLeavesProbesOpen(t *testing.T) {
+	server, cleanup, err := NewMetricsServer(&Config{AuthBearerToken: "t0ken"}, make(chan string), NewRegistry(),
+		&MetricsPipeline{config: &Config{}})
+	require.NoError(t, err)
+	defer cleanup()
+
+	recorder := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestMetricsServer_AuthProtectsAdminListener(t *testing.T) {
+	config := &Config{CollectInterval: 10000, AuthBearerToken: "t0ken", AdminListenAddress: "127.0.0.1:9401"}
+	pipeline := &MetricsPipeline{config: config}
+	pipeline.lastSuccess.Store(time.Now().UnixNano())
+	server, cleanup, err := NewMetricsServer(config, make(chan string), NewRegistry(), pipeline)
+	require.NoError(t, err)
+	defer cleanup()
+
+	require.NotNil(t, server.adminServer)
+	for path, want := range map[string]int{
+		"/health":   http.StatusOK,
+		"/ready":    http.StatusOK,
+		"/counters": http.StatusUnauthorized,
+		"/metrics":  http.StatusUnauthorized,
+	} {
+		recorder := httptest.NewRecorder()
+		server.adminServer.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, recorder.Code, path)
+	}
+}
@@ -53,7 +53,7 @@ func TestClockEventsCollector_Gather(t *testing.T) {
 		{"DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
 	}
 
-	cc, err := extractCounters(records, config)
+	cc, err := extractCounters(records, nil, config)
 	require.NoError(t, err)
 	require.Len(t, cc.ExporterCounters, 1)
 	require.Len(t, cc.DCGMCounters, 1)
@@ -215,7 +215,7 @@ func TestClockEventsCollector_NewClocksThrottleReasonsCollector(t *testing.T) {
 		records := [][]string{
 			{"DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
 		}
-		cc, err := extractCounters(records, config)
+		cc, err := extractCounters(records, nil, config)
 		require.NoError(t, err)
 		require.Len(t, cc.ExporterCounters, 0)
 		require.Len(t, cc.DCGMCounters, 1)
@@ -238,7 +238,7 @@ func TestClockEventsCollector_NewClocksThrottleReasonsCollector(t *testing.T) {
 			{"DCGM_EXP_CLOCK_EVENTS_COUNT", "gauge", ""},
 			{"DCGM_EXP_CLOCK_EVENTS_COUNT", "gauge", ""},
 		}
-		cc, err := extractCounters(records, config)
+		cc, err := extractCounters(records, nil, config)
 		require.NoError(t, err)
 		for i := range cc.DCGMCounters {
 			if cc.DCGMCounters[i].PromType == "label" {
@@ -271,7 +271,7 @@ func TestClockEventsCollector_Gather_AllTheThings(t *testing.T) {
 		{"DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
 	}
 
-	cc, err := extractCounters(records, config)
+	cc, err := extractCounters(records, nil, config)
 	require.NoError(t, err)
 	require.Len(t, cc.ExporterCounters, 1)
 	require.Len(t, cc.DCGMCounters, 1)
@@ -397,7 +397,7 @@ func TestClockEventsCollector_Gather_AllTheThings_WhenNoLabels(t *testing.T) {
 		{"DCGM_EXP_CLOCK_EVENTS_COUNT", "gauge", ""},
 	}
 
-	cc, err := extractCounters(records, config)
+	cc, err := extractCounters(records, nil, config)
 	require.NoError(t, err)
 	require.Len(t, cc.ExporterCounters, 1)
 	require.Len(t, cc.DCGMCounters, 0)
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const clockThrottleReasonLabel = "reason"
+
+// IsDCGMExpClockThrottleReasonsEnabled checks if the DCGM_EXP_CLOCK_THROTTLE_REASONS counter exists
+func IsDCGMExpClockThrottleReasonsEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpClockThrottleReasons
+	})
+}
+
+// clockThrottleReasonsCollector decodes the latest clock throttle reasons bitmask of every monitored GPU
+// into one gauge per reason, 1 while the reason limits the clocks and 0 otherwise.
+type clockThrottleReasonsCollector struct {
+	expCollector
+}
+
+func NewClockThrottleReasonsCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem,
+) (Collector, error) {
+	if !IsDCGMExpClockThrottleReasonsEnabled(counters) {
+		logrus.Error(dcgmExpClockThrottleReasons + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpClockThrottleReasons + " collector is disabled")
+	}
+
+	collector := clockThrottleReasonsCollector{}
+	collector.expCollector = newExpCollector(
+		counters,
+		hostname,
+		[]dcgm.Short{dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS},
+		config,
+		fieldEntityGroupTypeSystemInfo,
+	)
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpClockThrottleReasons
+	})]
+
+	return &collector, nil
+}
+
+func (c *clockThrottleReasonsCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	var read []uint
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		// The clocks are throttled per physical GPU, GPU instances share the reasons of their parent
+		gpu := mi.DeviceInfo.GPU
+		if slices.Contains(read, gpu) {
+			continue
+		}
+		read = append(read, gpu)
+
+		values, err := dcgmEntityGetLatestValuesHook(dcgm.FE_GPU, gpu,
+			[]dcgm.Short{dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS})
+		if err != nil {
+			logrus.Warnf("Failed to read the clock throttle reasons of GPU %d; err: %v", gpu, err)
+			continue
+		}
+
+		if len(values) == 0 || values[0].Status != 0 || isBlank(values[0]) {
+			continue
+		}
+
+		mi.InstanceInfo = nil
+		for _, reason := range decodeClockThrottleReasons(values[0].Int64()) {
+			m := c.createMetric(map[string]string{clockThrottleReasonLabel: reason.name}, mi, uuid, reason.active)
+			metrics[c.counter] = append(metrics[c.counter], m)
+		}
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
+
+type clockThrottleReason struct {
+	name   string
+	active int
+}
+
+// decodeClockThrottleReasons returns every known reason ordered by bit, the bits of unknown reasons are ignored
+func decodeClockThrottleReasons(bitmask int64) []clockThrottleReason {
+	bits := make([]clockEventBitmask, 0, len(clockEventToString))
+	for bit := range clockEventToString {
+		bits = append(bits, bit)
+	}
+	slices.Sort(bits)
+
+	res := make([]clockThrottleReason, 0, len(bits))
+	for _, bit := range bits {
+		reason := clockThrottleReason{name: bit.String()}
+		if clockEventBitmask(bitmask)&bit != 0 {
+			reason.active = 1
+		}
+		res = append(res, reason)
+	}
+
+	return res
+}
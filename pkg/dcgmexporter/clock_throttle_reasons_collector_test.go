@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeClockThrottleReasons(t *testing.T) {
+	tests := []struct {
+		name    string
+		bitmask int64
+		want    map[string]int
+	}{
+		{
+			name:    "When no bit is set, every reason is inactive",
+			bitmask: 0,
+			want:    map[string]int{},
+		},
+		{
+			name:    "When several bits are set, each of them is active",
+			bitmask: int64(DCGM_CLOCKS_THROTTLE_REASON_SW_POWER_CAP | DCGM_CLOCKS_THROTTLE_REASON_HW_THERMAL),
+			want:    map[string]int{"power_cap": 1, "hw_thermal": 1},
+		},
+		{
+			name:    "When an unknown bit is set, it is ignored",
+			bitmask: int64(DCGM_CLOCKS_THROTTLE_REASON_GPU_IDLE) | 0x10000,
+			want:    map[string]int{"gpu_idle": 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := decodeClockThrottleReasons(tc.bitmask)
+			require.Len(t, got, len(clockEventToString))
+			assert.Equal(t, "gpu_idle", got[0].name, "reasons are ordered by bit")
+
+			for _, reason := range got {
+				assert.Equal(t, tc.want[reason.name], reason.active, reason.name)
+			}
+		})
+	}
+}
+
+func TestClockThrottleReasonsCollector_GetMetrics(t *testing.T) {
+	bitmasks := map[uint]int64{
+		0: int64(DCGM_CLOCKS_THROTTLE_REASON_SW_THERMAL),
+		1: dcgm.DCGM_FT_INT64_BLANK,
+	}
+
+	dcgmEntityGetLatestValuesHook = func(_ dcgm.Field_Entity_Group, gpu uint, _ []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		if gpu == 2 {
+			return nil, errors.New("boom")
+		}
+		return []dcgm.FieldValue_v1{{
+			FieldId:   dcgm.DCGM_FI_DEV_CLOCK_THROTTLE_REASONS,
+			FieldType: dcgm.DCGM_FT_INT64,
+			Value:     int64FieldValue(bitmasks[gpu]),
+		}}, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 3,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	counter := Counter{
+		FieldID:   dcgm.Short(DCGMClockThrottleReasons),
+		FieldName: dcgmExpClockThrottleReasons,
+		PromType:  "gauge",
+	}
+	collector := clockThrottleReasonsCollector{
+		expCollector: expCollector{
+			sysInfo:  sysInfo,
+			counter:  counter,
+			hostname: "local-test",
+			config:   &Config{},
+		},
+	}
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+
+	// GPUs without a value or whose value cannot be read are not reported
+	values := map[string]string{}
+	for _, metric := range metrics[counter] {
+		assert.Equal(t, "0", metric.GPU)
+		assert.Equal(t, "local-test", metric.Hostname)
+		values[metric.Labels[clockThrottleReasonLabel]] = metric.Value
+	}
+
+	require.Len(t, values, len(clockEventToString))
+	assert.Equal(t, "1", values["sw_thermal"])
+	assert.Equal(t, "0", values["hw_thermal"])
+	assert.Equal(t, "0", values["power_cap"])
+}
+
+func TestNewClockThrottleReasonsCollector_Disabled(t *testing.T) {
+	_, err := NewClockThrottleReasonsCollector([]Counter{}, "", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.Error(t, err)
+}
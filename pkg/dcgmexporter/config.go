@@ -16,7 +16,11 @@
 
 package dcgmexporter
 
-import "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+import (
+	"regexp"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
 
 type KubernetesGPUIDType string
 
@@ -25,38 +29,185 @@ const (
 	DeviceName KubernetesGPUIDType = "device-name"
 )
 
+// Output formats of the metrics endpoint
+const (
+	FormatPrometheus = "prometheus"
+	FormatJSON       = "json"
+)
+
+// Handling of the blank values DCGM reports for the fields without value
+const (
+	MissingValueSkip    = "skip"
+	MissingValueNaN     = "nan"
+	MissingValueDefault = "default"
+)
+
+// GPU sharing strategies of the Kubernetes device plugin, reported with the sharing_strategy label
+const (
+	SharingStrategyNone        = "none"
+	SharingStrategyTimeSlicing = "time-slicing"
+	SharingStrategyMPS         = "mps"
+)
+
+// Sources of the Hostname label
+const (
+	HostnameSourceAuto     = "auto"      // NODE_NAME when set, the OS hostname otherwise
+	HostnameSourceOS       = "os"        // The OS hostname, a pod name in Kubernetes
+	HostnameSourceNodeName = "node-name" // The NODE_NAME environment variable, set with the downward API
+	HostnameSourceFixed    = "fixed"     // Config.FixedHostname
+)
+
+// Policies of MetricsPipeline.Run when the consumer of the output channel doesn't keep up
+const (
+	OutputBackpressureDropOldest = "drop-oldest" // The oldest payload not consumed yet is replaced by the newest one
+	OutputBackpressureDropNewest = "drop-newest" // The newest payload is dropped until the previous one is consumed
+	OutputBackpressureBlock      = "block"       // The collections wait until the consumer takes the payload
+)
+
+// Formats of the logs of dcgm-exporter
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
 type DeviceOptions struct {
 	Flex       bool  // If true, then monitor all GPUs if MIG mode is disabled or all GPU instances if MIG is enabled.
 	MajorRange []int // The indices of each GPU/NvSwitch to monitor, or -1 to monitor all
 	MinorRange []int // The indices of each GPUInstance/NvLink to monitor, or -1 to monitor all
 }
 
+// DeviceFilter restricts the GPUs enumerated by dcgm-exporter. An empty filter keeps all GPUs.
+type DeviceFilter struct {
+	Indices []int    // Indices of the GPUs to keep
+	UUIDs   []string // UUIDs of the GPUs to keep
+}
+
 type Config struct {
-	CollectorsFile             string
-	Address                    string
-	CollectInterval            int
-	Kubernetes                 bool
-	KubernetesGPUIdType        KubernetesGPUIDType
-	CollectDCP                 bool
-	UseOldNamespace            bool
-	UseRemoteHE                bool
-	RemoteHEInfo               string
-	GPUDevices                 DeviceOptions
-	SwitchDevices              DeviceOptions
-	CPUDevices                 DeviceOptions
-	NoHostname                 bool
-	UseFakeGPUs                bool
-	ConfigMapData              string
-	MetricGroups               []dcgm.MetricGroup
-	WebSystemdSocket           bool
-	WebConfigFile              string
-	XIDCountWindowSize         int
-	ReplaceBlanksInModelName   bool
-	Debug                      bool
-	ClockEventsCountWindowSize int
-	EnableDCGMLog              bool
-	DCGMLogLevel               string
-	PodResourcesKubeletSocket  string
-	HPCJobMappingDir           string
-	NvidiaResourceNames        []string
+	CollectorsFile                 string
+	Address                        string
+	CollectInterval                int
+	CollectIntervalOverrides       map[string]int
+	CollectIntervalJitter          float64 // Fraction of the interval by which the first tick is randomly delayed, 0 disables it
+	CollectTimeout                 int     // Time in ms after which a collector fails the tick, 0 waits indefinitely
+	MaxSeries                      int     // Maximum number of series exported by the collectors, 0 is unlimited
+	OutputBackpressure             string  // One of the OutputBackpressure* values, empty is OutputBackpressureDropOldest
+	DCGMUpdateFreq                 int     // Interval at which DCGM samples the watched fields in ms, 0 uses the collect interval of the entity
+	DCGMMaxKeepAge                 float64 // Age in seconds after which DCGM discards the samples, 0 keeps the latest one whatever its age
+	SamplingInterval               int     // Interval at which DCGM samples the fields of the sampled counters in ms
+	Kubernetes                     bool
+	Slurm                          bool // Labels the GPU metrics with the SLURM jobs of the processes running on the GPUs
+	KubernetesGPUIdType            KubernetesGPUIDType
+	NodeLabelAllowlist             []string // Labels of the Kubernetes node added to the GPU metrics
+	CollectDCP                     bool
+	UseOldNamespace                bool
+	UseRemoteHE                    bool
+	RemoteHEInfo                   string
+	GPUDevices                     DeviceOptions
+	SwitchDevices                  DeviceOptions
+	CPUDevices                     DeviceOptions
+	NoHostname                     bool
+	HostnameSource                 string // One of the HostnameSource* values, empty is HostnameSourceAuto
+	FixedHostname                  string // Hostname label of HostnameSourceFixed
+	UseFakeGPUs                    bool
+	DisableGPU                     bool // Skips the GPUs and their MIG instances, see EntityEnabled
+	DisableSwitch                  bool
+	DisableLink                    bool
+	DisableCPU                     bool
+	DisableCPUCore                 bool
+	ConfigMapData                  string
+	MetricGroups                   []dcgm.MetricGroup
+	WebSystemdSocket               bool
+	WebConfigFile                  string
+	EnablePprof                    bool   // Serves the Go profiles under /debug/pprof
+	AdminListenAddress             string // Serves the probes, counters, self-metrics and profiles instead of Address when set
+	AuthUsername                   string // Username required to scrape /metrics with basic auth, empty disables it
+	AuthPassword                   string
+	AuthBearerToken                string // Token required to scrape /metrics with bearer auth, empty disables it
+	TLSCertFile                    string // Serves the metrics over HTTPS when set, together with TLSKeyFile
+	TLSKeyFile                     string
+	TLSClientCAFile                string // Requires client certificates signed by this CA when set
+	XIDCountWindowSize             int
+	ReplaceBlanksInModelName       bool
+	Debug                          bool
+	LogFormat                      string // One of LogFormatText or LogFormatJSON
+	GPULabelStrategy               string // Value of the gpu label, one of GPULabelIndex, GPULabelUUID or GPULabelHostnameIndex
+	UUIDLabelSource                string // Value of the UUID label, one of UUIDLabelGPU or UUIDLabelMIG
+	LogLevel                       string // Name of a logrus level, Debug takes precedence
+	ClockEventsCountWindowSize     int
+	EnableDCGMLog                  bool
+	DCGMLogLevel                   string
+	PodResourcesKubeletSocket      string
+	HPCJobMappingDir               string
+	NvidiaResourceNames            []string
+	UseSampleTimestamp             bool
+	Format                         string
+	StaticLabels                   map[string]string
+	MetricNamePrefix               string            // Prepended to the name of every counter when the metrics are formatted
+	LabelRename                    map[string]string // Labels and attributes renamed before formatting, by original name
+	LabelDrop                      []string          // Labels and attributes dropped before formatting, applied after LabelRename
+	PodMappingNamespaceAllow       []string
+	PodMappingNamespaceDeny        []string
+	KubernetesRemoveContainerLabel bool // Drops the container label of the pod mapping, which is kept by default
+	InitRetryInterval              int
+	InitRetryTimeout               int
+	EnableCompression              bool
+	EnableProcessMetrics           bool
+	EnableProcessMemoryMetrics     bool // Exports DCGM_EXP_PROCESS_MEM_USED_BYTES per PID, labeled with the pod of its GPU
+	DiagLevel                      int  // Level of the diagnostic reported by DCGM_EXP_DIAG_RESULT, from 1 (quick) to 4 (extended)
+	DiagInterval                   int  // Interval in ms between the diagnostics reported by DCGM_EXP_DIAG_RESULT
+	DeviceRescanInterval           int  // Interval in ms between the re-enumerations of the GPUs, 0 disables them
+	EnableTopologyLabels           bool // Adds the numa_node label to the GPU metrics
+	EnableDriverLabels             bool // Adds the driver_version and vbios_version labels to the GPU metrics
+	EnableCPUAffinityLabel         bool // Adds the cpu_affinity label, the CPUs local to the GPU, to the GPU metrics
+	EnableComputeInstanceMetrics   bool // Collects the GPU instances per compute instance, labeled with GPU_CI_ID
+	EnableVGPU                     bool // Collects the vGPU fields per vGPU instance, labeled with vgpu_instance
+	EnableRollups                  bool // Exports node-level gauges derived from the GPU metrics, see rollupMetrics
+	FieldPreflight                 bool // Drops the fields each GPU doesn't support when the collectors are created
+	DeviceFilter                   DeviceFilter
+	CounterAllowRegex              *regexp.Regexp    // Only counters whose field name matches are kept, nil keeps all
+	CounterDenyRegex               *regexp.Regexp    // Counters whose field name matches are dropped, takes precedence over the allow regex
+	StrictCounterTypes             bool              // Fails to parse the counters declaring a monotonic field as a gauge instead of warning
+	HelpVars                       map[string]string // Values of the {<NAME>} variables of the help of the counters
+	RemoteWriteURL                 string
+	RemoteWriteUsername            string
+	RemoteWritePassword            string
+	RemoteWriteBearerToken         string
+	EnableOTLP                     bool
+	OTLPEndpoint                   string
+	OTLPHeaders                    map[string]string // Sent as gRPC metadata with every export
+	OTLPInsecure                   bool              // Disables TLS
+	OTLPCAFile                     string
+	OTLPCertFile                   string
+	OTLPKeyFile                    string
+	StatsDAddress                  string      // <HOST>:<PORT>, udp://<HOST>:<PORT> or unix://<PATH>, empty disables StatsD
+	StatsDTagFormat                string      // One of the StatsDTagFormat* values, empty is StatsDTagFormatDogStatsD
+	PushSuppressUnchanged          bool        // Skips pushing the gauges whose value didn't change, see deltaFilter
+	PushSuppressEpsilon            float64     // Largest difference between two values of a gauge considered unchanged
+	PushMaxSuppression             int         // Time in ms after which an unchanged gauge is pushed again
+	Version                        string      // Version of dcgm-exporter, set at build time
+	DCGMVersion                    string      // Version of the DCGM library linked at runtime
+	MissingValuePolicy             string      // One of MissingValueSkip, MissingValueNaN or MissingValueDefault
+	MissingValueDefault            float64     // Reported for the blank values with MissingValueDefault
+	Transforms                     []Transform // Applied after the built-in transformations, they can attach an Exemplar to the metrics
+	TransformOrder                 []string    // Names of the transformations applied first, in order, see orderTransforms
+	SharingStrategy                string      // Sharing strategy of the GPUs without a pod, and of the shared devices of the pods when set
+}
+
+// EntityEnabled reports whether the entities of the group are collected. The collectors of the disabled
+// entities are not created at all.
+func (c *Config) EntityEnabled(entityType dcgm.Field_Entity_Group) bool {
+	switch entityType {
+	case dcgm.FE_GPU:
+		return !c.DisableGPU
+	case dcgm.FE_SWITCH:
+		return !c.DisableSwitch
+	case dcgm.FE_LINK:
+		return !c.DisableLink
+	case dcgm.FE_CPU:
+		return !c.DisableCPU
+	case dcgm.FE_CPU_CORE:
+		return !c.DisableCPUCore
+	default:
+		return true
+	}
 }
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// monotonicFields are the DCGM fields whose value only grows until the GPU is reset. The DCGM field metadata only
+// describes the type of the values, not their semantic, so they are listed here.
+var monotonicFields = map[dcgm.Short]bool{
+	dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION:          true,
+	dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER:               true,
+	dcgm.DCGM_FI_DEV_POWER_VIOLATION:                   true,
+	dcgm.DCGM_FI_DEV_THERMAL_VIOLATION:                 true,
+	dcgm.DCGM_FI_DEV_SYNC_BOOST_VIOLATION:              true,
+	dcgm.DCGM_FI_DEV_BOARD_LIMIT_VIOLATION:             true,
+	dcgm.DCGM_FI_DEV_LOW_UTIL_VIOLATION:                true,
+	dcgm.DCGM_FI_DEV_RELIABILITY_VIOLATION:             true,
+	dcgm.DCGM_FI_DEV_TOTAL_APP_CLOCKS_VIOLATION:        true,
+	dcgm.DCGM_FI_DEV_TOTAL_BASE_CLOCKS_VIOLATION:       true,
+	dcgm.DCGM_FI_DEV_RETIRED_SBE:                       true,
+	dcgm.DCGM_FI_DEV_RETIRED_DBE:                       true,
+	dcgm.DCGM_FI_DEV_UNCORRECTABLE_REMAPPED_ROWS:       true,
+	dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS:         true,
+	dcgm.DCGM_FI_DEV_NVLINK_CRC_FLIT_ERROR_COUNT_TOTAL: true,
+	dcgm.DCGM_FI_DEV_NVLINK_CRC_DATA_ERROR_COUNT_TOTAL: true,
+	dcgm.DCGM_FI_DEV_NVLINK_REPLAY_ERROR_COUNT_TOTAL:   true,
+	dcgm.DCGM_FI_DEV_NVLINK_RECOVERY_ERROR_COUNT_TOTAL: true,
+}
+
+// isMonotonicField checks if the value of the field only grows, like the ECC error counters
+func isMonotonicField(fieldID dcgm.Short) bool {
+	return monotonicFields[fieldID] ||
+		(fieldID >= dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL && fieldID <= dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TEX)
+}
+
+// validateCounterType warns when a monotonic field is exported as a gauge, as rate() and increase() then ignore
+// the resets of the counter. The warning is an error in strict mode.
+func validateCounterType(fieldName string, fieldID dcgm.Short, promType string, strict bool) error {
+	if promType != "gauge" || !isMonotonicField(fieldID) {
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("counter '%s' only grows and must be declared as a counter, not a gauge", fieldName)
+	}
+
+	logrus.Warnf("Counter '%s' only grows and should be declared as a counter, not a gauge", fieldName)
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCounterType(t *testing.T) {
+	tests := []struct {
+		name     string
+		fieldID  dcgm.Short
+		promType string
+		strict   bool
+		wantErr  bool
+	}{
+		{
+			name:     "When a monotonic field is a counter, it is valid",
+			fieldID:  dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION,
+			promType: "counter",
+			strict:   true,
+		},
+		{
+			name:     "When a monotonic field is a gauge, it is only warned about",
+			fieldID:  dcgm.DCGM_FI_DEV_PCIE_REPLAY_COUNTER,
+			promType: "gauge",
+		},
+		{
+			name:     "When a monotonic field is a gauge in strict mode, it is an error",
+			fieldID:  dcgm.DCGM_FI_DEV_ECC_DBE_VOL_L2,
+			promType: "gauge",
+			strict:   true,
+			wantErr:  true,
+		},
+		{
+			name:     "When a field that can decrease is a gauge in strict mode, it is valid",
+			fieldID:  dcgm.DCGM_FI_DEV_GPU_TEMP,
+			promType: "gauge",
+			strict:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateCounterType("FIELD", tc.fieldID, tc.promType, tc.strict)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestExtractCountersStrictCounterTypes(t *testing.T) {
+	records := [][]string{{"DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "gauge", "Total energy consumption (in mJ)."}}
+
+	cs, err := extractCounters(records, nil, &Config{})
+	require.NoError(t, err)
+	assert.Len(t, cs.DCGMCounters, 1)
+
+	_, err = extractCounters(records, nil, &Config{StrictCounterTypes: true})
+	require.ErrorContains(t, err, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION")
+}
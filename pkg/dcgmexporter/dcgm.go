@@ -19,6 +19,7 @@ package dcgmexporter
 import (
 	"fmt"
 	"math/rand"
+	"slices"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/sirupsen/logrus"
@@ -38,9 +39,23 @@ func NewGroup() (dcgm.GroupHandle, func(), error) {
 	}, nil
 }
 
+// cpuCoreFields are the CPU fields also requested for each core, DCGM reports them blank on the hardware
+// that doesn't measure them per core and these values are skipped
+var cpuCoreFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_CPU_TEMP_CURRENT,
+	dcgm.DCGM_FI_DEV_CPU_POWER_UTIL_CURRENT,
+}
+
 func NewDeviceFields(counters []Counter, entityType dcgm.Field_Entity_Group) []dcgm.Short {
 	var deviceFields []dcgm.Short
 	for _, f := range counters {
+		if f.Scope != "" {
+			if counterScopes[f.Scope] == entityType {
+				deviceFields = append(deviceFields, f.FieldID)
+			}
+			continue
+		}
+
 		meta := dcgm.FieldGetById(f.FieldID)
 
 		if meta.EntityLevel == entityType || meta.EntityLevel == dcgm.FE_NONE {
@@ -49,9 +64,20 @@ func NewDeviceFields(counters []Counter, entityType dcgm.Field_Entity_Group) []d
 			deviceFields = append(deviceFields, f.FieldID)
 		} else if entityType == dcgm.FE_CPU && (meta.EntityLevel == dcgm.FE_CPU || meta.EntityLevel == dcgm.FE_CPU_CORE) {
 			deviceFields = append(deviceFields, f.FieldID)
+		} else if entityType == dcgm.FE_CPU_CORE && slices.Contains(cpuCoreFields, f.FieldID) {
+			deviceFields = append(deviceFields, f.FieldID)
 		}
 	}
 
+	if entityType == dcgm.FE_GPU {
+		deviceFields = withFramebufferFields(deviceFields)
+		deviceFields = withPowerLimitField(deviceFields)
+	}
+
+	if entityType == dcgm.FE_LINK {
+		deviceFields = withNVLinkThroughputFields(deviceFields)
+	}
+
 	return deviceFields
 }
 
@@ -81,7 +107,39 @@ func WatchFieldGroup(
 	return nil
 }
 
-func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, collectIntervalUsec int64) ([]dcgm.GroupHandle, dcgm.FieldHandle, []func(), error) {
+// watchParams returns the update frequency in us and the max keep age in seconds of the watches of the entity.
+// The collectors read the latest sample of the fields, so DCGM samples them at the collect interval of the entity
+// unless Config.DCGMUpdateFreq is set, in which case a slower frequency reports samples older than the interval.
+func watchParams(c *Config, entityType dcgm.Field_Entity_Group) (int64, float64) {
+	updateFreq := c.DCGMUpdateFreq
+	if updateFreq == 0 {
+		updateFreq = collectInterval(c, entityType)
+	}
+
+	if c.DCGMMaxKeepAge > 0 && c.DCGMMaxKeepAge*1000 < float64(updateFreq) {
+		logrus.Warnf("The DCGM samples are kept %gs, less than the update frequency of %dms; "+
+			"the fields will be reported without value between the updates", c.DCGMMaxKeepAge, updateFreq)
+	}
+
+	return int64(updateFreq) * 1000, c.DCGMMaxKeepAge
+}
+
+// collectInterval returns the collect interval of the entity in ms, Config.CollectIntervalOverrides included
+func collectInterval(c *Config, entityType dcgm.Field_Entity_Group) int {
+	for _, entity := range PipelineEntities {
+		if counterScopes[entity] != entityType {
+			continue
+		}
+
+		if override, exists := c.CollectIntervalOverrides[entity]; exists {
+			return override
+		}
+	}
+
+	return c.CollectInterval
+}
+
+func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, updateFreqUsec int64, maxKeepAge float64) ([]dcgm.GroupHandle, dcgm.FieldHandle, []func(), error) {
 	var err error
 	var cleanups []func()
 	var cleanup func()
@@ -95,11 +153,12 @@ func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, collect
 		/* one group per-CPU is created for cpu cores */
 		groups, cleanups, err = CreateCoreGroupsFromSystemInfo(sysInfo)
 	} else {
-		group, cleanup, err := CreateGroupFromSystemInfo(sysInfo)
+		var group dcgm.GroupHandle
+		group, cleanup, err = CreateGroupFromSystemInfo(sysInfo)
 		if err == nil {
 			groups = append(groups, group)
-			cleanups = append(cleanups, cleanup)
 		}
+		cleanups = append(cleanups, cleanup)
 	}
 
 	if err != nil {
@@ -114,7 +173,7 @@ func SetupDcgmFieldsWatch(deviceFields []dcgm.Short, sysInfo SystemInfo, collect
 
 		cleanups = append(cleanups, cleanup)
 
-		err = WatchFieldGroup(gr, fieldGroup, collectIntervalUsec, 0.0, 1)
+		err = WatchFieldGroup(gr, fieldGroup, updateFreqUsec, maxKeepAge, 1)
 		if err != nil {
 			goto fail
 		}
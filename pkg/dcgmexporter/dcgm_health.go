@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+/*
+#cgo linux LDFLAGS: -ldl
+#define _GNU_SOURCE
+#include <dlfcn.h>
+#include <stdint.h>
+
+#define DCGM_EXPORTER_HEALTH_WATCH_ALL 0xFFFFFFFF
+#define DCGM_EXPORTER_HEALTH_MAX_INCIDENTS 64
+
+// Layout of dcgmIncidentInfo_t, see dcgm_structs.h
+typedef struct {
+	unsigned int system;
+	int health;
+	char msg[1024];
+	unsigned int code;
+	int entityGroupId;
+	unsigned int entityId;
+} dcgmExporterIncidentInfo;
+
+// Layout of dcgmHealthResponse_v4, see dcgm_structs.h
+typedef struct {
+	unsigned int version;
+	int overallHealth;
+	unsigned int incidentCount;
+	dcgmExporterIncidentInfo incidents[DCGM_EXPORTER_HEALTH_MAX_INCIDENTS];
+} dcgmExporterHealthResponse;
+
+typedef int (*dcgmHealthSetFn)(uintptr_t, uintptr_t, unsigned int);
+typedef int (*dcgmHealthCheckFn)(uintptr_t, uintptr_t, dcgmExporterHealthResponse *);
+
+// setDCGMHealthWatches looks up dcgmHealthSet in the DCGM library loaded by go-dcgm and enables every
+// health watch of the group, found is 0 when the library isn't loaded
+static int setDCGMHealthWatches(uintptr_t handle, uintptr_t group, int *found) {
+	dcgmHealthSetFn fn = (dcgmHealthSetFn)dlsym(RTLD_DEFAULT, "dcgmHealthSet");
+	*found = fn != NULL;
+	if (fn == NULL) {
+		return 0;
+	}
+
+	return fn(handle, group, DCGM_EXPORTER_HEALTH_WATCH_ALL);
+}
+
+// checkDCGMHealth looks up dcgmHealthCheck in the DCGM library loaded by go-dcgm and checks the health
+// of the group, found is 0 when the library isn't loaded
+static int checkDCGMHealth(uintptr_t handle, uintptr_t group, dcgmExporterHealthResponse *response, int *found) {
+	dcgmHealthCheckFn fn = (dcgmHealthCheckFn)dlsym(RTLD_DEFAULT, "dcgmHealthCheck");
+	*found = fn != NULL;
+	if (fn == NULL) {
+		return 0;
+	}
+
+	response->version = (unsigned int)(sizeof(dcgmExporterHealthResponse) | (4 << 24));
+	return fn(handle, group, response);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// dcgmHostengineHandle is the handle of the connection go-dcgm opened with dcgm.Init, go-dcgm only checks
+// the health of groups it creates and destroys itself for every check
+//
+//go:linkname dcgmHostengineHandle github.com/NVIDIA/go-dcgm/pkg/dcgm.handle
+var dcgmHostengineHandle struct{ handle uintptr }
+
+// healthIncident is a health incident reported by DCGM for an entity of the checked group
+type healthIncident struct {
+	entity dcgm.GroupEntityPair
+	health int
+}
+
+// groupHandleID returns the DCGM identifier wrapped by the group handle
+func groupHandleID(group dcgm.GroupHandle) C.uintptr_t {
+	return *(*C.uintptr_t)(unsafe.Pointer(&group))
+}
+
+// dcgmHealthSet enables every health watch of the group, dcgm.Init must have been called.
+func dcgmHealthSet(group dcgm.GroupHandle) error {
+	var found C.int
+
+	result := C.setDCGMHealthWatches(C.uintptr_t(dcgmHostengineHandle.handle), groupHandleID(group), &found)
+	if found == 0 {
+		return fmt.Errorf("the DCGM library is not loaded")
+	}
+
+	if result != 0 {
+		return fmt.Errorf("could not set the health watches; error code: %d", int(result))
+	}
+
+	return nil
+}
+
+// dcgmHealthCheck returns the health incidents of the group, dcgmHealthSet must have been called on it.
+func dcgmHealthCheck(group dcgm.GroupHandle) ([]healthIncident, error) {
+	var response C.dcgmExporterHealthResponse
+	var found C.int
+
+	result := C.checkDCGMHealth(C.uintptr_t(dcgmHostengineHandle.handle), groupHandleID(group), &response, &found)
+	if found == 0 {
+		return nil, fmt.Errorf("the DCGM library is not loaded")
+	}
+
+	if result != 0 {
+		return nil, fmt.Errorf("could not check the health; error code: %d", int(result))
+	}
+
+	count := min(int(response.incidentCount), len(response.incidents))
+	incidents := make([]healthIncident, 0, count)
+	for _, incident := range response.incidents[:count] {
+		incidents = append(incidents, healthIncident{
+			entity: dcgm.GroupEntityPair{
+				EntityGroupId: dcgm.Field_Entity_Group(incident.entityGroupId),
+				EntityId:      uint(incident.entityId),
+			},
+			health: int(incident.health),
+		})
+	}
+
+	return incidents, nil
+}
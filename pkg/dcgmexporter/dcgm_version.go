@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+/*
+#cgo linux LDFLAGS: -ldl
+#define _GNU_SOURCE
+#include <dlfcn.h>
+
+// Layout of dcgmVersionInfo_v2, see dcgm_structs.h
+typedef struct {
+	unsigned int version;
+	char rawBuildInfoString[512];
+} dcgmExporterVersionInfo;
+
+typedef int (*dcgmVersionInfoFn)(dcgmExporterVersionInfo *);
+
+// getDCGMVersionInfo looks up dcgmVersionInfo in the DCGM library loaded by go-dcgm, found is 0 when
+// the library isn't loaded
+static int getDCGMVersionInfo(dcgmExporterVersionInfo *info, int *found) {
+	dcgmVersionInfoFn fn = (dcgmVersionInfoFn)dlsym(RTLD_DEFAULT, "dcgmVersionInfo");
+	*found = fn != NULL;
+	if (fn == NULL) {
+		return 0;
+	}
+
+	info->version = (unsigned int)(sizeof(dcgmExporterVersionInfo) | (2 << 24));
+	return fn(info);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+)
+
+const dcgmVersionKey = "version:"
+
+// DCGMVersion returns the version of the DCGM library linked at runtime, dcgm.Init must have been called.
+func DCGMVersion() (string, error) {
+	var info C.dcgmExporterVersionInfo
+	var found C.int
+
+	result := C.getDCGMVersionInfo(&info, &found)
+	if found == 0 {
+		return "", fmt.Errorf("the DCGM library is not loaded")
+	}
+
+	if result != 0 {
+		return "", fmt.Errorf("could not retrieve the DCGM version; error code: %d", int(result))
+	}
+
+	return parseDCGMVersion(C.GoString(&info.rawBuildInfoString[0]))
+}
+
+// parseDCGMVersion extracts the version from the DCGM build information, which looks like
+// "version:3.3.5;arch:x86_64;buildtype:Release;..."
+func parseDCGMVersion(buildInfo string) (string, error) {
+	for _, item := range strings.Split(buildInfo, ";") {
+		if version, found := strings.CutPrefix(item, dcgmVersionKey); found {
+			return version, nil
+		}
+	}
+
+	return "", fmt.Errorf("no version in the DCGM build information '%s'", buildInfo)
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDCGMVersion(t *testing.T) {
+	version, err := parseDCGMVersion("version:3.3.5;arch:x86_64;buildtype:Release;buildid:;builddate:2024-02-22")
+	require.NoError(t, err)
+	assert.Equal(t, "3.3.5", version)
+
+	_, err = parseDCGMVersion("arch:x86_64;buildtype:Release")
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DeviceScanner follows the GPUs attached to the host, to rebuild the collectors when GPUs are hot-added or removed
+type DeviceScanner struct {
+	useFakeGPUs bool
+	uuids       []string
+}
+
+// NewDeviceScanner creates a scanner of the GPUs currently attached to the host
+func NewDeviceScanner(config *Config) (*DeviceScanner, error) {
+	s := &DeviceScanner{useFakeGPUs: config.UseFakeGPUs}
+
+	uuids, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	s.uuids = uuids
+
+	return s, nil
+}
+
+// Changed re-enumerates the GPUs and reports whether they differ from the previous scan
+func (s *DeviceScanner) Changed() (bool, error) {
+	uuids, err := s.scan()
+	if err != nil {
+		return false, err
+	}
+
+	if slices.Equal(uuids, s.uuids) {
+		return false, nil
+	}
+
+	s.uuids = uuids
+
+	return true, nil
+}
+
+// scan returns the sorted UUIDs of the GPUs attached to the host
+func (s *DeviceScanner) scan() ([]string, error) {
+	count, err := dcgmGetAllDeviceCount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the GPUs; err: %w", err)
+	}
+
+	uuids := make([]string, 0, count)
+	for i := uint(0); i < count; i++ {
+		device, err := dcgmGetDeviceInfo(i)
+		if err != nil {
+			if !s.useFakeGPUs {
+				return nil, fmt.Errorf("failed to get the info of GPU %d; err: %w", i, err)
+			}
+			device.UUID = fmt.Sprintf("fake%d", i)
+		}
+
+		uuids = append(uuids, device.UUID)
+	}
+
+	slices.Sort(uuids)
+
+	return uuids, nil
+}
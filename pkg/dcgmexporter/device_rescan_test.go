@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceScanner_Changed(t *testing.T) {
+	var uuids []string
+	var deviceInfoErr error
+
+	dcgmGetAllDeviceCount = func() (uint, error) {
+		return uint(len(uuids)), nil
+	}
+	dcgmGetDeviceInfo = func(gpuId uint) (dcgm.Device, error) {
+		return dcgm.Device{GPU: gpuId, UUID: uuids[gpuId]}, deviceInfoErr
+	}
+	defer func() {
+		dcgmGetAllDeviceCount = dcgm.GetAllDeviceCount
+		dcgmGetDeviceInfo = dcgm.GetDeviceInfo
+	}()
+
+	tests := []struct {
+		name        string
+		initial     []string
+		current     []string
+		infoErr     error
+		useFakeGPUs bool
+		changed     bool
+		wantErr     bool
+	}{
+		{
+			name:    "When the GPUs are the same",
+			initial: []string{"GPU-0", "GPU-1"},
+			current: []string{"GPU-0", "GPU-1"},
+		},
+		{
+			name:    "When the GPUs are enumerated in another order",
+			initial: []string{"GPU-0", "GPU-1"},
+			current: []string{"GPU-1", "GPU-0"},
+		},
+		{
+			name:    "When a GPU is added",
+			initial: []string{"GPU-0"},
+			current: []string{"GPU-0", "GPU-1"},
+			changed: true,
+		},
+		{
+			name:    "When a GPU is removed",
+			initial: []string{"GPU-0", "GPU-1"},
+			current: []string{"GPU-1"},
+			changed: true,
+		},
+		{
+			name:    "When a GPU is replaced",
+			initial: []string{"GPU-0"},
+			current: []string{"GPU-2"},
+			changed: true,
+		},
+		{
+			name:    "When the info of a GPU fails",
+			initial: []string{"GPU-0"},
+			current: []string{"GPU-0"},
+			infoErr: errors.New("boom"),
+			wantErr: true,
+		},
+		{
+			name:        "When the info of a fake GPU fails",
+			initial:     []string{"GPU-0", "GPU-1"},
+			current:     []string{"GPU-0"},
+			infoErr:     errors.New("boom"),
+			useFakeGPUs: true,
+			changed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uuids, deviceInfoErr = tt.initial, nil
+
+			scanner, err := NewDeviceScanner(&Config{UseFakeGPUs: tt.useFakeGPUs})
+			require.NoError(t, err)
+
+			uuids, deviceInfoErr = tt.current, tt.infoErr
+
+			changed, err := scanner.Changed()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.changed, changed)
+
+			changed, err = scanner.Changed()
+			require.NoError(t, err)
+			assert.False(t, changed, "a second scan of the same GPUs must not report a change")
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// parseDevices parses the GPUs of a counter restricted to a subset of the GPUs, indices and ranges of indices
+// separated by ';', e.g. "0;2-3". An empty subset is nil, the counter is then collected on every GPU.
+func parseDevices(devices string) ([]uint, error) {
+	if devices == "" {
+		return nil, nil
+	}
+
+	var res []uint
+	for _, part := range strings.Split(devices, ";") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+
+		from, err := strconv.ParseUint(strings.TrimSpace(first), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GPU index '%s'", part)
+		}
+
+		to := from
+		if isRange {
+			to, err = strconv.ParseUint(strings.TrimSpace(last), 10, 32)
+			if err != nil || to < from {
+				return nil, fmt.Errorf("invalid GPU range '%s'", part)
+			}
+		}
+
+		for i := from; i <= to; i++ {
+			if !slices.Contains(res, uint(i)) {
+				res = append(res, uint(i))
+			}
+		}
+	}
+
+	slices.Sort(res)
+
+	return res, nil
+}
+
+// validateDevices checks the GPU subset of the counter, only the counters collected on the GPUs can be restricted
+func validateDevices(fieldName string, fieldID dcgm.Short, scope, devices string) error {
+	if devices == "" {
+		return nil
+	}
+
+	if _, err := parseDevices(devices); err != nil {
+		return fmt.Errorf("counter '%s' has invalid devices; err: %w", fieldName, err)
+	}
+
+	entityType := counterScopes[scope]
+	if scope == "" {
+		entityType = dcgm.FieldGetById(fieldID).EntityLevel
+	}
+
+	switch entityType {
+	case dcgm.FE_GPU, dcgm.FE_GPU_I, dcgm.FE_GPU_CI, dcgm.FE_VGPU:
+		return nil
+	default:
+		return fmt.Errorf("counter '%s' isn't collected on the GPUs, it cannot be restricted to devices", fieldName)
+	}
+}
+
+// fieldDevices returns the GPUs watching each of the device fields that only counters restricted to a subset of the
+// GPUs request. The other fields are watched on every GPU and aren't in the result.
+func fieldDevices(counters []Counter, deviceFields []dcgm.Short) map[dcgm.Short][]uint {
+	res := map[dcgm.Short][]uint{}
+	var everywhere []dcgm.Short
+
+	for _, counter := range counters {
+		if !slices.Contains(deviceFields, counter.FieldID) || slices.Contains(everywhere, counter.FieldID) {
+			continue
+		}
+
+		// The devices were validated with the counters
+		devices, _ := parseDevices(counter.Devices)
+		if devices == nil {
+			everywhere = append(everywhere, counter.FieldID)
+			delete(res, counter.FieldID)
+			continue
+		}
+
+		for _, device := range devices {
+			if !slices.Contains(res[counter.FieldID], device) {
+				res[counter.FieldID] = append(res[counter.FieldID], device)
+			}
+		}
+		slices.Sort(res[counter.FieldID])
+	}
+
+	return res
+}
+
+// entityFields returns the device fields watched on the entity, given the GPUs watching the fields restricted to a
+// subset of the GPUs
+func entityFields(mi MonitoringInfo, deviceFields []dcgm.Short, devices map[dcgm.Short][]uint) []dcgm.Short {
+	res := []dcgm.Short{}
+	for _, field := range deviceFields {
+		subset, restricted := devices[field]
+		if !restricted || slices.Contains(subset, mi.DeviceInfo.GPU) {
+			res = append(res, field)
+		}
+	}
+
+	return res
+}
+
+// watchDeviceSubsets watches the fields restricted to a subset of the GPUs, with one group per distinct subset
+// holding the monitored entities of its GPUs
+func watchDeviceSubsets(devices map[dcgm.Short][]uint, sysInfo SystemInfo, updateFreqUsec int64, maxKeepAge float64,
+) ([]func(), error) {
+	subsets := map[string][]dcgm.Short{}
+	for field, gpus := range devices {
+		key := fmt.Sprint(gpus)
+		subsets[key] = append(subsets[key], field)
+	}
+
+	var cleanups []func()
+	for _, fields := range subsets {
+		gpus := devices[fields[0]]
+
+		var entities []MonitoringInfo
+		for _, mi := range GetMonitoredEntities(sysInfo) {
+			if slices.Contains(gpus, mi.DeviceInfo.GPU) {
+				entities = append(entities, mi)
+			}
+		}
+
+		if len(entities) == 0 {
+			logrus.Warnf("None of GPUs %v is monitored, fields %v are not watched", gpus, fields)
+			continue
+		}
+
+		group, cleanup, err := createGroupFromMonitoringInfo(entities)
+		cleanups = append(cleanups, cleanup)
+		if err != nil {
+			return cleanups, err
+		}
+
+		fieldGroup, cleanup, err := NewFieldGroup(fields)
+		if err != nil {
+			return cleanups, err
+		}
+		cleanups = append(cleanups, cleanup)
+
+		err = WatchFieldGroup(group, fieldGroup, updateFreqUsec, maxKeepAge, 1)
+		if err != nil {
+			return cleanups, err
+		}
+	}
+
+	return cleanups, nil
+}
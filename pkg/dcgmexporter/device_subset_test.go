@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices string
+		want    []uint
+		wantErr bool
+	}{
+		{
+			name:    "When the devices are empty, the counter isn't restricted",
+			devices: "",
+			want:    nil,
+		},
+		{
+			name:    "When indices and ranges are given, they are merged and sorted",
+			devices: "3;0-1; 1",
+			want:    []uint{0, 1, 3},
+		},
+		{
+			name:    "When an index isn't a number, it is an error",
+			devices: "0;gpu1",
+			wantErr: true,
+		},
+		{
+			name:    "When a range is reversed, it is an error",
+			devices: "3-1",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseDevices(tc.devices)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestFieldDevices(t *testing.T) {
+	fields := []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_UTIL, dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, dcgm.DCGM_FI_PROF_SM_ACTIVE}
+
+	tests := []struct {
+		name     string
+		counters []Counter
+		want     map[dcgm.Short][]uint
+	}{
+		{
+			name: "When no counter is restricted, every field is watched everywhere",
+			counters: []Counter{
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL},
+				{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE},
+			},
+			want: map[dcgm.Short][]uint{},
+		},
+		{
+			name: "When counters of a field are restricted, the field is watched on the union of their GPUs",
+			counters: []Counter{
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL},
+				{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, Devices: "2"},
+				{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, Devices: "0"},
+			},
+			want: map[dcgm.Short][]uint{dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE: {0, 2}},
+		},
+		{
+			name: "When another counter of the field isn't restricted, the field is watched everywhere",
+			counters: []Counter{
+				{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE, Devices: "0"},
+				{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE},
+				{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE, Devices: "1"},
+			},
+			want: map[dcgm.Short][]uint{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, fieldDevices(tc.counters, fields))
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsWithFieldDevices(t *testing.T) {
+	requested := map[uint][]dcgm.Short{}
+	dcgmEntityGetLatestValuesHook = func(_ dcgm.Field_Entity_Group, gpu uint, fields []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		requested[gpu] = fields
+
+		var values []dcgm.FieldValue_v1
+		for _, field := range fields {
+			values = append(values, dcgm.FieldValue_v1{FieldId: uint(field), FieldType: dcgm.DCGM_FT_INT64,
+				Value: int64FieldValue(1)})
+		}
+		return values, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-00000000"}
+	sysInfo.GPUs[1].DeviceInfo = dcgm.Device{GPU: 1, UUID: "GPU-11111111"}
+
+	util := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	engine := Counter{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE",
+		PromType: "gauge", Devices: "0"}
+
+	deviceFields := []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_UTIL, dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE}
+	c := &DCGMCollector{
+		Counters:     []Counter{util, engine},
+		DeviceFields: deviceFields,
+		SysInfo:      sysInfo,
+		FieldDevices: fieldDevices([]Counter{util, engine}, deviceFields),
+	}
+
+	metrics, err := c.GetMetrics()
+	require.NoError(t, err)
+
+	// The canary GPU reads both fields, the other GPU only the fields watched everywhere
+	assert.Equal(t, deviceFields, requested[0])
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_UTIL}, requested[1])
+
+	assert.Len(t, metrics[util], 2)
+	require.Len(t, metrics[engine], 1)
+	assert.Equal(t, "0", metrics[engine][0].GPU)
+}
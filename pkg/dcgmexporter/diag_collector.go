@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const diagTestLabel = "test"
+
+// diagResultLevels maps the status of a diagnostic test to the level reported by the DCGM_EXP_DIAG_RESULT counter,
+// the tests that were skipped or did not run are left out
+var diagResultLevels = map[string]int{
+	"pass": gpuHealthPass,
+	"warn": gpuHealthWarn,
+	"fail": gpuHealthFail,
+}
+
+var dcgmRunDiagHook = runDiag
+
+// IsDCGMExpDiagResultEnabled checks if the DCGM_EXP_DIAG_RESULT counter exists
+func IsDCGMExpDiagResultEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpDiagResult
+	})
+}
+
+// diagCollector runs the DCGM diagnostic of the monitored GPUs every Config.DiagInterval, in the background as it
+// lasts from seconds to hours depending on Config.DiagLevel, and reports the result of each test of the last run.
+type diagCollector struct {
+	expCollector
+
+	mtx     sync.Mutex
+	results map[uint][]dcgm.DiagResult // Results of the last run by GPU, nil until a run completes
+
+	stop chan struct{}
+}
+
+func NewDiagCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem,
+) (Collector, error) {
+	if !IsDCGMExpDiagResultEnabled(counters) {
+		logrus.Error(dcgmExpDiagResult + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpDiagResult + " collector is disabled")
+	}
+
+	if config.DiagLevel < int(dcgm.DiagQuick) || config.DiagLevel > int(dcgm.DiagExtended) {
+		return nil, fmt.Errorf("invalid diagnostic level %d, expected 1 to 4", config.DiagLevel)
+	}
+
+	if config.DiagInterval <= 0 {
+		return nil, fmt.Errorf("invalid diagnostic interval %d, expected a positive number of ms", config.DiagInterval)
+	}
+
+	collector := diagCollector{
+		expCollector: expCollector{
+			connection:      dcgmConnection.Load(),
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: getTransformations(config),
+		},
+		stop: make(chan struct{}),
+	}
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpDiagResult
+	})]
+
+	go collector.run(time.Duration(config.DiagInterval) * time.Millisecond)
+
+	return &collector, nil
+}
+
+// run runs the diagnostic right away, then at every interval until Cleanup
+func (c *diagCollector) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.runDiag()
+
+		// Cleanup may have been called during the run, it takes precedence over a pending tick
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *diagCollector) runDiag() {
+	var gpus []uint
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		// The diagnostic tests the physical GPUs, GPU instances share the result of their parent
+		if !slices.Contains(gpus, mi.DeviceInfo.GPU) {
+			gpus = append(gpus, mi.DeviceInfo.GPU)
+		}
+	}
+
+	logrus.Infof("Running the level %d diagnostic of GPUs %v", c.config.DiagLevel, gpus)
+	start := time.Now()
+
+	diag, err := dcgmRunDiagHook(dcgm.DiagType(c.config.DiagLevel), gpus)
+	if err != nil {
+		// The results of the previous run are kept, they are the latest known state of the GPUs
+		logrus.Warnf("Failed to run the diagnostic of GPUs %v; err: %v", gpus, err)
+		return
+	}
+
+	logrus.Infof("Diagnostic of GPUs %v completed in %s", gpus, time.Since(start))
+
+	results := make(map[uint][]dcgm.DiagResult, len(diag.PerGpu))
+	for _, gpu := range diag.PerGpu {
+		results[gpu.GPU] = gpu.DiagResults
+	}
+
+	c.mtx.Lock()
+	c.results = results
+	c.mtx.Unlock()
+}
+
+// runDiag runs the diagnostic on a group of the given GPUs, created for the run
+func runDiag(level dcgm.DiagType, gpus []uint) (dcgm.DiagResults, error) {
+	group, err := dcgmCreateGroup(fmt.Sprintf("diag-group-%d", rand.Uint64()))
+	if err != nil {
+		return dcgm.DiagResults{}, err
+	}
+
+	defer func() {
+		if err := dcgm.DestroyGroup(group); err != nil {
+			logrus.Warnf("Cannot destroy diagnostic group %v; err: %v", group, err)
+		}
+	}()
+
+	for _, gpu := range gpus {
+		if err := dcgmAddEntityToGroup(group, dcgm.FE_GPU, gpu); err != nil {
+			return dcgm.DiagResults{}, err
+		}
+	}
+
+	return dcgm.RunDiag(level, group)
+}
+
+func (c *diagCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	c.mtx.Lock()
+	results := c.results
+	c.mtx.Unlock()
+
+	metrics := make(MetricsByCounter)
+	var reported []uint
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		gpu := mi.DeviceInfo.GPU
+		if slices.Contains(reported, gpu) {
+			continue
+		}
+		reported = append(reported, gpu)
+
+		mi.InstanceInfo = nil
+		for _, result := range results[gpu] {
+			level, exists := diagResultLevels[result.Status]
+			if !exists {
+				continue
+			}
+
+			m := c.createMetric(map[string]string{diagTestLabel: result.TestName}, mi, uuid, level)
+			metrics[c.counter] = append(metrics[c.counter], m)
+		}
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
+
+// Cleanup stops the diagnostics without waiting for a diagnostic that is running, which can last for hours. That run
+// completes in the background, it destroys its own group and its results are discarded with the collector.
+func (c *diagCollector) Cleanup() {
+	close(c.stop)
+	c.expCollector.Cleanup()
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagCollector_GetMetrics(t *testing.T) {
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	counter := Counter{
+		FieldID:   dcgm.Short(DCGMDiagResult),
+		FieldName: dcgmExpDiagResult,
+		PromType:  "gauge",
+	}
+
+	tests := []struct {
+		name    string
+		results dcgm.DiagResults
+		err     error
+		want    map[string]string
+	}{
+		{
+			name: "When the diagnostic completes, every test that ran is reported",
+			results: dcgm.DiagResults{
+				PerGpu: []dcgm.GpuResult{
+					{GPU: 0, DiagResults: []dcgm.DiagResult{
+						{TestName: "Memory", Status: "pass"},
+						{TestName: "PCIe", Status: "warn"},
+						{TestName: "Diagnostic", Status: "skipped"},
+					}},
+					{GPU: 1, DiagResults: []dcgm.DiagResult{
+						{TestName: "Memory", Status: "fail"},
+						{TestName: "PCIe", Status: "notrun"},
+					}},
+				},
+			},
+			want: map[string]string{"0/Memory": "0", "0/PCIe": "1", "1/Memory": "2"},
+		},
+		{
+			name: "When the diagnostic fails, nothing is reported",
+			err:  errors.New("boom"),
+			want: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			runs := make(chan struct{}, 1)
+			dcgmRunDiagHook = func(level dcgm.DiagType, gpus []uint) (dcgm.DiagResults, error) {
+				defer func() { runs <- struct{}{} }()
+				assert.Equal(t, dcgm.DiagQuick, level)
+				assert.Equal(t, []uint{0, 1}, gpus)
+				return tc.results, tc.err
+			}
+			defer func() {
+				dcgmRunDiagHook = runDiag
+			}()
+
+			collector, err := NewDiagCollector([]Counter{counter}, "local-test",
+				&Config{DiagLevel: int(dcgm.DiagQuick), DiagInterval: int(time.Hour.Milliseconds())},
+				FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+			require.NoError(t, err)
+			defer collector.Cleanup()
+
+			select {
+			case <-runs:
+			case <-time.After(time.Second):
+				require.Fail(t, "the diagnostic did not run at startup")
+			}
+
+			// The run completes once the results are stored
+			require.Eventually(t, func() bool {
+				metrics, err := collector.GetMetrics()
+				require.NoError(t, err)
+				return len(metrics[counter]) == len(tc.want)
+			}, time.Second, 10*time.Millisecond)
+
+			metrics, err := collector.GetMetrics()
+			require.NoError(t, err)
+
+			got := map[string]string{}
+			for _, metric := range metrics[counter] {
+				assert.Equal(t, "local-test", metric.Hostname)
+				got[metric.GPU+"/"+metric.Labels[diagTestLabel]] = metric.Value
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewDiagCollector(t *testing.T) {
+	counters := []Counter{{FieldID: dcgm.Short(DCGMDiagResult), FieldName: dcgmExpDiagResult, PromType: "gauge"}}
+
+	tests := []struct {
+		name     string
+		counters []Counter
+		config   *Config
+	}{
+		{
+			name:     "When the counter isn't in the counters, the collector is disabled",
+			counters: []Counter{},
+			config:   &Config{DiagLevel: 1, DiagInterval: 1000},
+		},
+		{
+			name:     "When the level is unknown, the collector isn't created",
+			counters: counters,
+			config:   &Config{DiagLevel: 5, DiagInterval: 1000},
+		},
+		{
+			name:     "When the interval isn't positive, the collector isn't created",
+			counters: counters,
+			config:   &Config{DiagLevel: 1, DiagInterval: 0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDiagCollector(tc.counters, "", tc.config, FieldEntityGroupTypeSystemInfoItem{})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestDiagCollector_CleanupDoesNotWait(t *testing.T) {
+	counter := Counter{FieldID: dcgm.Short(DCGMDiagResult), FieldName: dcgmExpDiagResult, PromType: "gauge"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runs atomic.Int32
+	dcgmRunDiagHook = func(dcgm.DiagType, []uint) (dcgm.DiagResults, error) {
+		if runs.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return dcgm.DiagResults{}, nil
+	}
+	defer func() {
+		dcgmRunDiagHook = runDiag
+	}()
+
+	collector, err := NewDiagCollector([]Counter{counter}, "local-test",
+		&Config{DiagLevel: int(dcgm.DiagQuick), DiagInterval: 1},
+		FieldEntityGroupTypeSystemInfoItem{})
+	require.NoError(t, err)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		require.Fail(t, "the diagnostic did not run at startup")
+	}
+
+	cleaned := make(chan struct{})
+	go func() {
+		collector.Cleanup()
+		close(cleaned)
+	}()
+
+	select {
+	case <-cleaned:
+	case <-time.After(time.Second):
+		require.Fail(t, "Cleanup waited for the running diagnostic")
+	}
+
+	// The interval elapsed during the run, no diagnostic starts once the collector is cleaned up
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load())
+}
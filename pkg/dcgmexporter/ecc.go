@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+
+// Labels of the ECC error counters
+const (
+	eccTypeAttribute     = "ecc_type"
+	eccCounterAttribute  = "ecc_counter"
+	eccLocationAttribute = "ecc_location"
+)
+
+var (
+	eccTypes     = []string{"single_bit", "double_bit"}
+	eccCounters  = []string{"volatile", "aggregate"}
+	eccLocations = []string{"l1", "l2", "device", "register", "texture"}
+)
+
+// addECCAttributes labels the ECC error counters with their error type, counter and memory location.
+// DCGM lays them out as the single and double bit totals of the volatile then aggregate counters, followed by
+// the volatile then aggregate counters of every location, single bit first.
+func addECCAttributes(attrs map[string]string, fieldID dcgm.Short) {
+	if fieldID < dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL || fieldID > dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TEX {
+		return
+	}
+
+	offset := int(fieldID - dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL)
+	attrs[eccTypeAttribute] = eccTypes[offset%2]
+
+	if fieldID <= dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL {
+		attrs[eccCounterAttribute] = eccCounters[offset/2]
+		attrs[eccLocationAttribute] = "total"
+		return
+	}
+
+	offset -= 4
+	attrs[eccCounterAttribute] = eccCounters[offset/(2*len(eccLocations))]
+	attrs[eccLocationAttribute] = eccLocations[offset%(2*len(eccLocations))/2]
+}
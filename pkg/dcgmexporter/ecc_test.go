@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddECCAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		fieldID dcgm.Short
+		want    map[string]string
+	}{
+		{
+			name:    "When the field is the volatile single bit total",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL,
+			want:    map[string]string{"ecc_type": "single_bit", "ecc_counter": "volatile", "ecc_location": "total"},
+		},
+		{
+			name:    "When the field is the aggregate double bit total",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL,
+			want:    map[string]string{"ecc_type": "double_bit", "ecc_counter": "aggregate", "ecc_location": "total"},
+		},
+		{
+			name:    "When the field is the volatile double bit L1 counter",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_DBE_VOL_L1,
+			want:    map[string]string{"ecc_type": "double_bit", "ecc_counter": "volatile", "ecc_location": "l1"},
+		},
+		{
+			name:    "When the field is the volatile single bit texture counter",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TEX,
+			want:    map[string]string{"ecc_type": "single_bit", "ecc_counter": "volatile", "ecc_location": "texture"},
+		},
+		{
+			name:    "When the field is the aggregate single bit device memory counter",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_SBE_AGG_DEV,
+			want:    map[string]string{"ecc_type": "single_bit", "ecc_counter": "aggregate", "ecc_location": "device"},
+		},
+		{
+			name:    "When the field is the aggregate double bit texture counter",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TEX,
+			want:    map[string]string{"ecc_type": "double_bit", "ecc_counter": "aggregate", "ecc_location": "texture"},
+		},
+		{
+			name:    "When the field isn't an ECC counter, nothing is added",
+			fieldID: dcgm.DCGM_FI_DEV_ECC_PENDING,
+			want:    map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs := map[string]string{}
+			addECCAttributes(attrs, tc.fieldID)
+			assert.Equal(t, tc.want, attrs)
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsECCFields(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL, FieldName: "DCGM_FI_DEV_ECC_SBE_VOL_TOTAL", PromType: "counter"},
+		{FieldID: dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL, FieldName: "DCGM_FI_DEV_ECC_DBE_AGG_TOTAL", PromType: "counter"},
+		{FieldID: dcgm.DCGM_FI_DEV_ECC_SBE_VOL_L2, FieldName: "DCGM_FI_DEV_ECC_SBE_VOL_L2", PromType: "counter"},
+	}
+	values := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_ECC_SBE_VOL_TOTAL, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(12)},
+		{FieldId: dcgm.DCGM_FI_DEV_ECC_DBE_AGG_TOTAL, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(1 << 40)},
+		{FieldId: dcgm.DCGM_FI_DEV_ECC_SBE_VOL_L2, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_NOT_SUPPORTED)},
+	}
+
+	tests := []struct {
+		name         string
+		counter      Counter
+		want         []Metric
+		wantRendered string
+	}{
+		{
+			name:    "When a volatile single-bit total is reported, it is labeled with its ECC attributes",
+			counter: counters[0],
+			want: []Metric{{
+				Value:      "12",
+				Attributes: map[string]string{"ecc_type": "single_bit", "ecc_counter": "volatile", "ecc_location": "total"},
+			}},
+			wantRendered: "# TYPE DCGM_FI_DEV_ECC_SBE_VOL_TOTAL counter\n",
+		},
+		{
+			name:    "When an aggregate double-bit total exceeds 32 bits, it keeps its precision",
+			counter: counters[1],
+			want: []Metric{{
+				Value:      "1099511627776",
+				Attributes: map[string]string{"ecc_type": "double_bit", "ecc_counter": "aggregate", "ecc_location": "total"},
+			}},
+			wantRendered: `ecc_location="total",ecc_type="double_bit"} 1099511627776`,
+		},
+		{
+			name:    "When the GPU doesn't track a location, its counter is skipped",
+			counter: counters[2],
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, counters, values...)
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+
+			var got []Metric
+			for _, metric := range metrics[tc.counter] {
+				assert.Equal(t, "GPU-00000000", metric.GPUUUID)
+				got = append(got, Metric{Value: metric.Value, Attributes: metric.Attributes})
+			}
+			assert.Equal(t, tc.want, got)
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tc.wantRendered)
+		})
+	}
+}
@@ -31,17 +31,17 @@ import (
 
 var expMetricsFormat = `
 
-{{- range $counter, $metrics := . -}}
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{gpu="{{ $metric.GPU }}",{{ $metric.UUID }}="{{ $metric.GPUUUID }}",pci_bus_id="{{ $metric.GPUPCIBusID }}",device="{{ $metric.GPUDevice }}",modelName="{{ $metric.GPUModelName }}"{{if $metric.MigProfile}},GPU_I_PROFILE="{{ $metric.MigProfile }}",GPU_I_ID="{{ $metric.GPUInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{gpu="{{ escape $metric.GPU }}",{{ $metric.UUID }}="{{ escape $metric.GPUUUID }}",pci_bus_id="{{ escape $metric.GPUPCIBusID }}",device="{{ escape $metric.GPUDevice }}",modelName="{{ escape $metric.GPUModelName }}"{{if $metric.MigProfile}},GPU_I_PROFILE="{{ escape $metric.MigProfile }}",GPU_I_ID="{{ escape $metric.GPUInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 {{- range $k, $v := $metric.Attributes -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 
 } {{ $metric.Value -}}
@@ -55,12 +55,11 @@ type Collector interface {
 }
 
 var getExpMetricTemplate = sync.OnceValue(func() *template.Template {
-	return template.Must(template.New("expMetrics").Parse(expMetricsFormat))
+	return template.Must(template.New("expMetrics").Funcs(templateFuncs).Parse(expMetricsFormat))
 })
 
 func encodeExpMetrics(w io.Writer, metrics MetricsByCounter) error {
-	tmpl := getExpMetricTemplate()
-	return tmpl.Execute(w, metrics)
+	return FormatMetricsTo(w, getExpMetricTemplate(), metrics)
 }
 
 var expCollectorFieldGroupIdx atomic.Uint32
@@ -74,6 +73,7 @@ type expCollector struct {
 	counterDeviceFields []dcgm.Short                   // Fields used for the counter
 	labelsCounters      []Counter                      // Counters used for labels
 	cleanups            []func()                       // Cleanup functions
+	connection          uint64                         // Connection to DCGM of the cleanups, see staleConnection
 	fieldValueParser    func(val int64) []int64        // Function to parse the field value
 	labelFiller         func(map[string]string, int64) // Function to fill labels
 	windowSize          int                            // Window size
@@ -208,6 +208,10 @@ func (c *expCollector) getLabelsFromCounters(mi MonitoringInfo, labels map[strin
 }
 
 func (c *expCollector) Cleanup() {
+	if staleConnection(c.connection) {
+		return
+	}
+
 	for _, cleanup := range c.cleanups {
 		cleanup()
 	}
@@ -233,6 +237,7 @@ func newExpCollector(
 	transformations := getTransformations(config)
 
 	collector := expCollector{
+		connection:          dcgmConnection.Load(),
 		hostname:            hostname,
 		config:              config,
 		labelDeviceFields:   labelDeviceFields,
@@ -249,9 +254,11 @@ func newExpCollector(
 
 	var err error
 
+	updateFreq, maxKeepAge := watchParams(config, collector.sysInfo.InfoType)
 	collector.deviceGroups, collector.deviceFieldGroup, collector.cleanups, err = SetupDcgmFieldsWatch(collector.counterDeviceFields,
 		collector.sysInfo,
-		int64(config.CollectInterval)*1000)
+		updateFreq,
+		maxKeepAge)
 	if err != nil {
 		logrus.Fatal("Failed to watch metrics: ", err)
 	}
@@ -19,16 +19,24 @@ package dcgmexporter
 import "fmt"
 
 const (
-	dcgmExpClockEventsCount = "DCGM_EXP_CLOCK_EVENTS_COUNT"
-	dcgmExpXIDErrorsCount   = "DCGM_EXP_XID_ERRORS_COUNT"
+	dcgmExpClockEventsCount     = "DCGM_EXP_CLOCK_EVENTS_COUNT"
+	dcgmExpXIDErrorsCount       = "DCGM_EXP_XID_ERRORS_COUNT"
+	dcgmExpGPUHealth            = "DCGM_EXP_GPU_HEALTH"
+	dcgmExpXIDErrorsTotal       = "DCGM_EXP_XID_ERRORS_TOTAL"
+	dcgmExpClockThrottleReasons = "DCGM_EXP_CLOCK_THROTTLE_REASONS"
+	dcgmExpDiagResult           = "DCGM_EXP_DIAG_RESULT"
 )
 
 type ExporterCounter uint16
 
 const (
-	DCGMFIUnknown        ExporterCounter = 0
-	DCGMXIDErrorsCount   ExporterCounter = iota + 9000
-	DCGMClockEventsCount ExporterCounter = iota + 9000
+	DCGMFIUnknown            ExporterCounter = 0
+	DCGMXIDErrorsCount       ExporterCounter = iota + 9000
+	DCGMClockEventsCount     ExporterCounter = iota + 9000
+	DCGMGPUHealth            ExporterCounter = iota + 9000
+	DCGMXIDErrorsTotal       ExporterCounter = iota + 9000
+	DCGMClockThrottleReasons ExporterCounter = iota + 9000
+	DCGMDiagResult           ExporterCounter = iota + 9000
 )
 
 // String method to convert the enum value to a string
@@ -38,6 +46,14 @@ func (enm ExporterCounter) String() string {
 		return dcgmExpXIDErrorsCount
 	case DCGMClockEventsCount:
 		return dcgmExpClockEventsCount
+	case DCGMGPUHealth:
+		return dcgmExpGPUHealth
+	case DCGMXIDErrorsTotal:
+		return dcgmExpXIDErrorsTotal
+	case DCGMClockThrottleReasons:
+		return dcgmExpClockThrottleReasons
+	case DCGMDiagResult:
+		return dcgmExpDiagResult
 	default:
 		return "DCGM_FI_UNKNOWN"
 	}
@@ -45,9 +61,13 @@ func (enm ExporterCounter) String() string {
 
 // DCGMFields maps DCGMExporterMetric String to enum
 var DCGMFields = map[string]ExporterCounter{
-	DCGMXIDErrorsCount.String():   DCGMXIDErrorsCount,
-	DCGMClockEventsCount.String(): DCGMClockEventsCount,
-	DCGMFIUnknown.String():        DCGMFIUnknown,
+	DCGMXIDErrorsCount.String():       DCGMXIDErrorsCount,
+	DCGMClockEventsCount.String():     DCGMClockEventsCount,
+	DCGMGPUHealth.String():            DCGMGPUHealth,
+	DCGMXIDErrorsTotal.String():       DCGMXIDErrorsTotal,
+	DCGMClockThrottleReasons.String(): DCGMClockThrottleReasons,
+	DCGMDiagResult.String():           DCGMDiagResult,
+	DCGMFIUnknown.String():            DCGMFIUnknown,
 }
 
 func IdentifyMetricType(s string) (ExporterCounter, error) {
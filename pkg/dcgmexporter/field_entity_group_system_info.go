@@ -43,6 +43,7 @@ func (f FieldEntityGroupTypeSystemInfoItem) isEmpty() bool {
 // FieldEntityGroupTypeSystemInfo represents a mapping between FieldEntityGroupType and SystemInfo
 type FieldEntityGroupTypeSystemInfo struct {
 	items         map[dcgm.Field_Entity_Group]FieldEntityGroupTypeSystemInfoItem
+	loadErrors    map[dcgm.Field_Entity_Group]error
 	counters      []Counter
 	gpuDevices    DeviceOptions
 	switchDevices DeviceOptions
@@ -54,6 +55,7 @@ type FieldEntityGroupTypeSystemInfo struct {
 func NewEntityGroupTypeSystemInfo(c []Counter, config *Config) *FieldEntityGroupTypeSystemInfo {
 	return &FieldEntityGroupTypeSystemInfo{
 		items:         make(map[dcgm.Field_Entity_Group]FieldEntityGroupTypeSystemInfoItem),
+		loadErrors:    make(map[dcgm.Field_Entity_Group]error),
 		counters:      c,
 		gpuDevices:    config.GPUDevices,
 		switchDevices: config.SwitchDevices,
@@ -77,6 +79,8 @@ func (e *FieldEntityGroupTypeSystemInfo) Load(entityType dcgm.Field_Entity_Group
 		UseFakeGPUs:   e.useFakeGPUs,
 	}, entityType)
 	if err != nil {
+		// Entities with fields to watch but without system info are reported as unavailable by the pipeline
+		e.loadErrors[entityType] = err
 		return err
 	}
 
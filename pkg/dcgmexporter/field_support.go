@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+var dcgmUpdateAllFieldsHook = dcgm.UpdateAllFields
+
+// isNotSupported reports whether DCGM reports the field as not supported by the entity, as opposed to a field
+// without value yet
+func isNotSupported(val dcgm.FieldValue_v1) bool {
+	if val.Status == dcgm.DCGM_ST_NOT_SUPPORTED {
+		return true
+	}
+
+	switch val.FieldType {
+	case dcgm.DCGM_FT_INT64:
+		v := val.Int64()
+		return v == dcgm.DCGM_FT_INT64_NOT_SUPPORTED || v == dcgm.DCGM_FT_INT32_NOT_SUPPORTED
+	case dcgm.DCGM_FT_DOUBLE:
+		return val.Float64() == dcgm.DCGM_FT_FP64_NOT_SUPPORTED
+	case dcgm.DCGM_FT_STRING:
+		return val.String() == dcgm.DCGM_FT_STR_NOT_SUPPORTED
+	}
+
+	return false
+}
+
+// dropUnsupportedFields samples the watched fields once and stops collecting on every entity the fields it doesn't
+// support, see Config.FieldPreflight. The counters of the other fields, and of the same fields on the entities
+// supporting them, are collected as usual. An entity whose fields can't be sampled keeps all of them.
+func (c *DCGMCollector) dropUnsupportedFields() {
+	if err := dcgmUpdateAllFieldsHook(); err != nil {
+		logrus.Warnf("Failed to sample the fields, the unsupported fields are not dropped; err: %v", err)
+		return
+	}
+
+	for i, entity := range c.monitoredEntities() {
+		fields := entity.fields
+		if fields == nil {
+			fields = c.DeviceFields
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		vals, err := dcgmEntityGetLatestValuesHook(entity.Entity.EntityGroupId, entity.Entity.EntityId, fields)
+		if err != nil {
+			logrus.Warnf("Failed to sample the fields of %s, its unsupported fields are not dropped; err: %v",
+				entityName(entity.MonitoringInfo), err)
+			continue
+		}
+
+		var unsupported []dcgm.Short
+		for _, val := range vals {
+			if isNotSupported(val) {
+				unsupported = append(unsupported, dcgm.Short(val.FieldId))
+			}
+		}
+		if len(unsupported) == 0 {
+			continue
+		}
+
+		c.entities[i].fields = slices.DeleteFunc(slices.Clone(fields), func(field dcgm.Short) bool {
+			return slices.Contains(unsupported, field)
+		})
+
+		var dropped []string
+		for _, counter := range c.Counters {
+			if slices.Contains(unsupported, counter.FieldID) {
+				dropped = append(dropped, counter.FieldName)
+			}
+		}
+		logrus.Infof("%s doesn't support the fields of counters %v, they are not collected on it",
+			entityName(entity.MonitoringInfo), dropped)
+	}
+}
+
+// entityName describes the GPU or GPU instance in the logs
+func entityName(mi MonitoringInfo) string {
+	if mi.InstanceInfo != nil {
+		return fmt.Sprintf("GPU %d instance %d", mi.DeviceInfo.GPU, mi.InstanceInfo.Info.NvmlInstanceId)
+	}
+
+	return fmt.Sprintf("GPU %d", mi.DeviceInfo.GPU)
+}
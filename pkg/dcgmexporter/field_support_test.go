@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNotSupported(t *testing.T) {
+	stringValue := func(v string) [4096]byte {
+		var b [4096]byte
+		copy(b[:], v)
+		return b
+	}
+
+	tests := []struct {
+		name string
+		val  dcgm.FieldValue_v1
+		want bool
+	}{
+		{
+			name: "When the integer value is the not supported sentinel, the field is not supported",
+			val:  dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_NOT_SUPPORTED)},
+			want: true,
+		},
+		{
+			name: "When the double value is the not supported sentinel, the field is not supported",
+			val:  dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(dcgm.DCGM_FT_FP64_NOT_SUPPORTED)},
+			want: true,
+		},
+		{
+			name: "When the string value is the not supported sentinel, the field is not supported",
+			val:  dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_STRING, Value: stringValue(dcgm.DCGM_FT_STR_NOT_SUPPORTED)},
+			want: true,
+		},
+		{
+			name: "When the status is not supported, the field is not supported",
+			val:  dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Status: dcgm.DCGM_ST_NOT_SUPPORTED},
+			want: true,
+		},
+		{
+			name: "When the value is blank, the field is supported but has no value yet",
+			val:  dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)},
+		},
+		{
+			name: "When the field has a value, it is supported",
+			val:  dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isNotSupported(tc.val))
+		})
+	}
+}
+
+func TestDCGMCollector_DropUnsupportedFields(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_MEMORY_TEMP, FieldName: "DCGM_FI_DEV_MEMORY_TEMP", PromType: "gauge"},
+	}
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-00000000"}
+	sysInfo.GPUs[1].DeviceInfo = dcgm.Device{GPU: 1, UUID: "GPU-11111111"}
+
+	// GPU 1 is of an older generation without memory temperature
+	latestValues := func(_ dcgm.Field_Entity_Group, gpu uint, fields []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		var res []dcgm.FieldValue_v1
+		for _, field := range fields {
+			value := int64FieldValue(40)
+			if field == dcgm.DCGM_FI_DEV_MEMORY_TEMP && gpu == 1 {
+				value = int64FieldValue(dcgm.DCGM_FT_INT64_NOT_SUPPORTED)
+			}
+			res = append(res, dcgm.FieldValue_v1{FieldId: uint(field), FieldType: dcgm.DCGM_FT_INT64, Value: value})
+		}
+		return res, nil
+	}
+
+	tests := []struct {
+		name         string
+		updateErr    error
+		wantGPUs     map[string][]string
+		wantRequests map[uint][]dcgm.Short
+	}{
+		{
+			name: "When a GPU doesn't support a field, its counters are not collected on that GPU only",
+			wantGPUs: map[string][]string{
+				"DCGM_FI_DEV_GPU_TEMP":    {"0", "1"},
+				"DCGM_FI_DEV_MEMORY_TEMP": {"0"},
+			},
+			wantRequests: map[uint][]dcgm.Short{
+				0: {dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_MEMORY_TEMP},
+				1: {dcgm.DCGM_FI_DEV_GPU_TEMP},
+			},
+		},
+		{
+			name:      "When the fields can't be sampled, they are all kept",
+			updateErr: errors.New("host engine unreachable"),
+			wantGPUs: map[string][]string{
+				"DCGM_FI_DEV_GPU_TEMP":    {"0", "1"},
+				"DCGM_FI_DEV_MEMORY_TEMP": {"0"},
+			},
+			wantRequests: map[uint][]dcgm.Short{
+				0: {dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_MEMORY_TEMP},
+				1: {dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_MEMORY_TEMP},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dcgmUpdateAllFieldsHook = func() error { return tc.updateErr }
+			dcgmEntityGetLatestValuesHook = latestValues
+			defer func() {
+				dcgmUpdateAllFieldsHook = dcgm.UpdateAllFields
+				dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+			}()
+
+			c := &DCGMCollector{
+				Counters:     counters,
+				DeviceFields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_MEMORY_TEMP},
+				SysInfo:      sysInfo,
+			}
+			c.dropUnsupportedFields()
+
+			requests := map[uint][]dcgm.Short{}
+			dcgmEntityGetLatestValuesHook = func(group dcgm.Field_Entity_Group, gpu uint, fields []dcgm.Short,
+			) ([]dcgm.FieldValue_v1, error) {
+				requests[gpu] = fields
+				return latestValues(group, gpu, fields)
+			}
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRequests, requests)
+
+			gpus := map[string][]string{}
+			for counter, values := range metrics {
+				for _, metric := range values {
+					gpus[counter.FieldName] = append(gpus[counter.FieldName], metric.GPU)
+				}
+			}
+			assert.Equal(t, tc.wantGPUs, gpus)
+		})
+	}
+}
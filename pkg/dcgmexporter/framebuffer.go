@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// framebufferFields break the framebuffer down into its used, free and reserved memory, which add up to its total
+var framebufferFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_FB_USED,
+	dcgm.DCGM_FI_DEV_FB_FREE,
+	dcgm.DCGM_FI_DEV_FB_RESERVED,
+}
+
+// withFramebufferFields adds the missing framebuffer fields to the device fields requesting one of them. DCGM then
+// updates the whole breakdown together, so its parts always come from the same sample.
+func withFramebufferFields(deviceFields []dcgm.Short) []dcgm.Short {
+	if !slices.ContainsFunc(deviceFields, isFramebufferField) {
+		return deviceFields
+	}
+
+	for _, field := range framebufferFields {
+		if !slices.Contains(deviceFields, field) {
+			deviceFields = append(deviceFields, field)
+		}
+	}
+
+	return deviceFields
+}
+
+func isFramebufferField(fieldID dcgm.Short) bool {
+	return slices.Contains(framebufferFields, fieldID)
+}
+
+// framebufferTimestamp returns the timestamp shared by the framebuffer series, the one of their newest sample, so
+// the parts of the breakdown add up to the total when they are queried at the same time. It is 0 without them.
+func framebufferTimestamp(values []dcgm.FieldValue_v1) int64 {
+	var res int64
+	for _, val := range values {
+		if isFramebufferField(dcgm.Short(val.FieldId)) {
+			res = max(res, val.Ts)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFramebufferFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []dcgm.Short
+		want   []dcgm.Short
+	}{
+		{
+			name:   "When no framebuffer field is requested, the fields are unchanged",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP},
+			want:   []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP},
+		},
+		{
+			name:   "When a framebuffer field is requested, the whole breakdown is watched",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_FB_FREE},
+			want: []dcgm.Short{
+				dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_FB_FREE, dcgm.DCGM_FI_DEV_FB_USED, dcgm.DCGM_FI_DEV_FB_RESERVED,
+			},
+		},
+		{
+			name:   "When the whole breakdown is requested, the fields are unchanged",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_FB_RESERVED, dcgm.DCGM_FI_DEV_FB_USED, dcgm.DCGM_FI_DEV_FB_FREE},
+			want:   []dcgm.Short{dcgm.DCGM_FI_DEV_FB_RESERVED, dcgm.DCGM_FI_DEV_FB_USED, dcgm.DCGM_FI_DEV_FB_FREE},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, withFramebufferFields(tc.fields))
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsFramebufferFields(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_FB_USED, FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_FB_FREE, FieldName: "DCGM_FI_DEV_FB_FREE", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_FB_RESERVED, FieldName: "DCGM_FI_DEV_FB_RESERVED", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+	}
+	values := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_FB_USED, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(1024), Ts: 2_000_000},
+		{FieldId: dcgm.DCGM_FI_DEV_FB_FREE, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(79000), Ts: 3_000_000},
+		{FieldId: dcgm.DCGM_FI_DEV_FB_RESERVED, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(512), Ts: 1_000_000},
+		{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(40), Ts: 1_000_000},
+	}
+
+	tests := []struct {
+		name          string
+		counter       Counter
+		wantValue     string
+		wantTimestamp string
+		wantRendered  string
+	}{
+		{
+			name:          "When the used framebuffer is sampled, it has the timestamp of the newest sample of the breakdown",
+			counter:       counters[0],
+			wantValue:     "1024",
+			wantTimestamp: "3000",
+			wantRendered:  `DCGM_FI_DEV_FB_USED{gpu="0",UUID="GPU-00000000",pci_bus_id="",device="nvidia0",modelName=""} 1024 3000`,
+		},
+		{
+			name:          "When the free framebuffer is the newest sample, it keeps its timestamp",
+			counter:       counters[1],
+			wantValue:     "79000",
+			wantTimestamp: "3000",
+			wantRendered:  `DCGM_FI_DEV_FB_FREE{gpu="0",UUID="GPU-00000000",pci_bus_id="",device="nvidia0",modelName=""} 79000 3000`,
+		},
+		{
+			name:          "When the reserved framebuffer isn't requested, it is watched and exported with the breakdown",
+			counter:       counters[2],
+			wantValue:     "512",
+			wantTimestamp: "3000",
+			wantRendered:  `DCGM_FI_DEV_FB_RESERVED{gpu="0",UUID="GPU-00000000",pci_bus_id="",device="nvidia0",modelName=""} 512 3000`,
+		},
+		{
+			name:          "When the field isn't a framebuffer field, it keeps the timestamp of its sample",
+			counter:       counters[3],
+			wantValue:     "40",
+			wantTimestamp: "1000",
+			wantRendered:  `DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-00000000",pci_bus_id="",device="nvidia0",modelName=""} 40 1000`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, counters, values...)
+			c.DeviceFields = withFramebufferFields([]dcgm.Short{dcgm.DCGM_FI_DEV_FB_USED, dcgm.DCGM_FI_DEV_GPU_TEMP})
+			c.UseSampleTimestamp = true
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+
+			require.Len(t, metrics[tc.counter], 1)
+			metric := metrics[tc.counter][0]
+			assert.Equal(t, tc.wantValue, metric.Value)
+			assert.Equal(t, "GPU-00000000", metric.GPUUUID)
+			assert.Equal(t, tc.wantTimestamp, metric.Timestamp)
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tc.wantRendered)
+		})
+	}
+}
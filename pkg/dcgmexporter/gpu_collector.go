@@ -17,8 +17,10 @@
 package dcgmexporter
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -31,6 +33,29 @@ const unknownErr = "Unknown Error"
 type DCGMCollectorConstructor func([]Counter, string, *Config, FieldEntityGroupTypeSystemInfoItem) (*DCGMCollector,
 	func(), error)
 
+// CollectorConstructor creates the collector of the entities of the item for the MetricsPipeline
+type CollectorConstructor func([]Counter, string, *Config, FieldEntityGroupTypeSystemInfoItem) (EntityCollector,
+	func(), error)
+
+// Entity returns the CollectorConstructor creating the DCGM collectors with the constructor
+func (newDCGMCollector DCGMCollectorConstructor) Entity() CollectorConstructor {
+	return func(c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+	) (EntityCollector, func(), error) {
+		collector, cleanup, err := newDCGMCollector(c, hostname, config, item)
+		// A nil *DCGMCollector would make a non-nil EntityCollector
+		if collector == nil {
+			return nil, cleanup, err
+		}
+		return collector, cleanup, err
+	}
+}
+
+// NewDCGMEntityCollector is the default CollectorConstructor of the pipeline, which collects the entities with DCGM
+func NewDCGMEntityCollector(c []Counter, hostname string, config *Config, item FieldEntityGroupTypeSystemInfoItem,
+) (EntityCollector, func(), error) {
+	return DCGMCollectorConstructor(NewDCGMCollector).Entity()(c, hostname, config, item)
+}
+
 func NewDCGMCollector(
 	c []Counter,
 	hostname string,
@@ -42,6 +67,7 @@ func NewDCGMCollector(
 	}
 
 	collector := &DCGMCollector{
+		Connection:   dcgmConnection.Load(),
 		Counters:     c,
 		DeviceFields: fieldEntityGroupTypeSystemInfo.DeviceFields,
 		SysInfo:      fieldEntityGroupTypeSystemInfo.SystemInfo,
@@ -55,15 +81,90 @@ func NewDCGMCollector(
 
 	collector.UseOldNamespace = config.UseOldNamespace
 	collector.ReplaceBlanksInModelName = config.ReplaceBlanksInModelName
+	collector.UseSampleTimestamp = config.UseSampleTimestamp
+
+	if config.EnableTopologyLabels && collector.SysInfo.InfoType == dcgm.FE_GPU {
+		collector.NUMANodes = getNUMANodes(collector.SysInfo)
+	}
+
+	collector.DriverLabels = config.EnableDriverLabels && collector.SysInfo.InfoType == dcgm.FE_GPU
+	collector.CPUAffinityLabel = config.EnableCPUAffinityLabel && collector.SysInfo.InfoType == dcgm.FE_GPU
+	collector.MissingValue = missingValue(config)
+
+	utilizationCounter := Counter{}
+	switch {
+	case collector.SysInfo.InfoType == dcgm.FE_LINK && hasNVLinkThroughputField(collector.DeviceFields):
+		utilizationCounter = nvlinkUtilizationCounter
+	case collector.SysInfo.InfoType == dcgm.FE_GPU && hasGPUNVLinkBandwidthField(collector.DeviceFields):
+		utilizationCounter = gpuNVLinkUtilizationCounter
+	}
+	if utilizationCounter.FieldName != "" {
+		collector.NVLinkBandwidth = hostNVLinkBandwidth()
+		if collector.NVLinkBandwidth == 0 {
+			logrus.Warnf("NVLink bandwidth unknown, none of the GPU models is known; %s is skipped",
+				utilizationCounter.FieldName)
+		}
+	}
+
+	// Only this collector's copy of the system info monitors the compute instances, and so watches their fields
+	if config.EnableComputeInstanceMetrics && collector.SysInfo.InfoType == dcgm.FE_GPU {
+		collector.SysInfo.monitorComputeInstances = true
+	}
+
+	// The vGPU fields are collected on the vGPU instances by the vGPU collector
+	if config.EnableVGPU && collector.SysInfo.InfoType == dcgm.FE_GPU {
+		collector.DeviceFields = slices.DeleteFunc(slices.Clone(collector.DeviceFields), isVGPUField)
+	}
+
+	if collector.SysInfo.InfoType == dcgm.FE_GPU {
+		if devices := fieldDevices(c, collector.DeviceFields); len(devices) > 0 {
+			collector.FieldDevices = devices
+		}
+	}
+
+	// The monitored entities and their metadata don't change for the lifetime of the collector
+	collector.monitoredEntities()
+
+	// The fields restricted to a subset of the GPUs are watched on those GPUs only
+	var watchedEverywhere []dcgm.Short
+	for _, field := range collector.DeviceFields {
+		if _, restricted := collector.FieldDevices[field]; !restricted {
+			watchedEverywhere = append(watchedEverywhere, field)
+		}
+	}
 
-	_, _, cleanups, err := SetupDcgmFieldsWatch(collector.DeviceFields,
-		fieldEntityGroupTypeSystemInfo.SystemInfo,
-		int64(config.CollectInterval)*1000)
+	updateFreq, maxKeepAge := watchParams(config, collector.SysInfo.InfoType)
+	if len(watchedEverywhere) > 0 {
+		_, _, cleanups, err := SetupDcgmFieldsWatch(watchedEverywhere,
+			collector.SysInfo,
+			updateFreq,
+			maxKeepAge)
+		if err != nil {
+			logrus.Fatal("Failed to watch metrics: ", err)
+		}
+
+		collector.Cleanups = cleanups
+	}
+
+	cleanups, err := watchDeviceSubsets(collector.FieldDevices, collector.SysInfo, updateFreq, maxKeepAge)
+	collector.Cleanups = append(collector.Cleanups, cleanups...)
 	if err != nil {
 		logrus.Fatal("Failed to watch metrics: ", err)
 	}
 
-	collector.Cleanups = cleanups
+	// The sampled fields are also watched at the sampling interval, keeping the samples between two collections
+	if fields := sampledFields(c, collector.DeviceFields); len(fields) > 0 && collector.SysInfo.InfoType == dcgm.FE_GPU {
+		sampling, cleanups, err := watchSampledFields(fields, collector.SysInfo, config)
+		collector.Cleanups = append(collector.Cleanups, cleanups...)
+		if err != nil {
+			logrus.Fatal("Failed to watch the sampled metrics: ", err)
+		}
+		collector.sampling = sampling
+	}
+
+	if config.FieldPreflight && collector.SysInfo.InfoType == dcgm.FE_GPU {
+		collector.dropUnsupportedFields()
+	}
 
 	return collector, func() { collector.Cleanup() }, nil
 }
@@ -72,6 +173,7 @@ func GetSystemInfo(config *Config, entityType dcgm.Field_Entity_Group) (*SystemI
 	sysInfo, err := InitializeSystemInfo(config.GPUDevices,
 		config.SwitchDevices,
 		config.CPUDevices,
+		config.DeviceFilter,
 		config.UseFakeGPUs, entityType)
 	if err != nil {
 		return nil, err
@@ -79,71 +181,172 @@ func GetSystemInfo(config *Config, entityType dcgm.Field_Entity_Group) (*SystemI
 	return &sysInfo, err
 }
 
+// GetHostname returns the value of the Hostname label from Config.HostnameSource, or an empty string with
+// Config.NoHostname. A source without value is an error.
 func GetHostname(config *Config) (string, error) {
-	hostname := ""
-	var err error
-	if !config.NoHostname {
-		if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
-			hostname = nodeName
-		} else {
+	if config.NoHostname {
+		return "", nil
+	}
+
+	var (
+		hostname string
+		err      error
+	)
+	source := cmp.Or(config.HostnameSource, HostnameSourceAuto)
+	switch source {
+	case HostnameSourceAuto:
+		hostname = os.Getenv("NODE_NAME")
+		if hostname == "" {
 			hostname, err = os.Hostname()
-			if err != nil {
-				return "", err
-			}
 		}
+	case HostnameSourceOS:
+		hostname, err = os.Hostname()
+	case HostnameSourceNodeName:
+		hostname = os.Getenv("NODE_NAME")
+	case HostnameSourceFixed:
+		hostname = config.FixedHostname
+	default:
+		return "", fmt.Errorf("unknown hostname source '%s'", source)
+	}
+	if err != nil {
+		return "", err
 	}
+
+	if hostname == "" {
+		return "", fmt.Errorf("hostname source '%s' yields an empty hostname", source)
+	}
+
 	return hostname, nil
 }
 
 func (c *DCGMCollector) Cleanup() {
+	if staleConnection(c.Connection) {
+		return
+	}
+
 	for _, c := range c.Cleanups {
 		c()
 	}
 }
 
-func (c *DCGMCollector) GetMetrics() (MetricsByCounter, error) {
-	monitoringInfo := GetMonitoredEntities(c.SysInfo)
+// monitoredEntities returns the entities monitored by the collector with the metadata of the GPU ones.
+// They are derived from SysInfo on the first call only, every collection reuses them.
+func (c *DCGMCollector) monitoredEntities() []monitoredEntity {
+	if c.entities != nil {
+		return c.entities
+	}
 
+	c.entities = []monitoredEntity{}
+	for _, mi := range GetMonitoredEntities(c.SysInfo) {
+		entity := monitoredEntity{MonitoringInfo: mi}
+		if c.FieldDevices != nil {
+			entity.fields = entityFields(mi, c.DeviceFields, c.FieldDevices)
+		}
+		if c.SysInfo.InfoType == dcgm.FE_GPU {
+			entity.metadata = newGPUMetadata(mi.DeviceInfo, mi.InstanceInfo, mi.ComputeInstanceInfo,
+				c.ReplaceBlanksInModelName)
+
+			// The versions were read from DCGM along with the device info when the system info was initialized
+			if c.DriverLabels {
+				entity.metadata.DriverVersion = mi.DeviceInfo.Identifiers.DriverVersion
+				entity.metadata.VBIOSVersion = mi.DeviceInfo.Identifiers.Vbios
+			}
+
+			// So is the affinity, which doesn't change while the GPU is attached
+			if c.CPUAffinityLabel {
+				entity.metadata.CPUAffinity = cpuList(mi.DeviceInfo.CPUAffinity)
+			}
+		}
+		c.entities = append(c.entities, entity)
+	}
+
+	return c.entities
+}
+
+// SystemInfo returns the entities monitored by the collector
+func (c *DCGMCollector) SystemInfo() SystemInfo {
+	return c.SysInfo
+}
+
+func (c *DCGMCollector) GetMetrics() (MetricsByCounter, error) {
 	metrics := make(MetricsByCounter)
 
-	for _, mi := range monitoringInfo {
+	var samples map[string][]float64
+	if c.sampling != nil {
+		samples = c.readSamples()
+	}
+
+	for _, entity := range c.monitoredEntities() {
+		mi := entity.MonitoringInfo
+
+		fields := c.DeviceFields
+		if entity.fields != nil {
+			// None of the fields is watched on the entity when they are all restricted to other GPUs
+			if len(entity.fields) == 0 {
+				continue
+			}
+			fields = entity.fields
+		}
+
 		var vals []dcgm.FieldValue_v1
 		var err error
 		if mi.Entity.EntityGroupId == dcgm.FE_LINK {
-			vals, err = dcgm.LinkGetLatestValues(mi.Entity.EntityId, mi.ParentId, c.DeviceFields)
+			vals, err = dcgm.LinkGetLatestValues(mi.Entity.EntityId, mi.ParentId, fields)
 		} else {
-			vals, err = dcgm.EntityGetLatestValues(mi.Entity.EntityGroupId, mi.Entity.EntityId, c.DeviceFields)
+			vals, err = dcgmEntityGetLatestValuesHook(mi.Entity.EntityGroupId, mi.Entity.EntityId, fields)
 		}
 
 		if err != nil {
-			if derr, ok := err.(*dcgm.DcgmError); ok {
-				if derr.Code == dcgm.DCGM_ST_CONNECTION_NOT_VALID {
-					logrus.Fatal("Could not retrieve metrics: ", err)
-				}
+			// The collection fails until the hostengine is back, which reports the collector down
+			if isConnectionLost(err) {
+				return nil, fmt.Errorf("lost the connection to the hostengine; err: %w", err)
 			}
 			return nil, err
 		}
 
+		counts := c.sampledCounts(metrics)
+
 		// InstanceInfo will be nil for GPUs
 		if c.SysInfo.InfoType == dcgm.FE_SWITCH || c.SysInfo.InfoType == dcgm.FE_LINK {
-			ToSwitchMetric(metrics, vals, c.Counters, mi, c.UseOldNamespace, c.Hostname)
+			ToSwitchMetric(metrics, vals, c.Counters, mi, c.metricOptions())
+			if mi.Entity.EntityGroupId == dcgm.FE_LINK && c.NVLinkBandwidth > 0 {
+				c.appendNVLinkUtilization(metrics, vals, mi)
+			}
 		} else if c.SysInfo.InfoType == dcgm.FE_CPU || c.SysInfo.InfoType == dcgm.FE_CPU_CORE {
-			ToCPUMetric(metrics, vals, c.Counters, mi, c.UseOldNamespace, c.Hostname)
+			ToCPUMetric(metrics, vals, c.Counters, mi, c.metricOptions())
 		} else {
-			ToMetric(metrics,
-				vals,
-				c.Counters,
-				mi.DeviceInfo,
-				mi.InstanceInfo,
-				c.UseOldNamespace,
-				c.Hostname,
-				c.ReplaceBlanksInModelName)
+			toGPUMetric(metrics, vals, c.Counters, entity.metadata, c.metricOptions())
+			if mi.Entity.EntityGroupId == dcgm.FE_GPU && c.NVLinkBandwidth > 0 {
+				c.appendGPUNVLinkUtilization(metrics, vals, mi)
+			}
+		}
+
+		c.appendAggregations(metrics, counts, mi.Entity, samples)
+	}
+
+	if c.SysInfo.InfoType == dcgm.FE_SWITCH || c.SysInfo.InfoType == dcgm.FE_LINK {
+		setSwitchPhysIDs(metrics, c.SysInfo)
+	}
+
+	if c.NUMANodes != nil {
+		for counter := range metrics {
+			for j := range metrics[counter] {
+				metrics[counter][j].GPUNUMANode = c.NUMANodes[metrics[counter][j].GPU]
+			}
 		}
 	}
 
+	c.observeHistograms(metrics)
+
 	return metrics, nil
 }
 
+// isConnectionLost reports whether the error is due to the connection to a remote hostengine being lost
+func isConnectionLost(err error) bool {
+	var derr *dcgm.DcgmError
+	return errors.As(err, &derr) && derr.Code == dcgm.DCGM_ST_CONNECTION_NOT_VALID
+}
+
 func ShouldMonitorDeviceType(fields []dcgm.Short, entityType dcgm.Field_Entity_Group) bool {
 	if len(fields) == 0 {
 		return false
@@ -166,46 +369,69 @@ func FindCounterField(c []Counter, fieldID uint) (Counter, error) {
 	return Counter{}, fmt.Errorf("could not find counter corresponding to field ID '%d'", fieldID)
 }
 
+// metricOptions returns the options of the conversion of the field values collected by c into metrics
+func (c *DCGMCollector) metricOptions() MetricOptions {
+	return MetricOptions{
+		UseOldNamespace:          c.UseOldNamespace,
+		Hostname:                 c.Hostname,
+		ReplaceBlanksInModelName: c.ReplaceBlanksInModelName,
+		UseSampleTimestamp:       c.UseSampleTimestamp,
+		MissingValue:             c.MissingValue,
+	}
+}
+
 func ToSwitchMetric(
-	metrics MetricsByCounter,
-	values []dcgm.FieldValue_v1, c []Counter, mi MonitoringInfo, useOld bool, hostname string,
+	metrics MetricsByCounter, values []dcgm.FieldValue_v1, c []Counter, mi MonitoringInfo, opts MetricOptions,
 ) {
 	labels := map[string]string{}
 
+	// The links are identified by their port and the ID of their switch, as the switches are
+	switchID := ""
+	if mi.Entity.EntityGroupId == dcgm.FE_LINK {
+		switchID = fmt.Sprintf("%d", mi.ParentId)
+	}
+
 	for _, val := range values {
-		v := ToString(val)
-		// Filter out counters with no value and ignored fields for this entity
+		// Counters the switch or port doesn't support are skipped rather than reported as zeros
+		if val.Status != dcgm.DCGM_ST_OK {
+			continue
+		}
 
 		counter, err := FindCounterField(c, val.FieldId)
 		if err != nil {
 			continue
 		}
 
+		// Filter out counters with no value and ignored fields for this entity
+		v, ok := fieldValue(val, counter, opts.MissingValue)
+		if !ok {
+			continue
+		}
+
 		if counter.PromType == "label" {
 			labels[counter.FieldName] = v
 			continue
 		}
 		uuid := "UUID"
-		if useOld {
+		if opts.UseOldNamespace {
 			uuid = "uuid"
 		}
-		var m Metric
-		if v == SkipDCGMValue {
-			continue
-		} else {
-			m = Metric{
-				Counter:      counter,
-				Value:        v,
-				UUID:         uuid,
-				GPU:          fmt.Sprintf("%d", mi.Entity.EntityId),
-				GPUUUID:      "",
-				GPUDevice:    fmt.Sprintf("nvswitch%d", mi.ParentId),
-				GPUModelName: "",
-				GPUPCIBusID:  "",
-				Hostname:     hostname,
-				Labels:       labels,
-				Attributes:   nil,
-			}
+		m := Metric{
+			Counter:      counter,
+			Value:        v,
+			UUID:         uuid,
+			GPU:          fmt.Sprintf("%d", mi.Entity.EntityId),
+			GPUUUID:      "",
+			GPUDevice:    switchID,
+			GPUModelName: "",
+			GPUPCIBusID:  "",
+			Hostname:     opts.Hostname,
+			Labels:       labels,
+			Attributes:   nil,
+		}
+
+		if opts.UseSampleTimestamp {
+			m.Timestamp = toTimestamp(val)
 		}
 
 		metrics[m.Counter] = append(metrics[m.Counter], m)
@@ -213,72 +439,138 @@ func ToSwitchMetric(
 }
 
 func ToCPUMetric(
-	metrics MetricsByCounter,
-	values []dcgm.FieldValue_v1, c []Counter, mi MonitoringInfo, useOld bool, hostname string,
+	metrics MetricsByCounter, values []dcgm.FieldValue_v1, c []Counter, mi MonitoringInfo, opts MetricOptions,
 ) {
 	labels := map[string]string{}
 
 	for _, val := range values {
-		v := ToString(val)
-		// Filter out counters with no value and ignored fields for this entity
+		// Fields unknown to the DCGM version or the hardware, like the per core ones on older CPUs, are skipped
+		if val.Status != dcgm.DCGM_ST_OK {
+			continue
+		}
 
 		counter, err := FindCounterField(c, val.FieldId)
 		if err != nil {
 			continue
 		}
 
+		// Filter out counters with no value and ignored fields for this entity
+		v, ok := fieldValue(val, counter, opts.MissingValue)
+		if !ok {
+			continue
+		}
+
 		if counter.PromType == "label" {
 			labels[counter.FieldName] = v
 			continue
 		}
 		uuid := "UUID"
-		if useOld {
+		if opts.UseOldNamespace {
 			uuid = "uuid"
 		}
-		var m Metric
-		if v == SkipDCGMValue {
-			continue
-		} else {
-			m = Metric{
-				Counter:      counter,
-				Value:        v,
-				UUID:         uuid,
-				GPU:          fmt.Sprintf("%d", mi.Entity.EntityId),
-				GPUUUID:      "",
-				GPUDevice:    fmt.Sprintf("%d", mi.ParentId),
-				GPUModelName: "",
-				GPUPCIBusID:  "",
-				Hostname:     hostname,
-				Labels:       labels,
-				Attributes:   nil,
-			}
+		m := Metric{
+			Counter:      counter,
+			Value:        v,
+			UUID:         uuid,
+			GPU:          fmt.Sprintf("%d", mi.Entity.EntityId),
+			GPUUUID:      "",
+			GPUDevice:    fmt.Sprintf("%d", mi.ParentId),
+			GPUModelName: "",
+			GPUPCIBusID:  "",
+			Hostname:     opts.Hostname,
+			Labels:       labels,
+			Attributes:   nil,
+		}
+
+		if opts.UseSampleTimestamp {
+			m.Timestamp = toTimestamp(val)
 		}
 
 		metrics[m.Counter] = append(metrics[m.Counter], m)
 	}
 }
 
+// gpuMetadata holds the labels of a GPU, GPU instance or compute instance that don't change
+// for the lifetime of the process
+type gpuMetadata struct {
+	GPU                  string
+	UUID                 string
+	Device               string
+	ModelName            string
+	PCIBusID             string
+	MigProfile           string
+	GPUInstanceID        string
+	MigUUID              string
+	GPUInstanceMemoryMB  string
+	GPUComputeInstanceID string
+	DriverVersion        string // Only set when the collector has DriverLabels
+	VBIOSVersion         string // Only set when the collector has DriverLabels
+	CPUAffinity          string // Only set when the collector has CPUAffinityLabel
+}
+
+func newGPUMetadata(
+	d dcgm.Device,
+	instanceInfo *GPUInstanceInfo,
+	computeInstanceInfo *ComputeInstanceInfo,
+	replaceBlanksInModelName bool,
+) gpuMetadata {
+	metadata := gpuMetadata{
+		GPU:       fmt.Sprintf("%d", d.GPU),
+		UUID:      d.UUID,
+		Device:    fmt.Sprintf("nvidia%d", d.GPU),
+		ModelName: getGPUModel(d, replaceBlanksInModelName),
+		PCIBusID:  d.PCI.BusID,
+	}
+
+	if instanceInfo != nil {
+		metadata.MigProfile = instanceInfo.ProfileName
+		metadata.GPUInstanceID = fmt.Sprintf("%d", instanceInfo.Info.NvmlInstanceId)
+		metadata.MigUUID = instanceInfo.UUID
+		if instanceInfo.MemoryMB > 0 {
+			metadata.GPUInstanceMemoryMB = strconv.FormatInt(instanceInfo.MemoryMB, 10)
+		}
+	}
+
+	if computeInstanceInfo != nil {
+		metadata.GPUComputeInstanceID = fmt.Sprintf("%d", computeInstanceInfo.InstanceInfo.NvmlComputeInstanceId)
+	}
+
+	return metadata
+}
+
 func ToMetric(
 	metrics MetricsByCounter,
 	values []dcgm.FieldValue_v1,
 	c []Counter,
 	d dcgm.Device,
 	instanceInfo *GPUInstanceInfo,
-	useOld bool,
-	hostname string,
-	replaceBlanksInModelName bool,
+	computeInstanceInfo *ComputeInstanceInfo,
+	opts MetricOptions,
+) {
+	metadata := newGPUMetadata(d, instanceInfo, computeInstanceInfo, opts.ReplaceBlanksInModelName)
+	toGPUMetric(metrics, values, c, metadata, opts)
+}
+
+// toGPUMetric converts the values of a GPU entity into metrics labeled with its metadata
+func toGPUMetric(
+	metrics MetricsByCounter,
+	values []dcgm.FieldValue_v1,
+	c []Counter,
+	metadata gpuMetadata,
+	opts MetricOptions,
 ) {
 	labels := map[string]string{}
+	fbTimestamp := framebufferTimestamp(values)
 
 	for _, val := range values {
-		v := ToString(val)
-		// Filter out counters with no value and ignored fields for this entity
-		if v == SkipDCGMValue {
+		counter, err := FindCounterField(c, val.FieldId)
+		if err != nil || !counter.inScope(metadata) {
 			continue
 		}
 
-		counter, err := FindCounterField(c, val.FieldId)
-		if err != nil {
+		// Filter out counters with no value and ignored fields for this entity
+		v, ok := fieldValue(val, counter, opts.MissingValue)
+		if !ok {
 			continue
 		}
 
@@ -287,14 +579,13 @@ func ToMetric(
 			continue
 		}
 		uuid := "UUID"
-		if useOld {
+		if opts.UseOldNamespace {
 			uuid = "uuid"
 		}
 
-		gpuModel := getGPUModel(d, replaceBlanksInModelName)
-
 		attrs := map[string]string{}
-		if counter.FieldID == dcgm.DCGM_FI_DEV_XID_ERRORS {
+		addECCAttributes(attrs, counter.FieldID)
+		if counter.FieldID == dcgm.DCGM_FI_DEV_XID_ERRORS && !isBlank(val) {
 			errCode := int(val.Int64())
 			attrs["err_code"] = strconv.Itoa(errCode)
 			if 0 <= errCode && errCode < len(xidErrCodeToText) {
@@ -308,26 +599,43 @@ func ToMetric(
 			Counter: counter,
 			Value:   v,
 
-			UUID:         uuid,
-			GPU:          fmt.Sprintf("%d", d.GPU),
-			GPUUUID:      d.UUID,
-			GPUDevice:    fmt.Sprintf("nvidia%d", d.GPU),
-			GPUModelName: gpuModel,
-			GPUPCIBusID:  d.PCI.BusID,
-			Hostname:     hostname,
+			UUID:                 uuid,
+			GPU:                  metadata.GPU,
+			GPUUUID:              metadata.UUID,
+			GPUDevice:            metadata.Device,
+			GPUModelName:         metadata.ModelName,
+			GPUPCIBusID:          metadata.PCIBusID,
+			MigProfile:           metadata.MigProfile,
+			GPUInstanceID:        metadata.GPUInstanceID,
+			MigUUID:              metadata.MigUUID,
+			GPUInstanceMemoryMB:  metadata.GPUInstanceMemoryMB,
+			GPUComputeInstanceID: metadata.GPUComputeInstanceID,
+			GPUDriverVersion:     metadata.DriverVersion,
+			GPUVBIOSVersion:      metadata.VBIOSVersion,
+			GPUCPUAffinity:       metadata.CPUAffinity,
+			Hostname:             opts.Hostname,
 
 			Labels:     labels,
 			Attributes: attrs,
 		}
-		if instanceInfo != nil {
-			m.MigProfile = instanceInfo.ProfileName
-			m.GPUInstanceID = fmt.Sprintf("%d", instanceInfo.Info.NvmlInstanceId)
-		} else {
-			m.MigProfile = ""
-			m.GPUInstanceID = ""
+		if opts.UseSampleTimestamp {
+			if isFramebufferField(dcgm.Short(val.FieldId)) {
+				val.Ts = fbTimestamp
+			}
+			m.Timestamp = toTimestamp(val)
 		}
 
 		metrics[m.Counter] = append(metrics[m.Counter], m)
+
+		// The ratio is labeled like the power usage, it is skipped when the GPU doesn't report its power limit
+		if counter.FieldID == dcgm.DCGM_FI_DEV_POWER_USAGE {
+			if ratio, ok := powerUsageRatio(values); ok {
+				derived := m
+				derived.Counter = powerUsageRatioCounter
+				derived.Value = ratio
+				metrics[derived.Counter] = append(metrics[derived.Counter], derived)
+			}
+		}
 	}
 }
 
@@ -342,6 +650,47 @@ func getGPUModel(d dcgm.Device, replaceBlanksInModelName bool) string {
 	return gpuModel
 }
 
+// toTimestamp converts the DCGM sample timestamp (usec) into a Prometheus timestamp (ms)
+func toTimestamp(value dcgm.FieldValue_v1) string {
+	return strconv.FormatInt(value.Ts/1000, 10)
+}
+
+// fieldValue returns the value of the field for the counter, false when it's skipped. The blank values DCGM
+// reports for the fields without value are replaced by missingValue, or skipped when it's empty. The other numeric
+// values are multiplied by Counter.Scale. Labels and strings are never replaced nor scaled.
+func fieldValue(val dcgm.FieldValue_v1, counter Counter, missingValue string) (string, bool) {
+	v := ToString(val)
+	if v != SkipDCGMValue {
+		if counter.PromType == "label" || val.FieldType == dcgm.DCGM_FT_STRING {
+			return v, true
+		}
+		return scaleValue(v, counter), true
+	}
+
+	if missingValue == "" || counter.PromType == "label" || val.FieldType == dcgm.DCGM_FT_STRING {
+		return "", false
+	}
+
+	return missingValue, true
+}
+
+// missingValue returns the value reported for the blank values with the Config.MissingValuePolicy
+func missingValue(c *Config) string {
+	switch c.MissingValuePolicy {
+	case MissingValueNaN:
+		return "NaN"
+	case MissingValueDefault:
+		return strconv.FormatFloat(c.MissingValueDefault, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// isBlank reports whether the value is one of the blank values of DCGM
+func isBlank(val dcgm.FieldValue_v1) bool {
+	return ToString(val) == SkipDCGMValue
+}
+
 func ToString(value dcgm.FieldValue_v1) string {
 	switch value.FieldType {
 	case dcgm.DCGM_FT_INT64:
@@ -376,7 +725,9 @@ func ToString(value dcgm.FieldValue_v1) string {
 		case dcgm.DCGM_FT_FP64_NOT_PERMISSIONED:
 			return SkipDCGMValue
 		default:
-			return fmt.Sprintf("%f", value.Float64())
+			// The shortest representation that parses back to the same value, ratios like the activities keep
+			// all their digits
+			return strconv.FormatFloat(v, 'f', -1, 64)
 		}
 	case dcgm.DCGM_FT_STRING:
 		switch v := value.String(); v {
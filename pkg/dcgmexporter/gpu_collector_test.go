@@ -17,37 +17,46 @@
 package dcgmexporter
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
 	"testing"
+	"text/template"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	osmock "github.com/NVIDIA/dcgm-exporter/internal/mocks/pkg/os"
+	osinterface "github.com/NVIDIA/dcgm-exporter/internal/pkg/os"
 )
 
 var sampleCounters = []Counter{
-	{dcgm.DCGM_FI_DEV_GPU_TEMP, "DCGM_FI_DEV_GPU_TEMP", "gauge", "Temperature Help info"},
-	{dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "gauge", "Energy help info"},
-	{dcgm.DCGM_FI_DEV_POWER_USAGE, "DCGM_FI_DEV_POWER_USAGE", "gauge", "Power help info"},
-	{dcgm.DCGM_FI_DRIVER_VERSION, "DCGM_FI_DRIVER_VERSION", "label", "Driver version"},
+	{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature Help info"},
+	{FieldID: dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", PromType: "gauge", Help: "Energy help info"},
+	{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge", Help: "Power help info"},
+	{FieldID: dcgm.DCGM_FI_DRIVER_VERSION, FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label", Help: "Driver version"},
 	/* test that switch and link metrics are filtered out automatically when devices are not detected */
 	{
-		dcgm.DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT,
-		"DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT",
-		"gauge",
-		"switch temperature",
+		FieldID:   dcgm.DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT,
+		FieldName: "DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT",
+		PromType:  "gauge",
+		Help:      "switch temperature",
 	},
 	{
-		dcgm.DCGM_FI_DEV_NVSWITCH_LINK_FLIT_ERRORS,
-		"DCGM_FI_DEV_NVSWITCH_LINK_FLIT_ERRORS",
-		"gauge",
-		"per-link flit errors",
+		FieldID:   dcgm.DCGM_FI_DEV_NVSWITCH_LINK_FLIT_ERRORS,
+		FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_FLIT_ERRORS",
+		PromType:  "gauge",
+		Help:      "per-link flit errors",
 	},
 	/* test that vgpu metrics are not filtered out */
-	{dcgm.DCGM_FI_DEV_VGPU_LICENSE_STATUS, "DCGM_FI_DEV_VGPU_LICENSE_STATUS", "gauge", "vgpu license status"},
+	{FieldID: dcgm.DCGM_FI_DEV_VGPU_LICENSE_STATUS, FieldName: "DCGM_FI_DEV_VGPU_LICENSE_STATUS", PromType: "gauge", Help: "vgpu license status"},
 	/* test that cpu and cpu core metrics are filtered out automatically when devices are not detected */
-	{dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL, "DCGM_FI_DEV_CPU_UTIL_TOTAL", "gauge", "Total CPU utilization"},
+	{FieldID: dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL, FieldName: "DCGM_FI_DEV_CPU_UTIL_TOTAL", PromType: "gauge", Help: "Total CPU utilization"},
 }
 
 var expectedMetrics = map[string]bool{
@@ -329,7 +338,8 @@ func TestToMetric(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("When replaceBlanksInModelName is %t", tc.replaceBlanksInModelName), func(t *testing.T) {
 			metrics := make(map[Counter][]Metric)
-			ToMetric(metrics, values, c, d, instanceInfo, false, "", tc.replaceBlanksInModelName)
+			ToMetric(metrics, values, c, d, instanceInfo, nil,
+				MetricOptions{ReplaceBlanksInModelName: tc.replaceBlanksInModelName})
 			assert.Len(t, metrics, 1)
 			// We get metric value with 0 index
 			metricValues := metrics[reflect.ValueOf(metrics).MapKeys()[0].Interface().(Counter)]
@@ -342,6 +352,100 @@ func TestToMetric(t *testing.T) {
 	}
 }
 
+func TestToMetricWithComputeInstance(t *testing.T) {
+	fieldValue := [4096]byte{}
+	fieldValue[0] = 42
+	values := []dcgm.FieldValue_v1{
+		{
+			FieldId:   150,
+			FieldType: dcgm.DCGM_FT_INT64,
+			Value:     fieldValue,
+		},
+	}
+
+	c := []Counter{
+		{
+			FieldID:   150,
+			FieldName: "DCGM_FI_DEV_GPU_TEMP",
+			PromType:  "gauge",
+			Help:      "Temperature Help info",
+		},
+	}
+
+	d := dcgm.Device{GPU: 0, UUID: "fake0"}
+	instanceInfo := &GPUInstanceInfo{
+		Info:        dcgm.MigEntityInfo{NvmlInstanceId: 1},
+		ProfileName: "1g.10gb",
+	}
+	computeInstanceInfo := &ComputeInstanceInfo{InstanceInfo: dcgm.MigEntityInfo{NvmlInstanceId: 1, NvmlComputeInstanceId: 2}}
+
+	metrics := make(map[Counter][]Metric)
+	ToMetric(metrics, values, c, d, instanceInfo, computeInstanceInfo, MetricOptions{})
+	require.Len(t, metrics[c[0]], 1)
+	assert.Equal(t, "1", metrics[c[0]][0].GPUInstanceID)
+	assert.Equal(t, "2", metrics[c[0]][0].GPUComputeInstanceID)
+
+	formatted, err := FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+	assert.Contains(t, formatted, `GPU_I_PROFILE="1g.10gb",GPU_I_ID="1",GPU_CI_ID="2"`)
+
+	// Without compute instance, the GPU instance labels are unchanged
+	metrics = make(map[Counter][]Metric)
+	ToMetric(metrics, values, c, d, instanceInfo, nil, MetricOptions{})
+	formatted, err = FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+	assert.Contains(t, formatted, `GPU_I_PROFILE="1g.10gb",GPU_I_ID="1"}`)
+}
+
+func TestToMetricWithGPUInstanceMemory(t *testing.T) {
+	values := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)},
+	}
+	c := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature"},
+	}
+	d := dcgm.Device{GPU: 0, UUID: "fake0"}
+
+	tests := []struct {
+		name         string
+		instanceInfo *GPUInstanceInfo
+		want         string
+	}{
+		{
+			name: "When the memory of the GPU instance is known, it is a label",
+			instanceInfo: &GPUInstanceInfo{
+				Info:        dcgm.MigEntityInfo{NvmlInstanceId: 1},
+				ProfileName: "1g.10gb",
+				MemoryMB:    9856,
+			},
+			want: `GPU_I_PROFILE="1g.10gb",GPU_I_ID="1",GPU_I_MEM_MB="9856"}`,
+		},
+		{
+			name: "When the memory of the GPU instance is unknown, the label is left out",
+			instanceInfo: &GPUInstanceInfo{
+				Info:        dcgm.MigEntityInfo{NvmlInstanceId: 1},
+				ProfileName: "1g.10gb",
+			},
+			want: `GPU_I_PROFILE="1g.10gb",GPU_I_ID="1"}`,
+		},
+		{
+			name: "When the GPU isn't in MIG mode, the label is left out",
+			want: `modelName=""}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := make(map[Counter][]Metric)
+			ToMetric(metrics, values, c, d, tc.instanceInfo, nil, MetricOptions{})
+
+			formatted, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, formatted, tc.want)
+		})
+	}
+}
+
 func TestToMetricWhenDCGM_FI_DEV_XID_ERRORSField(t *testing.T) {
 	c := []Counter{
 		{
@@ -401,7 +505,7 @@ func TestToMetricWhenDCGM_FI_DEV_XID_ERRORSField(t *testing.T) {
 			}
 
 			metrics := make(map[Counter][]Metric)
-			ToMetric(metrics, values, c, d, instanceInfo, false, "", false)
+			ToMetric(metrics, values, c, d, instanceInfo, nil, MetricOptions{})
 			assert.Len(t, metrics, 1)
 			// We get metric value with 0 index
 			metricValues := metrics[reflect.ValueOf(metrics).MapKeys()[0].Interface().(Counter)]
@@ -417,6 +521,324 @@ func TestToMetricWhenDCGM_FI_DEV_XID_ERRORSField(t *testing.T) {
 	}
 }
 
+func TestToMetricWithSampleTimestamp(t *testing.T) {
+	fieldValue := [4096]byte{}
+	fieldValue[0] = 42
+	values := []dcgm.FieldValue_v1{
+		{
+			FieldId:   150,
+			FieldType: dcgm.DCGM_FT_INT64,
+			Ts:        1700000000123456,
+			Value:     fieldValue,
+		},
+	}
+
+	c := []Counter{
+		{
+			FieldID:   150,
+			FieldName: "DCGM_FI_DEV_GPU_TEMP",
+			PromType:  "gauge",
+			Help:      "Temperature Help info",
+		},
+	}
+
+	d := dcgm.Device{
+		UUID: "fake0",
+	}
+
+	for _, tc := range []struct {
+		useSampleTimestamp bool
+		expectedTimestamp  string
+	}{
+		{useSampleTimestamp: true, expectedTimestamp: "1700000000123"},
+		{useSampleTimestamp: false, expectedTimestamp: ""},
+	} {
+		t.Run(fmt.Sprintf("When useSampleTimestamp is %t", tc.useSampleTimestamp), func(t *testing.T) {
+			metrics := make(map[Counter][]Metric)
+			ToMetric(metrics, values, c, d, nil, nil, MetricOptions{UseSampleTimestamp: tc.useSampleTimestamp})
+			require.Len(t, metrics[c[0]], 1)
+			assert.Equal(t, tc.expectedTimestamp, metrics[c[0]][0].Timestamp)
+		})
+	}
+}
+
+// int64FieldValue encodes v as the value of a DCGM_FT_INT64 field
+func int64FieldValue(v int64) [4096]byte {
+	var b [4096]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	return b
+}
+
+// float64FieldValue encodes v as the value of a DCGM_FT_DOUBLE field
+func float64FieldValue(v float64) [4096]byte {
+	var b [4096]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	return b
+}
+
+// testGPUCollectorWithValues returns a collector of the counters on the single GPU GPU-00000000, for which DCGM returns
+// values until the end of the test. The GPU watches the fields of the counters.
+func testGPUCollectorWithValues(t *testing.T, counters []Counter, values ...dcgm.FieldValue_v1) *DCGMCollector {
+	t.Helper()
+
+	dcgmEntityGetLatestValuesHook = func(dcgm.Field_Entity_Group, uint, []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		return values, nil
+	}
+	t.Cleanup(func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	})
+
+	sysInfo := SystemInfo{
+		GPUCount: 1,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{UUID: "GPU-00000000"}
+
+	fields := make([]dcgm.Short, 0, len(counters))
+	for _, counter := range counters {
+		fields = append(fields, counter.FieldID)
+	}
+
+	return &DCGMCollector{Counters: counters, DeviceFields: fields, SysInfo: sysInfo}
+}
+
+func TestToString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value dcgm.FieldValue_v1
+		want  string
+	}{
+		{
+			name:  "When a ratio has more than 6 decimals, they are all kept",
+			value: dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(0.123456789)},
+			want:  "0.123456789",
+		},
+		{
+			name:  "When a double is a whole number, it has no decimals",
+			value: dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(300)},
+			want:  "300",
+		},
+		{
+			name:  "When a double is tiny, it isn't rounded to zero",
+			value: dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(1.5e-9)},
+			want:  "0.0000000015",
+		},
+		{
+			name:  "When a double is blank, it is skipped",
+			value: dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(dcgm.DCGM_FT_FP64_BLANK)},
+			want:  SkipDCGMValue,
+		},
+		{
+			name:  "When an integer is given, it is formatted in base 10",
+			value: dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)},
+			want:  "42",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ToString(tc.value))
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsFloatPrecision(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, FieldName: "DCGM_FI_PROF_GR_ENGINE_ACTIVE",
+		PromType: "gauge", Help: "Ratio of time the graphics engine is active."}
+
+	tests := []struct {
+		name         string
+		activity     float64
+		wantRendered string
+	}{
+		{
+			name:         "When the ratio has more than 6 decimals, it round-trips",
+			activity:     0.123456789,
+			wantRendered: `modelName=""} 0.123456789`,
+		},
+		{
+			name:         "When the ratio is tiny, it round-trips",
+			activity:     1.5e-9,
+			wantRendered: `modelName=""} 0.0000000015`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, []Counter{counter}, dcgm.FieldValue_v1{
+				FieldId: dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE, FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(tc.activity),
+			})
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			require.Len(t, metrics[counter], 1)
+
+			got, err := strconv.ParseFloat(metrics[counter][0].Value, 64)
+			require.NoError(t, err)
+			assert.Equal(t, tc.activity, got, "the value must round-trip")
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tc.wantRendered)
+		})
+	}
+}
+
+func TestToMetricWithMissingValuePolicy(t *testing.T) {
+	stringValue := func(v string) [4096]byte {
+		var b [4096]byte
+		copy(b[:], v)
+		return b
+	}
+
+	blanks := map[string]dcgm.FieldValue_v1{
+		"DCGM_FT_INT32_BLANK":            {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT32_BLANK)},
+		"DCGM_FT_INT32_NOT_FOUND":        {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT32_NOT_FOUND)},
+		"DCGM_FT_INT32_NOT_SUPPORTED":    {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT32_NOT_SUPPORTED)},
+		"DCGM_FT_INT32_NOT_PERMISSIONED": {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT32_NOT_PERMISSIONED)},
+		"DCGM_FT_INT64_BLANK":            {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)},
+		"DCGM_FT_INT64_NOT_FOUND":        {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_NOT_FOUND)},
+		"DCGM_FT_INT64_NOT_SUPPORTED":    {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_NOT_SUPPORTED)},
+		"DCGM_FT_INT64_NOT_PERMISSIONED": {FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_NOT_PERMISSIONED)},
+		"DCGM_FT_FP64_BLANK":             {FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(dcgm.DCGM_FT_FP64_BLANK)},
+		"DCGM_FT_FP64_NOT_FOUND":         {FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(dcgm.DCGM_FT_FP64_NOT_FOUND)},
+		"DCGM_FT_FP64_NOT_SUPPORTED":     {FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(dcgm.DCGM_FT_FP64_NOT_SUPPORTED)},
+		"DCGM_FT_FP64_NOT_PERMISSIONED":  {FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(dcgm.DCGM_FT_FP64_NOT_PERMISSIONED)},
+		"DCGM_FT_STR_BLANK":              {FieldType: dcgm.DCGM_FT_STRING, Value: stringValue(dcgm.DCGM_FT_STR_BLANK)},
+		"DCGM_FT_STR_NOT_FOUND":          {FieldType: dcgm.DCGM_FT_STRING, Value: stringValue(dcgm.DCGM_FT_STR_NOT_FOUND)},
+		"DCGM_FT_STR_NOT_SUPPORTED":      {FieldType: dcgm.DCGM_FT_STRING, Value: stringValue(dcgm.DCGM_FT_STR_NOT_SUPPORTED)},
+		"DCGM_FT_STR_NOT_PERMISSIONED":   {FieldType: dcgm.DCGM_FT_STRING, Value: stringValue(dcgm.DCGM_FT_STR_NOT_PERMISSIONED)},
+	}
+
+	counter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	label := Counter{FieldID: dcgm.DCGM_FI_DRIVER_VERSION, FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label"}
+
+	tests := []struct {
+		policy string
+		want   string // Reported for the numeric blanks, the string ones are always skipped
+	}{
+		{policy: MissingValueSkip, want: ""},
+		{policy: MissingValueNaN, want: "NaN"},
+		{policy: MissingValueDefault, want: "-1"},
+	}
+
+	for _, tt := range tests {
+		missing := missingValue(&Config{MissingValuePolicy: tt.policy, MissingValueDefault: -1})
+
+		for name, blank := range blanks {
+			t.Run(fmt.Sprintf("When the policy is %s and the value is %s", tt.policy, name), func(t *testing.T) {
+				value := blank
+				value.FieldId = uint(counter.FieldID)
+				labelValue := blank
+				labelValue.FieldId = uint(label.FieldID)
+
+				metrics := MetricsByCounter{}
+				toGPUMetric(metrics, []dcgm.FieldValue_v1{labelValue, value}, []Counter{counter, label},
+					gpuMetadata{GPU: "0"}, MetricOptions{MissingValue: missing})
+				require.NotContains(t, metrics, label)
+
+				if tt.want == "" || blank.FieldType == dcgm.DCGM_FT_STRING {
+					assert.Empty(t, metrics)
+					return
+				}
+
+				require.Len(t, metrics[counter], 1)
+				assert.Equal(t, tt.want, metrics[counter][0].Value)
+				assert.Empty(t, metrics[counter][0].Labels)
+			})
+		}
+	}
+}
+
+func TestToCPUMetricPerCoreFields(t *testing.T) {
+	c := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL, FieldName: "DCGM_FI_DEV_CPU_UTIL_TOTAL", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_CPU_TEMP_CURRENT, FieldName: "DCGM_FI_DEV_CPU_TEMP_CURRENT", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_CPU_POWER_UTIL_CURRENT, FieldName: "DCGM_FI_DEV_CPU_POWER_UTIL_CURRENT", PromType: "gauge"},
+	}
+
+	mi := MonitoringInfo{
+		Entity:   dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_CPU_CORE, EntityId: 71},
+		ParentId: 1,
+	}
+
+	metrics := MetricsByCounter{}
+	ToCPUMetric(metrics, []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(12)},
+		{FieldId: dcgm.DCGM_FI_DEV_CPU_TEMP_CURRENT, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(48)},
+		// Not measured per core on this hardware
+		{FieldId: dcgm.DCGM_FI_DEV_CPU_POWER_UTIL_CURRENT, Status: dcgm.DCGM_ST_NO_DATA},
+	}, c, mi, MetricOptions{})
+
+	require.Len(t, metrics, 2)
+	require.Len(t, metrics[c[1]], 1)
+	assert.Equal(t, "48", metrics[c[1]][0].Value)
+	assert.Equal(t, "71", metrics[c[1]][0].GPU)
+	assert.Equal(t, "1", metrics[c[1]][0].GPUDevice)
+	assert.NotContains(t, metrics, c[2])
+}
+
+func TestToSwitchMetricLinkErrorCounters(t *testing.T) {
+	c := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS, FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS",
+			PromType: "counter", Help: "CRC errors"},
+		{FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_REPLAY_ERRORS, FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_REPLAY_ERRORS",
+			PromType: "counter", Help: "Replays"},
+		{FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_RECOVERY_ERRORS, FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_RECOVERY_ERRORS",
+			PromType: "counter", Help: "Recoveries"},
+	}
+
+	values := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(3)},
+		{FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_REPLAY_ERRORS, FieldType: dcgm.DCGM_FT_INT64,
+			Value: int64FieldValue(dcgm.DCGM_FT_INT64_NOT_SUPPORTED)},
+		// Not supported by the port, the value is left zeroed
+		{FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_RECOVERY_ERRORS, FieldType: dcgm.DCGM_FT_INT64,
+			Status: dcgm.DCGM_ST_NOT_SUPPORTED},
+	}
+
+	tests := []struct {
+		name     string
+		mi       MonitoringInfo
+		template *template.Template
+		want     string
+	}{
+		{
+			name: "When the entity is a link",
+			mi: MonitoringInfo{
+				Entity:   dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_LINK, EntityId: 5},
+				ParentId: 2,
+			},
+			template: linkMetricsTemplate,
+			want:     `DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS{nvlink="5",nvswitch="2"} 3`,
+		},
+		{
+			name: "When the entity is a switch",
+			mi: MonitoringInfo{
+				Entity:   dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_SWITCH, EntityId: 2},
+				ParentId: PARENT_ID_IGNORED,
+			},
+			template: switchMetricsTemplate,
+			want:     `DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS{nvswitch="2"} 3`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := MetricsByCounter{}
+			ToSwitchMetric(metrics, values, c, tt.mi, MetricOptions{})
+			require.Len(t, metrics, 1)
+
+			out, err := FormatMetrics(tt.template, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tt.want)
+			assert.NotContains(t, out, "REPLAY")
+			assert.NotContains(t, out, "RECOVERY")
+		})
+	}
+}
+
 func TestGPUCollector_GetMetrics(t *testing.T) {
 	teardownTest := setupTest(t)
 	defer teardownTest(t)
@@ -484,3 +906,438 @@ func TestGPUCollector_GetMetrics(t *testing.T) {
 
 	require.Equal(t, numGPUs, uint(len(values)))
 }
+
+func TestGPUCollector_GetMetricsReusesStaticMetadata(t *testing.T) {
+	valueCalls := 0
+	dcgmEntityGetLatestValuesHook = func(_ dcgm.Field_Entity_Group, gpu uint, _ []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		valueCalls++
+		value := [4096]byte{}
+		value[0] = byte(40 + gpu)
+		return []dcgm.FieldValue_v1{{
+			FieldId:   uint(dcgm.DCGM_FI_DEV_GPU_TEMP),
+			FieldType: dcgm.DCGM_FT_INT64,
+			Value:     value,
+		}}, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{
+			GPU:         i,
+			UUID:        fmt.Sprintf("GPU-0000000%d", i),
+			Identifiers: dcgm.DeviceIdentifiers{Model: "NVIDIA  T400 4GB"},
+		}
+	}
+
+	c := &DCGMCollector{
+		Counters:                 sampleCounters[:1],
+		DeviceFields:             []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP},
+		SysInfo:                  sysInfo,
+		ReplaceBlanksInModelName: true,
+	}
+
+	first, err := c.GetMetrics()
+	require.NoError(t, err)
+
+	// Changes of the system info after the first collection are not looked up again
+	c.SysInfo.GPUCount = 1
+	c.SysInfo.GPUs[0].DeviceInfo.Identifiers.Model = "changed"
+
+	second, err := c.GetMetrics()
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, valueCalls, "the values must be read on every collection")
+	assert.Equal(t, first, second)
+
+	temp := second[sampleCounters[0]]
+	require.Len(t, temp, 2)
+	for i, metric := range temp {
+		assert.Equal(t, fmt.Sprint(i), metric.GPU)
+		assert.Equal(t, fmt.Sprintf("GPU-0000000%d", i), metric.GPUUUID)
+		assert.Equal(t, fmt.Sprintf("nvidia%d", i), metric.GPUDevice)
+		assert.Equal(t, "NVIDIA-T400-4GB", metric.GPUModelName)
+		assert.Equal(t, fmt.Sprint(40+i), metric.Value)
+	}
+}
+
+func TestGPUCollector_GetMetricsWhenConnectionIsLost(t *testing.T) {
+	dcgmEntityGetLatestValuesHook = func(dcgm.Field_Entity_Group, uint, []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		return nil, &dcgm.DcgmError{Code: dcgm.DCGM_ST_CONNECTION_NOT_VALID}
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 1,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+	c := &DCGMCollector{Counters: sampleCounters[:1], SysInfo: sysInfo}
+
+	// The error is returned so the pipeline reports the collector down, instead of exiting
+	_, err := c.GetMetrics()
+	require.Error(t, err)
+	assert.True(t, isConnectionLost(err))
+	assert.ErrorContains(t, err, "lost the connection to the hostengine")
+
+	assert.False(t, isConnectionLost(&dcgm.DcgmError{Code: dcgm.DCGM_ST_NOT_SUPPORTED}))
+}
+
+func TestGPUCollector_GetMetricsWithDriverLabels(t *testing.T) {
+	temp := dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)}
+
+	tests := []struct {
+		name         string
+		driverLabels bool
+		wantDriver   string
+		wantVBIOS    string
+		wantRendered string
+	}{
+		{
+			name:         "When driver labels are disabled, the versions are not exported",
+			wantRendered: `modelName=""} 42`,
+		},
+		{
+			name:         "When driver labels are enabled, the versions are exported",
+			driverLabels: true,
+			wantDriver:   "550.54.15",
+			wantVBIOS:    "96.00.74.00.01",
+			wantRendered: `modelName="",driver_version="550.54.15",vbios_version="96.00.74.00.01"} 42`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, sampleCounters[:1], temp)
+			c.SysInfo.GPUs[0].DeviceInfo.Identifiers = dcgm.DeviceIdentifiers{
+				DriverVersion: "550.54.15", Vbios: "96.00.74.00.01",
+			}
+			c.DriverLabels = tc.driverLabels
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			require.Len(t, metrics[sampleCounters[0]], 1)
+
+			metric := metrics[sampleCounters[0]][0]
+			assert.Equal(t, tc.wantDriver, metric.GPUDriverVersion)
+			assert.Equal(t, tc.wantVBIOS, metric.GPUVBIOSVersion)
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tc.wantRendered)
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsWithCPUAffinityLabel(t *testing.T) {
+	temp := dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)}
+
+	tests := []struct {
+		name             string
+		cpuAffinityLabel bool
+		wantAffinity     string
+		wantRendered     string
+	}{
+		{
+			name:         "When the CPU affinity label is disabled, the affinity is not exported",
+			wantRendered: `modelName=""} 42`,
+		},
+		{
+			name:             "When the CPU affinity label is enabled, the affinity is exported",
+			cpuAffinityLabel: true,
+			wantAffinity:     "0-3,8",
+			wantRendered:     `modelName="",cpu_affinity="0-3,8"} 42`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, sampleCounters[:1], temp)
+			c.SysInfo.GPUs[0].DeviceInfo.CPUAffinity = "{0,1,2,3,8}"
+			c.CPUAffinityLabel = tc.cpuAffinityLabel
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			require.Len(t, metrics[sampleCounters[0]], 1)
+			assert.Equal(t, tc.wantAffinity, metrics[sampleCounters[0]][0].GPUCPUAffinity)
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tc.wantRendered)
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsSettingsFields(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_FAN_SPEED, FieldName: "DCGM_FI_DEV_FAN_SPEED", PromType: "gauge", Help: "Fan speed."},
+		{FieldID: dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT, FieldName: "DCGM_FI_DEV_POWER_MGMT_LIMIT", PromType: "gauge", Help: "Power limit."},
+		{FieldID: dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT, FieldName: "DCGM_FI_DEV_ENFORCED_POWER_LIMIT", PromType: "gauge", Help: "Enforced power limit."},
+	}
+	values := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_FAN_SPEED, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(55)},
+		{FieldId: dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT, FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(300)},
+		{FieldId: dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT, FieldType: dcgm.DCGM_FT_DOUBLE, Value: float64FieldValue(250.5)},
+	}
+
+	tests := []struct {
+		name    string
+		counter Counter
+		want    string
+	}{
+		{
+			name:    "When the fan speed is collected, it is exported as a gauge",
+			counter: counters[0],
+			want:    "55",
+		},
+		{
+			name:    "When the power management limit is collected, it is exported as a gauge",
+			counter: counters[1],
+			want:    "300",
+		},
+		{
+			name:    "When the enforced power limit is collected, it is exported as a gauge",
+			counter: counters[2],
+			want:    "250.5",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, counters, values...)
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			require.Len(t, metrics[tc.counter], 1)
+			assert.Equal(t, tc.want, metrics[tc.counter][0].Value)
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, fmt.Sprintf("# TYPE %s gauge\n", tc.counter.FieldName))
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsMemoryTemperature(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "GPU temperature (in C)."},
+		{FieldID: dcgm.DCGM_FI_DEV_MEMORY_TEMP, FieldName: "DCGM_FI_DEV_MEMORY_TEMP", PromType: "gauge", Help: "Memory (HBM) temperature (in C)."},
+	}
+
+	tests := []struct {
+		name       string
+		memoryTemp int64
+		want       map[string]string
+	}{
+		{
+			name:       "When the GPU reports its memory temperature, it is exported apart from the GPU temperature",
+			memoryTemp: 71,
+			want: map[string]string{
+				"DCGM_FI_DEV_GPU_TEMP":    "42",
+				"DCGM_FI_DEV_MEMORY_TEMP": "71",
+			},
+		},
+		{
+			name:       "When the GPU doesn't support the memory temperature, only the GPU temperature is exported",
+			memoryTemp: dcgm.DCGM_FT_INT64_NOT_SUPPORTED,
+			want:       map[string]string{"DCGM_FI_DEV_GPU_TEMP": "42"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, counters,
+				dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)},
+				dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_MEMORY_TEMP, FieldType: dcgm.DCGM_FT_INT64,
+					Value: int64FieldValue(tc.memoryTemp)},
+			)
+
+			var requested []dcgm.Short
+			latestValues := dcgmEntityGetLatestValuesHook
+			dcgmEntityGetLatestValuesHook = func(group dcgm.Field_Entity_Group, gpu uint, fields []dcgm.Short,
+			) ([]dcgm.FieldValue_v1, error) {
+				requested = fields
+				return latestValues(group, gpu, fields)
+			}
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			assert.Contains(t, requested, dcgm.Short(dcgm.DCGM_FI_DEV_MEMORY_TEMP), "the memory temperature is requested")
+
+			got := map[string]string{}
+			for counter, values := range metrics {
+				for _, metric := range values {
+					got[counter.FieldName] = metric.Value
+				}
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSetupDcgmFieldsWatchWhenGroupCreationFails(t *testing.T) {
+	dcgmCreateGroup = func(string) (dcgm.GroupHandle, error) {
+		return dcgm.GroupHandle{}, errors.New("no free group")
+	}
+	defer func() {
+		dcgmCreateGroup = dcgm.CreateGroup
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 1,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+
+	// The fields would never be updated, so the failure must not go unnoticed
+	_, _, _, err := SetupDcgmFieldsWatch([]dcgm.Short{dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT}, sysInfo, 1000, 0)
+	require.ErrorContains(t, err, "no free group")
+}
+
+func TestWatchParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         Config
+		entityType     dcgm.Field_Entity_Group
+		wantUpdateFreq int64
+		wantMaxKeepAge float64
+	}{
+		{
+			name:           "When the update frequency is not set, the collect interval is used",
+			config:         Config{CollectInterval: 30000},
+			entityType:     dcgm.FE_GPU,
+			wantUpdateFreq: 30000000,
+		},
+		{
+			name:           "When the entity has a collect interval override, the override is used",
+			config:         Config{CollectInterval: 30000, CollectIntervalOverrides: map[string]int{"switch": 5000}},
+			entityType:     dcgm.FE_SWITCH,
+			wantUpdateFreq: 5000000,
+		},
+		{
+			name:           "When another entity has a collect interval override, the collect interval is used",
+			config:         Config{CollectInterval: 30000, CollectIntervalOverrides: map[string]int{"switch": 5000}},
+			entityType:     dcgm.FE_GPU,
+			wantUpdateFreq: 30000000,
+		},
+		{
+			name: "When the update frequency is set, it is used for every entity",
+			config: Config{
+				CollectInterval:          30000,
+				CollectIntervalOverrides: map[string]int{"core": 5000},
+				DCGMUpdateFreq:           1000,
+				DCGMMaxKeepAge:           60,
+			},
+			entityType:     dcgm.FE_CPU_CORE,
+			wantUpdateFreq: 1000000,
+			wantMaxKeepAge: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updateFreq, maxKeepAge := watchParams(&tt.config, tt.entityType)
+			assert.Equal(t, tt.wantUpdateFreq, updateFreq)
+			assert.Equal(t, tt.wantMaxKeepAge, maxKeepAge)
+		})
+	}
+}
+
+func TestGetHostname(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		nodeName string
+		hostname string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "When the source is auto and NODE_NAME is set, NODE_NAME is used",
+			config:   &Config{},
+			nodeName: "node-1",
+			hostname: "pod-1",
+			want:     "node-1",
+		},
+		{
+			name:     "When the source is auto and NODE_NAME isn't set, the OS hostname is used",
+			config:   &Config{HostnameSource: HostnameSourceAuto},
+			hostname: "pod-1",
+			want:     "pod-1",
+		},
+		{
+			name:     "When the source is os, NODE_NAME is ignored",
+			config:   &Config{HostnameSource: HostnameSourceOS},
+			nodeName: "node-1",
+			hostname: "pod-1",
+			want:     "pod-1",
+		},
+		{
+			name:     "When the source is node-name, NODE_NAME is used",
+			config:   &Config{HostnameSource: HostnameSourceNodeName},
+			nodeName: "node-1",
+			hostname: "pod-1",
+			want:     "node-1",
+		},
+		{
+			name:     "When the source is node-name and NODE_NAME isn't set, it fails",
+			config:   &Config{HostnameSource: HostnameSourceNodeName},
+			hostname: "pod-1",
+			wantErr:  true,
+		},
+		{
+			name:     "When the source is fixed, the configured hostname is used",
+			config:   &Config{HostnameSource: HostnameSourceFixed, FixedHostname: "gpu-host"},
+			nodeName: "node-1",
+			hostname: "pod-1",
+			want:     "gpu-host",
+		},
+		{
+			name:    "When the source is fixed without hostname, it fails",
+			config:  &Config{HostnameSource: HostnameSourceFixed},
+			wantErr: true,
+		},
+		{
+			name:    "When the source is unknown, it fails",
+			config:  &Config{HostnameSource: "dns"},
+			wantErr: true,
+		},
+		{
+			name:    "When the hostname is omitted, the source isn't read",
+			config:  &Config{NoHostname: true, HostnameSource: HostnameSourceNodeName},
+			want:    "",
+			wantErr: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mOS := osmock.NewMockOS(ctrl)
+			mOS.EXPECT().Getenv("NODE_NAME").Return(tc.nodeName).AnyTimes()
+			mOS.EXPECT().Hostname().Return(tc.hostname, nil).AnyTimes()
+
+			os = mOS
+			defer func() {
+				os = osinterface.RealOS{}
+			}()
+
+			got, err := GetHostname(tc.config)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
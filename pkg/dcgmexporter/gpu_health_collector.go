@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// GPU health levels reported by the DCGM_EXP_GPU_HEALTH counter
+const (
+	gpuHealthPass = 0
+	gpuHealthWarn = 1
+	gpuHealthFail = 2
+)
+
+// gpuHealthLevels maps the dcgmHealthWatchResults_t of a health incident to a health level
+var gpuHealthLevels = map[int]int{
+	0:  gpuHealthPass,
+	10: gpuHealthWarn,
+	20: gpuHealthFail,
+}
+
+var (
+	dcgmHealthSetHook    = dcgmHealthSet
+	dcgmHealthCheckHook  = dcgmHealthCheck
+	dcgmDestroyGroupHook = dcgm.DestroyGroup
+)
+
+// IsDCGMExpGPUHealthEnabled checks if the DCGM_EXP_GPU_HEALTH counter exists
+func IsDCGMExpGPUHealthEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpGPUHealth
+	})
+}
+
+// gpuHealthCollector reports the result of the DCGM health checks of every monitored GPU.
+// It does not read field values, so the series stay available when a GPU stops reporting them.
+type gpuHealthCollector struct {
+	expCollector
+	group dcgm.GroupHandle
+	gpus  []uint
+}
+
+func NewGPUHealthCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem,
+) (Collector, error) {
+	if !IsDCGMExpGPUHealthEnabled(counters) {
+		logrus.Error(dcgmExpGPUHealth + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpGPUHealth + " collector is disabled")
+	}
+
+	collector := gpuHealthCollector{
+		expCollector: expCollector{
+			connection:      dcgmConnection.Load(),
+			sysInfo:         fieldEntityGroupTypeSystemInfo.SystemInfo,
+			hostname:        hostname,
+			config:          config,
+			transformations: getTransformations(config),
+		},
+	}
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpGPUHealth
+	})]
+
+	// Health checks are run per physical GPU, GPU instances share the result of their parent
+	for _, mi := range GetMonitoredEntities(collector.sysInfo) {
+		if !slices.Contains(collector.gpus, mi.DeviceInfo.GPU) {
+			collector.gpus = append(collector.gpus, mi.DeviceInfo.GPU)
+		}
+	}
+
+	group, err := dcgmCreateGroup(fmt.Sprintf("health-group-%d", rand.Uint64()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the health group; err: %w", err)
+	}
+
+	destroyGroup := func() {
+		if err := dcgmDestroyGroupHook(group); err != nil {
+			logrus.Warnf("Cannot destroy health group %v; err: %v", group, err)
+		}
+	}
+
+	for _, gpu := range collector.gpus {
+		if err := dcgmAddEntityToGroup(group, dcgm.FE_GPU, gpu); err != nil {
+			destroyGroup()
+			return nil, fmt.Errorf("cannot add GPU %d to the health group; err: %w", gpu, err)
+		}
+	}
+
+	// The health watches are registered once, DCGM keeps them for the lifetime of the group
+	if err := dcgmHealthSetHook(group); err != nil {
+		destroyGroup()
+		return nil, fmt.Errorf("cannot set the health watches; err: %w", err)
+	}
+
+	collector.group = group
+	collector.cleanups = append(collector.cleanups, destroyGroup)
+
+	return &collector, nil
+}
+
+func (c *gpuHealthCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	incidents, err := dcgmHealthCheckHook(c.group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the health of the GPUs; err: %w", err)
+	}
+
+	// A GPU without incidents is healthy, otherwise it reports its most severe incident
+	levels := make(map[uint]int, len(c.gpus))
+	for _, incident := range incidents {
+		if incident.entity.EntityGroupId != dcgm.FE_GPU {
+			continue
+		}
+
+		level, exists := gpuHealthLevels[incident.health]
+		if !exists {
+			logrus.Debugf("Unknown health result %d for GPU %d", incident.health, incident.entity.EntityId)
+			continue
+		}
+
+		levels[incident.entity.EntityId] = max(levels[incident.entity.EntityId], level)
+	}
+
+	metrics := make(MetricsByCounter)
+	var reported []uint
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		gpu := mi.DeviceInfo.GPU
+		if slices.Contains(reported, gpu) {
+			continue
+		}
+		reported = append(reported, gpu)
+
+		level := levels[gpu]
+		mi.InstanceInfo = nil
+		m := c.createMetric(map[string]string{}, mi, uuid, level)
+		metrics[c.counter] = append(metrics[c.counter], m)
+	}
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
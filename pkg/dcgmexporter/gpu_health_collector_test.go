@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUHealthCollector_GetMetrics(t *testing.T) {
+	group := dcgm.GroupHandle{}
+	var added []uint
+	var set, destroyed int
+
+	dcgmCreateGroup = func(string) (dcgm.GroupHandle, error) {
+		return group, nil
+	}
+	dcgmAddEntityToGroup = func(_ dcgm.GroupHandle, entityGroupID dcgm.Field_Entity_Group, entityID uint) error {
+		assert.Equal(t, dcgm.FE_GPU, entityGroupID)
+		added = append(added, entityID)
+		return nil
+	}
+	dcgmHealthSetHook = func(dcgm.GroupHandle) error {
+		set++
+		return nil
+	}
+	dcgmHealthCheckHook = func(dcgm.GroupHandle) ([]healthIncident, error) {
+		return []healthIncident{
+			{entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 1}, health: 10},
+			{entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 2}, health: 10},
+			{entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 2}, health: 20},
+			{entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 3}, health: 42},
+			{entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_SWITCH, EntityId: 0}, health: 20},
+		}, nil
+	}
+	dcgmDestroyGroupHook = func(dcgm.GroupHandle) error {
+		destroyed++
+		return nil
+	}
+	defer func() {
+		dcgmCreateGroup = dcgm.CreateGroup
+		dcgmAddEntityToGroup = dcgm.AddEntityToGroup
+		dcgmHealthSetHook = dcgmHealthSet
+		dcgmHealthCheckHook = dcgmHealthCheck
+		dcgmDestroyGroupHook = dcgm.DestroyGroup
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 4,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	counters := []Counter{{FieldID: dcgm.Short(DCGMGPUHealth), FieldName: dcgmExpGPUHealth, PromType: "gauge"}}
+	collector, err := NewGPUHealthCollector(counters, "local-test", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{0, 1, 2, 3}, added)
+
+	// The health watches are set once, not on every scrape
+	for i := 0; i < 2; i++ {
+		metrics, err := collector.GetMetrics()
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+
+		values := map[string]string{}
+		for _, metric := range metrics[counters[0]] {
+			assert.Equal(t, "local-test", metric.Hostname)
+			values[metric.GPU] = metric.Value
+		}
+
+		// GPUs report their most severe incident, unknown results are ignored
+		assert.Equal(t, map[string]string{"0": "0", "1": "1", "2": "2", "3": "0"}, values)
+	}
+	assert.Equal(t, 1, set)
+
+	collector.Cleanup()
+	assert.Equal(t, 1, destroyed)
+}
+
+func TestGPUHealthCollector_GetMetricsError(t *testing.T) {
+	dcgmCreateGroup = func(string) (dcgm.GroupHandle, error) {
+		return dcgm.GroupHandle{}, nil
+	}
+	dcgmHealthSetHook = func(dcgm.GroupHandle) error {
+		return nil
+	}
+	dcgmHealthCheckHook = func(dcgm.GroupHandle) ([]healthIncident, error) {
+		return nil, errors.New("boom")
+	}
+	defer func() {
+		dcgmCreateGroup = dcgm.CreateGroup
+		dcgmHealthSetHook = dcgmHealthSet
+		dcgmHealthCheckHook = dcgmHealthCheck
+	}()
+
+	counters := []Counter{{FieldID: dcgm.Short(DCGMGPUHealth), FieldName: dcgmExpGPUHealth, PromType: "gauge"}}
+	collector, err := NewGPUHealthCollector(counters, "local-test", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.NoError(t, err)
+
+	_, err = collector.GetMetrics()
+	require.Error(t, err)
+}
+
+func TestNewGPUHealthCollector_HealthSetError(t *testing.T) {
+	var destroyed int
+
+	dcgmCreateGroup = func(string) (dcgm.GroupHandle, error) {
+		return dcgm.GroupHandle{}, nil
+	}
+	dcgmHealthSetHook = func(dcgm.GroupHandle) error {
+		return errors.New("boom")
+	}
+	dcgmDestroyGroupHook = func(dcgm.GroupHandle) error {
+		destroyed++
+		return nil
+	}
+	defer func() {
+		dcgmCreateGroup = dcgm.CreateGroup
+		dcgmHealthSetHook = dcgmHealthSet
+		dcgmDestroyGroupHook = dcgm.DestroyGroup
+	}()
+
+	counters := []Counter{{FieldID: dcgm.Short(DCGMGPUHealth), FieldName: dcgmExpGPUHealth, PromType: "gauge"}}
+	_, err := NewGPUHealthCollector(counters, "local-test", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.Error(t, err)
+	assert.Equal(t, 1, destroyed)
+}
+
+func TestNewGPUHealthCollector_Disabled(t *testing.T) {
+	_, err := NewGPUHealthCollector([]Counter{}, "", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+// Values of the gpu label, see Config.GPULabelStrategy
+const (
+	GPULabelIndex         = "index"          // Index of the GPU on its host
+	GPULabelUUID          = "uuid"           // UUID of the GPU, the parent GPU for the GPU instances
+	GPULabelHostnameIndex = "hostname_index" // Hostname and index of the GPU, separated by '/'
+)
+
+const (
+	UUIDLabelGPU = "gpu" // UUID of the GPU, the parent GPU for the GPU instances
+	UUIDLabelMIG = "mig" // UUID of the MIG device for the GPU instances, of the GPU otherwise
+)
+
+// relabelGPUs replaces the index in the gpu label of the metrics according to the strategy, so that the label
+// identifies the GPU across hosts. It runs after the transformations, which look the GPUs up by index.
+func relabelGPUs(metrics MetricsByCounter, strategy string) {
+	if strategy == "" || strategy == GPULabelIndex {
+		return
+	}
+
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			metric := &metrics[counter][j]
+
+			switch strategy {
+			case GPULabelUUID:
+				metric.GPU = metric.GPUUUID
+			case GPULabelHostnameIndex:
+				metric.GPU = metric.Hostname + "/" + metric.GPU
+			}
+		}
+	}
+}
+
+// relabelUUIDs replaces the UUID of the parent GPU of the GPU instances by the UUID of their MIG device with
+// UUIDLabelMIG. The instances whose MIG UUID is unknown keep the UUID of their GPU. It runs after relabelGPUs, so the
+// gpu label is still the parent GPU with GPULabelUUID.
+func relabelUUIDs(metrics MetricsByCounter, source string) {
+	if source != UUIDLabelMIG {
+		return
+	}
+
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			metric := &metrics[counter][j]
+			if metric.MigUUID != "" {
+				metric.GPUUUID = metric.MigUUID
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabelGPUs(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	tests := []struct {
+		name     string
+		strategy string
+		want     string
+	}{
+		{
+			name:     "When no strategy is set, the index is kept",
+			strategy: "",
+			want:     "1",
+		},
+		{
+			name:     "When the strategy is index, the index is kept",
+			strategy: GPULabelIndex,
+			want:     "1",
+		},
+		{
+			name:     "When the strategy is uuid, the label is the UUID of the GPU",
+			strategy: GPULabelUUID,
+			want:     "GPU-11111111",
+		},
+		{
+			name:     "When the strategy is hostname_index, the label is prefixed with the hostname",
+			strategy: GPULabelHostnameIndex,
+			want:     "node-a/1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := MetricsByCounter{
+				counter: {{GPU: "1", GPUUUID: "GPU-11111111", Hostname: "node-a", UUID: "UUID", Value: "42"}},
+			}
+
+			relabelGPUs(metrics, tc.strategy)
+			assert.Equal(t, tc.want, metrics[counter][0].GPU)
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, `gpu="`+tc.want+`"`)
+		})
+	}
+}
+
+func TestRelabelUUIDs(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	tests := []struct {
+		name    string
+		source  string
+		migUUID string
+		want    string
+	}{
+		{
+			name:    "When no source is set, the UUID of the GPU is kept",
+			migUUID: "MIG-22222222",
+			want:    "GPU-11111111",
+		},
+		{
+			name:    "When the source is gpu, the UUID of the GPU is kept",
+			source:  UUIDLabelGPU,
+			migUUID: "MIG-22222222",
+			want:    "GPU-11111111",
+		},
+		{
+			name:    "When the source is mig, the label is the UUID of the MIG device",
+			source:  UUIDLabelMIG,
+			migUUID: "MIG-22222222",
+			want:    "MIG-22222222",
+		},
+		{
+			name:   "When the source is mig but the MIG UUID is unknown, the UUID of the GPU is kept",
+			source: UUIDLabelMIG,
+			want:   "GPU-11111111",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := MetricsByCounter{
+				counter: {{GPU: "1", GPUUUID: "GPU-11111111", MigProfile: "1g.10gb", GPUInstanceID: "7",
+					MigUUID: tc.migUUID, UUID: "UUID", Value: "42"}},
+			}
+
+			relabelGPUs(metrics, GPULabelUUID)
+			relabelUUIDs(metrics, tc.source)
+			assert.Equal(t, tc.want, metrics[counter][0].GPUUUID)
+			assert.Equal(t, "GPU-11111111", metrics[counter][0].GPU, "the gpu label stays the parent GPU")
+
+			out, err := FormatMetrics(migMetricsTemplate, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, `UUID="`+tc.want+`"`)
+		})
+	}
+}
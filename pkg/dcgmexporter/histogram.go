@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	histogramType      = "histogram"
+	bucketSeparator    = ";"
+	bucketLabel        = "le"
+	bucketSuffix       = "_bucket"
+	histogramSumSuffix = "_sum"
+	histogramCntSuffix = "_count"
+)
+
+// Histogram is the cumulative distribution of the values observed for a histogram counter
+type Histogram struct {
+	Bounds []float64 // Upper bounds of the buckets, in increasing order
+	Counts []uint64  // Number of observations less than or equal to each bound
+	Sum    float64
+	Count  uint64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *Histogram) observe(v float64) {
+	h.Sum += v
+	h.Count++
+
+	for i, bound := range h.Bounds {
+		if v <= bound {
+			h.Counts[i]++
+		}
+	}
+}
+
+// snapshot returns a copy of the histogram, so formatting it doesn't race with later observations
+func (h *Histogram) snapshot() *Histogram {
+	return &Histogram{
+		Bounds: h.Bounds,
+		Counts: slices.Clone(h.Counts),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// parseBuckets parses the ';' separated upper bounds of histogram buckets, they must be finite and increasing
+func parseBuckets(spec string) ([]float64, error) {
+	var bounds []float64
+
+	for _, s := range strings.Split(spec, bucketSeparator) {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket '%s'; err: %w", s, err)
+		}
+
+		if math.IsInf(bound, 0) || math.IsNaN(bound) {
+			return nil, fmt.Errorf("invalid bucket '%s'; the +Inf bucket is implicit", s)
+		}
+
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("buckets '%s' are not in increasing order", spec)
+		}
+
+		bounds = append(bounds, bound)
+	}
+
+	return bounds, nil
+}
+
+// validateBuckets checks that buckets are set for histogram counters, and only for them
+func validateBuckets(fieldName, promType, buckets string) error {
+	if promType != histogramType {
+		if buckets != "" {
+			return fmt.Errorf("counter '%s' has buckets but is of type '%s'", fieldName, promType)
+		}
+		return nil
+	}
+
+	if buckets == "" {
+		return fmt.Errorf("histogram counter '%s' has no buckets", fieldName)
+	}
+
+	if _, err := parseBuckets(buckets); err != nil {
+		return fmt.Errorf("histogram counter '%s' is malformed; err: %w", fieldName, err)
+	}
+
+	return nil
+}
+
+// observeHistograms adds the collected values of the histogram counters to the distributions of their series
+// and attaches the result to the metrics
+func (c *DCGMCollector) observeHistograms(metrics MetricsByCounter) {
+	for counter, counterMetrics := range metrics {
+		if counter.PromType != histogramType {
+			continue
+		}
+
+		for i, metric := range counterMetrics {
+			v, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				logrus.Debugf("Skipping histogram observation of '%s'; err: %v", counter.FieldName, err)
+				continue
+			}
+
+			key := strings.Join([]string{counter.FieldName, metric.GPU, metric.GPUInstanceID, metric.GPUComputeInstanceID,
+				metric.GPUDevice}, "/")
+			h, exists := c.histograms[key]
+			if !exists {
+				bounds, err := parseBuckets(counter.Buckets)
+				if err != nil {
+					logrus.Warnf("Skipping histogram counter '%s'; err: %v", counter.FieldName, err)
+					continue
+				}
+
+				if c.histograms == nil {
+					c.histograms = map[string]*Histogram{}
+				}
+
+				h = newHistogram(bounds)
+				c.histograms[key] = h
+			}
+
+			h.observe(v)
+			counterMetrics[i].Histogram = h.snapshot()
+		}
+	}
+}
+
+// expandHistograms replaces each metric holding a histogram by its `_bucket`, `_sum` and `_count` series.
+// The metrics are returned as is when no counter is a histogram.
+func expandHistograms(groupedMetrics MetricsByCounter) MetricsByCounter {
+	hasHistogram := false
+	for counter := range groupedMetrics {
+		if counter.PromType == histogramType {
+			hasHistogram = true
+			break
+		}
+	}
+
+	if !hasHistogram {
+		return groupedMetrics
+	}
+
+	res := make(MetricsByCounter, len(groupedMetrics))
+	for counter, metrics := range groupedMetrics {
+		if counter.PromType != histogramType {
+			res[counter] = metrics
+			continue
+		}
+
+		for _, metric := range metrics {
+			if metric.Histogram == nil {
+				res[counter] = append(res[counter], metric)
+				continue
+			}
+
+			h := metric.Histogram
+			for i, bound := range h.Bounds {
+				res[counter] = append(res[counter],
+					histogramSeries(metric, bucketSuffix, strconv.FormatFloat(bound, 'f', -1, 64), fmt.Sprint(h.Counts[i])))
+			}
+			res[counter] = append(res[counter],
+				histogramSeries(metric, bucketSuffix, "+Inf", fmt.Sprint(h.Count)),
+				histogramSeries(metric, histogramSumSuffix, "", strconv.FormatFloat(h.Sum, 'f', -1, 64)),
+				histogramSeries(metric, histogramCntSuffix, "", fmt.Sprint(h.Count)))
+		}
+	}
+
+	return res
+}
+
+// histogramSeries derives a series of the histogram from its metric, le is only set on buckets
+func histogramSeries(metric Metric, suffix, le, value string) Metric {
+	series := metric
+	series.Suffix = suffix
+	series.Value = value
+	series.Histogram = nil
+	series.Exemplar = nil
+
+	if le != "" {
+		series.Labels = maps.Clone(metric.Labels)
+		if series.Labels == nil {
+			series.Labels = map[string]string{}
+		}
+		series.Labels[bucketLabel] = le
+	}
+
+	return series
+}
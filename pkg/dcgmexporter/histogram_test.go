@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name: "When buckets are increasing, they are parsed",
+			spec: "500; 1000;1500.5",
+			want: []float64{500, 1000, 1500.5},
+		},
+		{
+			name:    "When a bucket is not a number, an error is returned",
+			spec:    "500;fast",
+			wantErr: true,
+		},
+		{
+			name:    "When buckets are not increasing, an error is returned",
+			spec:    "1000;500",
+			wantErr: true,
+		},
+		{
+			name:    "When the +Inf bucket is given, an error is returned",
+			spec:    "500;+Inf",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseBuckets(tc.spec)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestValidateBuckets(t *testing.T) {
+	assert.NoError(t, validateBuckets("DCGM_FI_DEV_GPU_TEMP", "gauge", ""))
+	assert.NoError(t, validateBuckets("DCGM_FI_DEV_SM_CLOCK", "histogram", "500;1000"))
+	assert.Error(t, validateBuckets("DCGM_FI_DEV_GPU_TEMP", "gauge", "500;1000"))
+	assert.Error(t, validateBuckets("DCGM_FI_DEV_SM_CLOCK", "histogram", ""))
+}
+
+func TestObserveHistograms(t *testing.T) {
+	clock := Counter{FieldID: 100, FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "histogram", Buckets: "500;1000"}
+	temp := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	c := &DCGMCollector{}
+	for _, value := range []string{"400", "900", "1400"} {
+		metrics := MetricsByCounter{
+			clock: {{Counter: clock, Value: value, GPU: "0"}},
+			temp:  {{Counter: temp, Value: "42", GPU: "0"}},
+		}
+		c.observeHistograms(metrics)
+
+		assert.Nil(t, metrics[temp][0].Histogram)
+		require.NotNil(t, metrics[clock][0].Histogram)
+	}
+
+	metrics := MetricsByCounter{clock: {{Counter: clock, Value: "700", GPU: "1"}}}
+	c.observeHistograms(metrics)
+
+	// Each GPU has its own distribution
+	assert.Equal(t, &Histogram{Bounds: []float64{500, 1000}, Counts: []uint64{1, 2}, Sum: 2700, Count: 3},
+		c.histograms["DCGM_FI_DEV_SM_CLOCK/0///"])
+	assert.Equal(t, &Histogram{Bounds: []float64{500, 1000}, Counts: []uint64{0, 1}, Sum: 700, Count: 1},
+		metrics[clock][0].Histogram)
+}
+
+func TestFormatMetricsHistogram(t *testing.T) {
+	clock := Counter{FieldID: 100, FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "histogram", Help: "SM clock.", Buckets: "500;1000"}
+	temp := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature."}
+
+	metrics := MetricsByCounter{
+		clock: {{
+			Counter:   clock,
+			Value:     "1400",
+			GPU:       "0",
+			UUID:      "UUID",
+			GPUUUID:   "GPU-00000000",
+			GPUDevice: "nvidia0",
+			Histogram: &Histogram{Bounds: []float64{500, 1000}, Counts: []uint64{1, 2}, Sum: 2700, Count: 3},
+			Labels:    map[string]string{"cluster": "a"},
+		}},
+		temp: {{
+			Counter:   temp,
+			Value:     "42",
+			GPU:       "0",
+			UUID:      "UUID",
+			GPUUUID:   "GPU-00000000",
+			GPUDevice: "nvidia0",
+		}},
+	}
+
+	got, err := FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+
+	labels := `gpu="0",UUID="GPU-00000000",pci_bus_id="",device="nvidia0",modelName="",cluster="a"`
+	assert.Contains(t, got, `# TYPE DCGM_FI_DEV_SM_CLOCK histogram
+DCGM_FI_DEV_SM_CLOCK_bucket{`+labels+`,le="500"} 1
+DCGM_FI_DEV_SM_CLOCK_bucket{`+labels+`,le="1000"} 2
+DCGM_FI_DEV_SM_CLOCK_bucket{`+labels+`,le="+Inf"} 3
+DCGM_FI_DEV_SM_CLOCK_sum{`+labels+`} 2700
+DCGM_FI_DEV_SM_CLOCK_count{`+labels+`} 3
+`)
+	assert.Contains(t, got, `DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-00000000",pci_bus_id="",device="nvidia0",modelName=""} 42`)
+
+	// The labels of the collected metric are left untouched
+	assert.Equal(t, map[string]string{"cluster": "a"}, metrics[clock][0].Labels)
+}
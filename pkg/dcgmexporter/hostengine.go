@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// hostengineConnectHook connects DCGM to the nv-hostengine listening at the endpoint
+	hostengineConnectHook = func(endpoint string) (func(), error) {
+		return dcgm.Init(dcgm.Standalone, endpoint, "0")
+	}
+
+	// hostengineProbeHook fails when the active nv-hostengine doesn't answer anymore
+	hostengineProbeHook = func() error {
+		_, err := dcgm.GetAllDeviceCount()
+		return err
+	}
+)
+
+// dcgmConnection identifies the connection to DCGM, it changes every time Hostengine fails over
+var dcgmConnection atomic.Uint64
+
+// staleConnection reports whether DCGM reconnected since the resources of a collector were created on the
+// connection. Their groups and watches went away with it and the current connection may reuse their IDs, so the
+// collector drops its cleanups without calling DCGM.
+func staleConnection(connection uint64) bool {
+	return dcgmConnection.Load() != connection
+}
+
+// Hostengine is the connection to one of the nv-hostengine endpoints of Config.RemoteHEInfo. It fails over to the
+// next endpoint, in order, when the active one stops answering.
+type Hostengine struct {
+	mtx       sync.Mutex
+	endpoints []string
+	active    int
+	cleanup   func() // Nil while no endpoint is connected
+	pauses    []sync.Locker
+
+	failovers atomic.Uint64
+}
+
+// ParseRemoteHEInfo splits the comma-separated <HOST>:<PORT> endpoints of Config.RemoteHEInfo
+func ParseRemoteHEInfo(info string) []string {
+	var res []string
+	for _, endpoint := range strings.Split(info, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			res = append(res, endpoint)
+		}
+	}
+
+	return res
+}
+
+// ConnectHostengine connects to the first endpoint that answers, in order
+func ConnectHostengine(endpoints []string) (*Hostengine, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no nv-hostengine endpoint to connect to")
+	}
+
+	h := &Hostengine{endpoints: endpoints}
+	if err := h.connect(0); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// connect tries the endpoints in order from start, wrapping around, callers must hold mtx
+func (h *Hostengine) connect(start int) error {
+	var errs []error
+	for i := range h.endpoints {
+		idx := (start + i) % len(h.endpoints)
+		endpoint := h.endpoints[idx]
+
+		logrus.Infof("Connecting to nv-hostengine at %s", endpoint)
+		cleanup, err := hostengineConnectHook(endpoint)
+		if err != nil {
+			if cleanup != nil {
+				cleanup()
+			}
+			logrus.WithError(err).Warnf("Failed to connect to nv-hostengine at %s", endpoint)
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+			continue
+		}
+
+		h.active = idx
+		h.cleanup = cleanup
+
+		return nil
+	}
+
+	return fmt.Errorf("could not connect to any nv-hostengine of '%s'; err: %w", strings.Join(h.endpoints, ","),
+		errors.Join(errs...))
+}
+
+// Check probes the active endpoint and fails over to the next ones when it doesn't answer. It reports whether the
+// connection changed, the fields must then be watched again since the watches belong to the previous connection.
+// The collections registered with pause are held while DCGM is shut down and initialized again.
+func (h *Hostengine) Check() (bool, error) {
+	h.mtx.Lock()
+	connected := h.cleanup != nil
+	pauses := slices.Clone(h.pauses)
+	h.mtx.Unlock()
+
+	var probeErr error
+	if connected {
+		probeErr = hostengineProbeHook()
+		if probeErr == nil {
+			return false, nil
+		}
+	}
+
+	// The collections take mtx to read the endpoint, so they are paused first
+	for _, pause := range pauses {
+		pause.Lock()
+		defer pause.Unlock()
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.cleanup != nil {
+		logrus.WithError(probeErr).Warnf("Lost the connection to nv-hostengine at %s; failing over",
+			h.endpoints[h.active])
+		h.cleanup()
+		h.cleanup = nil
+	}
+
+	if err := h.connect(h.active + 1); err != nil {
+		return false, err
+	}
+
+	dcgmConnection.Add(1)
+	h.failovers.Add(1)
+	logrus.Infof("Failed over to nv-hostengine at %s", h.endpoints[h.active])
+
+	return true, nil
+}
+
+// Endpoint returns the active endpoint, or an empty string while none is connected
+func (h *Hostengine) Endpoint() string {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.cleanup == nil {
+		return ""
+	}
+
+	return h.endpoints[h.active]
+}
+
+// Failovers returns the number of times the connection moved to another endpoint
+func (h *Hostengine) Failovers() uint64 {
+	return h.failovers.Load()
+}
+
+// pause registers a lock guarding collections, Check holds it while it reconnects
+func (h *Hostengine) pause(l sync.Locker) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.pauses = append(h.pauses, l)
+}
+
+// SetHostengine reports the active endpoint and the failovers of the connection with the internal metrics. The
+// collections are paused while the connection fails over.
+func (m *MetricsPipeline) SetHostengine(h *Hostengine) {
+	m.mtx.Lock()
+	m.hostengine = h
+	m.mtx.Unlock()
+
+	h.pause(&m.mtx)
+}
+
+// SetHostengine pauses the collections of the registry while the connection fails over
+func (r *Registry) SetHostengine(h *Hostengine) {
+	h.pause(&r.mtx)
+}
+
+// Close disconnects from the active endpoint
+func (h *Hostengine) Close() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.cleanup != nil {
+		h.cleanup()
+		h.cleanup = nil
+	}
+}
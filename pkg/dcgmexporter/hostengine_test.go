@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockHostengines replaces the DCGM connection with endpoints that answer when they are up
+func mockHostengines(t *testing.T, up map[string]bool) *[]string {
+	t.Helper()
+
+	var connected []string
+	active := ""
+
+	connectHook, probeHook := hostengineConnectHook, hostengineProbeHook
+	hostengineConnectHook = func(endpoint string) (func(), error) {
+		if !up[endpoint] {
+			return nil, fmt.Errorf("Error connecting to nv-hostengine: Host engine connection invalid/disconnected")
+		}
+		active = endpoint
+		connected = append(connected, endpoint)
+		return func() { active = "" }, nil
+	}
+	hostengineProbeHook = func() error {
+		if active == "" || !up[active] {
+			return fmt.Errorf("Host engine connection invalid/disconnected")
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		hostengineConnectHook, hostengineProbeHook = connectHook, probeHook
+	})
+
+	return &connected
+}
+
+func TestParseRemoteHEInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+		want []string
+	}{
+		{
+			name: "When a single endpoint is given, it is returned",
+			info: "localhost:5555",
+			want: []string{"localhost:5555"},
+		},
+		{
+			name: "When several endpoints are given, they are returned in order",
+			info: "primary:5555, secondary:5555,,",
+			want: []string{"primary:5555", "secondary:5555"},
+		},
+		{
+			name: "When no endpoint is given, nothing is returned",
+			info: " ",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ParseRemoteHEInfo(tc.info))
+		})
+	}
+}
+
+func TestConnectHostengine(t *testing.T) {
+	tests := []struct {
+		name    string
+		up      map[string]bool
+		want    string
+		wantErr string
+	}{
+		{
+			name: "When the first endpoint answers, it is active",
+			up:   map[string]bool{"primary:5555": true, "secondary:5555": true},
+			want: "primary:5555",
+		},
+		{
+			name: "When the first endpoint doesn't answer, the next one is active",
+			up:   map[string]bool{"secondary:5555": true},
+			want: "secondary:5555",
+		},
+		{
+			name:    "When no endpoint answers, an error is returned",
+			up:      map[string]bool{},
+			wantErr: "could not connect to any nv-hostengine of 'primary:5555,secondary:5555'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockHostengines(t, tc.up)
+
+			h, err := ConnectHostengine([]string{"primary:5555", "secondary:5555"})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, h.Endpoint())
+			assert.Equal(t, uint64(0), h.Failovers())
+		})
+	}
+}
+
+func TestHostengine_Check(t *testing.T) {
+	up := map[string]bool{"primary:5555": true, "secondary:5555": true}
+	connected := mockHostengines(t, up)
+
+	h, err := ConnectHostengine([]string{"primary:5555", "secondary:5555"})
+	require.NoError(t, err)
+
+	changed, err := h.Check()
+	require.NoError(t, err)
+	assert.False(t, changed, "the connection must be kept while the endpoint answers")
+
+	up["primary:5555"] = false
+	changed, err = h.Check()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "secondary:5555", h.Endpoint())
+	assert.Equal(t, uint64(1), h.Failovers())
+
+	up["secondary:5555"] = false
+	_, err = h.Check()
+	require.Error(t, err)
+	assert.Equal(t, "", h.Endpoint(), "no endpoint is active once they all failed")
+
+	up["primary:5555"] = true
+	changed, err = h.Check()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "primary:5555", h.Endpoint())
+	assert.Equal(t, uint64(2), h.Failovers())
+	assert.Equal(t, []string{"primary:5555", "secondary:5555", "primary:5555"}, *connected)
+
+	h.Close()
+	assert.Equal(t, "", h.Endpoint())
+}
+
+func TestHostengine_CheckPausesCollections(t *testing.T) {
+	up := map[string]bool{"primary:5555": true, "secondary:5555": true}
+	mockHostengines(t, up)
+
+	h, err := ConnectHostengine([]string{"primary:5555", "secondary:5555"})
+	require.NoError(t, err)
+
+	pipeline := &MetricsPipeline{}
+	pipeline.SetHostengine(h)
+	registry := NewRegistry()
+	registry.SetHostengine(h)
+
+	connectHook := hostengineConnectHook
+	hostengineConnectHook = func(endpoint string) (func(), error) {
+		assert.False(t, pipeline.mtx.TryLock(), "the pipeline must not collect while DCGM reconnects")
+		assert.False(t, registry.mtx.TryLock(), "the registry must not collect while DCGM reconnects")
+		return connectHook(endpoint)
+	}
+
+	up["primary:5555"] = false
+	changed, err := h.Check()
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	// The collections resume once the connection failed over
+	assert.True(t, pipeline.mtx.TryLock())
+	assert.True(t, registry.mtx.TryLock())
+}
+
+func TestStaleConnection(t *testing.T) {
+	var cleaned int
+	collector := expCollector{
+		connection: dcgmConnection.Load(),
+		cleanups:   []func(){func() { cleaned++ }},
+	}
+
+	collector.Cleanup()
+	assert.Equal(t, 1, cleaned)
+
+	// The groups of the previous connection may have been reused, they are not destroyed
+	dcgmConnection.Add(1)
+	collector.Cleanup()
+	assert.Equal(t, 1, cleaned)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+const jsonContentType = "application/json"
+
+// jsonNumber matches the values that are valid JSON numbers, ParseFloat also accepts NaN, Inf, hexadecimal and
+// underscored values that json.Marshal rejects
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// jsonMetric is the representation of a single Metric in the JSON output format
+type jsonMetric struct {
+	Name              string            `json:"name"`
+	Value             any               `json:"value"`
+	Timestamp         json.Number       `json:"timestamp,omitempty"`
+	GPU               string            `json:"gpu"`
+	UUID              string            `json:"uuid,omitempty"`
+	Device            string            `json:"device,omitempty"`
+	ModelName         string            `json:"modelName,omitempty"`
+	PCIBusID          string            `json:"pci_bus_id,omitempty"`
+	NUMANode          string            `json:"numa_node,omitempty"`
+	DriverVersion     string            `json:"driver_version,omitempty"`
+	VBIOSVersion      string            `json:"vbios_version,omitempty"`
+	CPUAffinity       string            `json:"cpu_affinity,omitempty"`
+	MigProfile        string            `json:"GPU_I_PROFILE,omitempty"`
+	GPUInstanceID     string            `json:"GPU_I_ID,omitempty"`
+	GPUInstanceMemory string            `json:"GPU_I_MEM_MB,omitempty"`
+	ComputeInstanceID string            `json:"GPU_CI_ID,omitempty"`
+	VGPUInstance      string            `json:"vgpu_instance,omitempty"`
+	SwitchPhysID      string            `json:"nvswitch_phys_id,omitempty"`
+	Hostname          string            `json:"hostname,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Attributes        map[string]string `json:"attributes,omitempty"`
+}
+
+// jsonCounter is the representation of a Counter served by the counters endpoint
+type jsonCounter struct {
+	FieldID   uint16  `json:"field_id"`
+	FieldName string  `json:"field_name"`
+	PromType  string  `json:"type"`
+	Help      string  `json:"help"`
+	Buckets   string  `json:"buckets,omitempty"`
+	Scope     string  `json:"scope,omitempty"`
+	Scale     float64 `json:"scale,omitempty"`
+	Devices   string  `json:"devices,omitempty"`
+}
+
+// formatCountersJSON renders the counters as a JSON array, in the given order
+func formatCountersJSON(counters []Counter) ([]byte, error) {
+	res := make([]jsonCounter, 0, len(counters))
+	for _, counter := range counters {
+		res = append(res, jsonCounter{
+			FieldID:   uint16(counter.FieldID),
+			FieldName: counter.FieldName,
+			PromType:  counter.PromType,
+			Help:      counter.Help,
+			Buckets:   counter.Buckets,
+			Scope:     counter.Scope,
+			Scale:     counter.Scale,
+			Devices:   counter.Devices,
+		})
+	}
+
+	return json.Marshal(res)
+}
+
+// FormatMetricsJSON renders the metrics as a flat JSON array with one object per metric.
+// Metrics are ordered like in the text format, the histograms are expanded to their `_bucket`, `_sum` and `_count`
+// series like in the text format, and numeric values are kept as JSON numbers.
+func FormatMetricsJSON(groupedMetrics MetricsByCounter) (string, error) {
+	res := []jsonMetric{}
+	for _, group := range sortMetrics(expandHistograms(groupedMetrics)) {
+		counter := group.Counter
+		for _, metric := range group.Metrics {
+			res = append(res, jsonMetric{
+				Name:              counter.FieldName + metric.Suffix,
+				Value:             toJSONValue(metric.Value),
+				Timestamp:         json.Number(metric.Timestamp),
+				GPU:               metric.GPU,
+				UUID:              metric.GPUUUID,
+				Device:            metric.GPUDevice,
+				ModelName:         metric.GPUModelName,
+				PCIBusID:          metric.GPUPCIBusID,
+				NUMANode:          metric.GPUNUMANode,
+				DriverVersion:     metric.GPUDriverVersion,
+				VBIOSVersion:      metric.GPUVBIOSVersion,
+				CPUAffinity:       metric.GPUCPUAffinity,
+				MigProfile:        metric.MigProfile,
+				GPUInstanceID:     metric.GPUInstanceID,
+				GPUInstanceMemory: metric.GPUInstanceMemoryMB,
+				ComputeInstanceID: metric.GPUComputeInstanceID,
+				VGPUInstance:      metric.VGPUInstance,
+				SwitchPhysID:      metric.SwitchPhysID,
+				Hostname:          metric.Hostname,
+				Labels:            metric.Labels,
+				Attributes:        metric.Attributes,
+			})
+		}
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// toJSONValue keeps finite decimal values as JSON numbers and falls back to a string otherwise
+func toJSONValue(value string) any {
+	if jsonNumber.MatchString(value) {
+		return json.Number(value)
+	}
+
+	return value
+}
+
+// joinJSONArrays merges JSON arrays produced by FormatMetricsJSON into a single array.
+// Empty strings are ignored.
+func joinJSONArrays(arrays ...string) string {
+	var elements []string
+	for _, array := range arrays {
+		array = strings.TrimSpace(array)
+		if len(array) <= len("[]") {
+			continue
+		}
+
+		elements = append(elements, array[1:len(array)-1])
+	}
+
+	return "[" + strings.Join(elements, ",") + "]"
+}
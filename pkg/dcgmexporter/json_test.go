@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMetricsJSON(t *testing.T) {
+	temp := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	power := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+
+	metrics := MetricsByCounter{
+		power: {
+			{
+				Counter:  power,
+				Value:    "72.500000",
+				GPU:      "0",
+				GPUUUID:  "fake0",
+				Hostname: "host",
+			},
+		},
+		temp: {
+			{
+				Counter:    temp,
+				Value:      "42",
+				GPU:        "0",
+				GPUUUID:    "fake0",
+				Hostname:   "host",
+				Labels:     map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15"},
+				Attributes: map[string]string{"pod": "gpu-pod"},
+			},
+		},
+	}
+
+	out, err := FormatMetricsJSON(metrics)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"name":"DCGM_FI_DEV_GPU_TEMP","value":42,"gpu":"0","uuid":"fake0","hostname":"host",
+		 "labels":{"DCGM_FI_DRIVER_VERSION":"550.54.15"},"attributes":{"pod":"gpu-pod"}},
+		{"name":"DCGM_FI_DEV_POWER_USAGE","value":72.5,"gpu":"0","uuid":"fake0","hostname":"host"}
+	]`, out)
+
+	out, err = FormatMetricsJSON(MetricsByCounter{})
+	require.NoError(t, err)
+	assert.Equal(t, "[]", out)
+}
+
+func TestFormatMetricsJSONNonFinite(t *testing.T) {
+	counter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{
+			name:  "When the value is NaN, it is emitted as a string",
+			value: "NaN",
+			want:  `"NaN"`,
+		},
+		{
+			name:  "When the value is +Inf, it is emitted as a string",
+			value: "+Inf",
+			want:  `"+Inf"`,
+		},
+		{
+			name:  "When the value is -Inf, it is emitted as a string",
+			value: "-Inf",
+			want:  `"-Inf"`,
+		},
+		{
+			name:  "When the value is not in decimal form, it is emitted as a string",
+			value: "1_000",
+			want:  `"1_000"`,
+		},
+		{
+			name:  "When the value has an exponent, it is emitted as a number",
+			value: "-1.5e+10",
+			want:  `-1.5e+10`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := FormatMetricsJSON(MetricsByCounter{
+				counter: {{Counter: counter, Value: tc.value, GPU: "0", GPUUUID: "fake0", Hostname: "host"}},
+			})
+			require.NoError(t, err)
+			assert.JSONEq(t, `[{"name":"DCGM_FI_DEV_GPU_TEMP","value":`+tc.want+
+				`,"gpu":"0","uuid":"fake0","hostname":"host"}]`, out)
+		})
+	}
+}
+
+func TestFormatMetricsJSONHistogram(t *testing.T) {
+	clock := Counter{FieldID: 100, FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "histogram", Buckets: "500;1000"}
+
+	out, err := FormatMetricsJSON(MetricsByCounter{
+		clock: {{
+			Counter:   clock,
+			Value:     "1400",
+			GPU:       "0",
+			GPUUUID:   "fake0",
+			Histogram: &Histogram{Bounds: []float64{500, 1000}, Counts: []uint64{1, 2}, Sum: 2700, Count: 3},
+		}},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"name":"DCGM_FI_DEV_SM_CLOCK_bucket","value":1,"gpu":"0","uuid":"fake0","labels":{"le":"500"}},
+		{"name":"DCGM_FI_DEV_SM_CLOCK_bucket","value":2,"gpu":"0","uuid":"fake0","labels":{"le":"1000"}},
+		{"name":"DCGM_FI_DEV_SM_CLOCK_bucket","value":3,"gpu":"0","uuid":"fake0","labels":{"le":"+Inf"}},
+		{"name":"DCGM_FI_DEV_SM_CLOCK_sum","value":2700,"gpu":"0","uuid":"fake0"},
+		{"name":"DCGM_FI_DEV_SM_CLOCK_count","value":3,"gpu":"0","uuid":"fake0"}
+	]`, out)
+}
+
+func TestJoinJSONArrays(t *testing.T) {
+	assert.Equal(t, "[]", joinJSONArrays())
+	assert.Equal(t, "[]", joinJSONArrays("", "[]"))
+	assert.Equal(t, `[{"a":1},{"b":2},{"c":3}]`, joinJSONArrays(`[{"a":1},{"b":2}]`, "", `[{"c":3}]`))
+}
@@ -18,11 +18,13 @@ package dcgmexporter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -36,6 +38,12 @@ import (
 var (
 	connectionTimeout = 10 * time.Second
 
+	// Delay before reconnecting to the kubelet after a failure, doubled after every consecutive failure
+	podResourcesMinBackoff = time.Second
+	podResourcesMaxBackoff = time.Minute
+
+	errPodResourcesBackoff = errors.New("waiting to reconnect to the kubelet")
+
 	gkeMigDeviceIDRegex            = regexp.MustCompile(`^nvidia([0-9]+)/gi([0-9]+)$`)
 	gkeVirtualGPUDeviceIDSeparator = "/vgpu"
 	nvmlGetMIGDeviceInfoByIDHook   = nvmlprovider.GetMIGDeviceInfoByID
@@ -45,7 +53,8 @@ func NewPodMapper(c *Config) (*PodMapper, error) {
 	logrus.Infof("Kubernetes metrics collection enabled!")
 
 	return &PodMapper{
-		Config: c,
+		Config:       c,
+		podResources: &kubeletPodResources{socket: c.PodResourcesKubeletSocket},
 	}, nil
 }
 
@@ -53,24 +62,28 @@ func (p *PodMapper) Name() string {
 	return "podMapper"
 }
 
-func (p *PodMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
-	socketPath := p.Config.PodResourcesKubeletSocket
-	_, err := os.Stat(socketPath)
-	if os.IsNotExist(err) {
-		logrus.Info("No Kubelet socket, ignoring")
-		return nil
-	}
+// Failures returns the number of Process calls that could not list the pods. The metrics of these calls are
+// exported without the pod attributes.
+func (p *PodMapper) Failures() uint64 {
+	return p.failures.Load()
+}
 
-	// TODO: This needs to be moved out of the critical path.
-	c, cleanup, err := connectToServer(socketPath)
+func (p *PodMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
+	pods, err := p.podResources.List()
 	if err != nil {
-		return err
+		p.failures.Add(1)
+		if errors.Is(err, errPodResourcesBackoff) {
+			logrus.Debugf("Skipping the pod mapping; err: %v", err)
+		} else {
+			logrus.Warnf("Failed to list the pods, the metrics are exported without the pod labels; err: %v", err)
+		}
+
+		// The other attributes, like the default sharing strategy, are still set to keep the series stable
+		pods = &podresourcesapi.ListPodResourcesResponse{}
 	}
-	defer cleanup()
 
-	pods, err := p.listPods(c)
-	if err != nil {
-		return err
+	if pods == nil {
+		return nil
 	}
 
 	deviceToPod := p.toDeviceToPod(pods, sysInfo)
@@ -86,25 +99,105 @@ func (p *PodMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error
 				return err
 			}
 
+			sharingStrategy := p.Config.SharingStrategy
+
 			podInfo, exists := deviceToPod[deviceID]
 			if exists {
+				sharingStrategy = podInfo.SharingStrategy
+
 				if !p.Config.UseOldNamespace {
 					metrics[counter][j].Attributes[podAttribute] = podInfo.Name
 					metrics[counter][j].Attributes[namespaceAttribute] = podInfo.Namespace
-					metrics[counter][j].Attributes[containerAttribute] = podInfo.Container
+					if !p.Config.KubernetesRemoveContainerLabel {
+						metrics[counter][j].Attributes[containerAttribute] = podInfo.Container
+					}
 				} else {
 					metrics[counter][j].Attributes[oldPodAttribute] = podInfo.Name
 					metrics[counter][j].Attributes[oldNamespaceAttribute] = podInfo.Namespace
-					metrics[counter][j].Attributes[oldContainerAttribute] = podInfo.Container
+					if !p.Config.KubernetesRemoveContainerLabel {
+						metrics[counter][j].Attributes[oldContainerAttribute] = podInfo.Container
+					}
 				}
 			}
+
+			if sharingStrategy != "" {
+				metrics[counter][j].Attributes[sharingStrategyAttribute] = sharingStrategy
+			}
 		}
 	}
 
 	return nil
 }
 
-func connectToServer(socket string) (*grpc.ClientConn, func(), error) {
+// podResourcesLister lists the devices allocated to the pods, a nil response means the pods can't be listed on
+// this node
+type podResourcesLister interface {
+	List() (*podresourcesapi.ListPodResourcesResponse, error)
+}
+
+// kubeletPodResources lists the pods with the pod-resources API of the kubelet listening on socket. The
+// connection is kept between the calls and re-established after a failure, once the backoff delay elapsed.
+type kubeletPodResources struct {
+	socket string
+
+	mtx     sync.Mutex
+	conn    *grpc.ClientConn
+	backoff time.Duration // Delay of the last failure, 0 after a success
+	retryAt time.Time     // The connection is not re-established before
+}
+
+func (k *kubeletPodResources) List() (*podresourcesapi.ListPodResourcesResponse, error) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	_, err := os.Stat(k.socket)
+	if os.IsNotExist(err) {
+		logrus.Info("No Kubelet socket, ignoring")
+		k.close()
+		return nil, nil
+	}
+
+	if k.conn == nil {
+		if wait := time.Until(k.retryAt); wait > 0 {
+			return nil, fmt.Errorf("%w, retrying in %s", errPodResourcesBackoff, wait.Round(time.Millisecond))
+		}
+
+		conn, err := connectToServer(k.socket)
+		if err != nil {
+			k.fail()
+			return nil, err
+		}
+		k.conn = conn
+	}
+
+	resp, err := listPods(k.conn)
+	if err != nil {
+		// The kubelet may have restarted, the next call reconnects to the new socket
+		k.close()
+		k.fail()
+		return nil, err
+	}
+
+	k.backoff = 0
+
+	return resp, nil
+}
+
+// fail delays the next connection, callers must hold mtx
+func (k *kubeletPodResources) fail() {
+	k.backoff = min(max(2*k.backoff, podResourcesMinBackoff), podResourcesMaxBackoff)
+	k.retryAt = time.Now().Add(k.backoff)
+}
+
+// close closes the connection if any, callers must hold mtx
+func (k *kubeletPodResources) close() {
+	if k.conn != nil {
+		k.conn.Close()
+		k.conn = nil
+	}
+}
+
+func connectToServer(socket string) (*grpc.ClientConn, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
 	defer cancel()
 
@@ -118,13 +211,13 @@ func connectToServer(socket string) (*grpc.ClientConn, func(), error) {
 		}),
 	)
 	if err != nil {
-		return nil, func() {}, fmt.Errorf("failure connecting to '%s'; err: %w", socket, err)
+		return nil, fmt.Errorf("failure connecting to '%s'; err: %w", socket, err)
 	}
 
-	return conn, func() { conn.Close() }, nil
+	return conn, nil
 }
 
-func (p *PodMapper) listPods(conn *grpc.ClientConn) (*podresourcesapi.ListPodResourcesResponse, error) {
+func listPods(conn *grpc.ClientConn) (*podresourcesapi.ListPodResourcesResponse, error) {
 	client := podresourcesapi.NewPodResourcesListerClient(conn)
 
 	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
@@ -144,6 +237,10 @@ func (p *PodMapper) toDeviceToPod(
 	deviceToPodMap := make(map[string]PodInfo)
 
 	for _, pod := range devicePods.GetPodResources() {
+		if !p.isNamespaceMapped(pod.GetNamespace()) {
+			continue
+		}
+
 		for _, container := range pod.GetContainers() {
 			for _, device := range container.GetDevices() {
 
@@ -155,13 +252,14 @@ func (p *PodMapper) toDeviceToPod(
 					}
 				}
 
-				podInfo := PodInfo{
-					Name:      pod.GetName(),
-					Namespace: pod.GetNamespace(),
-					Container: container.GetName(),
-				}
-
 				for _, deviceID := range device.GetDeviceIds() {
+					podInfo := PodInfo{
+						Name:            pod.GetName(),
+						Namespace:       pod.GetNamespace(),
+						Container:       container.GetName(),
+						SharingStrategy: p.sharingStrategy(deviceID),
+					}
+
 					if strings.HasPrefix(deviceID, MIG_UUID_PREFIX) {
 						migDevice, err := nvmlGetMIGDeviceInfoByIDHook(deviceID)
 						if err == nil {
@@ -199,3 +297,31 @@ func (p *PodMapper) toDeviceToPod(
 
 	return deviceToPodMap
 }
+
+// sharingStrategy returns the sharing strategy of a device allocated to a pod. The device plugin suffixes the IDs
+// of the replicas of a shared GPU with "::<replica>", they are shared by time-slicing unless the configured strategy
+// is MPS. The other devices aren't shared, which is only reported when a strategy is configured.
+func (p *PodMapper) sharingStrategy(deviceID string) string {
+	if !strings.Contains(deviceID, "::") {
+		if p.Config.SharingStrategy == "" {
+			return ""
+		}
+		return SharingStrategyNone
+	}
+
+	if p.Config.SharingStrategy == SharingStrategyMPS {
+		return SharingStrategyMPS
+	}
+
+	return SharingStrategyTimeSlicing
+}
+
+// isNamespaceMapped reports whether pods in the namespace may contribute labels.
+// The deny list wins over the allow list; an empty allow list allows every namespace.
+func (p *PodMapper) isNamespaceMapped(namespace string) bool {
+	if slices.Contains(p.Config.PodMappingNamespaceDeny, namespace) {
+		return false
+	}
+
+	return len(p.Config.PodMappingNamespaceAllow) == 0 || slices.Contains(p.Config.PodMappingNamespaceAllow, namespace)
+}
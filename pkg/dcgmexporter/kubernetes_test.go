@@ -62,7 +62,10 @@ func TestProcessPodMapper(t *testing.T) {
 	cleanup = StartMockServer(t, server, socketPath)
 	defer cleanup()
 
-	podMapper, err := NewPodMapper(&Config{KubernetesGPUIdType: GPUUID, PodResourcesKubeletSocket: socketPath})
+	podMapper, err := NewPodMapper(&Config{
+		KubernetesGPUIdType:       GPUUID,
+		PodResourcesKubeletSocket: socketPath,
+	})
 	require.NoError(t, err)
 	var sysInfo SystemInfo
 	err = podMapper.Process(out, sysInfo)
@@ -335,3 +338,365 @@ func TestProcessPodMapper_WithD_Different_Format_Of_DeviceID(t *testing.T) {
 			})
 	}
 }
+
+func TestPodMapper_toDeviceToPod_NamespaceFilter(t *testing.T) {
+	newPod := func(name, namespace, gpuUUID string) *podresourcesapi.PodResources {
+		return &podresourcesapi.PodResources{
+			Name:      name,
+			Namespace: namespace,
+			Containers: []*podresourcesapi.ContainerResources{
+				{
+					Name: "default",
+					Devices: []*podresourcesapi.ContainerDevices{
+						{
+							ResourceName: nvidiaResourceName,
+							DeviceIds:    []string{gpuUUID},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	pods := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			newPod("pod-a", "team-a", "GPU-0"),
+			newPod("pod-b", "team-b", "GPU-1"),
+			newPod("pod-c", "kube-system", "GPU-2"),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		wantIDs []string
+	}{
+		{
+			name:    "When no lists are set, all pods are mapped",
+			wantIDs: []string{"GPU-0", "GPU-1", "GPU-2"},
+		},
+		{
+			name:    "When allow list is set, only allowed namespaces are mapped",
+			allow:   []string{"team-a", "team-b"},
+			wantIDs: []string{"GPU-0", "GPU-1"},
+		},
+		{
+			name:    "When deny list is set, denied namespaces are skipped",
+			deny:    []string{"kube-system"},
+			wantIDs: []string{"GPU-0", "GPU-1"},
+		},
+		{
+			name:    "When both lists are set, deny takes precedence",
+			allow:   []string{"team-a", "team-b"},
+			deny:    []string{"team-b"},
+			wantIDs: []string{"GPU-0"},
+		},
+		{
+			name:    "When namespace names differ in case, they are not matched",
+			allow:   []string{"Team-A"},
+			wantIDs: []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			podMapper, err := NewPodMapper(&Config{
+				KubernetesGPUIdType:      GPUUID,
+				PodMappingNamespaceAllow: tc.allow,
+				PodMappingNamespaceDeny:  tc.deny,
+			})
+			require.NoError(t, err)
+
+			deviceToPod := podMapper.toDeviceToPod(pods, SystemInfo{})
+			gotIDs := make([]string, 0, len(deviceToPod))
+			for id := range deviceToPod {
+				gotIDs = append(gotIDs, id)
+			}
+			assert.ElementsMatch(t, tc.wantIDs, gotIDs)
+		})
+	}
+}
+
+func TestProcessPodMapper_ContainerLabel(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	const gpuUUID = "b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name            string
+		disabled        bool
+		useOldNamespace bool
+		wantAttribute   string
+		unwantAttribute string
+	}{
+		{
+			name:            "When container label is disabled, container attribute is not set",
+			disabled:        true,
+			unwantAttribute: containerAttribute,
+		},
+		{
+			name:          "When container label is not disabled, container attribute is set",
+			wantAttribute: containerAttribute,
+		},
+		{
+			name:            "When container label is disabled with old namespace, old container attribute is not set",
+			disabled:        true,
+			useOldNamespace: true,
+			unwantAttribute: oldContainerAttribute,
+		},
+		{
+			name:            "When container label is not disabled with old namespace, old container attribute is set",
+			useOldNamespace: true,
+			wantAttribute:   oldContainerAttribute,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir, cleanup := CreateTmpDir(t)
+			defer cleanup()
+			socketPath := tmpDir + "/kubelet.sock"
+
+			server := grpc.NewServer()
+			podresourcesapi.RegisterPodResourcesListerServer(server,
+				NewPodResourcesMockServer(nvidiaResourceName, []string{gpuUUID}))
+			cleanup = StartMockServer(t, server, socketPath)
+			defer cleanup()
+
+			podMapper, err := NewPodMapper(&Config{
+				KubernetesGPUIdType:            GPUUID,
+				PodResourcesKubeletSocket:      socketPath,
+				UseOldNamespace:                tc.useOldNamespace,
+				KubernetesRemoveContainerLabel: tc.disabled,
+			})
+			require.NoError(t, err)
+
+			counter := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+			metrics := MetricsByCounter{
+				counter: {
+					{GPU: "0", GPUUUID: gpuUUID, Value: "42", Counter: counter, Attributes: map[string]string{}},
+				},
+			}
+
+			err = podMapper.Process(metrics, SystemInfo{})
+			require.NoError(t, err)
+
+			attributes := metrics[counter][0].Attributes
+			if tc.wantAttribute != "" {
+				assert.Equal(t, "default", attributes[tc.wantAttribute])
+			}
+			if tc.unwantAttribute != "" {
+				assert.NotContains(t, attributes, tc.unwantAttribute)
+			}
+		})
+	}
+}
+
+func TestProcessPodMapper_SharingStrategy(t *testing.T) {
+	const gpuUUID = "b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name            string
+		podDeviceID     string
+		metricGPUUUID   string
+		sharingStrategy string
+		want            string
+	}{
+		{
+			name:          "When the device is not shared and no strategy is configured, the label is omitted",
+			podDeviceID:   gpuUUID,
+			metricGPUUUID: gpuUUID,
+		},
+		{
+			name:            "When the device is not shared and a strategy is configured, none is reported",
+			podDeviceID:     gpuUUID,
+			metricGPUUUID:   gpuUUID,
+			sharingStrategy: SharingStrategyTimeSlicing,
+			want:            SharingStrategyNone,
+		},
+		{
+			name:          "When the device is a replica and no strategy is configured, time-slicing is reported",
+			podDeviceID:   gpuUUID + "::1",
+			metricGPUUUID: gpuUUID,
+			want:          SharingStrategyTimeSlicing,
+		},
+		{
+			name:            "When the device is a replica and MPS is configured, mps is reported",
+			podDeviceID:     gpuUUID + "::1",
+			metricGPUUUID:   gpuUUID,
+			sharingStrategy: SharingStrategyMPS,
+			want:            SharingStrategyMPS,
+		},
+		{
+			name:            "When the GPU is not allocated to a pod, the configured strategy is reported",
+			podDeviceID:     gpuUUID,
+			metricGPUUUID:   "GPU-other",
+			sharingStrategy: SharingStrategyMPS,
+			want:            SharingStrategyMPS,
+		},
+		{
+			name:          "When the GPU is not allocated to a pod and no strategy is configured, the label is omitted",
+			podDeviceID:   gpuUUID + "::1",
+			metricGPUUUID: "GPU-other",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			podMapper, err := NewPodMapper(&Config{
+				KubernetesGPUIdType: GPUUID,
+				SharingStrategy:     tc.sharingStrategy,
+			})
+			require.NoError(t, err)
+			podMapper.podResources = newFakePodResources(nvidiaResourceName, tc.podDeviceID)
+
+			counter := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+			metrics := MetricsByCounter{
+				counter: {
+					{GPU: "0", GPUUUID: tc.metricGPUUUID, Value: "42", Counter: counter, Attributes: map[string]string{}},
+				},
+			}
+
+			err = podMapper.Process(metrics, SystemInfo{})
+			require.NoError(t, err)
+
+			attributes := metrics[counter][0].Attributes
+			if tc.want == "" {
+				assert.NotContains(t, attributes, sharingStrategyAttribute)
+			} else {
+				assert.Equal(t, tc.want, attributes[sharingStrategyAttribute])
+			}
+		})
+	}
+}
+
+// fakePodResources returns canned pod resources instead of querying the kubelet
+type fakePodResources struct {
+	resp *podresourcesapi.ListPodResourcesResponse
+	err  error
+}
+
+// newFakePodResources returns the pod resources the mock server lists for the devices
+func newFakePodResources(resourceName string, deviceIDs ...string) *fakePodResources {
+	resp, _ := NewPodResourcesMockServer(resourceName, deviceIDs).List(context.Background(), nil)
+	return &fakePodResources{resp: resp}
+}
+
+func (f *fakePodResources) List() (*podresourcesapi.ListPodResourcesResponse, error) {
+	return f.resp, f.err
+}
+
+func TestProcessPodMapper_PodResources(t *testing.T) {
+	const gpuUUID = "b8ea3855-276c-c9cb-b366-c6fa655957c5"
+
+	tests := []struct {
+		name         string
+		podResources *fakePodResources
+		wantPod      string
+		wantFailures uint64
+	}{
+		{
+			name:         "When the device is allocated to a pod, the pod attributes are set",
+			podResources: newFakePodResources(nvidiaResourceName, gpuUUID),
+			wantPod:      "gpu-pod-0",
+		},
+		{
+			name:         "When the device is allocated to another pod, the pod attributes are not set",
+			podResources: newFakePodResources(nvidiaResourceName, "GPU-other"),
+		},
+		{
+			name:         "When the pods can't be listed on the node, the metrics are left untouched",
+			podResources: &fakePodResources{},
+		},
+		{
+			name:         "When listing the pods fails, the metrics keep their other attributes and the failure is counted",
+			podResources: &fakePodResources{err: fmt.Errorf("connection refused")},
+			wantFailures: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			podMapper, err := NewPodMapper(&Config{KubernetesGPUIdType: GPUUID, SharingStrategy: SharingStrategyNone})
+			require.NoError(t, err)
+			podMapper.podResources = tc.podResources
+
+			counter := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+			metrics := MetricsByCounter{
+				counter: {
+					{GPU: "0", GPUUUID: gpuUUID, Value: "42", Counter: counter, Attributes: map[string]string{}},
+				},
+			}
+
+			err = podMapper.Process(metrics, SystemInfo{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantFailures, podMapper.Failures())
+
+			attributes := metrics[counter][0].Attributes
+			if tc.podResources.resp != nil || tc.podResources.err != nil {
+				assert.Equal(t, SharingStrategyNone, attributes[sharingStrategyAttribute])
+			}
+			if tc.wantPod == "" {
+				assert.NotContains(t, attributes, podAttribute)
+				return
+			}
+			assert.Equal(t, tc.wantPod, attributes[podAttribute])
+			assert.Equal(t, "default", attributes[namespaceAttribute])
+		})
+	}
+}
+
+func TestKubeletPodResources_Reconnect(t *testing.T) {
+	testutils.RequireLinux(t)
+
+	tmpDir, cleanup := CreateTmpDir(t)
+	defer cleanup()
+
+	defer func(timeout time.Duration) {
+		connectionTimeout = timeout
+	}(connectionTimeout)
+	connectionTimeout = 100 * time.Millisecond
+
+	// A regular file stands for the socket of a kubelet that is restarting
+	file, err := os.CreateTemp(tmpDir, "kubelet-*.sock")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	socketPath := file.Name()
+
+	podResources := &kubeletPodResources{socket: socketPath}
+
+	_, err = podResources.List()
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errPodResourcesBackoff)
+	assert.Equal(t, podResourcesMinBackoff, podResources.backoff)
+
+	_, err = podResources.List()
+	require.ErrorIs(t, err, errPodResourcesBackoff, "the connection is not retried before the backoff elapsed")
+
+	require.NoError(t, os.Remove(socketPath))
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server,
+		NewPodResourcesMockServer(nvidiaResourceName, []string{"GPU-0"}))
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	podResources.retryAt = time.Time{}
+	resp, err := podResources.List()
+	require.NoError(t, err)
+	require.Len(t, resp.GetPodResources(), 1)
+	assert.Zero(t, podResources.backoff)
+
+	podResources.mtx.Lock()
+	conn := podResources.conn
+	podResources.mtx.Unlock()
+	require.NotNil(t, conn)
+
+	_, err = podResources.List()
+	require.NoError(t, err)
+	assert.Same(t, conn, podResources.conn, "the connection is kept between the calls")
+}
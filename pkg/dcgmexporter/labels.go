@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are the label names rendered by the metric templates or set by the transformations
+var reservedLabels = []string{
+	"gpu",
+	"UUID",
+	"uuid",
+	"pci_bus_id",
+	"numa_node",
+	"device",
+	"modelName",
+	"driver_version",
+	"vbios_version",
+	"cpu_affinity",
+	"GPU_I_PROFILE",
+	"GPU_I_ID",
+	"GPU_I_MEM_MB",
+	"GPU_CI_ID",
+	"vgpu_instance",
+	"Hostname",
+	"nvswitch",
+	"nvswitch_phys_id",
+	"nvlink",
+	"cpu",
+	"cpucore",
+	"err_code",
+	"err_msg",
+	"xid",
+	"clock_event",
+	clockThrottleReasonLabel,
+	diagTestLabel,
+	eccTypeAttribute,
+	eccCounterAttribute,
+	eccLocationAttribute,
+	windowSizeInMSLabel,
+	bucketLabel,
+	podAttribute,
+	namespaceAttribute,
+	containerAttribute,
+	oldPodAttribute,
+	oldNamespaceAttribute,
+	oldContainerAttribute,
+	hpcJobAttribute,
+	slurmJobIDAttribute,
+	slurmUserAttribute,
+	sharingStrategyAttribute,
+	entityLabel,
+	pidLabel,
+	"major",
+	"minor",
+	"endpoint",
+}
+
+// ValidateStaticLabels checks that static labels are valid Prometheus label names
+// and don't collide with the labels generated by dcgm-exporter
+func ValidateStaticLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid static label name '%s'", name)
+		}
+
+		if slices.Contains(reservedLabels, name) {
+			return fmt.Errorf("static label '%s' collides with a label generated by dcgm-exporter", name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateLabelRemapping checks that labels are renamed to valid Prometheus label names that collide neither
+// with each other nor with the labels generated by dcgm-exporter or the static labels
+func ValidateLabelRemapping(rename map[string]string, staticLabels map[string]string) error {
+	froms := make([]string, 0, len(rename))
+	for from := range rename {
+		froms = append(froms, from)
+	}
+	slices.Sort(froms)
+
+	renamedFrom := map[string]string{}
+	for _, from := range froms {
+		to := rename[from]
+		if !labelNameRegex.MatchString(to) || strings.HasPrefix(to, "__") {
+			return fmt.Errorf("invalid label name '%s' for renamed label '%s'", to, from)
+		}
+
+		if other, exists := renamedFrom[to]; exists {
+			return fmt.Errorf("labels '%s' and '%s' are both renamed to '%s'", other, from, to)
+		}
+		renamedFrom[to] = from
+
+		if slices.Contains(reservedLabels, to) {
+			return fmt.Errorf("label '%s' is renamed to '%s', which collides with a label generated by dcgm-exporter",
+				from, to)
+		}
+
+		if _, exists := staticLabels[to]; exists {
+			return fmt.Errorf("label '%s' is renamed to '%s', which collides with a static label", from, to)
+		}
+	}
+
+	return nil
+}
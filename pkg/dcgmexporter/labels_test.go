@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStaticLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "When no labels",
+			labels: nil,
+		},
+		{
+			name:   "When labels are valid",
+			labels: map[string]string{"cluster": "prod", "region": "us-east-1"},
+		},
+		{
+			name:    "When label collides with gpu",
+			labels:  map[string]string{"gpu": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with Hostname",
+			labels:  map[string]string{"Hostname": "node"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with cpu_affinity",
+			labels:  map[string]string{"cpu_affinity": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with vgpu_instance",
+			labels:  map[string]string{"vgpu_instance": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with the histogram bucket label",
+			labels:  map[string]string{"le": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with sharing_strategy",
+			labels:  map[string]string{"sharing_strategy": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with ecc_type",
+			labels:  map[string]string{"ecc_type": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with slurm_job_id",
+			labels:  map[string]string{"slurm_job_id": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with reason",
+			labels:  map[string]string{"reason": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with xid",
+			labels:  map[string]string{"xid": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with major",
+			labels:  map[string]string{"major": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with endpoint",
+			labels:  map[string]string{"endpoint": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with the diagnostic test label",
+			labels:  map[string]string{"test": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label collides with clock_event",
+			labels:  map[string]string{"clock_event": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "When label name is invalid",
+			labels:  map[string]string{"my-cluster": "prod"},
+			wantErr: true,
+		},
+		{
+			name:    "When label name is reserved by Prometheus",
+			labels:  map[string]string{"__name__": "prod"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStaticLabels(tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateLabelRemapping(t *testing.T) {
+	tests := []struct {
+		name         string
+		rename       map[string]string
+		staticLabels map[string]string
+		wantErr      bool
+	}{
+		{
+			name: "When no labels are renamed",
+		},
+		{
+			name:   "When labels are renamed to distinct names",
+			rename: map[string]string{"DCGM_FI_DRIVER_VERSION": "nvidia_driver", "pod": "k8s_pod"},
+		},
+		{
+			name:    "When a label is renamed to the driver version label generated by dcgm-exporter",
+			rename:  map[string]string{"DCGM_FI_DRIVER_VERSION": "driver_version"},
+			wantErr: true,
+		},
+		{
+			name:    "When a label is renamed to an invalid name",
+			rename:  map[string]string{"pod": "k8s-pod"},
+			wantErr: true,
+		},
+		{
+			name:    "When two labels are renamed to the same name",
+			rename:  map[string]string{"pod": "workload", "container": "workload"},
+			wantErr: true,
+		},
+		{
+			name:    "When a label is renamed to a label generated by dcgm-exporter",
+			rename:  map[string]string{"DCGM_FI_DRIVER_VERSION": "device"},
+			wantErr: true,
+		},
+		{
+			name:         "When a label is renamed to a static label",
+			rename:       map[string]string{"pod": "cluster"},
+			staticLabels: map[string]string{"cluster": "prod"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLabelRemapping(tt.rename, tt.staticLabels)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeLabelsRefreshInterval is how long the node labels are cached before they are read again from the API server
+const nodeLabelsRefreshInterval = 5 * time.Minute
+
+var getKubeClientHook = getKubeClient
+
+// nodeLabelMapper adds the labels of Config.NodeLabelAllowlist of the Kubernetes node, named by the NODE_NAME
+// environment variable, to the labels of the GPU metrics. The node is read from the API server every
+// nodeLabelsRefreshInterval in the background, so that the collections never wait for the API server, and the last
+// labels read are kept while the API server isn't reachable.
+type nodeLabelMapper struct {
+	allowlist []string
+	nodeName  string
+	client    kubernetes.Interface
+
+	mtx         sync.Mutex
+	labels      map[string]string
+	lastRefresh time.Time
+	refreshing  bool
+	refreshes   sync.WaitGroup // Running refreshes, waited for by the tests
+}
+
+func newNodeLabelMapper(c *Config) (*nodeLabelMapper, error) {
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("the NODE_NAME environment variable is not set")
+	}
+
+	client, err := getKubeClientHook()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Kubernetes client; err: %w", err)
+	}
+
+	logrus.Infof("Kubernetes node labels %v of node %q enabled", c.NodeLabelAllowlist, nodeName)
+
+	p := &nodeLabelMapper{
+		allowlist: c.NodeLabelAllowlist,
+		nodeName:  nodeName,
+		client:    client,
+	}
+
+	p.mtx.Lock()
+	p.startRefresh()
+	p.mtx.Unlock()
+
+	return p, nil
+}
+
+func (p *nodeLabelMapper) Name() string {
+	return "nodeLabelMapper"
+}
+
+// Process adds the cached labels of the node to the metrics, and starts refreshing them when they are due
+func (p *nodeLabelMapper) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	p.mtx.Lock()
+	if time.Since(p.lastRefresh) >= nodeLabelsRefreshInterval {
+		p.startRefresh()
+	}
+	labels := p.labels
+	p.mtx.Unlock()
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			if metrics[counter][j].Labels == nil {
+				metrics[counter][j].Labels = map[string]string{}
+			}
+
+			for k, v := range labels {
+				metrics[counter][j].Labels[k] = v
+			}
+		}
+	}
+
+	return nil
+}
+
+// startRefresh starts reading the labels of the node in the background, unless it is already being read. The caller
+// holds p.mtx.
+func (p *nodeLabelMapper) startRefresh() {
+	if p.refreshing {
+		return
+	}
+
+	p.refreshing = true
+	p.lastRefresh = time.Now()
+	p.refreshes.Add(1)
+
+	go p.refresh()
+}
+
+// refresh reads the allowed labels of the node, keeping the previous ones when the node can't be read
+func (p *nodeLabelMapper) refresh() {
+	defer p.refreshes.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+
+	node, err := p.client.CoreV1().Nodes().Get(ctx, p.nodeName, metav1.GetOptions{})
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.refreshing = false
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to read the labels of node %q; retrying in %s", p.nodeName,
+			nodeLabelsRefreshInterval)
+		return
+	}
+
+	labels := map[string]string{}
+	for _, key := range p.allowlist {
+		if value, exists := node.Labels[key]; exists {
+			labels[key] = value
+		}
+	}
+
+	logrus.Debugf("Labels of node %q: %v", p.nodeName, labels)
+
+	p.labels = labels
+}
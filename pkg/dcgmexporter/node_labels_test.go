@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNodeLabelMapper_Process(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-1",
+			Labels: map[string]string{
+				"node.kubernetes.io/instance-type": "p4d.24xlarge",
+				"topology.kubernetes.io/zone":      "us-east-1a",
+				"kubernetes.io/os":                 "linux",
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		nodeName  string
+		allowlist []string
+		labels    map[string]string
+		want      map[string]string
+	}{
+		{
+			name:      "When the node has the allowed labels, they are added",
+			nodeName:  "node-1",
+			allowlist: []string{"node.kubernetes.io/instance-type", "topology.kubernetes.io/zone"},
+			want: map[string]string{
+				"node.kubernetes.io/instance-type": "p4d.24xlarge",
+				"topology.kubernetes.io/zone":      "us-east-1a",
+			},
+		},
+		{
+			name:      "When an allowed label isn't on the node, it is skipped",
+			nodeName:  "node-1",
+			allowlist: []string{"topology.kubernetes.io/zone", "example.com/rack"},
+			want:      map[string]string{"topology.kubernetes.io/zone": "us-east-1a"},
+		},
+		{
+			name:      "When the metric has labels, they are kept",
+			nodeName:  "node-1",
+			allowlist: []string{"kubernetes.io/os"},
+			labels:    map[string]string{"team": "ml"},
+			want:      map[string]string{"team": "ml", "kubernetes.io/os": "linux"},
+		},
+		{
+			name:      "When the node can't be read, the metrics are unchanged",
+			nodeName:  "node-2",
+			allowlist: []string{"kubernetes.io/os"},
+			labels:    map[string]string{"team": "ml"},
+			want:      map[string]string{"team": "ml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NODE_NAME", tt.nodeName)
+			getKubeClientHook = func() (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(node), nil
+			}
+			defer func() {
+				getKubeClientHook = getKubeClient
+			}()
+
+			mapper, err := newNodeLabelMapper(&Config{NodeLabelAllowlist: tt.allowlist})
+			require.NoError(t, err)
+			mapper.refreshes.Wait()
+
+			counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+			metrics := MetricsByCounter{counter: {{GPU: "0", Value: "1", Labels: tt.labels}}}
+
+			require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+			if len(tt.want) == 0 {
+				assert.Empty(t, metrics[counter][0].Labels)
+				return
+			}
+			assert.Equal(t, tt.want, metrics[counter][0].Labels)
+		})
+	}
+}
+
+func TestNodeLabelMapper_ProcessKeepsTheLabelsUntilTheRefresh(t *testing.T) {
+	t.Setenv("NODE_NAME", "node-1")
+	client := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{"topology.kubernetes.io/zone": "us-east-1a"},
+		},
+	})
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return client, nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	mapper, err := newNodeLabelMapper(&Config{NodeLabelAllowlist: []string{"topology.kubernetes.io/zone"}})
+	require.NoError(t, err)
+	mapper.refreshes.Wait()
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	process := func() map[string]string {
+		metrics := MetricsByCounter{counter: {{GPU: "0", Value: "1"}}}
+		require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+		return metrics[counter][0].Labels
+	}
+
+	assert.Equal(t, map[string]string{"topology.kubernetes.io/zone": "us-east-1a"}, process())
+
+	// The node is gone, the cached labels are reported until the next refresh, and kept when it fails
+	require.NoError(t, client.CoreV1().Nodes().Delete(context.Background(), "node-1", metav1.DeleteOptions{}))
+	assert.Equal(t, map[string]string{"topology.kubernetes.io/zone": "us-east-1a"}, process())
+
+	mapper.lastRefresh = time.Now().Add(-nodeLabelsRefreshInterval)
+	assert.Equal(t, map[string]string{"topology.kubernetes.io/zone": "us-east-1a"}, process())
+	mapper.refreshes.Wait()
+	assert.Equal(t, map[string]string{"topology.kubernetes.io/zone": "us-east-1a"}, process())
+}
+
+func TestNodeLabelMapper_ProcessDoesNotWaitForTheAPIServer(t *testing.T) {
+	t.Setenv("NODE_NAME", "node-1")
+	client := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{"topology.kubernetes.io/zone": "us-east-1a"},
+		},
+	})
+	unblock := make(chan struct{})
+	client.PrependReactor("get", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-unblock
+		return false, nil, nil
+	})
+	getKubeClientHook = func() (kubernetes.Interface, error) {
+		return client, nil
+	}
+	defer func() {
+		getKubeClientHook = getKubeClient
+	}()
+
+	mapper, err := newNodeLabelMapper(&Config{NodeLabelAllowlist: []string{"topology.kubernetes.io/zone"}})
+	require.NoError(t, err)
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{counter: {{GPU: "0", Value: "1"}}}
+
+	// The node is being read, the metrics are processed without its labels meanwhile
+	processed := make(chan error)
+	go func() { processed <- mapper.Process(metrics, SystemInfo{}) }()
+	select {
+	case err := <-processed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Process waited for the API server")
+	}
+	assert.Empty(t, metrics[counter][0].Labels)
+
+	close(unblock)
+	mapper.refreshes.Wait()
+
+	require.NoError(t, mapper.Process(metrics, SystemInfo{}))
+	assert.Equal(t, map[string]string{"topology.kubernetes.io/zone": "us-east-1a"}, metrics[counter][0].Labels)
+}
+
+func TestNewNodeLabelMapper(t *testing.T) {
+	t.Run("When NODE_NAME isn't set, it fails", func(t *testing.T) {
+		t.Setenv("NODE_NAME", "")
+		_, err := newNodeLabelMapper(&Config{NodeLabelAllowlist: []string{"kubernetes.io/os"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("When the Kubernetes client can't be created, it fails", func(t *testing.T) {
+		t.Setenv("NODE_NAME", "node-1")
+		getKubeClientHook = func() (kubernetes.Interface, error) {
+			return nil, errors.New("not in a cluster")
+		}
+		defer func() {
+			getKubeClientHook = getKubeClient
+		}()
+
+		_, err := newNodeLabelMapper(&Config{NodeLabelAllowlist: []string{"kubernetes.io/os"}})
+		assert.Error(t, err)
+	})
+}
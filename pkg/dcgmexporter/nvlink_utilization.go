@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// nvlinkUtilizationCounter is derived from the throughput counters of the NVSwitch ports, exported along with them
+var nvlinkUtilizationCounter = Counter{
+	FieldID:   dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX,
+	FieldName: "dcgm_nvlink_bandwidth_utilization",
+	PromType:  "gauge",
+	Help:      "Throughput of the busiest direction of the NVLink as a percentage of the bandwidth of the link (in %).",
+}
+
+var nvlinkThroughputFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX,
+	dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_RX,
+}
+
+// gpuNVLinkUtilizationCounter is derived from the bandwidth counters of the links of the GPUs. It isn't named like
+// nvlinkUtilizationCounter, the GPU and link metrics are rendered separately and would repeat its HELP and TYPE.
+var gpuNVLinkUtilizationCounter = Counter{
+	FieldID:   dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L0,
+	FieldName: "dcgm_gpu_nvlink_bandwidth_utilization",
+	PromType:  "gauge",
+	Help:      "Throughput of both directions of the NVLink of the GPU as a percentage of the bandwidth of the link in both directions (in %).",
+}
+
+// gpuNVLinkBandwidthFields are the bandwidth counters of the links of a GPU, indexed by link
+var gpuNVLinkBandwidthFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L0,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L1,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L2,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L3,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L4,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L5,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L6,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L7,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L8,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L9,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L10,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L11,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L12,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L13,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L14,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L15,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L16,
+	dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L17,
+}
+
+// nvlinkBandwidths is the bandwidth of a link in each direction in bytes/s, by NVLink generation
+var nvlinkBandwidths = map[int]float64{
+	1: 20e9,
+	2: 25e9,
+	3: 25e9,
+	4: 25e9,
+	5: 50e9,
+}
+
+// nvlinkGenerations is the NVLink generation of the GPU models, which the NVSwitches they are attached to share
+var nvlinkGenerations = []struct {
+	model      string
+	generation int
+}{
+	{"P100", 1},
+	{"V100", 2},
+	{"A100", 3},
+	{"A800", 3},
+	{"H100", 4},
+	{"H200", 4},
+	{"H800", 4},
+	{"B100", 5},
+	{"B200", 5},
+	{"B300", 5},
+}
+
+// nvlinkThroughputSample is the last value of a throughput counter of a link and the rate derived from it
+type nvlinkThroughputSample struct {
+	value     float64
+	timestamp int64   // DCGM sample timestamp in us
+	rate      float64 // In bytes/s, valid once hasRate is set
+	hasRate   bool
+}
+
+// nvlinkGeneration returns the NVLink generation of the GPU model, 0 when it is unknown
+func nvlinkGeneration(model string) int {
+	model = strings.ToUpper(model)
+	for _, g := range nvlinkGenerations {
+		if strings.Contains(model, g.model) {
+			return g.generation
+		}
+	}
+
+	return 0
+}
+
+// hostNVLinkBandwidth returns the bandwidth of the links of the host in each direction in bytes/s, looked up from the
+// model of its GPUs, 0 when none of the models is known
+func hostNVLinkBandwidth() float64 {
+	count, err := dcgmGetAllDeviceCount()
+	if err != nil {
+		return 0
+	}
+
+	for i := uint(0); i < count; i++ {
+		device, err := dcgmGetDeviceInfo(i)
+		if err != nil {
+			continue
+		}
+
+		if generation := nvlinkGeneration(device.Identifiers.Model); generation > 0 {
+			return nvlinkBandwidths[generation]
+		}
+	}
+
+	return 0
+}
+
+func hasNVLinkThroughputField(deviceFields []dcgm.Short) bool {
+	return slices.ContainsFunc(nvlinkThroughputFields, func(field dcgm.Short) bool {
+		return slices.Contains(deviceFields, field)
+	})
+}
+
+func hasGPUNVLinkBandwidthField(deviceFields []dcgm.Short) bool {
+	return slices.ContainsFunc(gpuNVLinkBandwidthFields, func(field dcgm.Short) bool {
+		return slices.Contains(deviceFields, field)
+	})
+}
+
+// withNVLinkThroughputFields adds the throughput counter of the other direction to the device fields requesting
+// one of them, so the utilization is derived from both directions
+func withNVLinkThroughputFields(deviceFields []dcgm.Short) []dcgm.Short {
+	if !hasNVLinkThroughputField(deviceFields) {
+		return deviceFields
+	}
+
+	for _, field := range nvlinkThroughputFields {
+		if !slices.Contains(deviceFields, field) {
+			deviceFields = append(deviceFields, field)
+		}
+	}
+
+	return deviceFields
+}
+
+// appendNVLinkUtilization adds the utilization of the link to the metrics, as a copy of the throughput metric of the
+// link. It is skipped until two samples of a throughput counter are collected, or when none is exported.
+func (c *DCGMCollector) appendNVLinkUtilization(metrics MetricsByCounter, values []dcgm.FieldValue_v1,
+	mi MonitoringInfo,
+) {
+	utilization, ok := c.nvlinkUtilization(fmt.Sprintf("%d/%d", mi.ParentId, mi.Entity.EntityId), values)
+	if !ok {
+		return
+	}
+
+	port, switchID := fmt.Sprint(mi.Entity.EntityId), fmt.Sprint(mi.ParentId)
+	for _, counter := range c.Counters {
+		if !slices.Contains(nvlinkThroughputFields, counter.FieldID) {
+			continue
+		}
+
+		// The metrics of the other links of the switch are in the same list
+		i := slices.IndexFunc(metrics[counter], func(m Metric) bool {
+			return m.GPU == port && m.GPUDevice == switchID
+		})
+		if i < 0 {
+			continue
+		}
+
+		derived := metrics[counter][i]
+		derived.Counter = nvlinkUtilizationCounter
+		derived.Value = strconv.FormatFloat(utilization, 'f', -1, 64)
+		metrics[nvlinkUtilizationCounter] = append(metrics[nvlinkUtilizationCounter], derived)
+
+		return
+	}
+}
+
+// appendGPUNVLinkUtilization adds the utilization of each link of the GPU to the metrics, as a copy of the bandwidth
+// metric of the link labeled with the link. The bandwidth counters count the bytes of both directions, so the rate is
+// relative to the bandwidth of the link in both directions. A link is skipped until two samples of its counter are
+// collected.
+func (c *DCGMCollector) appendGPUNVLinkUtilization(metrics MetricsByCounter, values []dcgm.FieldValue_v1,
+	mi MonitoringInfo,
+) {
+	for link, field := range gpuNVLinkBandwidthFields {
+		counter, err := FindCounterField(c.Counters, uint(field))
+		if err != nil {
+			continue
+		}
+
+		rate, ok := c.nvlinkRate(fmt.Sprintf("gpu/%d/%d", mi.Entity.EntityId, link), field, values)
+		if !ok {
+			continue
+		}
+
+		// The metrics of the other GPUs and of the GPU instances are in the same list
+		i := slices.IndexFunc(metrics[counter], func(m Metric) bool {
+			return m.GPUUUID == mi.DeviceInfo.UUID && m.GPUInstanceID == ""
+		})
+		if i < 0 {
+			continue
+		}
+
+		derived := metrics[counter][i]
+		derived.Counter = gpuNVLinkUtilizationCounter
+		derived.Value = strconv.FormatFloat(rate/(2*c.NVLinkBandwidth)*100, 'f', -1, 64)
+		derived.Labels = maps.Clone(derived.Labels)
+		if derived.Labels == nil {
+			derived.Labels = map[string]string{}
+		}
+		derived.Labels["nvlink"] = strconv.Itoa(link)
+		metrics[gpuNVLinkUtilizationCounter] = append(metrics[gpuNVLinkUtilizationCounter], derived)
+	}
+}
+
+// nvlinkUtilization returns the rate of the busiest direction of the link identified by key as a percentage of
+// NVLinkBandwidth. The rates are derived from the throughput counters, which count the bytes sent and received by the
+// port.
+func (c *DCGMCollector) nvlinkUtilization(key string, values []dcgm.FieldValue_v1) (float64, bool) {
+	var rates []float64
+	for _, field := range nvlinkThroughputFields {
+		if rate, ok := c.nvlinkRate(key, field, values); ok {
+			rates = append(rates, rate)
+		}
+	}
+
+	if len(rates) == 0 || c.NVLinkBandwidth <= 0 {
+		return 0, false
+	}
+
+	return slices.Max(rates) / c.NVLinkBandwidth * 100, true
+}
+
+// nvlinkRate returns the rate in bytes/s of the throughput counter of the link identified by key, derived from its
+// previous sample; while DCGM reports the same sample, the previous rate is kept. There is no rate until two samples
+// are collected, nor after the counter is reset.
+func (c *DCGMCollector) nvlinkRate(key string, field dcgm.Short, values []dcgm.FieldValue_v1) (float64, bool) {
+	value, ok := floatFieldValue(values, field)
+	if !ok {
+		return 0, false
+	}
+
+	if c.nvlinkThroughput == nil {
+		c.nvlinkThroughput = map[string]nvlinkThroughputSample{}
+	}
+
+	i := slices.IndexFunc(values, func(val dcgm.FieldValue_v1) bool {
+		return dcgm.Short(val.FieldId) == field
+	})
+	sample := nvlinkThroughputSample{value: value, timestamp: values[i].Ts}
+
+	sampleKey := fmt.Sprintf("%s/%d", key, field)
+	prev, exists := c.nvlinkThroughput[sampleKey]
+	switch {
+	case !exists || value < prev.value:
+		// First sample or counter reset
+	case sample.timestamp == prev.timestamp:
+		sample.rate, sample.hasRate = prev.rate, prev.hasRate
+	case sample.timestamp > prev.timestamp:
+		sample.rate = (value - prev.value) / (float64(sample.timestamp-prev.timestamp) / 1e6)
+		sample.hasRate = true
+	}
+	c.nvlinkThroughput[sampleKey] = sample
+
+	return sample.rate, sample.hasRate
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNVLinkGeneration(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		want  int
+	}{
+		{name: "When the GPU is a V100", model: "Tesla V100-SXM2-32GB", want: 2},
+		{name: "When the GPU is an A100", model: "NVIDIA A100-SXM4-80GB", want: 3},
+		{name: "When the GPU is an H100", model: "NVIDIA H100 80GB HBM3", want: 4},
+		{name: "When the GPU is a GH200", model: "NVIDIA GH200 480GB", want: 4},
+		{name: "When the GPU is a B200", model: "NVIDIA B200", want: 5},
+		{name: "When the GPU has no NVLink generation", model: "NVIDIA L4", want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, nvlinkGeneration(tc.model))
+		})
+	}
+}
+
+func TestHostNVLinkBandwidth(t *testing.T) {
+	models := []string{"NVIDIA L4", "NVIDIA H100 80GB HBM3"}
+	dcgmGetAllDeviceCount = func() (uint, error) {
+		return uint(len(models)), nil
+	}
+	dcgmGetDeviceInfo = func(gpuId uint) (dcgm.Device, error) {
+		return dcgm.Device{GPU: gpuId, Identifiers: dcgm.DeviceIdentifiers{Model: models[gpuId]}}, nil
+	}
+	defer func() {
+		dcgmGetAllDeviceCount = dcgm.GetAllDeviceCount
+		dcgmGetDeviceInfo = dcgm.GetDeviceInfo
+	}()
+
+	assert.Equal(t, 25e9, hostNVLinkBandwidth())
+
+	models = []string{"NVIDIA L4"}
+	assert.Equal(t, float64(0), hostNVLinkBandwidth())
+}
+
+func TestWithNVLinkThroughputFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []dcgm.Short
+		want   []dcgm.Short
+	}{
+		{
+			name:   "When the TX throughput is requested, the RX throughput is added",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX},
+			want: []dcgm.Short{
+				dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX, dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_RX,
+			},
+		},
+		{
+			name: "When both directions are requested, the fields are left unchanged",
+			fields: []dcgm.Short{
+				dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_RX, dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX,
+			},
+			want: []dcgm.Short{
+				dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_RX, dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX,
+			},
+		},
+		{
+			name:   "When no throughput is requested, the fields are left unchanged",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS},
+			want:   []dcgm.Short{dcgm.DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, withNVLinkThroughputFields(tc.fields))
+		})
+	}
+}
+
+func TestDCGMCollector_AppendNVLinkUtilization(t *testing.T) {
+	tx := Counter{
+		FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX, FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX",
+		PromType: "counter",
+	}
+
+	throughput := func(ts, tx, rx int64) []dcgm.FieldValue_v1 {
+		return []dcgm.FieldValue_v1{
+			{
+				FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX, FieldType: dcgm.DCGM_FT_INT64, Ts: ts,
+				Value: int64FieldValue(tx),
+			},
+			{
+				FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_RX, FieldType: dcgm.DCGM_FT_INT64, Ts: ts,
+				Value: int64FieldValue(rx),
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		samples [][]dcgm.FieldValue_v1
+		want    []string
+	}{
+		{
+			name:    "When a single sample is collected, the utilization is skipped",
+			samples: [][]dcgm.FieldValue_v1{throughput(1e6, 0, 0)},
+			want:    []string{""},
+		},
+		{
+			name: "When two samples are collected, the busiest direction is reported",
+			samples: [][]dcgm.FieldValue_v1{
+				throughput(1e6, 0, 0),
+				throughput(2e6, 5e9, 10e9),
+			},
+			want: []string{"", "40"},
+		},
+		{
+			name: "When DCGM reports the same sample, the previous utilization is kept",
+			samples: [][]dcgm.FieldValue_v1{
+				throughput(1e6, 0, 0),
+				throughput(2e6, 5e9, 10e9),
+				throughput(2e6, 5e9, 10e9),
+			},
+			want: []string{"", "40", "40"},
+		},
+		{
+			name: "When the counters are reset, the utilization is skipped until the next sample",
+			samples: [][]dcgm.FieldValue_v1{
+				throughput(1e6, 5e9, 5e9),
+				throughput(2e6, 0, 0),
+				throughput(4e6, 25e9, 5e9),
+			},
+			want: []string{"", "", "50"},
+		},
+		{
+			name: "When the throughput has no value, the utilization is skipped",
+			samples: [][]dcgm.FieldValue_v1{
+				throughput(1e6, dcgm.DCGM_FT_INT64_BLANK, dcgm.DCGM_FT_INT64_BLANK),
+				throughput(2e6, dcgm.DCGM_FT_INT64_BLANK, dcgm.DCGM_FT_INT64_BLANK),
+			},
+			want: []string{"", ""},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &DCGMCollector{Counters: []Counter{tx}, NVLinkBandwidth: 25e9, Hostname: "node-1"}
+			mi := MonitoringInfo{Entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_LINK, EntityId: 3}, ParentId: 1}
+
+			var got []string
+			for _, values := range tc.samples {
+				metrics := MetricsByCounter{}
+				ToSwitchMetric(metrics, values, c.Counters, mi, MetricOptions{Hostname: c.Hostname})
+				c.appendNVLinkUtilization(metrics, values, mi)
+
+				value := ""
+				if derived := metrics[nvlinkUtilizationCounter]; len(derived) > 0 {
+					require.Len(t, derived, 1)
+					assert.Equal(t, "3", derived[0].GPU)
+					assert.Equal(t, "1", derived[0].GPUDevice)
+					assert.Equal(t, "node-1", derived[0].Hostname)
+					value = derived[0].Value
+				}
+				got = append(got, value)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDCGMCollector_AppendNVLinkUtilizationOfEachLink(t *testing.T) {
+	tx := Counter{
+		FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX, FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX",
+		PromType: "counter",
+	}
+	c := &DCGMCollector{Counters: []Counter{tx}, NVLinkBandwidth: 25e9}
+
+	throughput := func(ts, tx int64) []dcgm.FieldValue_v1 {
+		return []dcgm.FieldValue_v1{
+			{
+				FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_THROUGHPUT_TX, FieldType: dcgm.DCGM_FT_INT64, Ts: ts,
+				Value: int64FieldValue(tx),
+			},
+		}
+	}
+
+	links := []MonitoringInfo{
+		{Entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_LINK, EntityId: 3}, ParentId: 1},
+		{Entity: dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_LINK, EntityId: 4}, ParentId: 1},
+	}
+	for _, mi := range links {
+		c.appendNVLinkUtilization(MetricsByCounter{}, throughput(1e6, 0), mi)
+	}
+
+	// The throughput metric of the second link is appended before the utilization of the first one is derived
+	metrics := MetricsByCounter{}
+	ToSwitchMetric(metrics, throughput(2e6, 5e9), c.Counters, links[0], MetricOptions{})
+	ToSwitchMetric(metrics, throughput(2e6, 10e9), c.Counters, links[1], MetricOptions{})
+	c.appendNVLinkUtilization(metrics, throughput(2e6, 5e9), links[0])
+	c.appendNVLinkUtilization(metrics, throughput(2e6, 10e9), links[1])
+
+	derived := metrics[nvlinkUtilizationCounter]
+	require.Len(t, derived, 2)
+	assert.Equal(t, "3", derived[0].GPU)
+	assert.Equal(t, "20", derived[0].Value)
+	assert.Equal(t, "4", derived[1].GPU)
+	assert.Equal(t, "40", derived[1].Value)
+}
+
+func TestDCGMCollector_AppendGPUNVLinkUtilization(t *testing.T) {
+	l0 := Counter{
+		FieldID: dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L0, FieldName: "DCGM_FI_DEV_NVLINK_BANDWIDTH_L0", PromType: "counter",
+	}
+	l1 := Counter{
+		FieldID: dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L1, FieldName: "DCGM_FI_DEV_NVLINK_BANDWIDTH_L1", PromType: "counter",
+	}
+	c := &DCGMCollector{Counters: []Counter{l0, l1}, NVLinkBandwidth: 25e9}
+
+	bandwidth := func(ts, l0, l1 int64) []dcgm.FieldValue_v1 {
+		return []dcgm.FieldValue_v1{
+			{FieldId: dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L0, FieldType: dcgm.DCGM_FT_INT64, Ts: ts, Value: int64FieldValue(l0)},
+			{FieldId: dcgm.DCGM_FI_DEV_NVLINK_BANDWIDTH_L1, FieldType: dcgm.DCGM_FT_INT64, Ts: ts, Value: int64FieldValue(l1)},
+		}
+	}
+
+	mi := MonitoringInfo{
+		Entity:     dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: 0},
+		DeviceInfo: dcgm.Device{GPU: 0, UUID: "GPU-00000000"},
+	}
+	metadata := newGPUMetadata(mi.DeviceInfo, nil, nil, false)
+
+	var got MetricsByCounter
+	for _, values := range [][]dcgm.FieldValue_v1{bandwidth(1e6, 0, 0), bandwidth(2e6, 10e9, 25e9)} {
+		got = MetricsByCounter{}
+		toGPUMetric(got, values, c.Counters, metadata, MetricOptions{})
+		c.appendGPUNVLinkUtilization(got, values, mi)
+	}
+
+	derived := got[gpuNVLinkUtilizationCounter]
+	require.Len(t, derived, 2)
+	assert.Equal(t, "0", derived[0].GPU)
+	assert.Equal(t, map[string]string{"nvlink": "0"}, derived[0].Labels)
+	assert.Equal(t, "20", derived[0].Value)
+	assert.Equal(t, map[string]string{"nvlink": "1"}, derived[1].Labels)
+	assert.Equal(t, "50", derived[1].Value)
+
+	// The labels of the bandwidth metrics are left as they were
+	assert.Empty(t, got[l0][0].Labels)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	openMetricsCounterSuffix = "_total"
+	exemplarComment          = "# EXEMPLAR "
+)
+
+// FormatOpenMetrics converts metrics rendered in the Prometheus text format (see FormatMetrics)
+// into the OpenMetrics text format.
+//
+// Counters are renamed to carry the `_total` suffix required by OpenMetrics, unless they already have it.
+// Metric families are written in name order and the output is terminated by a single `# EOF` line.
+// No `# UNIT` metadata is written, because DCGM field names don't carry the unit suffix OpenMetrics requires.
+// The exemplars rendered by the metric templates are kept on counters, OpenMetrics doesn't allow them on gauges.
+func FormatOpenMetrics(w io.Writer, metrics string) error {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(metrics))
+	if err != nil {
+		return fmt.Errorf("failed to parse metrics; err: %w", err)
+	}
+
+	exemplars, err := parseExemplars(metrics)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := families[name]
+		if family.GetType() == dto.MetricType_COUNTER {
+			for _, metric := range family.Metric {
+				metric.Counter.Exemplar = exemplars[seriesKey(name, metric.Label)]
+			}
+
+			if !strings.HasSuffix(name, openMetricsCounterSuffix) {
+				totalName := name + openMetricsCounterSuffix
+				family.Name = &totalName
+			}
+		}
+
+		if _, err := expfmt.MetricFamilyToOpenMetrics(w, family); err != nil {
+			return fmt.Errorf("failed to format metric '%s'; err: %w", name, err)
+		}
+	}
+
+	_, err = expfmt.FinalizeOpenMetrics(w)
+
+	return err
+}
+
+// parseExemplars returns the exemplars of the metrics by series, each one is rendered on the line following
+// the sample of its series
+func parseExemplars(metrics string) (map[string]*dto.Exemplar, error) {
+	res := map[string]*dto.Exemplar{}
+
+	var sample string
+	for _, line := range strings.Split(metrics, "\n") {
+		exemplar, found := strings.CutPrefix(line, exemplarComment)
+		if !found {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				sample = line
+			}
+			continue
+		}
+
+		if sample == "" {
+			continue
+		}
+
+		series, err := parseSample(sample)
+		if err != nil {
+			return nil, err
+		}
+
+		// The exemplar is parsed like a sample, its labels identify the trace
+		parsed, err := parseSample("exemplar" + exemplar)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse exemplar '%s'; err: %w", exemplar, err)
+		}
+
+		e := &dto.Exemplar{
+			Label: parsed.Label,
+			Value: parsed.Untyped.Value,
+		}
+		if parsed.TimestampMs != nil {
+			e.Timestamp = timestamppb.New(time.UnixMilli(parsed.GetTimestampMs()))
+		}
+
+		res[seriesKey(series.name, series.Label)] = e
+	}
+
+	return res, nil
+}
+
+type parsedSample struct {
+	*dto.Metric
+	name string
+}
+
+// parseSample parses a single line of the Prometheus text format
+func parseSample(line string) (parsedSample, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(line + "\n"))
+	if err != nil {
+		return parsedSample{}, fmt.Errorf("failed to parse sample '%s'; err: %w", line, err)
+	}
+
+	for name, family := range families {
+		return parsedSample{Metric: family.Metric[0], name: name}, nil
+	}
+
+	return parsedSample{}, fmt.Errorf("no sample in '%s'", line)
+}
+
+// seriesKey identifies a series by its name and labels
+func seriesKey(name string, labels []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	sort.Strings(pairs)
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
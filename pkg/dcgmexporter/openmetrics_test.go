@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatOpenMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		metrics  string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "When metric is a gauge",
+			metrics: `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in C).
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="fake0"} 42
+`,
+			expected: `# HELP DCGM_FI_DEV_GPU_TEMP GPU temperature (in C).
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="fake0"} 42.0
+# EOF
+`,
+		},
+		{
+			name: "When counter has no _total suffix",
+			metrics: `# HELP DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION Total energy consumption since boot (in mJ).
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="0"} 1000
+`,
+			expected: `# HELP DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION Total energy consumption since boot (in mJ).
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total{gpu="0"} 1000.0
+# EOF
+`,
+		},
+		{
+			name: "When counter already has _total suffix",
+			metrics: `# HELP DCGM_EXP_ERRORS_total Errors.
+# TYPE DCGM_EXP_ERRORS_total counter
+DCGM_EXP_ERRORS_total{gpu="0"} 3
+`,
+			expected: `# HELP DCGM_EXP_ERRORS Errors.
+# TYPE DCGM_EXP_ERRORS counter
+DCGM_EXP_ERRORS_total{gpu="0"} 3.0
+# EOF
+`,
+		},
+		{
+			name: "When counter has an exemplar",
+			metrics: `# HELP DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION Total energy consumption since boot (in mJ).
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="0"} 1000
+# EXEMPLAR {trace_id="4bf92f3577b34da6"} 1000 1700000000500
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION{gpu="1"} 2000
+`,
+			expected: `# HELP DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION Total energy consumption since boot (in mJ).
+# TYPE DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION counter
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total{gpu="0"} 1000.0 # {trace_id="4bf92f3577b34da6"} 1000.0 1.7000000005e+09
+DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total{gpu="1"} 2000.0
+# EOF
+`,
+		},
+		{
+			name: "When gauge has an exemplar",
+			metrics: `# HELP DCGM_FI_DEV_GPU_UTIL GPU utilization (in %).
+# TYPE DCGM_FI_DEV_GPU_UTIL gauge
+DCGM_FI_DEV_GPU_UTIL{gpu="0"} 80
+# EXEMPLAR {trace_id="4bf92f3577b34da6"} 80
+`,
+			expected: `# HELP DCGM_FI_DEV_GPU_UTIL GPU utilization (in %).
+# TYPE DCGM_FI_DEV_GPU_UTIL gauge
+DCGM_FI_DEV_GPU_UTIL{gpu="0"} 80.0
+# EOF
+`,
+		},
+		{
+			name:     "When there are no metrics",
+			metrics:  "",
+			expected: "# EOF\n",
+		},
+		{
+			name:    "When metrics are malformed",
+			metrics: "DCGM_FI_DEV_GPU_TEMP{gpu=0} 42\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := FormatOpenMetrics(&buf, tt.metrics)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+			assert.Equal(t, 1, strings.Count(buf.String(), "# EOF"))
+		})
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	otlpScopeName        = "dcgm-exporter"
+	otlpHostNameKey      = "host.name"
+	otlpGPUUUIDKey       = "gpu.uuid"
+	otlpResourceKeySplit = "\x00"
+)
+
+// DefaultOTLPEndpoint is the address of a collector running next to the exporter
+const DefaultOTLPEndpoint = "localhost:4317"
+
+// otlpExporter pushes the collected metrics to an OpenTelemetry collector over OTLP/gRPC.
+// Counters are exported as cumulative monotonic sums and every other type as gauges.
+type otlpExporter struct {
+	endpoint string
+	headers  metadata.MD
+	timeout  time.Duration
+	start    time.Time // Start time of the cumulative sums
+
+	conn   *grpc.ClientConn
+	client collectormetricspb.MetricsServiceClient
+}
+
+func newOTLPExporter(c *Config) (*otlpExporter, func(), error) {
+	creds, err := otlpCredentials(c)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	endpoint := c.OTLPEndpoint
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("cannot create OTLP client for '%s'; err: %w", endpoint, err)
+	}
+
+	e := &otlpExporter{
+		endpoint: endpoint,
+		headers:  metadata.New(c.OTLPHeaders),
+		timeout:  time.Duration(c.CollectInterval) * time.Millisecond,
+		start:    time.Now(),
+		conn:     conn,
+		client:   collectormetricspb.NewMetricsServiceClient(conn),
+	}
+
+	return e, func() {
+		if err := conn.Close(); err != nil {
+			logrus.Warnf("Failed to close the OTLP connection; err: %v", err)
+		}
+	}, nil
+}
+
+// otlpCredentials returns the transport credentials selected by the OTLP options of the config
+func otlpCredentials(c *Config) (credentials.TransportCredentials, error) {
+	if c.OTLPInsecure {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.OTLPCAFile != "" {
+		pem, err := readCAFile(c.OTLPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read OTLP CA file; err: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in OTLP CA file '%s'", c.OTLPCAFile)
+		}
+	}
+
+	if c.OTLPCertFile != "" || c.OTLPKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.OTLPCertFile, c.OTLPKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load OTLP client certificate; err: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+func (e *otlpExporter) target() string {
+	return e.endpoint
+}
+
+func (e *otlpExporter) push(ctx context.Context, batch pushBatch) error {
+	req := toOTLPRequest(batch, e.start)
+	if len(req.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, e.headers), e.timeout)
+	defer cancel()
+
+	resp, err := e.client.Export(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if rejected := resp.GetPartialSuccess().GetRejectedDataPoints(); rejected > 0 {
+		logrus.Warnf("OTLP endpoint '%s' rejected %d data points: %s",
+			e.endpoint, rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+
+	return nil
+}
+
+// toOTLPRequest converts a batch into an OTLP export request.
+// The hostname and the GPU UUID of the metrics are resource attributes, one resource per pair;
+// the remaining labels rendered by the text template of the entity are data point attributes.
+func toOTLPRequest(batch pushBatch, start time.Time) *collectormetricspb.ExportMetricsServiceRequest {
+	type resource struct {
+		attributes []*commonpb.KeyValue
+		metrics    map[string]*metricspb.Metric
+	}
+
+	resources := map[string]*resource{}
+
+	for _, i := range batch.entities {
+		for counter, values := range batch.metrics[i] {
+			for _, metric := range values {
+				value, err := strconv.ParseFloat(metric.Value, 64)
+				if err != nil {
+					logrus.Debugf("Skipping non-numeric value '%s' of %s for OTLP", metric.Value, counter.FieldName)
+					continue
+				}
+
+				timestamp := batch.time
+				if metric.Timestamp != "" {
+					if ts, err := strconv.ParseInt(metric.Timestamp, 10, 64); err == nil {
+						timestamp = time.UnixMilli(ts)
+					}
+				}
+
+				labels := entityLabels(i, metric)
+				for k, v := range metric.Labels {
+					labels[k] = v
+				}
+				for k, v := range metric.Attributes {
+					labels[k] = v
+				}
+
+				hostname := labels["Hostname"]
+				delete(labels, "Hostname")
+
+				var uuid string
+				if PipelineEntities[i] == "gpu" {
+					uuid = labels[metric.UUID]
+					delete(labels, metric.UUID)
+				}
+
+				key := hostname + otlpResourceKeySplit + uuid
+				r, exists := resources[key]
+				if !exists {
+					r = &resource{metrics: map[string]*metricspb.Metric{}}
+					if hostname != "" {
+						r.attributes = append(r.attributes, otlpAttribute(otlpHostNameKey, hostname))
+					}
+					if uuid != "" {
+						r.attributes = append(r.attributes, otlpAttribute(otlpGPUUUIDKey, uuid))
+					}
+					resources[key] = r
+				}
+
+				point := &metricspb.NumberDataPoint{
+					TimeUnixNano: uint64(timestamp.UnixNano()),
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+				}
+				for k, v := range labels {
+					point.Attributes = append(point.Attributes, otlpAttribute(k, v))
+				}
+				sort.Slice(point.Attributes, func(a, b int) bool {
+					return point.Attributes[a].Key < point.Attributes[b].Key
+				})
+
+				m, exists := r.metrics[counter.FieldName]
+				if !exists {
+					m = newOTLPMetric(counter)
+					r.metrics[counter.FieldName] = m
+				}
+
+				if sum := m.GetSum(); sum != nil {
+					point.StartTimeUnixNano = uint64(start.UnixNano())
+					sum.DataPoints = append(sum.DataPoints, point)
+				} else {
+					m.GetGauge().DataPoints = append(m.GetGauge().DataPoints, point)
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(resources))
+	for key := range resources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	req := &collectormetricspb.ExportMetricsServiceRequest{}
+	for _, key := range keys {
+		r := resources[key]
+
+		scope := &metricspb.ScopeMetrics{Scope: &commonpb.InstrumentationScope{Name: otlpScopeName}}
+		for _, m := range r.metrics {
+			scope.Metrics = append(scope.Metrics, m)
+		}
+		sort.Slice(scope.Metrics, func(a, b int) bool {
+			return scope.Metrics[a].Name < scope.Metrics[b].Name
+		})
+
+		req.ResourceMetrics = append(req.ResourceMetrics, &metricspb.ResourceMetrics{
+			Resource:     &resourcepb.Resource{Attributes: r.attributes},
+			ScopeMetrics: []*metricspb.ScopeMetrics{scope},
+		})
+	}
+
+	return req
+}
+
+func newOTLPMetric(counter Counter) *metricspb.Metric {
+	m := &metricspb.Metric{Name: counter.FieldName, Description: counter.Help}
+
+	if counter.PromType == "counter" {
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	} else {
+		m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+	}
+
+	return m
+}
+
+func readCAFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func otlpAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
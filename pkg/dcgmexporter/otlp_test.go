@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func attributeMap(attributes []*commonpb.KeyValue) map[string]string {
+	res := map[string]string{}
+	for _, kv := range attributes {
+		res[kv.Key] = kv.Value.GetStringValue()
+	}
+	return res
+}
+
+func TestToOTLPRequest(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	start := time.UnixMilli(1600000000000)
+
+	temp := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "GPU temperature (in C)."}
+	energy := Counter{FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", PromType: "counter"}
+	switchTemp := Counter{FieldName: "DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT", PromType: "gauge"}
+
+	gpu := func(id, uuid, value string) Metric {
+		return Metric{
+			Value:        value,
+			UUID:         "UUID",
+			GPU:          id,
+			GPUUUID:      uuid,
+			GPUDevice:    "nvidia" + id,
+			GPUModelName: "NVIDIA T400 4GB",
+			GPUPCIBusID:  "00000000:0000:0000.0",
+			Hostname:     "local-test",
+			Labels:       map[string]string{"cluster": "prod"},
+		}
+	}
+
+	metrics := make([]MetricsByCounter, len(PipelineEntities))
+	metrics[gpuEntity] = MetricsByCounter{
+		temp:   {gpu("0", "GPU-0", "42"), gpu("1", "GPU-1", "43"), gpu("2", "GPU-2", "N/A")},
+		energy: {gpu("0", "GPU-0", "1000")},
+	}
+	metrics[1] = MetricsByCounter{
+		switchTemp: {{Value: "30", GPU: "0", Hostname: "local-test", Timestamp: "1650000000000"}},
+	}
+
+	req := toOTLPRequest(pushBatch{entities: []int{gpuEntity, 1}, metrics: metrics, time: now}, start)
+	require.Len(t, req.ResourceMetrics, 3)
+
+	// The switch has no GPU UUID so its resource only identifies the host
+	assert.Equal(t, map[string]string{"host.name": "local-test"},
+		attributeMap(req.ResourceMetrics[0].Resource.Attributes))
+	switchMetrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, switchMetrics, 1)
+	point := switchMetrics[0].GetGauge().DataPoints[0]
+	assert.Equal(t, map[string]string{"nvswitch": "0"}, attributeMap(point.Attributes))
+	assert.Equal(t, uint64(time.UnixMilli(1650000000000).UnixNano()), point.TimeUnixNano)
+
+	assert.Equal(t, map[string]string{"host.name": "local-test", "gpu.uuid": "GPU-0"},
+		attributeMap(req.ResourceMetrics[1].Resource.Attributes))
+	scope := req.ResourceMetrics[1].ScopeMetrics[0]
+	assert.Equal(t, otlpScopeName, scope.Scope.Name)
+	require.Len(t, scope.Metrics, 2)
+
+	assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP", scope.Metrics[0].Name)
+	assert.Equal(t, "GPU temperature (in C).", scope.Metrics[0].Description)
+	point = scope.Metrics[0].GetGauge().DataPoints[0]
+	assert.Equal(t, 42.0, point.GetAsDouble())
+	assert.Equal(t, uint64(now.UnixNano()), point.TimeUnixNano)
+	assert.Equal(t, map[string]string{
+		"gpu":        "0",
+		"device":     "nvidia0",
+		"modelName":  "NVIDIA T400 4GB",
+		"pci_bus_id": "00000000:0000:0000.0",
+		"cluster":    "prod",
+	}, attributeMap(point.Attributes))
+
+	sum := scope.Metrics[1].GetSum()
+	require.NotNil(t, sum)
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.AggregationTemporality)
+	assert.Equal(t, 1000.0, sum.DataPoints[0].GetAsDouble())
+	assert.Equal(t, uint64(start.UnixNano()), sum.DataPoints[0].StartTimeUnixNano)
+
+	// Non-numeric values are skipped, so GPU-2 has no resource
+	assert.Equal(t, "GPU-1", attributeMap(req.ResourceMetrics[2].Resource.Attributes)["gpu.uuid"])
+}
+
+type fakeMetricsService struct {
+	collectormetricspb.UnimplementedMetricsServiceServer
+
+	requests chan *collectormetricspb.ExportMetricsServiceRequest
+	headers  chan metadata.MD
+}
+
+func (s *fakeMetricsService) Export(ctx context.Context,
+	req *collectormetricspb.ExportMetricsServiceRequest,
+) (*collectormetricspb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.headers <- md
+	s.requests <- req
+	return &collectormetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPExporter_Push(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	service := &fakeMetricsService{
+		requests: make(chan *collectormetricspb.ExportMetricsServiceRequest, 1),
+		headers:  make(chan metadata.MD, 1),
+	}
+
+	server := grpc.NewServer()
+	collectormetricspb.RegisterMetricsServiceServer(server, service)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	e := &otlpExporter{
+		endpoint: "bufnet",
+		headers:  metadata.New(map[string]string{"authorization": "Bearer token"}),
+		timeout:  time.Second,
+		start:    time.Now(),
+		conn:     conn,
+		client:   collectormetricspb.NewMetricsServiceClient(conn),
+	}
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metrics := make([]MetricsByCounter, len(PipelineEntities))
+	metrics[gpuEntity] = MetricsByCounter{
+		counter: {{Value: "42", UUID: "UUID", GPU: "0", GPUUUID: "GPU-0"}},
+	}
+
+	err = e.push(context.Background(), pushBatch{entities: []int{gpuEntity}, metrics: metrics, time: time.Now()})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Bearer token"}, (<-service.headers).Get("authorization"))
+	req := <-service.requests
+	require.Len(t, req.ResourceMetrics, 1)
+	assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP", req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+}
+
+func TestOTLPCredentials(t *testing.T) {
+	creds, err := otlpCredentials(&Config{OTLPInsecure: true})
+	require.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	creds, err = otlpCredentials(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	_, err = otlpCredentials(&Config{OTLPCAFile: "/nonexistent/ca.pem"})
+	require.Error(t, err)
+}
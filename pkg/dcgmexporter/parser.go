@@ -20,7 +20,13 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/sirupsen/logrus"
@@ -36,10 +42,17 @@ const (
 	dcpFieldsStart = 1000
 )
 
+// Number of fields of a counter record: the name, type and help followed by the optional ones, see extractCounters
+const (
+	minCounterFields = 3
+	maxCounterFields = 8
+)
+
 func GetCounterSet(c *Config) (*CounterSet, error) {
 	var (
-		err     error
-		records [][]string
+		err       error
+		records   [][]string
+		positions []string
 	)
 
 	res := new(CounterSet)
@@ -61,37 +74,206 @@ func GetCounterSet(c *Config) (*CounterSet, error) {
 	if err != nil || c.ConfigMapData == undefinedConfigMapData {
 		logrus.Infof("Falling back to metric file '%s'", c.CollectorsFile)
 
-		records, err = ReadCSVFile(c.CollectorsFile)
+		records, positions, err = ReadCSVFiles(c.CollectorsFile)
 		if err != nil {
 			logrus.Errorf("Could not read metrics file '%s'; err: %v", c.CollectorsFile, err)
 			return res, err
 		}
 	}
 
-	res, err = extractCounters(records, c)
+	res, err = extractCounters(records, positions, c)
 	if err != nil {
 		return res, err
 	}
 
-	return res, err
+	res, err = filterCounters(res, c)
+	if err != nil {
+		return res, err
+	}
+
+	res.DCGMCounters = filterProfilingCounters(res.DCGMCounters, c)
+
+	return res, nil
+}
+
+// filterCounters keeps the counters whose field name matches Config.CounterAllowRegex and not Config.CounterDenyRegex.
+// Filtering out every counter is an error.
+func filterCounters(cs *CounterSet, c *Config) (*CounterSet, error) {
+	if c.CounterAllowRegex == nil && c.CounterDenyRegex == nil {
+		return cs, nil
+	}
+
+	keep := func(counter Counter) bool {
+		if c.CounterDenyRegex != nil && c.CounterDenyRegex.MatchString(counter.FieldName) {
+			return false
+		}
+
+		return c.CounterAllowRegex == nil || c.CounterAllowRegex.MatchString(counter.FieldName)
+	}
+
+	res := &CounterSet{}
+	for _, counter := range cs.DCGMCounters {
+		if keep(counter) {
+			res.DCGMCounters = append(res.DCGMCounters, counter)
+		} else {
+			logrus.Debugf("Counter '%s' filtered out", counter.FieldName)
+		}
+	}
+
+	for _, counter := range cs.ExporterCounters {
+		if keep(counter) {
+			res.ExporterCounters = append(res.ExporterCounters, counter)
+		} else {
+			logrus.Debugf("Counter '%s' filtered out", counter.FieldName)
+		}
+	}
+
+	if len(res.DCGMCounters) == 0 && len(res.ExporterCounters) == 0 {
+		return res, fmt.Errorf("no counter left after applying the counter allow regex '%v' and deny regex '%v'",
+			c.CounterAllowRegex, c.CounterDenyRegex)
+	}
+
+	return res, nil
 }
 
 func ReadCSVFile(filename string) ([][]string, error) {
+	records, _, err := readCSVFile(filename)
+
+	return records, err
+}
+
+// readCSVFile reads the records of a CSV file along with their position, "<filename>:<line>", where line is the
+// 1-based physical line on which the record starts, comments included
+func readCSVFile(filename string) ([][]string, []string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer file.Close()
 
 	r := csv.NewReader(file)
 	r.Comment = '#'
-	records, err := r.ReadAll()
+	r.FieldsPerRecord = -1
 
-	return records, err
+	var (
+		records   [][]string
+		positions []string
+	)
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records, positions, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+		records = append(records, record)
+		positions = append(positions, fmt.Sprintf("%s:%d", filename, line))
+	}
+}
+
+// ReadCSVFiles reads the counters from a comma-separated list of CSV files and directories, along with the
+// position of each record, "<filename>:<line>", reported by extractCounters.
+// Directories contribute their *.csv files in lexical order. Counters defined in several files
+// are kept once; the same counter with a different type or help text is an error.
+func ReadCSVFiles(paths string) ([][]string, []string, error) {
+	filenames, err := expandCSVPaths(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		records   [][]string
+		positions []string
+	)
+	definedIn := map[string]string{}
+	definitions := map[string][]string{}
+
+	for _, filename := range filenames {
+		fileRecords, filePositions, err := readCSVFile(filename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read metrics file '%s'; err: %w", filename, err)
+		}
+
+		for i, record := range fileRecords {
+			// Malformed records are kept as is and reported by extractCounters
+			if len(record) < minCounterFields || len(record) > maxCounterFields {
+				records = append(records, record)
+				positions = append(positions, filePositions[i])
+				continue
+			}
+
+			fields := make([]string, len(record))
+			for j, r := range record {
+				fields[j] = strings.Trim(r, " ")
+			}
+
+			// A field given by its numeric ID is the same counter as the field given by its name, unknown IDs are
+			// reported by extractCounters
+			_ = resolveFieldID(fields, filePositions[i])
+
+			name := fields[0]
+			if previous, exists := definitions[name]; exists {
+				if !slices.Equal(previous, fields) {
+					return nil, nil, fmt.Errorf("counter '%s' is defined differently in '%s' and '%s'",
+						name, definedIn[name], filename)
+				}
+				continue
+			}
+
+			definedIn[name] = filename
+			definitions[name] = fields
+			records = append(records, record)
+			positions = append(positions, filePositions[i])
+		}
+	}
+
+	return records, positions, nil
+}
+
+// expandCSVPaths splits the comma-separated paths and replaces directories with the CSV files they contain
+func expandCSVPaths(paths string) ([]string, error) {
+	var filenames []string
+
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			// Let ReadCSVFile report missing files
+			filenames = append(filenames, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read metrics directory '%s'; err: %w", path, err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() && filepath.Ext(entry.Name()) == ".csv" {
+				filenames = append(filenames, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no metrics file found in '%s'", paths)
+	}
+
+	return filenames, nil
 }
 
-func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
+// extractCounters extracts the counters of the records. The errors report the matching positions, see ReadCSVFiles,
+// or the 1-based index of the record when its position is unknown, like for the records of a ConfigMap.
+func extractCounters(records [][]string, positions []string, c *Config) (*CounterSet, error) {
 	res := CounterSet{}
 
 	for i, record := range records {
@@ -100,14 +282,64 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 			continue
 		}
 
+		position := fmt.Sprintf("record %d", i+1)
+		if i < len(positions) {
+			position = positions[i]
+		}
+
 		for j, r := range record {
 			record[j] = strings.Trim(r, " ")
 		}
 
-		if len(record) != 3 {
-			return nil, fmt.Errorf("malformed CSV record; err: failed to parse line %d (`%v`), "+
-				"expected 3 fields", i,
-				record)
+		if len(record) < minCounterFields || len(record) > maxCounterFields {
+			return nil, fmt.Errorf("malformed CSV record; err: failed to parse %s (`%v`), "+
+				"expected %d to %d fields", position,
+				record, minCounterFields, maxCounterFields)
+		}
+
+		if err := resolveFieldID(record, position); err != nil {
+			return nil, err
+		}
+
+		if err := validatePromType(record[0], record[1], position); err != nil {
+			return nil, err
+		}
+
+		// The optional fourth field holds the buckets of histogram counters, the optional fifth one the scope,
+		// the optional sixth one the multiplier of the values, the optional seventh one the GPUs collecting it and the
+		// optional eighth one the statistics of its samples
+		var buckets, scope, multiplier, devices, aggregations string
+		if len(record) >= 4 {
+			buckets = record[3]
+		}
+		if len(record) >= 5 {
+			scope = record[4]
+		}
+		if len(record) >= 6 {
+			multiplier = record[5]
+		}
+		if len(record) >= 7 {
+			devices = record[6]
+		}
+		if len(record) == 8 {
+			aggregations = record[7]
+		}
+
+		if err := validateBuckets(record[0], record[1], buckets); err != nil {
+			return nil, err
+		}
+
+		if err := validateScope(record[0], scope); err != nil {
+			return nil, err
+		}
+
+		scale, err := parseScale(record[0], record[1], multiplier)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateAggregations(record[0], record[1], aggregations); err != nil {
+			return nil, err
 		}
 
 		fieldID, ok := dcgm.DCGM_FI[record[0]]
@@ -118,7 +350,22 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 			if err != nil {
 				return nil, fmt.Errorf("could not find DCGM field; err: %w", err)
 			} else if expField != DCGMFIUnknown {
-				res.ExporterCounters = append(res.ExporterCounters, Counter{dcgm.Short(expField), record[0], record[1], record[2]})
+				if scale != 0 {
+					return nil, fmt.Errorf("counter '%s' is computed by dcgm-exporter and cannot be scaled", record[0])
+				}
+				if devices != "" {
+					return nil, fmt.Errorf("counter '%s' is computed by dcgm-exporter and cannot be restricted to devices",
+						record[0])
+				}
+				if aggregations != "" {
+					return nil, fmt.Errorf("counter '%s' is computed by dcgm-exporter and cannot be sampled", record[0])
+				}
+				help, err := counterHelp(record[0], record[2], fmt.Sprintf("%s (computed by dcgm-exporter).", record[0]),
+					c.HelpVars)
+				if err != nil {
+					return nil, err
+				}
+				res.ExporterCounters = append(res.ExporterCounters, Counter{dcgm.Short(expField), record[0], record[1], help, buckets, scope, scale, devices, aggregations})
 				continue
 			}
 		}
@@ -129,34 +376,129 @@ func extractCounters(records [][]string, c *Config) (*CounterSet, error) {
 
 		if !useOld {
 			if !fieldIsSupported(uint(fieldID), c) {
-				logrus.Warnf("Skipping line %d ('%s'): metric not enabled", i, record[0])
+				logrus.Warnf("Skipping %s ('%s'): metric not enabled", position, record[0])
 				continue
 			}
 
-			if _, ok := promMetricType[record[1]]; !ok {
-				return nil, fmt.Errorf("could not find Prometheus metric type '%s'", record[1])
+			if err := validateCounterType(record[0], fieldID, record[1], c.StrictCounterTypes); err != nil {
+				return nil, err
 			}
 
-			res.DCGMCounters = append(res.DCGMCounters, Counter{fieldID, record[0], record[1], record[2]})
+			if err := validateDevices(record[0], fieldID, scope, devices); err != nil {
+				return nil, err
+			}
+
+			help, err := counterHelp(record[0], record[2], defaultFieldHelp(record[0], fieldID), c.HelpVars)
+			if err != nil {
+				return nil, err
+			}
+
+			res.DCGMCounters = append(res.DCGMCounters, Counter{fieldID, record[0], record[1], help, buckets, scope, scale, devices, aggregations})
 		} else {
 			if !fieldIsSupported(uint(oldFieldID), c) {
-				logrus.Warnf("Skipping line %d ('%s'): metric not enabled", i, record[0])
+				logrus.Warnf("Skipping %s ('%s'): metric not enabled", position, record[0])
 				continue
 			}
 
-			if _, ok := promMetricType[record[1]]; !ok {
-				return nil, fmt.Errorf("could not find Prometheus metric type '%s'", record[1])
+			if err := validateCounterType(record[0], oldFieldID, record[1], c.StrictCounterTypes); err != nil {
+				return nil, err
+			}
+
+			if err := validateDevices(record[0], oldFieldID, scope, devices); err != nil {
+				return nil, err
 			}
 
-			res.DCGMCounters = append(res.DCGMCounters, Counter{oldFieldID, record[0], record[1], record[2]})
+			help, err := counterHelp(record[0], record[2], defaultFieldHelp(record[0], oldFieldID), c.HelpVars)
+			if err != nil {
+				return nil, err
+			}
+
+			res.DCGMCounters = append(res.DCGMCounters, Counter{oldFieldID, record[0], record[1], help, buckets, scope, scale, devices, aggregations})
 		}
 	}
 
 	return &res, nil
 }
 
+// validatePromType checks that the type of a counter is one of promMetricType, so that the templates never emit
+// an unknown # TYPE. It applies to the counters of the DCGM fields missing from the dictionary as well.
+func validatePromType(counter, promType, position string) error {
+	if _, ok := promMetricType[promType]; !ok {
+		return fmt.Errorf("could not find Prometheus metric type '%s' of counter '%s' at %s, "+
+			"expected gauge, counter, histogram, summary or label", promType, counter, position)
+	}
+
+	return nil
+}
+
+// helpVarPattern matches the {<NAME>} variables of the help of the counters
+var helpVarPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// counterHelp returns the help of a counter. An empty help falls back to the default one, the {<NAME>}
+// variables of the others are replaced with their value in vars.
+func counterHelp(counter, help, defaultHelp string, vars map[string]string) (string, error) {
+	if help == "" {
+		return defaultHelp, nil
+	}
+
+	var err error
+	res := helpVarPattern.ReplaceAllStringFunc(help, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown help variable '%s' of counter '%s'", name, counter)
+		}
+
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
+
+// defaultFieldHelp is the help of the DCGM counters declared without one
+func defaultFieldHelp(name string, fieldID dcgm.Short) string {
+	return fmt.Sprintf("%s (DCGM field %d).", name, fieldID)
+}
+
+// fieldNamesByID maps the DCGM field IDs to the name of their field
+var fieldNamesByID = sync.OnceValue(func() map[dcgm.Short]string {
+	res := map[dcgm.Short]string{}
+	for name, fieldID := range dcgm.DCGM_FI {
+		// The map also holds the DCGM_FT_* field types
+		if strings.HasPrefix(name, "DCGM_FI_") {
+			res[fieldID] = name
+		}
+	}
+
+	return res
+})
+
+// resolveFieldID replaces the numeric DCGM field ID of a record with the name of the field. The type and help of
+// such records can be left empty, they default to a gauge and to the default help of the field.
+func resolveFieldID(record []string, position string) error {
+	id, err := strconv.ParseUint(record[0], 10, 16)
+	if err != nil {
+		return nil
+	}
+
+	name, ok := fieldNamesByID()[dcgm.Short(id)]
+	if !ok {
+		return fmt.Errorf("could not find DCGM field; err: unknown field ID %d at %s", id, position)
+	}
+
+	record[0] = name
+	if record[1] == "" {
+		record[1] = "gauge"
+	}
+
+	return nil
+}
+
 func fieldIsSupported(fieldID uint, c *Config) bool {
-	if fieldID < dcpFieldsStart || fieldID >= cpuFieldsStart {
+	if !isProfilingField(fieldID) {
 		return true
 	}
 
@@ -193,6 +535,7 @@ func readConfigMap(kubeClient kubernetes.Interface, c *Config) ([][]string, erro
 
 	r := csv.NewReader(strings.NewReader(cm.Data["metrics"]))
 	r.Comment = '#'
+	r.FieldsPerRecord = -1
 	records, err := r.ReadAll()
 
 	if len(records) == 0 {
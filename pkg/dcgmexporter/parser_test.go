@@ -1,9 +1,15 @@
 package dcgmexporter
 
 import (
+	sysOS "os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
@@ -109,6 +115,81 @@ func TestExtractCounters(t *testing.T) {
 			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature\n",
 			valid: true,
 		},
+		{
+			name:  "Valid Input DCGM_FI_DEV_SM_CLOCK histogram",
+			field: "DCGM_FI_DEV_SM_CLOCK, histogram, SM clock, 500;1000;1500\n",
+			valid: true,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_SM_CLOCK histogram without buckets",
+			field: "DCGM_FI_DEV_SM_CLOCK, histogram, SM clock\n",
+			valid: false,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_GPU_TEMP gauge with buckets",
+			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature, 50;80\n",
+			valid: false,
+		},
+		{
+			name:  "Valid Input DCGM_FI_DEV_GPU_TEMP with mig scope",
+			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature, , mig\n",
+			valid: true,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_GPU_TEMP with unknown scope",
+			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature, , vgpu\n",
+			valid: false,
+		},
+		{
+			name:  "Valid Input DCGM_FI_DEV_POWER_USAGE with multiplier",
+			field: "DCGM_FI_DEV_POWER_USAGE, gauge, power, , , 0.001\n",
+			valid: true,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_POWER_USAGE with malformed multiplier",
+			field: "DCGM_FI_DEV_POWER_USAGE, gauge, power, , , milli\n",
+			valid: false,
+		},
+		{
+			name:  "Invalid Input DCGM_EXP_XID_ERRORS_COUNT with multiplier",
+			field: "DCGM_EXP_XID_ERRORS_COUNT, gauge, xid errors, , , 2\n",
+			valid: false,
+		},
+		{
+			name:  "Valid Input DCGM_FI_DEV_GPU_TEMP restricted to devices",
+			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature, , gpu, , 0;2-3\n",
+			valid: true,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_GPU_TEMP with malformed devices",
+			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature, , gpu, , 3-1\n",
+			valid: false,
+		},
+		{
+			name:  "Invalid Input DCGM_FI_DEV_GPU_TEMP with switch scope restricted to devices",
+			field: "DCGM_FI_DEV_GPU_TEMP, gauge, temperature, , switch, , 0\n",
+			valid: false,
+		},
+		{
+			name:  "Invalid Input DCGM_EXP_XID_ERRORS_COUNT restricted to devices",
+			field: "DCGM_EXP_XID_ERRORS_COUNT, gauge, xid errors, , , , 0\n",
+			valid: false,
+		},
+		{
+			name:  "Valid Input field ID 150",
+			field: "150, gauge, temperature\n",
+			valid: true,
+		},
+		{
+			name:  "Valid Input field ID 150 without type and help",
+			field: "150, , \n",
+			valid: true,
+		},
+		{
+			name:  "Invalid Input unknown field ID",
+			field: "9999, gauge, unknown\n",
+			valid: false,
+		},
 		{
 			name:  "Invalid Input DCGM_EXP_XID_ERRORS_COUNTXXX",
 			field: "DCGM_EXP_XID_ERRORS_COUNTXXX, gauge, temperature\n",
@@ -123,6 +204,284 @@ func TestExtractCounters(t *testing.T) {
 	}
 }
 
+func TestExtractCountersByFieldID(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		want    []Counter
+		wantErr string
+	}{
+		{
+			name:    "When a field ID is given, it is resolved to the name of the field",
+			records: [][]string{{"150", "gauge", "GPU temperature (in C)."}},
+			want: []Counter{
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge",
+					Help: "GPU temperature (in C)."},
+			},
+		},
+		{
+			name:    "When the type and help of a field ID are empty, they have defaults",
+			records: [][]string{{"100", "", ""}},
+			want: []Counter{
+				{FieldID: dcgm.DCGM_FI_DEV_SM_CLOCK, FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "gauge",
+					Help: "DCGM_FI_DEV_SM_CLOCK (DCGM field 100)."},
+			},
+		},
+		{
+			name:    "When a field ID is unknown, the record is reported",
+			records: [][]string{{"DCGM_FI_DEV_GPU_TEMP", "gauge", "temperature"}, {"9999", "gauge", "unknown"}},
+			wantErr: "unknown field ID 9999 at record 2",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cs, err := extractCounters(tc.records, nil, &Config{})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cs.DCGMCounters)
+		})
+	}
+}
+
+func TestExtractCountersPromType(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		wantErr string
+	}{
+		{
+			name: "When every type is a Prometheus type, the counters are extracted",
+			records: [][]string{
+				{"DCGM_FI_DEV_GPU_TEMP", "gauge", "temperature"},
+				{"DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "counter", "energy"},
+				{"DCGM_FI_DRIVER_VERSION", "label", "driver"},
+			},
+		},
+		{
+			name:    "When the type of a DCGM field is invalid, the record is reported",
+			records: [][]string{{"DCGM_FI_DEV_GPU_TEMP", "gauge", "temperature"}, {"DCGM_FI_DEV_SM_CLOCK", "gague", "clock"}},
+			wantErr: "could not find Prometheus metric type 'gague' of counter 'DCGM_FI_DEV_SM_CLOCK' at record 2",
+		},
+		{
+			name:    "When the type of a counter computed by dcgm-exporter is invalid, the record is reported",
+			records: [][]string{{"DCGM_EXP_XID_ERRORS_COUNT", "countr", "xid"}},
+			wantErr: "could not find Prometheus metric type 'countr' of counter 'DCGM_EXP_XID_ERRORS_COUNT' at record 1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := extractCounters(tc.records, nil, &Config{})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestExtractCountersHelp(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  [][]string
+		helpVars map[string]string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:    "When the help is empty, the default help of the field is used",
+			records: [][]string{{"DCGM_FI_DEV_GPU_TEMP", "gauge", ""}},
+			want:    []string{"DCGM_FI_DEV_GPU_TEMP (DCGM field 150)."},
+		},
+		{
+			name:    "When the help is set, it overrides the default help",
+			records: [][]string{{"DCGM_FI_DEV_GPU_TEMP", "gauge", "GPU temperature (in C)."}},
+			want:    []string{"GPU temperature (in C)."},
+		},
+		{
+			name: "When the help has variables, they are expanded",
+			records: [][]string{
+				{"DCGM_FI_DEV_GPU_TEMP", "gauge", "GPU temperature (in C), see {runbook}/temperature."},
+				{"DCGM_FI_DEV_SM_CLOCK", "gauge", ""},
+			},
+			helpVars: map[string]string{"runbook": "https://runbooks.example.com/gpu"},
+			want: []string{
+				"GPU temperature (in C), see https://runbooks.example.com/gpu/temperature.",
+				"DCGM_FI_DEV_SM_CLOCK (DCGM field 100).",
+			},
+		},
+		{
+			name:    "When the help has an unknown variable, it fails",
+			records: [][]string{{"DCGM_FI_DEV_GPU_TEMP", "gauge", "See {runbook}."}},
+			wantErr: "unknown help variable 'runbook' of counter 'DCGM_FI_DEV_GPU_TEMP'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cs, err := extractCounters(tc.records, nil, &Config{HelpVars: tc.helpVars})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			var got []string
+			for _, counter := range cs.DCGMCounters {
+				got = append(got, counter.Help)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestReadCSVFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	utilization := writeFile("utilization.csv", "DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %).\n")
+	temperature := writeFile("temperature.csv", "# Temperature\nDCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n")
+	duplicate := writeFile("duplicate.csv", "DCGM_FI_DEV_GPU_TEMP,gauge,GPU temperature (in C).\n")
+	conflict := writeFile("conflict.txt", "DCGM_FI_DEV_GPU_TEMP, counter, GPU temperature (in C).\n")
+
+	tests := []struct {
+		name      string
+		paths     string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name:      "When a single file is given, its counters are read",
+			paths:     utilization,
+			wantNames: []string{"DCGM_FI_DEV_GPU_UTIL"},
+		},
+		{
+			name:      "When a list of files is given, counters are concatenated",
+			paths:     utilization + ", " + temperature,
+			wantNames: []string{"DCGM_FI_DEV_GPU_UTIL", "DCGM_FI_DEV_GPU_TEMP"},
+		},
+		{
+			name:      "When a directory is given, its CSV files are read in lexical order",
+			paths:     dir,
+			wantNames: []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_GPU_UTIL"},
+		},
+		{
+			name:      "When a counter is defined twice identically, it is kept once",
+			paths:     temperature + "," + duplicate,
+			wantNames: []string{"DCGM_FI_DEV_GPU_TEMP"},
+		},
+		{
+			name:    "When a counter is defined twice differently, both files are named",
+			paths:   temperature + "," + conflict,
+			wantErr: "counter 'DCGM_FI_DEV_GPU_TEMP' is defined differently in '" + temperature + "' and '" + conflict + "'",
+		},
+		{
+			name:    "When a file does not exist, an error is returned",
+			paths:   filepath.Join(dir, "missing.csv"),
+			wantErr: "missing.csv",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			records, _, err := ReadCSVFiles(tc.paths)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			var names []string
+			for _, record := range records {
+				names = append(names, strings.TrimSpace(record[0]))
+			}
+			assert.Equal(t, tc.wantNames, names)
+		})
+	}
+}
+
+func TestReadCSVFilesWithOptionalFields(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	subset := writeFile("subset.csv", "DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C)., , , , 0-1\n")
+	duplicate := writeFile("duplicate.csv", "DCGM_FI_DEV_GPU_TEMP,gauge,GPU temperature (in C).,,,,0-1\n")
+	conflict := writeFile("conflict.csv", "DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C)., , , , 2\n")
+
+	records, _, err := ReadCSVFiles(subset + "," + duplicate)
+	require.NoError(t, err)
+	assert.Len(t, records, 1, "a counter restricted to the same GPUs is kept once")
+
+	_, _, err = ReadCSVFiles(subset + "," + conflict)
+	require.ErrorContains(t, err, "counter 'DCGM_FI_DEV_GPU_TEMP' is defined differently")
+
+	sampled := writeFile("sampled.csv", "DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %)., , , , , min;max\n")
+	resampled := writeFile("resampled.csv", "DCGM_FI_DEV_GPU_UTIL, gauge, GPU utilization (in %)., , , , , avg\n")
+
+	_, _, err = ReadCSVFiles(sampled + "," + resampled)
+	require.ErrorContains(t, err, "counter 'DCGM_FI_DEV_GPU_UTIL' is defined differently")
+}
+
+func TestReadCSVFilesWithFieldIDs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	byName := writeFile("by-name.csv", "DCGM_FI_DEV_POWER_USAGE, gauge, Power draw (in W).\n")
+	byID := writeFile("by-id.csv", "155, gauge, Power draw (in W).\n")
+	conflict := writeFile("conflict.csv", "155, counter, Power draw (in W).\n")
+
+	records, _, err := ReadCSVFiles(byName + "," + byID)
+	require.NoError(t, err)
+	assert.Len(t, records, 1, "a field given by its name and by its ID is kept once")
+
+	_, _, err = ReadCSVFiles(byName + "," + conflict)
+	require.ErrorContains(t, err, "counter 'DCGM_FI_DEV_POWER_USAGE' is defined differently")
+}
+
+func TestReadCSVFilesPositions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, sysOS.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	temperature := writeFile("temperature.csv", "# Temperature\n\nDCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n")
+	clocks := writeFile("clocks.csv", "DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n"+
+		"# Clocks\nDCGM_FI_DEV_SM_CLOCK, gague, SM clock frequency (in MHz).\n9999, gauge, Unknown field.\n")
+
+	records, positions, err := ReadCSVFiles(temperature + "," + clocks)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{temperature + ":3", clocks + ":3", clocks + ":4"}, positions)
+
+	_, err = extractCounters(records, positions, &Config{})
+	require.ErrorContains(t, err, "counter 'DCGM_FI_DEV_SM_CLOCK' at "+clocks+":3")
+
+	_, err = extractCounters(records[2:], positions[2:], &Config{})
+	require.ErrorContains(t, err, "unknown field ID 9999 at "+clocks+":4")
+}
+
 func extractCountersHelper(t *testing.T, input string, valid bool) {
 	tmpFile, err := os.CreateTemp(os.TempDir(), "prefix-")
 	if err != nil {
@@ -155,3 +514,83 @@ func extractCountersHelper(t *testing.T, input string, valid bool) {
 		assert.Nil(t, cc, "Expected no counters.")
 	}
 }
+
+func TestFilterCounters(t *testing.T) {
+	counterSet := &CounterSet{
+		DCGMCounters: []Counter{
+			{FieldName: "DCGM_FI_DEV_GPU_TEMP"},
+			{FieldName: "DCGM_FI_DEV_POWER_USAGE"},
+			{FieldName: "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE"},
+		},
+		ExporterCounters: []Counter{
+			{FieldName: "DCGM_EXP_XID_ERRORS_COUNT"},
+		},
+	}
+
+	fieldNames := func(counters []Counter) []string {
+		var res []string
+		for _, counter := range counters {
+			res = append(res, counter.FieldName)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name             string
+		allow            string
+		deny             string
+		dcgmCounters     []string
+		exporterCounters []string
+		wantErr          bool
+	}{
+		{
+			name:             "When no regex is set",
+			dcgmCounters:     []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_POWER_USAGE", "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE"},
+			exporterCounters: []string{"DCGM_EXP_XID_ERRORS_COUNT"},
+		},
+		{
+			name:         "When only the allow regex is set",
+			allow:        "^DCGM_FI_DEV_",
+			dcgmCounters: []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_POWER_USAGE"},
+		},
+		{
+			name:             "When only the deny regex is set",
+			deny:             "PROF",
+			dcgmCounters:     []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_POWER_USAGE"},
+			exporterCounters: []string{"DCGM_EXP_XID_ERRORS_COUNT"},
+		},
+		{
+			name:         "When the deny regex overlaps the allow regex",
+			allow:        "^DCGM_FI_DEV_",
+			deny:         "POWER",
+			dcgmCounters: []string{"DCGM_FI_DEV_GPU_TEMP"},
+		},
+		{
+			name:    "When no counter is left",
+			allow:   "^DCGM_FI_DEV_",
+			deny:    "^DCGM_",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			if tt.allow != "" {
+				config.CounterAllowRegex = regexp.MustCompile(tt.allow)
+			}
+			if tt.deny != "" {
+				config.CounterDenyRegex = regexp.MustCompile(tt.deny)
+			}
+
+			got, err := filterCounters(counterSet, config)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.dcgmCounters, fieldNames(got.DCGMCounters))
+			assert.Equal(t, tt.exporterCounters, fieldNames(got.ExporterCounters))
+		})
+	}
+}
@@ -17,8 +17,15 @@
 package dcgmexporter
 
 import (
-	"bytes"
+	"cmp"
+	"context"
 	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"text/template"
 	"time"
@@ -27,93 +34,196 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// PipelineEntities names the entities collected by the MetricsPipeline, in output order.
+// The names are used as keys of Config.CollectIntervalOverrides.
+var PipelineEntities = []string{"gpu", "switch", "link", "cpu", "core"}
+
+// gpuEntity is the index of the GPU entity in PipelineEntities
+const gpuEntity = 0
+
+// drainTimeout bounds how long Run waits on shutdown to hand the last payload to a slow consumer, and how long the
+// server waits for it. It must stay below the time startDCGMExporter waits for the pipeline to stop.
+var drainTimeout = time.Second
+
 func NewMetricsPipeline(config *Config,
 	counters []Counter,
 	hostname string,
-	newDCGMCollector DCGMCollectorConstructor,
+	newCollector CollectorConstructor,
 	fieldEntityGroupTypeSystemInfo *FieldEntityGroupTypeSystemInfo,
 ) (*MetricsPipeline, func(), error) {
 	logrus.WithField(LoggerDumpKey, fmt.Sprintf("%+v", counters)).Debug("Counters are initialized")
 
-	cleanups := []func(){}
+	switch config.OutputBackpressure {
+	case "", OutputBackpressureDropOldest, OutputBackpressureDropNewest, OutputBackpressureBlock:
+	default:
+		return nil, func() {}, fmt.Errorf("unknown output backpressure policy '%s'", config.OutputBackpressure)
+	}
+
+	collectors, collectorsCleanup := newPipelineCollectors(config, counters, hostname, newCollector,
+		fieldEntityGroupTypeSystemInfo)
+	cleanups := []func(){collectorsCleanup}
+
+	var pushQueues []*pushQueue
+	if config.RemoteWriteURL != "" {
+		pushQueues = append(pushQueues, newPushQueue(newRemoteWriter(config)))
+	}
+	if config.EnableOTLP {
+		otlpExporter, cleanup, err := newOTLPExporter(config)
+		if err != nil {
+			logrus.Warnf("Cannot create OTLP exporter; err: %v", err)
+		} else {
+			pushQueues = append(pushQueues, newPushQueue(otlpExporter))
+		}
+		cleanups = append(cleanups, cleanup)
+	}
+	if config.StatsDAddress != "" {
+		statsDWriter, cleanup, err := newStatsDWriter(config)
+		if err != nil {
+			logrus.Warnf("Cannot create StatsD writer; err: %v", err)
+		} else {
+			pushQueues = append(pushQueues, newPushQueue(statsDWriter))
+		}
+		cleanups = append(cleanups, cleanup)
+	}
+	if config.PushSuppressUnchanged {
+		for _, q := range pushQueues {
+			q.filter = newDeltaFilter(config)
+		}
+	}
+
+	transformations := getTransformations(config)
+
+	health := newEntityHealth(config, fieldEntityGroupTypeSystemInfo, collectors.entityCollectors())
 
+	return &MetricsPipeline{
+			config: config,
+
+			migMetricsFormat:     migMetricsTemplate,
+			switchMetricsFormat:  switchMetricsTemplate,
+			linkMetricsFormat:    linkMetricsTemplate,
+			cpuMetricsFormat:     cpuMetricsTemplate,
+			cpuCoreMetricsFormat: cpuCoreMetricsTemplate,
+			processMetricsFormat: processMetricsTemplate,
+			vgpuMetricsFormat:    vgpuMetricsTemplate,
+
+			counters:         counters,
+			gpuCollector:     collectors.gpuCollector,
+			switchCollector:  collectors.switchCollector,
+			linkCollector:    collectors.linkCollector,
+			transformations:  transformations,
+			cpuCollector:     collectors.cpuCollector,
+			coreCollector:    collectors.coreCollector,
+			processCollector: collectors.processCollector,
+			vgpuCollector:    collectors.vgpuCollector,
+			pushQueues:       pushQueues,
+			health:           health,
+			metricGroups:     activeMetricGroups(counters, config),
+		}, func() {
+			for _, cleanup := range cleanups {
+				cleanup()
+			}
+		}, nil
+}
+
+// pipelineCollectors are the collectors of the pipeline, Reload swaps them for new ones
+type pipelineCollectors struct {
+	gpuCollector     EntityCollector
+	switchCollector  EntityCollector
+	linkCollector    EntityCollector
+	cpuCollector     EntityCollector
+	coreCollector    EntityCollector
+	processCollector *processCollector
+	vgpuCollector    *vgpuCollector
+}
+
+// newPipelineCollectors creates the collectors of the enabled entities, an entity whose collector cannot be created
+// is skipped. The returned function cleans up the collectors.
+func newPipelineCollectors(config *Config,
+	counters []Counter,
+	hostname string,
+	newCollector CollectorConstructor,
+	fieldEntityGroupTypeSystemInfo *FieldEntityGroupTypeSystemInfo,
+) (pipelineCollectors, func()) {
 	var (
-		gpuCollector    *DCGMCollector
-		switchCollector *DCGMCollector
-		linkCollector   *DCGMCollector
-		cpuCollector    *DCGMCollector
-		coreCollector   *DCGMCollector
-		err             error
+		c        pipelineCollectors
+		cleanups []func()
+		err      error
 	)
 
-	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU); exists {
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU); exists && config.EntityEnabled(dcgm.FE_GPU) {
 		var cleanup func()
-		gpuCollector, cleanup, err = newDCGMCollector(counters, hostname, config, item)
+		c.gpuCollector, cleanup, err = newCollectorWithRetry(newCollector, counters, hostname, config, item)
 		if err != nil {
-			logrus.Warn("Cannot create DCGMCollector for dcgm.FE_GPU")
+			logrus.Warnf("Cannot create collector for dcgm.FE_GPU; err: %v", err)
 		}
 		cleanups = append(cleanups, cleanup)
 	}
 
-	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_SWITCH); exists {
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_SWITCH); exists && config.EntityEnabled(dcgm.FE_SWITCH) {
 		var cleanup func()
-		switchCollector, cleanup, err = newDCGMCollector(counters, hostname, config, item)
+		c.switchCollector, cleanup, err = newCollectorWithRetry(newCollector, counters, hostname, config, item)
 		if err != nil {
-			logrus.Warn("Cannot create DCGMCollector for dcgm.FE_SWITCH")
+			logrus.Warnf("Cannot create collector for dcgm.FE_SWITCH; err: %v", err)
 		}
 		cleanups = append(cleanups, cleanup)
 	}
 
-	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_LINK); exists {
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_LINK); exists && config.EntityEnabled(dcgm.FE_LINK) {
 		var cleanup func()
-		linkCollector, cleanup, err = newDCGMCollector(counters, hostname, config, item)
+		c.linkCollector, cleanup, err = newCollectorWithRetry(newCollector, counters, hostname, config, item)
 		if err != nil {
-			logrus.Warn("Cannot create DCGMCollector for dcgm.FE_LINK")
+			logrus.Warnf("Cannot create collector for dcgm.FE_LINK; err: %v", err)
 		}
 		cleanups = append(cleanups, cleanup)
 	}
 
-	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_CPU); exists {
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_CPU); exists && config.EntityEnabled(dcgm.FE_CPU) {
 		var cleanup func()
-		cpuCollector, cleanup, err = newDCGMCollector(counters, hostname, config, item)
+		c.cpuCollector, cleanup, err = newCollectorWithRetry(newCollector, counters, hostname, config, item)
 		if err != nil {
-			logrus.Warn("Cannot create DCGMCollector for dcgm.FE_CPU")
+			logrus.Warnf("Cannot create collector for dcgm.FE_CPU; err: %v", err)
 		}
 		cleanups = append(cleanups, cleanup)
 	}
 
-	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_CPU_CORE); exists {
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_CPU_CORE); exists && config.EntityEnabled(dcgm.FE_CPU_CORE) {
 		var cleanup func()
-		coreCollector, cleanup, err = newDCGMCollector(counters, hostname, config, item)
+		c.coreCollector, cleanup, err = newCollectorWithRetry(newCollector, counters, hostname, config, item)
 		if err != nil {
-			logrus.Warn("Cannot create DCGMCollector for dcgm.FE_CPU_CORE")
+			logrus.Warnf("Cannot create collector for dcgm.FE_CPU_CORE; err: %v", err)
 		}
 		cleanups = append(cleanups, cleanup)
 	}
 
-	transformations := getTransformations(config)
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU); exists && config.EntityEnabled(dcgm.FE_GPU) &&
+		(config.EnableProcessMetrics || config.EnableProcessMemoryMetrics) {
+		var cleanup func()
+		c.processCollector, cleanup, err = newProcessCollector(hostname, config, item)
+		if err != nil {
+			logrus.Warnf("Cannot create process collector; err: %v", err)
+		}
+		cleanups = append(cleanups, cleanup)
+	}
 
-	return &MetricsPipeline{
-			config: config,
+	if item, exists := fieldEntityGroupTypeSystemInfo.Get(dcgm.FE_GPU); exists && config.EntityEnabled(dcgm.FE_GPU) && config.EnableVGPU {
+		var cleanup func()
+		c.vgpuCollector, cleanup, err = newVGPUCollector(counters, hostname, config, item)
+		if err != nil {
+			logrus.Warnf("Cannot create vGPU collector; err: %v", err)
+		}
+		cleanups = append(cleanups, cleanup)
+	}
 
-			migMetricsFormat:     template.Must(template.New("migMetrics").Parse(migMetricsFormat)),
-			switchMetricsFormat:  template.Must(template.New("switchMetrics").Parse(switchMetricsFormat)),
-			linkMetricsFormat:    template.Must(template.New("switchMetrics").Parse(linkMetricsFormat)),
-			cpuMetricsFormat:     template.Must(template.New("cpuMetrics").Parse(cpuMetricsFormat)),
-			cpuCoreMetricsFormat: template.Must(template.New("cpuMetrics").Parse(cpuCoreMetricsFormat)),
-
-			counters:        counters,
-			gpuCollector:    gpuCollector,
-			switchCollector: switchCollector,
-			linkCollector:   linkCollector,
-			transformations: transformations,
-			cpuCollector:    cpuCollector,
-			coreCollector:   coreCollector,
-		}, func() {
-			for _, cleanup := range cleanups {
-				cleanup()
-			}
-		}, nil
+	return c, func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}
+}
+
+// entityCollectors returns the collectors of the entities, in the order of PipelineEntities
+func (c pipelineCollectors) entityCollectors() []EntityCollector {
+	return []EntityCollector{c.gpuCollector, c.switchCollector, c.linkCollector, c.cpuCollector, c.coreCollector}
 }
 
 func getTransformations(c *Config) []Transform {
@@ -127,157 +237,851 @@ func getTransformations(c *Config) []Transform {
 		}
 	}
 
+	if len(c.NodeLabelAllowlist) > 0 {
+		nodeLabelMapper, err := newNodeLabelMapper(c)
+		if err != nil {
+			logrus.Warnf("Could not enable the Kubernetes node labels: %v", err)
+		} else {
+			transformations = append(transformations, nodeLabelMapper)
+		}
+	}
+
+	if c.Slurm {
+		transformations = append(transformations, newSlurmMapper())
+	}
+
 	if c.HPCJobMappingDir != "" {
 		hpcMapper := newHPCMapper(c)
 		transformations = append(transformations, hpcMapper)
 	}
 
+	return orderTransforms(append(transformations, c.Transforms...), c.TransformOrder)
+}
+
+// builtinTransformNames are the names of the transformations created from the config, the ones accepted by
+// ValidateTransformOrder
+var builtinTransformNames = []string{"podMapper", "nodeLabelMapper", "slurmMapper", "hpcMapper"}
+
+// orderTransforms moves the transformations named in order to the front, in that order. The others keep their
+// default order after them: the built-in ones first, then Config.Transforms. A transformation overwrites the
+// attributes set by the previous ones, so the last one writing an attribute wins.
+func orderTransforms(transformations []Transform, order []string) []Transform {
+	rank := func(t Transform) int {
+		if i := slices.Index(order, t.Name()); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+
+	slices.SortStableFunc(transformations, func(a, b Transform) int {
+		return cmp.Compare(rank(a), rank(b))
+	})
+
 	return transformations
 }
 
+// ValidateTransformOrder checks that the order only names built-in transformations, each at most once
+func ValidateTransformOrder(order []string) error {
+	for i, name := range order {
+		if !slices.Contains(builtinTransformNames, name) {
+			return fmt.Errorf("unknown transform '%s', expected one of %s", name,
+				strings.Join(builtinTransformNames, ", "))
+		}
+
+		if slices.Contains(order[:i], name) {
+			return fmt.Errorf("transform '%s' is ordered more than once", name)
+		}
+	}
+
+	return nil
+}
+
+// Reload rebuilds the collectors for a new set of counters and swaps them in between two collections.
+// The transformations and the push queues only depend on the config, they are kept along with their
+// connections. The returned function cleans up the new collectors; cleaning up the previous ones is
+// left to the caller once Reload returns.
+func (m *MetricsPipeline) Reload(counters []Counter,
+	hostname string,
+	newCollector CollectorConstructor,
+	fieldEntityGroupTypeSystemInfo *FieldEntityGroupTypeSystemInfo,
+) (func(), error) {
+	logrus.WithField(LoggerDumpKey, fmt.Sprintf("%+v", counters)).Debug("Counters are reloaded")
+
+	next, cleanup := newPipelineCollectors(m.config, counters, hostname, newCollector, fieldEntityGroupTypeSystemInfo)
+	health := newEntityHealth(m.config, fieldEntityGroupTypeSystemInfo, next.entityCollectors())
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.counters = counters
+	m.gpuCollector = next.gpuCollector
+	m.switchCollector = next.switchCollector
+	m.linkCollector = next.linkCollector
+	m.cpuCollector = next.cpuCollector
+	m.coreCollector = next.coreCollector
+	m.processCollector = next.processCollector
+	m.vgpuCollector = next.vgpuCollector
+	m.health = health
+	m.metricGroups = activeMetricGroups(counters, m.config)
+
+	for i := range m.additionalCollectors {
+		m.health[i].monitored = true
+	}
+	m.cache = nil
+	m.latest = nil
+
+	return cleanup, nil
+}
+
+// RetryWithBackoff calls attempt until it succeeds or Config.InitRetryTimeout elapses, and returns the error of the
+// last attempt. The delay between attempts starts at Config.InitRetryInterval and doubles after every failure. The
+// failures are logged as failures to <action>.
+func RetryWithBackoff(config *Config, action string, attempt func() error) error {
+	deadline := time.Now().Add(time.Duration(config.InitRetryTimeout) * time.Millisecond)
+	delay := time.Duration(config.InitRetryInterval) * time.Millisecond
+
+	for {
+		err := attempt()
+		if err == nil || delay <= 0 {
+			return err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+
+		logrus.Infof("Failed to %s, retrying in %s; err: %v", action, min(delay, remaining), err)
+
+		time.Sleep(min(delay, remaining))
+		delay *= 2
+	}
+}
+
+// newCollectorWithRetry calls newCollector until it succeeds, see RetryWithBackoff. The collectors of the failed
+// attempts are cleaned up.
+func newCollectorWithRetry(newCollector CollectorConstructor,
+	counters []Counter,
+	hostname string,
+	config *Config,
+	item FieldEntityGroupTypeSystemInfoItem,
+) (EntityCollector, func(), error) {
+	var (
+		collector EntityCollector
+		cleanup   func()
+	)
+
+	err := RetryWithBackoff(config, "create collector for "+item.SystemInfo.InfoType.String(), func() error {
+		var err error
+		collector, cleanup, err = newCollector(counters, hostname, config, item)
+		if err != nil {
+			cleanup()
+			cleanup = func() {}
+		}
+
+		return err
+	})
+
+	return collector, cleanup, err
+}
+
 // Primarely for testing, caller expected to cleanup the collector
 func NewMetricsPipelineWithGPUCollector(c *Config, collector *DCGMCollector) (*MetricsPipeline, func(), error) {
 	return &MetricsPipeline{
 		config: c,
 
-		migMetricsFormat:     template.Must(template.New("migMetrics").Parse(migMetricsFormat)),
-		switchMetricsFormat:  template.Must(template.New("switchMetrics").Parse(switchMetricsFormat)),
-		linkMetricsFormat:    template.Must(template.New("switchMetrics").Parse(linkMetricsFormat)),
-		cpuMetricsFormat:     template.Must(template.New("cpuMetrics").Parse(cpuMetricsFormat)),
-		cpuCoreMetricsFormat: template.Must(template.New("cpuMetrics").Parse(cpuCoreMetricsFormat)),
+		migMetricsFormat:     migMetricsTemplate,
+		switchMetricsFormat:  switchMetricsTemplate,
+		linkMetricsFormat:    linkMetricsTemplate,
+		cpuMetricsFormat:     cpuMetricsTemplate,
+		cpuCoreMetricsFormat: cpuCoreMetricsTemplate,
+		processMetricsFormat: processMetricsTemplate,
+		vgpuMetricsFormat:    vgpuMetricsTemplate,
 
 		counters:     collector.Counters,
 		gpuCollector: collector,
+		health:       []entityHealth{{monitored: true, up: true}},
 	}, func() {}, nil
 }
 
+// Run collects the metrics every collect interval and sends their output to out until stop is closed. On stop, the
+// last payload is flushed to out, then out is closed so the consumer knows no payload follows.
 func (m *MetricsPipeline) Run(out chan string, stop chan interface{}, wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer close(out)
 
 	logrus.Info("Pipeline starting")
 
 	// Note we are using a ticker so that we can stick as close as possible to the collect interval.
 	// e.g: The CollectInterval is 10s and the transformation pipeline takes 5s, the time will
 	// ensure we really collect metrics every 10s by firing an event 5s after the run function completes.
-	t := time.NewTicker(time.Millisecond * time.Duration(m.config.CollectInterval))
-	defer t.Stop()
+	//
+	// When collect interval overrides are configured, one ticker is started per distinct interval
+	// and each tick only refreshes the entities that use that interval.
+	//
+	// With Config.CollectIntervalJitter, the tickers start after a random fraction of their interval
+	// drawn once per instance, so that instances restarted together don't collect at the same time.
+	ticks := make(chan []int)
+	var tickersWG sync.WaitGroup
+	defer tickersWG.Wait()
+
+	jitter := rand.Float64() * m.config.CollectIntervalJitter
+
+	for interval, entities := range m.entitiesByInterval() {
+		tickersWG.Add(1)
+		go func(interval int, entities []int) {
+			defer tickersWG.Done()
+
+			if offset := tickerOffset(interval, jitter); offset > 0 {
+				logrus.Debugf("Delaying the collections every %d ms by %s", interval, offset)
+
+				select {
+				case <-stop:
+					return
+				case <-time.After(offset):
+				}
+			}
+
+			t := time.NewTicker(time.Millisecond * time.Duration(interval))
+			defer t.Stop()
+
+			for {
+				select {
+				case <-stop:
+					return
+				case <-t.C:
+					select {
+					case ticks <- entities:
+					case <-stop:
+						return
+					}
+				}
+			}
+		}(interval, entities)
+	}
+
+	for _, q := range m.pushQueues {
+		tickersWG.Add(1)
+		go func(q *pushQueue) {
+			defer tickersWG.Done()
+			q.run(stop)
+		}(q)
+	}
+
+	// pending is a single-slot buffer holding the payload that out could not take yet. With the default
+	// Config.OutputBackpressure a newer payload replaces it, so the consumer always gets the most recent one,
+	// with OutputBackpressureDropNewest the newer payload is dropped instead. OutputBackpressureBlock waits
+	// for the consumer, so nothing is ever pending. A collection that is in flight when stop is closed completes first, so its output
+	// ends up either in out or here, and is flushed before returning.
+	var pending string
+	var hasPending bool
 
 	for {
+		// Sending on a nil channel blocks, which disables the case while nothing is pending
+		var send chan string
+		if hasPending {
+			send = out
+		}
+
 		select {
 		case <-stop:
+			if hasPending {
+				drain(out, pending)
+			}
 			return
-		case <-t.C:
-			o, err := m.run()
+		case send <- pending:
+			hasPending = false
+		case entities := <-ticks:
+			o, err := m.collect(entities)
 			if err != nil {
 				logrus.Errorf("Failed to collect metrics; err: %v", err)
-				/* flush output rather than output stale data */
-				out <- ""
-				continue
+				/* flush output rather than output stale data, but keep reporting the collector health */
+				o = ""
+				if m.config.AdminListenAddress == "" {
+					o = m.internalMetrics()
+				}
+			} else if len(m.pushQueues) > 0 {
+				batch := m.pushBatch(entities)
+				for _, q := range m.pushQueues {
+					q.enqueue(batch)
+				}
 			}
 
-			if len(out) == cap(out) {
-				logrus.Errorf("Channel is full skipping.")
-			} else {
-				out <- o
+			switch m.config.OutputBackpressure {
+			case OutputBackpressureBlock:
+				select {
+				case out <- o:
+				case <-stop:
+					drain(out, o)
+					return
+				}
+			case OutputBackpressureDropNewest:
+				if hasPending {
+					m.coalescedTicks.Add(1)
+					logrus.Debug("Metrics payload still pending; dropping the newest one")
+					continue
+				}
+				pending = o
+				hasPending = !trySend(out, o)
+			default:
+				if hasPending {
+					m.coalescedTicks.Add(1)
+				}
+				pending = o
+				hasPending = !m.publish(out, o)
 			}
 		}
 	}
 }
 
-func (m *MetricsPipeline) run() (string, error) {
-	var metrics map[Counter][]Metric
-	var err error
-	var formatted string
+// tickerOffset returns the delay of the first tick of a ticker firing every interval ms
+func tickerOffset(interval int, jitter float64) time.Duration {
+	return time.Duration(float64(interval) * jitter * float64(time.Millisecond))
+}
 
-	if m.gpuCollector != nil {
-		/* Collect GPU Metrics */
-		metrics, err = m.gpuCollector.GetMetrics()
-		if err != nil {
-			return "", fmt.Errorf("failed to collect gpu metrics; err: %w", err)
+// publish hands the payload to out without blocking. When out is full, the oldest buffered payload is
+// dropped in favor of the new one since the consumer only needs the latest. It reports whether out took it.
+func (m *MetricsPipeline) publish(out chan string, payload string) bool {
+	select {
+	case out <- payload:
+		return true
+	default:
+	}
+
+	// Run is the only sender, so once a stale payload is drained the send cannot block
+	select {
+	case <-out:
+		m.coalescedTicks.Add(1)
+		logrus.Debug("Metrics channel is full; replacing the oldest payload")
+	default:
+		return false
+	}
+
+	select {
+	case out <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// trySend hands the payload to out without blocking and reports whether out took it
+func trySend(out chan string, payload string) bool {
+	select {
+	case out <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain pushes the payload to out, giving up after drainTimeout if nobody reads it
+func drain(out chan string, payload string) {
+	select {
+	case out <- payload:
+	case <-time.After(drainTimeout):
+		logrus.Warnf("Dropping last metrics payload; consumer did not read it within %s", drainTimeout)
+	}
+}
+
+// Ready reports whether at least one collector exists and a collection succeeded
+// within the last two ticks of the most frequently collected entity.
+func (m *MetricsPipeline) Ready() bool {
+	lastSuccess := m.lastSuccess.Load()
+	if lastSuccess == 0 {
+		return false
+	}
+
+	interval := m.config.CollectInterval
+	for override := range m.entitiesByInterval() {
+		interval = min(interval, override)
+	}
+
+	return time.Since(time.Unix(0, lastSuccess)) <= 2*time.Duration(interval)*time.Millisecond
+}
+
+// entitiesByInterval groups the pipeline entities by their effective collect interval
+func (m *MetricsPipeline) entitiesByInterval() map[int][]int {
+	res := map[int][]int{}
+
+	for i, entity := range PipelineEntities {
+		interval := m.config.CollectInterval
+		if override, exists := m.config.CollectIntervalOverrides[entity]; exists {
+			interval = override
 		}
 
-		for _, transform := range m.transformations {
-			err := transform.Process(metrics, m.gpuCollector.SysInfo)
-			if err != nil {
-				return "", fmt.Errorf("failed to transform metrics for transform '%s'; err: %w", transform.Name(), err)
-			}
+		res[interval] = append(res[interval], i)
+	}
+
+	return res
+}
+
+// CollectOnce collects the metrics of every entity synchronously and returns them in the configured output format,
+// for callers driving the collection on their own schedule instead of Run. It is safe to call concurrently with Run
+// and with itself, collections are serialized. Each call counts as a collection like a tick of Run: it advances the
+// histograms and the collector health reported by the next outputs, but doesn't push the metrics to the push
+// exporters.
+func (m *MetricsPipeline) CollectOnce() (string, error) {
+	return m.run()
+}
+
+// CollectMetrics collects the metrics of every entity like CollectOnce, and returns them unformatted indexed like
+// PipelineEntities. The names of the counters aren't prefixed with Config.MetricNamePrefix.
+func (m *MetricsPipeline) CollectMetrics() ([]MetricsByCounter, error) {
+	if _, err := m.run(); err != nil {
+		return nil, err
+	}
+
+	return m.pushBatch(nil).metrics, nil
+}
+
+func (m *MetricsPipeline) run() (string, error) {
+	all := make([]int, len(PipelineEntities))
+	for i := range all {
+		all[i] = i
+	}
+
+	return m.collect(all)
+}
+
+// collect refreshes the metrics of the given entities and returns the formatted output of all entities.
+// Entities that are not refreshed contribute the output of their most recent collection.
+func (m *MetricsPipeline) collect(entities []int) (string, error) {
+	// The lock is held for the whole collection, so Reload cannot swap the collectors while they are in use
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	collectors := m.entityCollectors()
+
+	results := make([]collectResult, len(collectors))
+
+	// Collectors query independent DCGM groups, so they can run concurrently.
+	// Each goroutine writes only to its own slot, which keeps the formatting
+	// order below independent of completion order.
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, i := range entities {
+		if len(collectors[i]) == 0 {
+			continue
 		}
 
-		formatted, err = FormatMetrics(m.migMetricsFormat, metrics)
-		if err != nil {
-			return "", fmt.Errorf("failed to format metrics; err: %w", err)
+		wg.Add(1)
+		go func(i int, collectors []EntityCollector) {
+			defer wg.Done()
+			collectStart := time.Now()
+			results[i] = m.getEntityMetrics(collectors)
+			results[i].duration = time.Since(collectStart)
+		}(i, collectors[i])
+	}
+	wg.Wait()
+	m.collectionDuration = time.Since(start)
+
+	if m.cache == nil {
+		m.cache = make([]string, len(collectors))
+		m.latest = make([]MetricsByCounter, len(collectors))
+	}
+
+	primary := make([]EntityCollector, len(collectors))
+	for i := range collectors {
+		if len(collectors[i]) > 0 {
+			primary[i] = collectors[i][0]
 		}
 	}
 
-	if m.switchCollector != nil {
-		/* Collect Switch Metrics */
-		metrics, err = m.switchCollector.GetMetrics()
-		if err != nil {
-			return "", fmt.Errorf("failed to collect switch metrics; err: %w", err)
+	m.updateHealth(entities, primary, results)
+
+	for _, i := range entities {
+		if len(collectors[i]) == 0 {
+			continue
 		}
 
-		if len(metrics) > 0 {
-			switchFormatted, err := FormatMetrics(m.switchMetricsFormat, metrics)
+		if i == gpuEntity {
+			/* Collect GPU Metrics */
+			m.cache[i] = ""
+			m.latest[i] = nil
+
+			err := results[i].err
+			if err != nil {
+				return "", fmt.Errorf("failed to collect gpu metrics; err: %w", err)
+			}
+
+			// The merged collectors may watch other GPUs, the metrics of each are mapped with its own system info
+			for _, part := range results[i].parts {
+				for _, transform := range m.transformations {
+					err := transform.Process(part.metrics, part.collector.SystemInfo())
+					if err != nil {
+						return "", fmt.Errorf("failed to transform metrics for transform '%s'; err: %w", transform.Name(), err)
+					}
+				}
+			}
+
+			metrics := mergeMetrics(results[i].parts)
+
+			relabelGPUs(metrics, m.config.GPULabelStrategy)
+			relabelUUIDs(metrics, m.config.UUIDLabelSource)
+			m.remapLabels(metrics)
+			m.addStaticLabels(metrics)
+			sanitizeLabelNames(metrics)
+			m.limitSeries(PipelineEntities[i], metrics)
+
+			m.cache[i], err = m.format(i, metrics)
 			if err != nil {
-				logrus.Warnf("Failed to format switch metrics with error: %v", err)
+				return "", fmt.Errorf("failed to format metrics; err: %w", err)
 			}
 
-			formatted = formatted + switchFormatted
+			m.latest[i] = metrics
+
+			if m.config.EnableRollups {
+				rollups, rollupsFormatted, err := m.collectRollups(metrics)
+				if err != nil {
+					logrus.Warnf("Failed to collect the rollups; err: %v", err)
+				} else if m.config.Format == FormatJSON {
+					m.cache[i] = joinJSONArrays(m.cache[i], rollupsFormatted)
+				} else {
+					m.cache[i] += rollupsFormatted
+				}
+
+				// The rollups are distinct from the device counters
+				for counter, values := range rollups {
+					m.latest[i][counter] = values
+				}
+			}
+
+			if m.processCollector != nil {
+				processMetrics, processFormatted, err := m.collectProcessMetrics()
+				if err != nil {
+					logrus.Warnf("Failed to collect process metrics; err: %v", err)
+				} else if m.config.Format == FormatJSON {
+					m.cache[i] = joinJSONArrays(m.cache[i], processFormatted)
+				} else {
+					m.cache[i] += processFormatted
+				}
+
+				// Process counters are distinct from the device counters
+				for counter, values := range processMetrics {
+					m.latest[i][counter] = values
+				}
+			}
+
+			if m.vgpuCollector != nil {
+				vgpuMetrics, vgpuFormatted, err := m.collectVGPUMetrics()
+				if err != nil {
+					logrus.Warnf("Failed to collect vGPU metrics; err: %v", err)
+				} else if m.config.Format == FormatJSON {
+					m.cache[i] = joinJSONArrays(m.cache[i], vgpuFormatted)
+				} else {
+					m.cache[i] += vgpuFormatted
+				}
+
+				// The vGPU fields aren't collected by the GPU collectors
+				for counter, values := range vgpuMetrics {
+					m.latest[i][counter] = values
+				}
+			}
+
+			continue
 		}
-	}
 
-	if m.linkCollector != nil {
-		/* Collect Link Metrics */
-		metrics, err = m.linkCollector.GetMetrics()
-		if err != nil {
-			return "", fmt.Errorf("failed to collect link metrics; err: %w", err)
+		entity := PipelineEntities[i]
+		m.cache[i] = ""
+		m.latest[i] = nil
+
+		if results[i].err != nil {
+			logrus.Warnf("Failed to collect %s metrics; err: %v", entity, results[i].err)
+			continue
 		}
 
+		metrics := mergeMetrics(results[i].parts)
 		if len(metrics) > 0 {
-			switchFormatted, err := FormatMetrics(m.linkMetricsFormat, metrics)
+			m.remapLabels(metrics)
+			m.addStaticLabels(metrics)
+			sanitizeLabelNames(metrics)
+			m.limitSeries(entity, metrics)
+
+			entityFormatted, err := m.format(i, metrics)
 			if err != nil {
-				logrus.Warnf("failed to format link metrics; err: %v", err)
+				logrus.Warnf("Failed to format %s metrics; err: %v", entity, err)
 			}
 
-			formatted = formatted + switchFormatted
+			m.cache[i] = entityFormatted
+			m.latest[i] = metrics
 		}
 	}
 
-	if m.cpuCollector != nil {
-		/* Collect CPU Metrics */
-		metrics, err = m.cpuCollector.GetMetrics()
+	// Only a collection that succeeded makes the pipeline ready, an entity without collector or failing doesn't
+	if slices.ContainsFunc(entities, func(i int) bool { return len(collectors[i]) > 0 && results[i].err == nil }) {
+		m.lastSuccess.Store(time.Now().UnixNano())
+	}
+
+	// The self-metrics are served by the admin server when there's one
+	var internal string
+	if m.config.AdminListenAddress == "" {
+		var err error
+		internal, err = m.formatInternalMetrics()
 		if err != nil {
-			return "", fmt.Errorf("failed to collect CPU metrics; err: %w", err)
+			logrus.Warnf("Failed to format internal metrics; err: %v", err)
 		}
+	}
 
-		if len(metrics) > 0 {
-			cpuFormatted, err := FormatMetrics(m.cpuMetricsFormat, metrics)
-			if err != nil {
-				logrus.Warnf("Failed to format cpu metrics with error: %v", err)
-			}
+	if m.config.Format == FormatJSON {
+		if strings.Join(m.cache, "")+internal == "" {
+			return "", nil
+		}
 
-			formatted = formatted + cpuFormatted
+		return joinJSONArrays(joinJSONArrays(m.cache...), internal), nil
+	}
+
+	return strings.Join(m.cache, "") + internal, nil
+}
+
+// getMetrics returns the metrics of the collector, or an error once Config.CollectTimeout elapses. GetMetrics cannot
+// be interrupted, so the collector isn't called again until its stuck call returns, and the result of that call is
+// dropped.
+func (m *MetricsPipeline) getMetrics(collector EntityCollector) (MetricsByCounter, error) {
+	if m.config.CollectTimeout <= 0 {
+		return collector.GetMetrics()
+	}
+
+	if _, inFlight := m.inFlight.Load(collector); inFlight {
+		return nil, fmt.Errorf("previous collection did not return yet")
+	}
+
+	timeout := time.Duration(m.config.CollectTimeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan collectResult, 1)
+	m.inFlight.Store(collector, struct{}{})
+	go func() {
+		defer m.inFlight.Delete(collector)
+		metrics, err := collector.GetMetrics()
+		done <- collectResult{metrics: metrics, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.metrics, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("collection did not complete within %s; err: %w", timeout, ctx.Err())
+	}
+}
+
+// collectProcessMetrics returns the metrics of the processes running on the GPUs and their formatted output,
+// callers must hold mtx
+func (m *MetricsPipeline) collectProcessMetrics() (MetricsByCounter, string, error) {
+	metrics, err := m.processCollector.GetMetrics()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Processes are matched to pods through the GPU they run on
+	for _, transform := range m.transformations {
+		err := transform.Process(metrics, m.processCollector.sysInfo)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to transform metrics for transform '%s'; err: %w", transform.Name(), err)
 		}
 	}
 
-	if m.coreCollector != nil {
-		/* Collect cpu core Metrics */
-		metrics, err = m.coreCollector.GetMetrics()
+	if m.config.Kubernetes {
+		labelUnknownPods(metrics, m.config)
+	}
+
+	relabelGPUs(metrics, m.config.GPULabelStrategy)
+	m.remapLabels(metrics)
+	m.addStaticLabels(metrics)
+	sanitizeLabelNames(metrics)
+	m.limitSeries("process", metrics)
+
+	var formatted string
+	if m.config.Format == FormatJSON {
+		formatted, err = FormatMetricsJSON(prefixMetricNames(metrics, m.config.MetricNamePrefix))
+	} else {
+		formatted, err = FormatMetrics(m.processMetricsFormat, prefixMetricNames(metrics, m.config.MetricNamePrefix))
+	}
+
+	return metrics, formatted, err
+}
+
+// collectVGPUMetrics returns the metrics of the vGPU instances running on the GPUs and their formatted output,
+// callers must hold mtx
+func (m *MetricsPipeline) collectVGPUMetrics() (MetricsByCounter, string, error) {
+	metrics, err := m.vgpuCollector.GetMetrics()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, transform := range m.transformations {
+		err := transform.Process(metrics, m.vgpuCollector.sysInfo)
 		if err != nil {
-			return "", fmt.Errorf("failed to collect CPU core metrics; err: %w", err)
+			return nil, "", fmt.Errorf("failed to transform metrics for transform '%s'; err: %w", transform.Name(), err)
 		}
+	}
 
-		if len(metrics) > 0 {
-			coreFormatted, err := FormatMetrics(m.cpuCoreMetricsFormat, metrics)
-			if err != nil {
-				logrus.Warnf("failed to format cpu core metrics; err: %v", err)
+	relabelGPUs(metrics, m.config.GPULabelStrategy)
+	m.remapLabels(metrics)
+	m.addStaticLabels(metrics)
+	sanitizeLabelNames(metrics)
+	m.limitSeries("vgpu", metrics)
+
+	var formatted string
+	if m.config.Format == FormatJSON {
+		formatted, err = FormatMetricsJSON(prefixMetricNames(metrics, m.config.MetricNamePrefix))
+	} else {
+		formatted, err = FormatMetrics(m.vgpuMetricsFormat, prefixMetricNames(metrics, m.config.MetricNamePrefix))
+	}
+
+	return metrics, formatted, err
+}
+
+// pushBatch snapshots the latest metrics of the given entities for the push queues
+func (m *MetricsPipeline) pushBatch(entities []int) pushBatch {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	batch := pushBatch{metrics: make([]MetricsByCounter, len(m.latest)), time: time.Now()}
+	copy(batch.metrics, m.latest)
+
+	for _, i := range entities {
+		if i < len(batch.metrics) && batch.metrics[i] != nil {
+			batch.entities = append(batch.entities, i)
+		}
+	}
+
+	return batch
+}
+
+// remapLabels renames then drops the labels and attributes of every metric, see Config.LabelRename and Config.LabelDrop
+func (m *MetricsPipeline) remapLabels(metrics MetricsByCounter) {
+	if len(m.config.LabelRename) == 0 && len(m.config.LabelDrop) == 0 {
+		return
+	}
+
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			metrics[counter][j].Labels = m.remap(metrics[counter][j].Labels)
+			metrics[counter][j].Attributes = m.remap(metrics[counter][j].Attributes)
+		}
+	}
+}
+
+// remap returns a remapped copy of the labels, since the collectors share label maps between metrics
+func (m *MetricsPipeline) remap(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	res := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if to, ok := m.config.LabelRename[name]; ok {
+			name = to
+		}
+
+		if slices.Contains(m.config.LabelDrop, name) {
+			continue
+		}
+
+		res[name] = value
+	}
+
+	return res
+}
+
+// addStaticLabels merges Config.StaticLabels into the labels of every metric
+func (m *MetricsPipeline) addStaticLabels(metrics MetricsByCounter) {
+	if len(m.config.StaticLabels) == 0 {
+		return
+	}
+
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			if metrics[counter][j].Labels == nil {
+				metrics[counter][j].Labels = map[string]string{}
 			}
 
-			formatted = formatted + coreFormatted
+			for k, v := range m.config.StaticLabels {
+				metrics[counter][j].Labels[k] = v
+			}
+		}
+	}
+}
+
+var metricNamePrefixRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// ValidateMetricNamePrefix checks that the prefix starts valid Prometheus metric names, an empty prefix is valid
+func ValidateMetricNamePrefix(prefix string) error {
+	if prefix != "" && !metricNamePrefixRegex.MatchString(prefix) {
+		return fmt.Errorf("invalid metric name prefix '%s'", prefix)
+	}
+
+	return nil
+}
+
+// prefixMetricNames returns the metrics with the prefix prepended to the name of their counter, the metrics
+// passed in are left untouched. They are returned as is when the prefix is empty.
+func prefixMetricNames(metrics MetricsByCounter, prefix string) MetricsByCounter {
+	if prefix == "" {
+		return metrics
+	}
+
+	res := make(MetricsByCounter, len(metrics))
+	for counter, values := range metrics {
+		prefixed := counter
+		prefixed.FieldName = prefix + counter.FieldName
+
+		res[prefixed] = make([]Metric, len(values))
+		for j, metric := range values {
+			metric.Counter = prefixed
+			res[prefixed][j] = metric
 		}
 	}
 
-	return formatted, nil
+	return res
+}
+
+// format renders the metrics of the entity at index i in the configured output format
+func (m *MetricsPipeline) format(i int, metrics MetricsByCounter) (string, error) {
+	metrics = prefixMetricNames(metrics, m.config.MetricNamePrefix)
+
+	if m.config.Format == FormatJSON {
+		return FormatMetricsJSON(metrics)
+	}
+
+	formats := []*template.Template{
+		m.migMetricsFormat,
+		m.switchMetricsFormat,
+		m.linkMetricsFormat,
+		m.cpuMetricsFormat,
+		m.cpuCoreMetricsFormat,
+	}
+
+	return FormatMetrics(formats[i], metrics)
+}
+
+// Counters returns the counters of the DCGM fields collected by the pipeline, the ones of the last Reload
+func (m *MetricsPipeline) Counters() []Counter {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return slices.Clone(m.counters)
+}
+
+// collectors returns the pipeline collectors indexed by pipeline entity
+func (m *MetricsPipeline) collectors() []EntityCollector {
+	return []EntityCollector{
+		m.gpuCollector,
+		m.switchCollector,
+		m.linkCollector,
+		m.cpuCollector,
+		m.coreCollector,
+	}
+}
+
+// collectResult holds the output of the GetMetrics calls of the collectors of an entity
+type collectResult struct {
+	metrics  MetricsByCounter
+	parts    []collectorMetrics // Metrics of each collector that succeeded, see mergeMetrics
+	err      error
+	duration time.Duration
 }
 
 /*
@@ -292,86 +1096,198 @@ func (m *MetricsPipeline) run() (string, error) {
  */
 
 var migMetricsFormat = `
-{{- range $counter, $metrics := . -}}
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
+# HELP {{ $counter.FieldName }} {{ $counter.Help }}
+# TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
+{{- range $metric := $metrics }}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{gpu="{{ escape $metric.GPU }}",{{ $metric.UUID }}="{{ escape $metric.GPUUUID }}",pci_bus_id="{{ escape $metric.GPUPCIBusID }}"{{if $metric.GPUNUMANode}},numa_node="{{ escape $metric.GPUNUMANode }}"{{end}},device="{{ escape $metric.GPUDevice }}",modelName="{{ escape $metric.GPUModelName }}"{{if $metric.GPUDriverVersion}},driver_version="{{ escape $metric.GPUDriverVersion }}"{{end}}{{if $metric.GPUVBIOSVersion}},vbios_version="{{ escape $metric.GPUVBIOSVersion }}"{{end}}{{if $metric.GPUCPUAffinity}},cpu_affinity="{{ escape $metric.GPUCPUAffinity }}"{{end}}{{if $metric.MigProfile}},GPU_I_PROFILE="{{ escape $metric.MigProfile }}",GPU_I_ID="{{ escape $metric.GPUInstanceID }}"{{if $metric.GPUInstanceMemoryMB}},GPU_I_MEM_MB="{{ escape $metric.GPUInstanceMemoryMB }}"{{end}}{{if $metric.GPUComputeInstanceID}},GPU_CI_ID="{{ escape $metric.GPUComputeInstanceID }}"{{end}}{{end}}{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
+
+{{- range $k, $v := $metric.Labels -}}
+	,{{ $k }}="{{ escape $v }}"
+{{- end -}}
+{{- range $k, $v := $metric.Attributes -}}
+	,{{ $k }}="{{ escape $v }}"
+{{- end -}}
+
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
+{{- end }}
+{{ end }}`
+
+// processMetricsFormat renders the per-process metrics, the process ID is passed in the labels
+var processMetricsFormat = `
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
+# HELP {{ $counter.FieldName }} {{ $counter.Help }}
+# TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
+{{- range $metric := $metrics }}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{gpu="{{ escape $metric.GPU }}",{{ $metric.UUID }}="{{ escape $metric.GPUUUID }}",pci_bus_id="{{ escape $metric.GPUPCIBusID }}",device="{{ escape $metric.GPUDevice }}",modelName="{{ escape $metric.GPUModelName }}"{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
+
+{{- range $k, $v := $metric.Labels -}}
+	,{{ $k }}="{{ escape $v }}"
+{{- end -}}
+{{- range $k, $v := $metric.Attributes -}}
+	,{{ $k }}="{{ escape $v }}"
+{{- end -}}
+
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
+{{- end }}
+{{ end }}`
+
+// vgpuMetricsFormat renders the metrics of the vGPU instances, labeled with their parent GPU
+var vgpuMetricsFormat = `
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{gpu="{{ $metric.GPU }}",{{ $metric.UUID }}="{{ $metric.GPUUUID }}",pci_bus_id="{{ $metric.GPUPCIBusID }}",device="{{ $metric.GPUDevice }}",modelName="{{ $metric.GPUModelName }}"{{if $metric.MigProfile}},GPU_I_PROFILE="{{ $metric.MigProfile }}",GPU_I_ID="{{ $metric.GPUInstanceID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{gpu="{{ escape $metric.GPU }}",{{ $metric.UUID }}="{{ escape $metric.GPUUUID }}",pci_bus_id="{{ escape $metric.GPUPCIBusID }}",device="{{ escape $metric.GPUDevice }}",modelName="{{ escape $metric.GPUModelName }}",vgpu_instance="{{ escape $metric.VGPUInstance }}"{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 {{- range $k, $v := $metric.Attributes -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
 
-} {{ $metric.Value -}}
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
 {{- end }}
 {{ end }}`
 
 var switchMetricsFormat = `
-{{- range $counter, $metrics := . -}}
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{nvswitch="{{ $metric.GPU }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{nvswitch="{{ escape $metric.GPU }}"{{if $metric.SwitchPhysID}},nvswitch_phys_id="{{ escape $metric.SwitchPhysID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
-} {{ $metric.Value -}}
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
 {{- end }}
 {{ end }}`
 
 var linkMetricsFormat = `
-{{- range $counter, $metrics := . -}}
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{nvlink="{{ $metric.GPU }}",nvswitch="{{ $metric.GPUDevice }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{nvlink="{{ escape $metric.GPU }}",nvswitch="{{ escape $metric.GPUDevice }}"{{if $metric.SwitchPhysID}},nvswitch_phys_id="{{ escape $metric.SwitchPhysID }}"{{end}}{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
-} {{ $metric.Value -}}
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
 {{- end }}
 {{ end }}`
 
 var cpuMetricsFormat = `
-{{- range $counter, $metrics := . -}}
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{cpu="{{ $metric.GPU }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{cpu="{{ escape $metric.GPU }}"{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
-} {{ $metric.Value -}}
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
 {{- end }}
 {{ end }}`
 
 var cpuCoreMetricsFormat = `
-{{- range $counter, $metrics := . -}}
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
 # HELP {{ $counter.FieldName }} {{ $counter.Help }}
 # TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
 {{- range $metric := $metrics }}
-{{ $counter.FieldName }}{cpucore="{{ $metric.GPU }}",cpu="{{ $metric.GPUDevice }}"{{if $metric.Hostname }},Hostname="{{ $metric.Hostname }}"{{end}}
+{{ $counter.FieldName }}{{ $metric.Suffix }}{cpucore="{{ escape $metric.GPU }}",cpu="{{ escape $metric.GPUDevice }}"{{if $metric.Hostname }},Hostname="{{ escape $metric.Hostname }}"{{end}}
 
 {{- range $k, $v := $metric.Labels -}}
-	,{{ $k }}="{{ $v }}"
+	,{{ $k }}="{{ escape $v }}"
 {{- end -}}
-} {{ $metric.Value -}}
+} {{ $metric.Value -}}{{ if $metric.Timestamp }} {{ $metric.Timestamp }}{{ end -}}
+{{ template "exemplar" $metric }}
 {{- end }}
 {{ end }}`
 
+// exemplarFormat renders the exemplar of a metric as a comment following its sample, which the Prometheus text
+// format ignores and FormatOpenMetrics turns into an OpenMetrics exemplar
+var exemplarFormat = `{{ define "exemplar" }}{{ with .Exemplar }}
+# EXEMPLAR {
+{{- $sep := "" -}}
+{{- range $k, $v := .Labels -}}
+	{{ $sep }}{{ $k }}="{{ escape $v }}"{{ $sep = "," }}
+{{- end -}}
+} {{ .Value }}{{ if .Timestamp }} {{ .Timestamp }}{{ end }}{{ end }}{{ end }}`
+
+func newMetricsTemplate(name, format string) *template.Template {
+	return template.Must(template.Must(template.New(name).Funcs(templateFuncs).Parse(format)).Parse(exemplarFormat))
+}
+
+// The templates are parsed once and shared by the pipelines, each under a unique name
+var (
+	migMetricsTemplate     = newMetricsTemplate("migMetrics", migMetricsFormat)
+	switchMetricsTemplate  = newMetricsTemplate("switchMetrics", switchMetricsFormat)
+	linkMetricsTemplate    = newMetricsTemplate("linkMetrics", linkMetricsFormat)
+	cpuMetricsTemplate     = newMetricsTemplate("cpuMetrics", cpuMetricsFormat)
+	cpuCoreMetricsTemplate = newMetricsTemplate("cpuCoreMetrics", cpuCoreMetricsFormat)
+	processMetricsTemplate = newMetricsTemplate("processMetrics", processMetricsFormat)
+	vgpuMetricsTemplate    = newMetricsTemplate("vgpuMetrics", vgpuMetricsFormat)
+)
+
 // FormatMetrics Template is passed here so that it isn't recompiled at each iteration
 func FormatMetrics(t *template.Template, groupedMetrics MetricsByCounter) (string, error) {
-	// Format metrics
-	var res bytes.Buffer
-	if err := t.Execute(&res, groupedMetrics); err != nil {
+	var res strings.Builder
+	if err := FormatMetricsTo(&res, t, groupedMetrics); err != nil {
 		return "", err
 	}
 
 	return res.String(), nil
 }
+
+// FormatMetricsTo renders the metrics with the template straight to the writer, without holding the whole output
+// in memory. The metrics endpoint uses it to stream the registry metrics to the response. The output rendered
+// before an error is left in the writer.
+func FormatMetricsTo(w io.Writer, t *template.Template, groupedMetrics MetricsByCounter) error {
+	return t.Execute(w, sortMetrics(expandHistograms(groupedMetrics)))
+}
+
+// counterMetrics holds the metrics of a counter, as ranged over by the templates
+type counterMetrics struct {
+	Counter Counter
+	Metrics []Metric
+}
+
+// sortMetrics orders the counters by field name and their metrics by GPU index then UUID, so the output is the
+// same across scrapes for the same metrics. Metrics of the same device, like histogram series, keep their order.
+func sortMetrics(groupedMetrics MetricsByCounter) []counterMetrics {
+	res := make([]counterMetrics, 0, len(groupedMetrics))
+	for counter, metrics := range groupedMetrics {
+		sorted := slices.Clone(metrics)
+		slices.SortStableFunc(sorted, func(a, b Metric) int {
+			return cmp.Or(compareGPUIndex(a.GPU, b.GPU), cmp.Compare(a.GPUUUID, b.GPUUUID))
+		})
+		res = append(res, counterMetrics{Counter: counter, Metrics: sorted})
+	}
+
+	slices.SortFunc(res, func(a, b counterMetrics) int {
+		return cmp.Compare(a.Counter.FieldName, b.Counter.FieldName)
+	})
+
+	return res
+}
+
+// compareGPUIndex compares the indexes numerically, so that GPU 10 comes after GPU 9
+func compareGPUIndex(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA != nil || errB != nil {
+		return cmp.Compare(a, b)
+	}
+
+	return cmp.Compare(x, y)
+}
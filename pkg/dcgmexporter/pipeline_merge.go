@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// collectorMetrics holds the metrics returned by one of the collectors of an entity
+type collectorMetrics struct {
+	collector EntityCollector
+	metrics   MetricsByCounter
+}
+
+// AddCollector merges the metrics of another collector of the entity type into the output of that entity, e.g. to
+// export the devices of several hostengines from a single endpoint. The caller owns the collector: it is kept across
+// Reload and must be cleaned up by the caller once the pipeline stops.
+func (m *MetricsPipeline) AddCollector(entityType dcgm.Field_Entity_Group, collector EntityCollector) error {
+	i := slices.Index(FieldEntityGroupTypeToMonitor, entityType)
+	if i < 0 || i >= len(PipelineEntities) {
+		return fmt.Errorf("entity type %s isn't collected by the pipeline", entityType.String())
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.additionalCollectors == nil {
+		m.additionalCollectors = map[int][]EntityCollector{}
+	}
+	m.additionalCollectors[i] = append(m.additionalCollectors[i], collector)
+
+	if i < len(m.health) {
+		m.health[i].monitored = true
+	}
+
+	return nil
+}
+
+// entityCollectors returns the collectors of every pipeline entity indexed by entity, the collector created by the
+// pipeline first then the ones added with AddCollector. Callers must hold mtx.
+func (m *MetricsPipeline) entityCollectors() [][]EntityCollector {
+	res := make([][]EntityCollector, len(PipelineEntities))
+	for i, collector := range m.collectors() {
+		if collector != nil {
+			res[i] = append(res[i], collector)
+		}
+		res[i] = append(res[i], m.additionalCollectors[i]...)
+	}
+
+	return res
+}
+
+// getEntityMetrics returns the metrics of every collector of an entity. The entity fails only when all of its
+// collectors fail, the failure of some of them is logged and their metrics are left out.
+func (m *MetricsPipeline) getEntityMetrics(collectors []EntityCollector) collectResult {
+	var res collectResult
+	var errs []error
+
+	for _, collector := range collectors {
+		metrics, err := m.getMetrics(collector)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		res.parts = append(res.parts, collectorMetrics{collector: collector, metrics: metrics})
+	}
+
+	switch {
+	case len(res.parts) > 0:
+		for _, err := range errs {
+			logrus.Warnf("Failed to collect the metrics of a merged collector; err: %v", err)
+		}
+	case len(errs) == 1:
+		res.err = errs[0]
+	default:
+		res.err = errors.Join(errs...)
+	}
+
+	return res
+}
+
+// mergeMetrics merges the metrics of the collectors of an entity. The counters are merged by name, so that each
+// is rendered with a single HELP and TYPE even when the collectors read different counter files: the first
+// collector exporting a counter defines its help and type.
+func mergeMetrics(parts []collectorMetrics) MetricsByCounter {
+	switch len(parts) {
+	case 0:
+		return nil
+	case 1:
+		return parts[0].metrics
+	}
+
+	res := make(MetricsByCounter)
+	byName := map[string]Counter{}
+
+	for _, part := range parts {
+		for counter, values := range part.metrics {
+			merged, exists := byName[counter.FieldName]
+			if !exists {
+				merged = counter
+				byName[counter.FieldName] = merged
+			}
+
+			for _, metric := range values {
+				metric.Counter = merged
+				res[merged] = append(res[merged], metric)
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMetrics(t *testing.T) {
+	temp := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature"}
+	otherTemp := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "GPU temperature (in C)."}
+	power := Counter{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+
+	tests := []struct {
+		name  string
+		parts []collectorMetrics
+		want  MetricsByCounter
+	}{
+		{
+			name:  "When no collector succeeded, nothing is merged",
+			parts: nil,
+			want:  nil,
+		},
+		{
+			name: "When a single collector succeeded, its metrics are kept as is",
+			parts: []collectorMetrics{
+				{metrics: MetricsByCounter{temp: {{GPU: "0", Value: "42"}}}},
+			},
+			want: MetricsByCounter{temp: {{GPU: "0", Value: "42"}}},
+		},
+		{
+			name: "When the collectors export the same counter, it is merged under the counter of the first one",
+			parts: []collectorMetrics{
+				{metrics: MetricsByCounter{temp: {{GPU: "0", Value: "42"}}}},
+				{metrics: MetricsByCounter{
+					otherTemp: {{GPU: "1", Value: "43"}},
+					power:     {{GPU: "1", Value: "300"}},
+				}},
+			},
+			want: MetricsByCounter{
+				temp:  {{GPU: "0", Value: "42", Counter: temp}, {GPU: "1", Value: "43", Counter: temp}},
+				power: {{GPU: "1", Value: "300", Counter: power}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, mergeMetrics(tc.parts))
+		})
+	}
+}
+
+func TestMetricsPipeline_AddCollector(t *testing.T) {
+	dcgmEntityGetLatestValuesHook = func(dcgm.Field_Entity_Group, uint, []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		return []dcgm.FieldValue_v1{
+			{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)},
+		}, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	newCollector := func(uuid string) *DCGMCollector {
+		sysInfo := SystemInfo{
+			GPUCount: 1,
+			InfoType: dcgm.FE_GPU,
+			gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+		}
+		sysInfo.GPUs[0].DeviceInfo = dcgm.Device{UUID: uuid}
+
+		return &DCGMCollector{
+			Counters: []Counter{
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+			},
+			DeviceFields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP},
+			SysInfo:      sysInfo,
+		}
+	}
+
+	p, cleanup, err := NewMetricsPipelineWithGPUCollector(&Config{}, newCollector("GPU-00000000"))
+	require.NoError(t, err)
+	defer cleanup()
+
+	require.NoError(t, p.AddCollector(dcgm.FE_GPU, newCollector("GPU-11111111")))
+	require.Error(t, p.AddCollector(dcgm.FE_NONE, newCollector("GPU-22222222")))
+
+	out, err := p.CollectOnce()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, strings.Count(out, "# HELP DCGM_FI_DEV_GPU_TEMP"))
+	assert.Equal(t, 1, strings.Count(out, "# TYPE DCGM_FI_DEV_GPU_TEMP"))
+	assert.Contains(t, out, `UUID="GPU-00000000"`)
+	assert.Contains(t, out, `UUID="GPU-11111111"`)
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"maps"
+	"runtime"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	collectorUpMetric      = "dcgm_exporter_collector_up"
+	collectionErrorsMetric = "dcgm_exporter_collection_errors_total"
+	coalescedTicksMetric   = "dcgm_exporter_coalesced_ticks_total"
+	seriesDroppedMetric    = "dcgm_exporter_series_dropped_total"
+	podMappingErrorsMetric = "dcgm_exporter_pod_mapping_failures_total"
+	durationMetric         = "dcgm_exporter_collection_duration_seconds"
+	totalDurationMetric    = "dcgm_exporter_collection_total_duration_seconds"
+	buildInfoMetric        = "dcgm_exporter_build_info"
+	metricGroupMetric      = "dcgm_exporter_profiling_metric_group_active"
+	hostengineMetric       = "dcgm_exporter_hostengine_active"
+	failoversMetric        = "dcgm_exporter_hostengine_failovers_total"
+	entityLabel            = "entity"
+)
+
+var internalMetricsFormat = `
+{{- range . }}{{ $counter := .Counter }}{{ $metrics := .Metrics -}}
+# HELP {{ $counter.FieldName }} {{ $counter.Help }}
+# TYPE {{ $counter.FieldName }} {{ $counter.PromType }}
+{{- range $metric := $metrics }}
+{{ $counter.FieldName }}{{ if or $metric.Attributes $metric.Labels }}{
+{{- $sep := "" -}}
+{{- range $k, $v := $metric.Attributes -}}
+	{{ $sep }}{{ $k }}="{{ escape $v }}"{{ $sep = "," }}
+{{- end -}}
+{{- range $k, $v := $metric.Labels -}}
+	{{ $sep }}{{ $k }}="{{ escape $v }}"{{ $sep = "," }}
+{{- end -}}
+}{{ end }} {{ $metric.Value -}}
+{{- end }}
+{{ end }}`
+
+var internalMetricsTemplate = template.Must(template.New("internalMetrics").Funcs(templateFuncs).Parse(internalMetricsFormat))
+
+// entityHealth tracks the state of the collector of a single pipeline entity
+type entityHealth struct {
+	monitored bool   // The entity has fields to watch, its collector is expected to exist
+	up        bool   // The collector exists and its last collection succeeded
+	errors    uint64 // Number of failed collections
+
+	duration time.Duration // Duration of the last GetMetrics call of the collector
+}
+
+// newEntityHealth reports every enabled entity that dcgm-exporter tried to load, including the ones
+// whose system info or collector could not be created at startup.
+func newEntityHealth(config *Config,
+	fieldEntityGroupTypeSystemInfo *FieldEntityGroupTypeSystemInfo, collectors []EntityCollector,
+) []entityHealth {
+	health := make([]entityHealth, len(PipelineEntities))
+	for i, egt := range FieldEntityGroupTypeToMonitor {
+		_, loaded := fieldEntityGroupTypeSystemInfo.Get(egt)
+		_, failed := fieldEntityGroupTypeSystemInfo.loadErrors[egt]
+
+		health[i] = entityHealth{
+			monitored: (loaded || failed) && config.EntityEnabled(egt),
+			up:        collectors[i] != nil,
+		}
+	}
+
+	return health
+}
+
+// updateHealth records the outcome of a collection, callers must hold mtx
+func (m *MetricsPipeline) updateHealth(entities []int, collectors []EntityCollector, results []collectResult) {
+	for _, i := range entities {
+		if i >= len(m.health) || !m.health[i].monitored {
+			continue
+		}
+
+		if collectors[i] != nil {
+			m.health[i].duration = results[i].duration
+		}
+
+		switch {
+		case collectors[i] == nil:
+			m.health[i].up = false
+		case results[i].err != nil:
+			m.health[i].up = false
+			m.health[i].errors++
+		default:
+			m.health[i].up = true
+		}
+	}
+}
+
+// internalMetrics returns the formatted collector health, or an empty string if it cannot be formatted
+func (m *MetricsPipeline) internalMetrics() string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	internal, err := m.formatInternalMetrics()
+	if err != nil {
+		logrus.Warnf("Failed to format internal metrics; err: %v", err)
+		return ""
+	}
+
+	return internal
+}
+
+// formatInternalMetrics renders the collector health and collection duration of the monitored entities,
+// the duration of the last tick, the number of coalesced ticks, dropped series and pod mapping failures, the
+// watched profiling metric groups and the active nv-hostengine, callers must hold mtx
+func (m *MetricsPipeline) formatInternalMetrics() (string, error) {
+	upCounter := Counter{
+		FieldName: collectorUpMetric,
+		PromType:  "gauge",
+		Help:      "Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).",
+	}
+	errorsCounter := Counter{
+		FieldName: collectionErrorsMetric,
+		PromType:  "counter",
+		Help:      "Number of failed collections of the entity.",
+	}
+	durationCounter := Counter{
+		FieldName: durationMetric,
+		PromType:  "gauge",
+		Help:      "Duration of the last collection of the entity, in seconds.",
+	}
+	totalDurationCounter := Counter{
+		FieldName: totalDurationMetric,
+		PromType:  "gauge",
+		Help:      "Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.",
+	}
+	coalescedCounter := Counter{
+		FieldName: coalescedTicksMetric,
+		PromType:  "counter",
+		Help:      "Number of collections whose output was replaced by a newer one before the server read it.",
+	}
+	seriesDroppedCounter := Counter{
+		FieldName: seriesDroppedMetric,
+		PromType:  "counter",
+		Help:      "Number of series dropped because the collectors exceeded the maximum number of series.",
+	}
+	podMappingErrorsCounter := Counter{
+		FieldName: podMappingErrorsMetric,
+		PromType:  "counter",
+		Help:      "Number of collections exported without the pod labels because the kubelet could not list the pods.",
+	}
+	metricGroupCounter := Counter{
+		FieldName: metricGroupMetric,
+		PromType:  "gauge",
+		Help:      "Profiling metric groups watched by DCGM, the profiling metrics of the other groups are skipped.",
+	}
+
+	hostengineCounter := Counter{
+		FieldName: hostengineMetric,
+		PromType:  "gauge",
+		Help:      "The nv-hostengine endpoint dcgm-exporter is connected to.",
+	}
+	failoversCounter := Counter{
+		FieldName: failoversMetric,
+		PromType:  "counter",
+		Help:      "Number of times the connection moved to another nv-hostengine endpoint.",
+	}
+
+	metrics := MetricsByCounter{}
+	for i, health := range m.health {
+		if !health.monitored {
+			continue
+		}
+
+		value := "0"
+		if health.up {
+			value = "1"
+		}
+
+		entity := PipelineEntities[i]
+		metrics[upCounter] = append(metrics[upCounter], m.newInternalMetric(upCounter, entity, value))
+		metrics[errorsCounter] = append(metrics[errorsCounter],
+			m.newInternalMetric(errorsCounter, entity, fmt.Sprint(health.errors)))
+		metrics[durationCounter] = append(metrics[durationCounter],
+			m.newInternalMetric(durationCounter, entity, fmt.Sprint(health.duration.Seconds())))
+	}
+
+	if len(metrics) == 0 {
+		return "", nil
+	}
+
+	metrics[totalDurationCounter] = []Metric{{
+		Counter: totalDurationCounter,
+		Value:   fmt.Sprint(m.collectionDuration.Seconds()),
+		Labels:  maps.Clone(m.config.StaticLabels),
+	}}
+	metrics[coalescedCounter] = []Metric{{
+		Counter: coalescedCounter,
+		Value:   fmt.Sprint(m.coalescedTicks.Load()),
+		Labels:  maps.Clone(m.config.StaticLabels),
+	}}
+
+	if m.config.MaxSeries > 0 {
+		metrics[seriesDroppedCounter] = []Metric{{
+			Counter: seriesDroppedCounter,
+			Value:   fmt.Sprint(m.droppedSeries),
+			Labels:  maps.Clone(m.config.StaticLabels),
+		}}
+	}
+
+	for _, transform := range m.transformations {
+		if podMapper, ok := transform.(*PodMapper); ok {
+			metrics[podMappingErrorsCounter] = []Metric{{
+				Counter: podMappingErrorsCounter,
+				Value:   fmt.Sprint(podMapper.Failures()),
+				Labels:  maps.Clone(m.config.StaticLabels),
+			}}
+		}
+	}
+
+	for _, group := range m.metricGroups {
+		metrics[metricGroupCounter] = append(metrics[metricGroupCounter], Metric{
+			Counter: metricGroupCounter,
+			Value:   "1",
+			Labels:  maps.Clone(m.config.StaticLabels),
+			Attributes: map[string]string{
+				"major": fmt.Sprint(group.Major),
+				"minor": fmt.Sprint(group.Minor),
+			},
+		})
+	}
+
+	if m.hostengine != nil {
+		if endpoint := m.hostengine.Endpoint(); endpoint != "" {
+			metrics[hostengineCounter] = []Metric{{
+				Counter:    hostengineCounter,
+				Value:      "1",
+				Labels:     maps.Clone(m.config.StaticLabels),
+				Attributes: map[string]string{"endpoint": endpoint},
+			}}
+		}
+		metrics[failoversCounter] = []Metric{{
+			Counter: failoversCounter,
+			Value:   fmt.Sprint(m.hostengine.Failovers()),
+			Labels:  maps.Clone(m.config.StaticLabels),
+		}}
+	}
+
+	if m.config.Format == FormatJSON {
+		return FormatMetricsJSON(metrics)
+	}
+
+	// Counters are rendered one at a time to keep the output order stable
+	var res string
+	for _, counter := range []Counter{
+		upCounter, errorsCounter, durationCounter, totalDurationCounter, coalescedCounter, seriesDroppedCounter,
+		podMappingErrorsCounter, metricGroupCounter, hostengineCounter, failoversCounter,
+	} {
+		if len(metrics[counter]) == 0 {
+			continue
+		}
+
+		formatted, err := FormatMetrics(internalMetricsTemplate, MetricsByCounter{counter: metrics[counter]})
+		if err != nil {
+			return "", err
+		}
+
+		res += formatted
+	}
+
+	return res, nil
+}
+
+func (m *MetricsPipeline) newInternalMetric(counter Counter, entity, value string) Metric {
+	return Metric{
+		Counter:    counter,
+		Value:      value,
+		Labels:     maps.Clone(m.config.StaticLabels),
+		Attributes: map[string]string{entityLabel: entity},
+	}
+}
+
+// formatBuildInfo renders the constant build info gauge, it doesn't depend on the collectors so it's computed once
+func formatBuildInfo(c *Config) (string, error) {
+	counter := Counter{
+		FieldName: buildInfoMetric,
+		PromType:  "gauge",
+		Help:      "A metric with a constant '1' value labeled by the version of dcgm-exporter, DCGM and Go.",
+	}
+
+	metrics := MetricsByCounter{
+		counter: {{
+			Counter: counter,
+			Value:   "1",
+			Attributes: map[string]string{
+				"version":      c.Version,
+				"dcgm_version": c.DCGMVersion,
+				"go_version":   runtime.Version(),
+			},
+			Labels: maps.Clone(c.StaticLabels),
+		}},
+	}
+
+	if c.Format == FormatJSON {
+		return FormatMetricsJSON(metrics)
+	}
+
+	return FormatMetrics(internalMetricsTemplate, metrics)
+}
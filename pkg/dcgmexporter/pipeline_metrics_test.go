@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateHealth(t *testing.T) {
+	p := &MetricsPipeline{
+		config: &Config{},
+		health: []entityHealth{
+			{monitored: true, up: true},
+			{monitored: true, up: false},
+			{monitored: false},
+			{monitored: true, up: true},
+			{monitored: true, up: true},
+		},
+	}
+
+	collectors := []EntityCollector{&DCGMCollector{}, nil, nil, &DCGMCollector{}, &DCGMCollector{}}
+	results := []collectResult{
+		{duration: time.Second},
+		{},
+		{},
+		{err: errors.New("boom"), duration: 2 * time.Second},
+		{},
+	}
+
+	p.updateHealth([]int{0, 1, 2, 3}, collectors, results)
+	p.updateHealth([]int{3}, collectors, results)
+
+	assert.Equal(t, []entityHealth{
+		{monitored: true, up: true, duration: time.Second},
+		{monitored: true, up: false},
+		{monitored: false},
+		{monitored: true, up: false, errors: 2, duration: 2 * time.Second},
+		{monitored: true, up: true},
+	}, p.health)
+}
+
+func TestFormatInternalMetrics(t *testing.T) {
+	health := []entityHealth{
+		{monitored: true, up: true, duration: 250 * time.Millisecond},
+		{monitored: true, up: false, errors: 3},
+	}
+
+	tests := []struct {
+		name         string
+		config       *Config
+		health       []entityHealth
+		metricGroups []dcgm.MetricGroup
+		dropped      uint64
+		podMapper    *PodMapper
+		hostengine   *Hostengine
+		want         string
+	}{
+		{
+			name:   "When no entity is monitored, nothing is emitted",
+			config: &Config{},
+			health: []entityHealth{{}, {}},
+			want:   "",
+		},
+		{
+			name:   "When entities are monitored, their health is emitted",
+			config: &Config{},
+			health: health,
+			want: `# HELP dcgm_exporter_collector_up Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).
+# TYPE dcgm_exporter_collector_up gauge
+dcgm_exporter_collector_up{entity="gpu"} 1
+dcgm_exporter_collector_up{entity="switch"} 0
+# HELP dcgm_exporter_collection_errors_total Number of failed collections of the entity.
+# TYPE dcgm_exporter_collection_errors_total counter
+dcgm_exporter_collection_errors_total{entity="gpu"} 0
+dcgm_exporter_collection_errors_total{entity="switch"} 3
+# HELP dcgm_exporter_collection_duration_seconds Duration of the last collection of the entity, in seconds.
+# TYPE dcgm_exporter_collection_duration_seconds gauge
+dcgm_exporter_collection_duration_seconds{entity="gpu"} 0.25
+dcgm_exporter_collection_duration_seconds{entity="switch"} 0
+# HELP dcgm_exporter_collection_total_duration_seconds Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.
+# TYPE dcgm_exporter_collection_total_duration_seconds gauge
+dcgm_exporter_collection_total_duration_seconds 0
+# HELP dcgm_exporter_coalesced_ticks_total Number of collections whose output was replaced by a newer one before the server read it.
+# TYPE dcgm_exporter_coalesced_ticks_total counter
+dcgm_exporter_coalesced_ticks_total 0
+`,
+		},
+		{
+			name:   "When static labels are set, they are added",
+			config: &Config{StaticLabels: map[string]string{"cluster": "a"}},
+			health: health[:1],
+			want: `# HELP dcgm_exporter_collector_up Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).
+# TYPE dcgm_exporter_collector_up gauge
+dcgm_exporter_collector_up{entity="gpu",cluster="a"} 1
+# HELP dcgm_exporter_collection_errors_total Number of failed collections of the entity.
+# TYPE dcgm_exporter_collection_errors_total counter
+dcgm_exporter_collection_errors_total{entity="gpu",cluster="a"} 0
+# HELP dcgm_exporter_collection_duration_seconds Duration of the last collection of the entity, in seconds.
+# TYPE dcgm_exporter_collection_duration_seconds gauge
+dcgm_exporter_collection_duration_seconds{entity="gpu",cluster="a"} 0.25
+# HELP dcgm_exporter_collection_total_duration_seconds Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.
+# TYPE dcgm_exporter_collection_total_duration_seconds gauge
+dcgm_exporter_collection_total_duration_seconds{cluster="a"} 0
+# HELP dcgm_exporter_coalesced_ticks_total Number of collections whose output was replaced by a newer one before the server read it.
+# TYPE dcgm_exporter_coalesced_ticks_total counter
+dcgm_exporter_coalesced_ticks_total{cluster="a"} 0
+`,
+		},
+		{
+			name:         "When profiling metric groups are watched, they are emitted",
+			config:       &Config{},
+			health:       health[:1],
+			metricGroups: []dcgm.MetricGroup{{Major: 1, Minor: 0}, {Major: 2, Minor: 1}},
+			want: `# HELP dcgm_exporter_collector_up Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).
+# TYPE dcgm_exporter_collector_up gauge
+dcgm_exporter_collector_up{entity="gpu"} 1
+# HELP dcgm_exporter_collection_errors_total Number of failed collections of the entity.
+# TYPE dcgm_exporter_collection_errors_total counter
+dcgm_exporter_collection_errors_total{entity="gpu"} 0
+# HELP dcgm_exporter_collection_duration_seconds Duration of the last collection of the entity, in seconds.
+# TYPE dcgm_exporter_collection_duration_seconds gauge
+dcgm_exporter_collection_duration_seconds{entity="gpu"} 0.25
+# HELP dcgm_exporter_collection_total_duration_seconds Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.
+# TYPE dcgm_exporter_collection_total_duration_seconds gauge
+dcgm_exporter_collection_total_duration_seconds 0
+# HELP dcgm_exporter_coalesced_ticks_total Number of collections whose output was replaced by a newer one before the server read it.
+# TYPE dcgm_exporter_coalesced_ticks_total counter
+dcgm_exporter_coalesced_ticks_total 0
+# HELP dcgm_exporter_profiling_metric_group_active Profiling metric groups watched by DCGM, the profiling metrics of the other groups are skipped.
+# TYPE dcgm_exporter_profiling_metric_group_active gauge
+dcgm_exporter_profiling_metric_group_active{major="1",minor="0"} 1
+dcgm_exporter_profiling_metric_group_active{major="2",minor="1"} 1
+`,
+		},
+		{
+			name:    "When the series are limited, the dropped series are emitted",
+			config:  &Config{MaxSeries: 10},
+			health:  health[:1],
+			dropped: 7,
+			want: `# HELP dcgm_exporter_collector_up Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).
+# TYPE dcgm_exporter_collector_up gauge
+dcgm_exporter_collector_up{entity="gpu"} 1
+# HELP dcgm_exporter_collection_errors_total Number of failed collections of the entity.
+# TYPE dcgm_exporter_collection_errors_total counter
+dcgm_exporter_collection_errors_total{entity="gpu"} 0
+# HELP dcgm_exporter_collection_duration_seconds Duration of the last collection of the entity, in seconds.
+# TYPE dcgm_exporter_collection_duration_seconds gauge
+dcgm_exporter_collection_duration_seconds{entity="gpu"} 0.25
+# HELP dcgm_exporter_collection_total_duration_seconds Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.
+# TYPE dcgm_exporter_collection_total_duration_seconds gauge
+dcgm_exporter_collection_total_duration_seconds 0
+# HELP dcgm_exporter_coalesced_ticks_total Number of collections whose output was replaced by a newer one before the server read it.
+# TYPE dcgm_exporter_coalesced_ticks_total counter
+dcgm_exporter_coalesced_ticks_total 0
+# HELP dcgm_exporter_series_dropped_total Number of series dropped because the collectors exceeded the maximum number of series.
+# TYPE dcgm_exporter_series_dropped_total counter
+dcgm_exporter_series_dropped_total 7
+`,
+		},
+		{
+			name:      "When the metrics are mapped to the pods, the pod mapping failures are emitted",
+			config:    &Config{},
+			health:    health[:1],
+			podMapper: &PodMapper{},
+			want: `# HELP dcgm_exporter_collector_up Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).
+# TYPE dcgm_exporter_collector_up gauge
+dcgm_exporter_collector_up{entity="gpu"} 1
+# HELP dcgm_exporter_collection_errors_total Number of failed collections of the entity.
+# TYPE dcgm_exporter_collection_errors_total counter
+dcgm_exporter_collection_errors_total{entity="gpu"} 0
+# HELP dcgm_exporter_collection_duration_seconds Duration of the last collection of the entity, in seconds.
+# TYPE dcgm_exporter_collection_duration_seconds gauge
+dcgm_exporter_collection_duration_seconds{entity="gpu"} 0.25
+# HELP dcgm_exporter_collection_total_duration_seconds Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.
+# TYPE dcgm_exporter_collection_total_duration_seconds gauge
+dcgm_exporter_collection_total_duration_seconds 0
+# HELP dcgm_exporter_coalesced_ticks_total Number of collections whose output was replaced by a newer one before the server read it.
+# TYPE dcgm_exporter_coalesced_ticks_total counter
+dcgm_exporter_coalesced_ticks_total 0
+# HELP dcgm_exporter_pod_mapping_failures_total Number of collections exported without the pod labels because the kubelet could not list the pods.
+# TYPE dcgm_exporter_pod_mapping_failures_total counter
+dcgm_exporter_pod_mapping_failures_total 2
+`,
+		},
+		{
+			name:   "When DCGM runs on a remote hostengine, the active endpoint and the failovers are emitted",
+			config: &Config{},
+			health: health[:1],
+			hostengine: &Hostengine{
+				endpoints: []string{"primary:5555", "secondary:5555"},
+				active:    1,
+				cleanup:   func() {},
+			},
+			want: `# HELP dcgm_exporter_collector_up Whether the last collection of the entity succeeded (1) or its collector is unavailable (0).
+# TYPE dcgm_exporter_collector_up gauge
+dcgm_exporter_collector_up{entity="gpu"} 1
+# HELP dcgm_exporter_collection_errors_total Number of failed collections of the entity.
+# TYPE dcgm_exporter_collection_errors_total counter
+dcgm_exporter_collection_errors_total{entity="gpu"} 0
+# HELP dcgm_exporter_collection_duration_seconds Duration of the last collection of the entity, in seconds.
+# TYPE dcgm_exporter_collection_duration_seconds gauge
+dcgm_exporter_collection_duration_seconds{entity="gpu"} 0.25
+# HELP dcgm_exporter_collection_total_duration_seconds Duration of the last tick, in seconds. The entities refreshed by a tick are collected concurrently.
+# TYPE dcgm_exporter_collection_total_duration_seconds gauge
+dcgm_exporter_collection_total_duration_seconds 0
+# HELP dcgm_exporter_coalesced_ticks_total Number of collections whose output was replaced by a newer one before the server read it.
+# TYPE dcgm_exporter_coalesced_ticks_total counter
+dcgm_exporter_coalesced_ticks_total 0
+# HELP dcgm_exporter_hostengine_active The nv-hostengine endpoint dcgm-exporter is connected to.
+# TYPE dcgm_exporter_hostengine_active gauge
+dcgm_exporter_hostengine_active{endpoint="secondary:5555"} 1
+# HELP dcgm_exporter_hostengine_failovers_total Number of times the connection moved to another nv-hostengine endpoint.
+# TYPE dcgm_exporter_hostengine_failovers_total counter
+dcgm_exporter_hostengine_failovers_total 1
+`,
+		},
+		{
+			name:   "When format is JSON, a JSON array is emitted",
+			config: &Config{Format: FormatJSON},
+			health: health[:1],
+			want: `[{"name":"dcgm_exporter_coalesced_ticks_total","value":0,"gpu":""},` +
+				`{"name":"dcgm_exporter_collection_duration_seconds","value":0.25,"gpu":"","attributes":{"entity":"gpu"}},` +
+				`{"name":"dcgm_exporter_collection_errors_total","value":0,"gpu":"","attributes":{"entity":"gpu"}},` +
+				`{"name":"dcgm_exporter_collection_total_duration_seconds","value":0,"gpu":""},` +
+				`{"name":"dcgm_exporter_collector_up","value":1,"gpu":"","attributes":{"entity":"gpu"}}]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &MetricsPipeline{
+				config:        tc.config,
+				health:        tc.health,
+				metricGroups:  tc.metricGroups,
+				droppedSeries: tc.dropped,
+			}
+			if tc.podMapper != nil {
+				tc.podMapper.failures.Store(2)
+				p.transformations = []Transform{tc.podMapper}
+			}
+			if tc.hostengine != nil {
+				tc.hostengine.failovers.Store(1)
+				p.hostengine = tc.hostengine
+			}
+
+			got, err := p.formatInternalMetrics()
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestFormatBuildInfo(t *testing.T) {
+	got, err := formatBuildInfo(&Config{
+		Version:      "3.3.5-3.4.0",
+		DCGMVersion:  "3.3.5",
+		StaticLabels: map[string]string{"cluster": "a"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP dcgm_exporter_build_info A metric with a constant '1' value labeled by the version of dcgm-exporter, DCGM and Go.
+# TYPE dcgm_exporter_build_info gauge
+dcgm_exporter_build_info{dcgm_version="3.3.5",go_version="`+runtime.Version()+`",version="3.3.5-3.4.0",cluster="a"} 1
+`, got)
+
+	got, err = formatBuildInfo(&Config{Format: FormatJSON, Version: "3.3.5-3.4.0"})
+	require.NoError(t, err)
+	assert.Contains(t, got, `"name":"dcgm_exporter_build_info"`)
+	assert.Contains(t, got, `"version":"3.3.5-3.4.0"`)
+}
@@ -17,8 +17,16 @@
 package dcgmexporter
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -88,6 +96,7 @@ func TestCountPipelineCleanup(t *testing.T) {
 	for _, c := range []struct {
 		name             string
 		enabledCollector map[dcgm.Field_Entity_Group]struct{}
+		disabledEntity   dcgm.Field_Entity_Group
 	}{{
 		name: "only_gpu",
 		enabledCollector: map[dcgm.Field_Entity_Group]struct{}{
@@ -133,6 +142,15 @@ func TestCountPipelineCleanup(t *testing.T) {
 			dcgm.FE_CPU:      {},
 			dcgm.FE_CPU_CORE: {},
 		},
+	}, {
+		name: "all_switch_disabled",
+		enabledCollector: map[dcgm.Field_Entity_Group]struct{}{
+			dcgm.FE_SWITCH:   {},
+			dcgm.FE_LINK:     {},
+			dcgm.FE_CPU:      {},
+			dcgm.FE_CPU_CORE: {},
+		},
+		disabledEntity: dcgm.FE_SWITCH,
 	}} {
 		t.Run(c.name, func(t *testing.T) {
 			cleanupCounter := 0
@@ -141,6 +159,11 @@ func TestCountPipelineCleanup(t *testing.T) {
 				Kubernetes:     false,
 				ConfigMapData:  undefinedConfigMapData,
 				CollectorsFile: f.Name(),
+				DisableGPU:     c.disabledEntity == dcgm.FE_GPU,
+				DisableSwitch:  c.disabledEntity == dcgm.FE_SWITCH,
+				DisableLink:    c.disabledEntity == dcgm.FE_LINK,
+				DisableCPU:     c.disabledEntity == dcgm.FE_CPU,
+				DisableCPUCore: c.disabledEntity == dcgm.FE_CPU_CORE,
 			}
 
 			cc, err := GetCounterSet(config)
@@ -162,12 +185,18 @@ func TestCountPipelineCleanup(t *testing.T) {
 			_, cleanup, err := NewMetricsPipeline(config,
 				cc.DCGMCounters,
 				"",
-				testNewDCGMCollector(t, &cleanupCounter, c.enabledCollector),
+				testNewDCGMCollector(t, &cleanupCounter, c.enabledCollector).Entity(),
 				fieldEntityGroupTypeSystemInfo)
 			require.NoError(t, err, "case: %s failed", c.name)
 
+			// The collector of a disabled entity is never created
+			wantCleanups := len(c.enabledCollector)
+			if _, exists := c.enabledCollector[c.disabledEntity]; exists {
+				wantCleanups--
+			}
+
 			cleanup()
-			require.Equal(t, len(c.enabledCollector), cleanupCounter, "case: %s failed", c.name)
+			require.Equal(t, wantCleanups, cleanupCounter, "case: %s failed", c.name)
 		})
 	}
 }
@@ -192,7 +221,7 @@ func TestNewMetricsPipelineWhenFieldEntityGroupTypeSystemInfoItemIsEmpty(t *test
 	p, cleanup, err := NewMetricsPipeline(config,
 		sampleCounters,
 		"",
-		func(_ []Counter, _ string, _ *Config, item FieldEntityGroupTypeSystemInfoItem) (*DCGMCollector, func(), error) {
+		func(_ []Counter, _ string, _ *Config, item FieldEntityGroupTypeSystemInfoItem) (EntityCollector, func(), error) {
 			assert.True(t, item.isEmpty())
 			return nil, func() {}, errors.New("empty")
 		},
@@ -204,5 +233,921 @@ func TestNewMetricsPipelineWhenFieldEntityGroupTypeSystemInfoItemIsEmpty(t *test
 
 	out, err := p.run()
 	require.NoError(t, err)
-	require.Empty(t, out)
+	require.NotContains(t, out, "DCGM_FI_")
+	require.Contains(t, out, `dcgm_exporter_collector_up{entity="gpu"} 0`)
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastSuccess time.Time
+		overrides   map[string]int
+		want        bool
+	}{
+		{
+			name: "When no collection succeeded, pipeline is not ready",
+			want: false,
+		},
+		{
+			name:        "When last collection succeeded within two intervals, pipeline is ready",
+			lastSuccess: time.Now().Add(-15 * time.Second),
+			want:        true,
+		},
+		{
+			name:        "When last collection is older than two intervals, pipeline is not ready",
+			lastSuccess: time.Now().Add(-25 * time.Second),
+			want:        false,
+		},
+		{
+			name:        "When an entity is collected more often, its interval is used",
+			lastSuccess: time.Now().Add(-15 * time.Second),
+			overrides:   map[string]int{"gpu": 5000},
+			want:        false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &MetricsPipeline{
+				config: &Config{
+					CollectInterval:          10000,
+					CollectIntervalOverrides: tc.overrides,
+				},
+			}
+			if !tc.lastSuccess.IsZero() {
+				p.lastSuccess.Store(tc.lastSuccess.UnixNano())
+			}
+
+			assert.Equal(t, tc.want, p.Ready())
+		})
+	}
+}
+
+func TestReadyAfterFailedCollection(t *testing.T) {
+	collector := &vendorCollector{err: errors.New("switch unavailable")}
+	p := &MetricsPipeline{
+		config:          &Config{CollectInterval: 10000},
+		switchCollector: collector,
+		health:          []entityHealth{{}, {monitored: true}, {}, {}, {}},
+	}
+
+	// A failed collection doesn't make the pipeline ready
+	_, err := p.collect([]int{1})
+	require.NoError(t, err)
+	assert.False(t, p.Ready())
+
+	// Neither does the collection of an entity without collector
+	_, err = p.collect([]int{gpuEntity})
+	require.NoError(t, err)
+	assert.False(t, p.Ready())
+
+	collector.err = nil
+	_, err = p.collect([]int{1})
+	require.NoError(t, err)
+	assert.True(t, p.Ready())
+}
+
+func TestReload(t *testing.T) {
+	config := &Config{}
+
+	newFieldEntityGroupTypeSystemInfo := func(counters []Counter) *FieldEntityGroupTypeSystemInfo {
+		fieldEntityGroupTypeSystemInfo := NewEntityGroupTypeSystemInfo(counters, config)
+		// We inject system info for unit test purpose
+		fieldEntityGroupTypeSystemInfo.items[dcgm.FE_GPU] = FieldEntityGroupTypeSystemInfoItem{
+			SystemInfo: SystemInfo{InfoType: dcgm.FE_GPU},
+		}
+		return fieldEntityGroupTypeSystemInfo
+	}
+
+	previousCleanups := 0
+	previousCounters := []Counter{{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}}
+	p, cleanup, err := NewMetricsPipeline(config, previousCounters, "",
+		testNewDCGMCollector(t, &previousCleanups, nil).Entity(),
+		newFieldEntityGroupTypeSystemInfo(previousCounters))
+	require.NoError(t, err)
+	previousCollector := p.gpuCollector
+	p.cache = []string{"stale"}
+	queue := &pushQueue{}
+	p.pushQueues = []*pushQueue{queue}
+	transform := newSlurmMapper()
+	p.transformations = []Transform{transform}
+
+	nextCleanups := 0
+	nextCounters := []Counter{{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}}
+	nextCleanup, err := p.Reload(nextCounters, "",
+		testNewDCGMCollector(t, &nextCleanups, nil).Entity(),
+		newFieldEntityGroupTypeSystemInfo(nextCounters))
+	require.NoError(t, err)
+
+	assert.Equal(t, nextCounters, p.counters)
+	assert.NotNil(t, p.gpuCollector)
+	assert.NotSame(t, previousCollector, p.gpuCollector)
+	assert.Nil(t, p.cache)
+
+	// The push queues and the transformations keep their connections across reloads
+	require.Len(t, p.pushQueues, 1)
+	assert.Same(t, queue, p.pushQueues[0])
+	require.Len(t, p.transformations, 1)
+	assert.Same(t, transform, p.transformations[0])
+
+	// Reload leaves the cleanup of both generations of collectors to the caller
+	assert.Equal(t, 0, previousCleanups)
+	cleanup()
+	assert.Equal(t, 1, previousCleanups)
+	nextCleanup()
+	assert.Equal(t, 1, nextCleanups)
+}
+
+func TestNewCollectorWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *Config
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "When retries are disabled, a single attempt is made",
+			config:       &Config{InitRetryInterval: 1},
+			failures:     1,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "When construction recovers before the timeout, the collector is returned",
+			config:       &Config{InitRetryInterval: 1, InitRetryTimeout: 10000},
+			failures:     3,
+			wantAttempts: 4,
+		},
+		{
+			name:         "When construction succeeds, no retry is made",
+			config:       &Config{InitRetryInterval: 1, InitRetryTimeout: 10000},
+			wantAttempts: 1,
+		},
+		{
+			name:     "When construction keeps failing, the error is returned after the timeout",
+			config:   &Config{InitRetryInterval: 1, InitRetryTimeout: 20},
+			failures: 1000,
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			newCollector := func(_ []Counter, _ string, _ *Config, _ FieldEntityGroupTypeSystemInfoItem,
+			) (EntityCollector, func(), error) {
+				attempts++
+				if attempts <= tc.failures {
+					return nil, func() {}, errors.New("hostengine is not ready")
+				}
+
+				return &DCGMCollector{}, func() {}, nil
+			}
+
+			collector, _, err := newCollectorWithRetry(newCollector, nil, "", tc.config,
+				FieldEntityGroupTypeSystemInfoItem{})
+			if tc.wantErr {
+				require.Error(t, err)
+				assert.Nil(t, collector)
+			} else {
+				require.NoError(t, err)
+				assert.NotNil(t, collector)
+			}
+
+			if tc.wantAttempts > 0 {
+				assert.Equal(t, tc.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+// vendorCollector is a backend collecting fixed GPU metrics without DCGM
+type vendorCollector struct {
+	metrics MetricsByCounter
+	err     error
+	cleaned bool
+}
+
+func (c *vendorCollector) GetMetrics() (MetricsByCounter, error) {
+	return c.metrics, c.err
+}
+
+func (c *vendorCollector) Cleanup() {
+	c.cleaned = true
+}
+
+func (c *vendorCollector) SystemInfo() SystemInfo {
+	return SystemInfo{InfoType: dcgm.FE_GPU}
+}
+
+func TestNewMetricsPipelineWithCollectorBackend(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge",
+		Help: "GPU temperature (in C)."}
+	collector := &vendorCollector{metrics: MetricsByCounter{
+		counter: {{Counter: counter, Value: "42", GPU: "0", UUID: "UUID", GPUUUID: "GPU-vendor"}},
+	}}
+
+	fieldEntityGroupTypeSystemInfo := &FieldEntityGroupTypeSystemInfo{
+		items: map[dcgm.Field_Entity_Group]FieldEntityGroupTypeSystemInfoItem{
+			dcgm.FE_GPU: {SystemInfo: SystemInfo{InfoType: dcgm.FE_GPU}},
+		},
+	}
+
+	p, cleanup, err := NewMetricsPipeline(&Config{}, []Counter{counter}, "",
+		func(_ []Counter, _ string, _ *Config, _ FieldEntityGroupTypeSystemInfoItem) (EntityCollector, func(), error) {
+			return collector, collector.Cleanup, nil
+		},
+		fieldEntityGroupTypeSystemInfo)
+	require.NoError(t, err)
+
+	out, err := p.CollectOnce()
+	require.NoError(t, err)
+	assert.Contains(t, out, "# TYPE DCGM_FI_DEV_GPU_TEMP gauge")
+	assert.Contains(t, out, `UUID="GPU-vendor"`)
+
+	cleanup()
+	assert.True(t, collector.cleaned)
+}
+
+func TestDCGMCollectorConstructorEntity(t *testing.T) {
+	newDCGMCollector := DCGMCollectorConstructor(func(_ []Counter, _ string, _ *Config,
+		_ FieldEntityGroupTypeSystemInfoItem,
+	) (*DCGMCollector, func(), error) {
+		return nil, func() {}, errors.New("no GPU")
+	})
+
+	collector, _, err := newDCGMCollector.Entity()(nil, "", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.Error(t, err)
+	assert.True(t, collector == nil, "a nil DCGM collector must be a nil EntityCollector")
+}
+
+func TestRunDrainsOnStop(t *testing.T) {
+	originalDrainTimeout := drainTimeout
+	drainTimeout = 100 * time.Millisecond
+	defer func() {
+		drainTimeout = originalDrainTimeout
+	}()
+
+	tests := []struct {
+		name       string
+		readOnStop bool
+	}{
+		{
+			name:       "When consumer reads after stop, the last payload is delivered",
+			readOnStop: true,
+		},
+		{
+			name:       "When consumer does not read, Run returns after the drain timeout",
+			readOnStop: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &MetricsPipeline{
+				config: &Config{
+					CollectInterval: 10,
+				},
+			}
+
+			// Nobody reads the unbuffered channel before stop, so every tick leaves its payload pending.
+			out := make(chan string)
+			stop := make(chan interface{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go p.Run(out, stop, &wg)
+
+			time.Sleep(50 * time.Millisecond)
+			close(stop)
+
+			if tc.readOnStop {
+				select {
+				case <-out:
+				case <-time.After(time.Second):
+					t.Fatal("Last payload was not delivered on stop")
+				}
+			}
+
+			require.NoError(t, WaitWithTimeout(&wg, time.Second))
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	p := &MetricsPipeline{config: &Config{}}
+
+	out := make(chan string, 2)
+	require.True(t, p.publish(out, "first"))
+	require.True(t, p.publish(out, "second"))
+
+	// When out is full, the oldest payload makes room for the newest one
+	require.True(t, p.publish(out, "third"))
+	assert.Equal(t, uint64(1), p.coalescedTicks.Load())
+	assert.Equal(t, "second", <-out)
+	assert.Equal(t, "third", <-out)
+
+	// An unbuffered channel without a reader cannot take the payload
+	assert.False(t, p.publish(make(chan string), "fourth"))
+	assert.Equal(t, uint64(1), p.coalescedTicks.Load())
+}
+
+func TestRunCoalescesPendingPayloads(t *testing.T) {
+	p := &MetricsPipeline{
+		config: &Config{
+			CollectInterval: 10,
+		},
+	}
+
+	out := make(chan string)
+	stop := make(chan interface{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go p.Run(out, stop, &wg)
+
+	// Every tick that finds a payload still pending replaces it
+	require.Eventually(t, func() bool {
+		return p.coalescedTicks.Load() >= 2
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("Pending payload was not delivered")
+	}
+
+	close(stop)
+	require.NoError(t, WaitWithTimeout(&wg, 2*drainTimeout))
+}
+
+func TestRunOutputBackpressure(t *testing.T) {
+	originalDrainTimeout := drainTimeout
+	drainTimeout = 100 * time.Millisecond
+	defer func() {
+		drainTimeout = originalDrainTimeout
+	}()
+
+	tests := []struct {
+		name          string
+		backpressure  string
+		wantCoalesced bool
+	}{
+		{
+			name:          "When the policy is drop-oldest, the ticks finding a pending payload are coalesced",
+			backpressure:  OutputBackpressureDropOldest,
+			wantCoalesced: true,
+		},
+		{
+			name:          "When the policy is drop-newest, the ticks finding a pending payload are coalesced",
+			backpressure:  OutputBackpressureDropNewest,
+			wantCoalesced: true,
+		},
+		{
+			name:          "When the policy is block, no payload is dropped",
+			backpressure:  OutputBackpressureBlock,
+			wantCoalesced: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &MetricsPipeline{
+				config: &Config{
+					CollectInterval:    10,
+					OutputBackpressure: tc.backpressure,
+				},
+			}
+
+			out := make(chan string)
+			stop := make(chan interface{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go p.Run(out, stop, &wg)
+
+			time.Sleep(100 * time.Millisecond)
+			assert.Equal(t, tc.wantCoalesced, p.coalescedTicks.Load() > 0)
+
+			select {
+			case <-out:
+			case <-time.After(time.Second):
+				t.Fatal("Payload was not delivered")
+			}
+
+			close(stop)
+			require.NoError(t, WaitWithTimeout(&wg, 2*drainTimeout))
+		})
+	}
+}
+
+func TestNewMetricsPipelineWhenOutputBackpressureIsUnknown(t *testing.T) {
+	_, cleanup, err := NewMetricsPipeline(&Config{OutputBackpressure: "drop-all"}, nil, "", nil, nil)
+	defer cleanup()
+	require.Error(t, err)
+}
+
+func TestEntitiesByInterval(t *testing.T) {
+	p := &MetricsPipeline{
+		config: &Config{
+			CollectInterval: 10000,
+		},
+	}
+
+	assert.Equal(t, map[int][]int{10000: {0, 1, 2, 3, 4}}, p.entitiesByInterval())
+
+	p.config.CollectIntervalOverrides = map[string]int{
+		"switch": 60000,
+		"link":   60000,
+		"core":   30000,
+	}
+
+	assert.Equal(t, map[int][]int{
+		10000: {0, 3},
+		30000: {4},
+		60000: {1, 2},
+	}, p.entitiesByInterval())
+}
+
+func TestTickerOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int
+		jitter   float64
+		want     time.Duration
+	}{
+		{
+			name:     "When jitter is 0, the ticker isn't delayed",
+			interval: 30000,
+			jitter:   0,
+			want:     0,
+		},
+		{
+			name:     "When jitter is set, the ticker is delayed by that fraction of the interval",
+			interval: 30000,
+			jitter:   0.25,
+			want:     7500 * time.Millisecond,
+		},
+		{
+			name:     "When the interval is short, the delay keeps sub-millisecond precision",
+			interval: 10,
+			jitter:   0.05,
+			want:     500 * time.Microsecond,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tickerOffset(tc.interval, tc.jitter))
+		})
+	}
+}
+
+func TestRunStopsDuringJitterDelay(t *testing.T) {
+	p := &MetricsPipeline{
+		config: &Config{
+			CollectInterval:       3600000,
+			CollectIntervalJitter: 0.9,
+		},
+	}
+
+	out := make(chan string)
+	stop := make(chan interface{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go p.Run(out, stop, &wg)
+
+	close(stop)
+
+	require.NoError(t, WaitWithTimeout(&wg, time.Second))
+}
+
+func TestFormatMetricsWithTimestamp(t *testing.T) {
+	counter := Counter{
+		FieldID:   150,
+		FieldName: "DCGM_FI_DEV_GPU_TEMP",
+		PromType:  "gauge",
+		Help:      "Temperature Help info",
+	}
+
+	metric := Metric{
+		Counter:   counter,
+		Value:     "42",
+		GPU:       "0",
+		UUID:      "UUID",
+		GPUUUID:   "fake0",
+		GPUDevice: "nvidia0",
+	}
+
+	tmpl := migMetricsTemplate
+
+	out, err := FormatMetrics(tmpl, MetricsByCounter{counter: {metric}})
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_TEMP Temperature Help info
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="fake0",pci_bus_id="",device="nvidia0",modelName=""} 42
+`, out)
+
+	metric.Timestamp = "1700000000123"
+	out, err = FormatMetrics(tmpl, MetricsByCounter{counter: {metric}})
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_TEMP Temperature Help info
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="fake0",pci_bus_id="",device="nvidia0",modelName=""} 42 1700000000123
+`, out)
+
+	// Like the metrics of the other entities, the ones of the processes have a timestamp
+	out, err = FormatMetrics(processMetricsTemplate, MetricsByCounter{counter: {metric}})
+	require.NoError(t, err)
+	assert.Contains(t, out, `modelName=""} 42 1700000000123`)
+}
+
+func TestMetricsTemplateNames(t *testing.T) {
+	p, cleanup, err := NewMetricsPipelineWithGPUCollector(&Config{}, &DCGMCollector{})
+	require.NoError(t, err)
+	defer cleanup()
+
+	templates := []*template.Template{
+		p.migMetricsFormat,
+		p.switchMetricsFormat,
+		p.linkMetricsFormat,
+		p.cpuMetricsFormat,
+		p.cpuCoreMetricsFormat,
+		p.processMetricsFormat,
+	}
+
+	names := map[string]bool{}
+	for _, tmpl := range templates {
+		require.NotNil(t, tmpl)
+		assert.False(t, names[tmpl.Name()], "duplicate template name %q", tmpl.Name())
+		names[tmpl.Name()] = true
+	}
+}
+
+func TestAddStaticLabels(t *testing.T) {
+	counter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metrics := MetricsByCounter{
+		counter: {
+			{Counter: counter, GPU: "0", Labels: map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15"}},
+			{Counter: counter, GPU: "1"},
+		},
+	}
+
+	p := &MetricsPipeline{
+		config: &Config{
+			StaticLabels: map[string]string{"cluster": "prod"},
+		},
+	}
+	p.addStaticLabels(metrics)
+
+	assert.Equal(t, map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15", "cluster": "prod"}, metrics[counter][0].Labels)
+	assert.Equal(t, map[string]string{"cluster": "prod"}, metrics[counter][1].Labels)
+}
+
+func TestRemapLabels(t *testing.T) {
+	counter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	shared := map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15", "DCGM_FI_DEV_BRAND": "Tesla"}
+	metrics := MetricsByCounter{
+		counter: {
+			{Counter: counter, GPU: "0", Labels: shared, Attributes: map[string]string{"pod": "a", "namespace": "b"}},
+			{Counter: counter, GPU: "1", Labels: shared},
+		},
+	}
+
+	p := &MetricsPipeline{
+		config: &Config{
+			LabelRename: map[string]string{"DCGM_FI_DRIVER_VERSION": "driver_version", "pod": "k8s_pod"},
+			LabelDrop:   []string{"DCGM_FI_DEV_BRAND", "namespace"},
+		},
+	}
+	p.remapLabels(metrics)
+
+	for _, metric := range metrics[counter] {
+		assert.Equal(t, map[string]string{"driver_version": "550.54.15"}, metric.Labels)
+	}
+	assert.Equal(t, map[string]string{"k8s_pod": "a"}, metrics[counter][0].Attributes)
+	assert.Nil(t, metrics[counter][1].Attributes)
+
+	// The maps shared by the collectors are left untouched
+	assert.Equal(t, map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15", "DCGM_FI_DEV_BRAND": "Tesla"}, shared)
+}
+
+func TestFormatWithMetricNamePrefix(t *testing.T) {
+	counter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature."}
+	metrics := MetricsByCounter{counter: {{Counter: counter, Value: "42", GPU: "0", UUID: "UUID", GPUUUID: "fake0"}}}
+
+	unprefixed, cleanup, err := NewMetricsPipelineWithGPUCollector(&Config{}, &DCGMCollector{})
+	require.NoError(t, err)
+	defer cleanup()
+
+	prefixed, cleanup, err := NewMetricsPipelineWithGPUCollector(&Config{MetricNamePrefix: "gpu_"}, &DCGMCollector{})
+	require.NoError(t, err)
+	defer cleanup()
+
+	for i, entity := range PipelineEntities {
+		want, err := unprefixed.format(i, metrics)
+		require.NoError(t, err)
+
+		got, err := prefixed.format(i, metrics)
+		require.NoError(t, err)
+
+		assert.Contains(t, got, "# HELP gpu_DCGM_FI_DEV_GPU_TEMP Temperature.\n", entity)
+		assert.Contains(t, got, "# TYPE gpu_DCGM_FI_DEV_GPU_TEMP gauge\n", entity)
+		assert.Equal(t, strings.ReplaceAll(want, "DCGM_FI_DEV_GPU_TEMP", "gpu_DCGM_FI_DEV_GPU_TEMP"), got, entity)
+	}
+
+	// The collected metrics keep their names, they are shared with the push exporters
+	assert.Equal(t, "DCGM_FI_DEV_GPU_TEMP", metrics[counter][0].Counter.FieldName)
+}
+
+func TestFormatMetricsOrdering(t *testing.T) {
+	temp := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature."}
+	power := Counter{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge", Help: "Power."}
+	metric := func(counter Counter, gpu, uuid string) Metric {
+		return Metric{Counter: counter, Value: "1", GPU: gpu, UUID: "UUID", GPUUUID: uuid}
+	}
+	metrics := MetricsByCounter{
+		power: {metric(power, "10", "gpu10"), metric(power, "2", "gpu2b"), metric(power, "2", "gpu2a")},
+		temp:  {metric(temp, "1", "gpu1"), metric(temp, "0", "gpu0")},
+	}
+
+	want := `# HELP DCGM_FI_DEV_GPU_TEMP Temperature.
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="gpu0",pci_bus_id="",device="",modelName=""} 1
+DCGM_FI_DEV_GPU_TEMP{gpu="1",UUID="gpu1",pci_bus_id="",device="",modelName=""} 1
+# HELP DCGM_FI_DEV_POWER_USAGE Power.
+# TYPE DCGM_FI_DEV_POWER_USAGE gauge
+DCGM_FI_DEV_POWER_USAGE{gpu="2",UUID="gpu2a",pci_bus_id="",device="",modelName=""} 1
+DCGM_FI_DEV_POWER_USAGE{gpu="2",UUID="gpu2b",pci_bus_id="",device="",modelName=""} 1
+DCGM_FI_DEV_POWER_USAGE{gpu="10",UUID="gpu10",pci_bus_id="",device="",modelName=""} 1
+`
+
+	// Maps are ranged in a random order, every formatting must give the same output
+	for i := 0; i < 10; i++ {
+		got, err := FormatMetrics(migMetricsTemplate, metrics)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// The collected metrics are left in their order
+	assert.Equal(t, "10", metrics[power][0].GPU)
+}
+
+func TestFormatMetricsTo(t *testing.T) {
+	metrics := benchmarkMetrics(2, 3)
+
+	want, err := FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, FormatMetricsTo(&buf, migMetricsTemplate, metrics))
+	assert.Equal(t, want, buf.String())
+}
+
+// benchmarkMetrics returns the metrics of a fleet node with the given number of GPUs and counters
+func benchmarkMetrics(gpus, counters int) MetricsByCounter {
+	metrics := MetricsByCounter{}
+	for i := 0; i < counters; i++ {
+		counter := Counter{FieldID: dcgm.Short(i), FieldName: fmt.Sprintf("DCGM_FI_DEV_FIELD_%d", i), PromType: "gauge",
+			Help: "Benchmark field."}
+		for gpu := 0; gpu < gpus; gpu++ {
+			metrics[counter] = append(metrics[counter], Metric{
+				Counter:      counter,
+				Value:        "42",
+				GPU:          strconv.Itoa(gpu),
+				UUID:         "UUID",
+				GPUUUID:      fmt.Sprintf("GPU-%d", gpu),
+				GPUDevice:    fmt.Sprintf("nvidia%d", gpu),
+				GPUModelName: "NVIDIA H100 80GB HBM3",
+				GPUPCIBusID:  "00000000:00:00.0",
+				Hostname:     "node-a",
+			})
+		}
+	}
+
+	return metrics
+}
+
+func BenchmarkFormatMetrics(b *testing.B) {
+	metrics := benchmarkMetrics(64, 50)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		out, err := FormatMetrics(migMetricsTemplate, metrics)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _ = io.WriteString(io.Discard, out)
+	}
+}
+
+func BenchmarkFormatMetricsTo(b *testing.B) {
+	metrics := benchmarkMetrics(64, 50)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := FormatMetricsTo(io.Discard, migMetricsTemplate, metrics); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// traceTransform attaches the exemplar of a trace to every metric
+type traceTransform struct{}
+
+func (traceTransform) Name() string { return "trace" }
+
+func (traceTransform) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	for counter := range metrics {
+		for i := range metrics[counter] {
+			metrics[counter][i].Exemplar = &Exemplar{
+				Labels: map[string]string{"trace_id": "4bf92f3577b34da6"},
+				Value:  metrics[counter][i].Value,
+			}
+		}
+	}
+	return nil
+}
+
+func TestFormatMetricsWithExemplar(t *testing.T) {
+	transformations := getTransformations(&Config{Transforms: []Transform{traceTransform{}}})
+	require.Len(t, transformations, 1)
+
+	energy := Counter{FieldID: 156, FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", PromType: "counter", Help: "Energy."}
+	metrics := MetricsByCounter{energy: {{Counter: energy, Value: "1000", GPU: "0", UUID: "UUID", GPUUUID: "fake0"}}}
+
+	plain, err := FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+	assert.NotContains(t, plain, "EXEMPLAR")
+
+	require.NoError(t, transformations[0].Process(metrics, SystemInfo{}))
+	formatted, err := FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+	assert.Equal(t, plain+"# EXEMPLAR {trace_id=\"4bf92f3577b34da6\"} 1000\n", formatted)
+
+	var buf bytes.Buffer
+	require.NoError(t, FormatOpenMetrics(&buf, formatted))
+	assert.Contains(t, buf.String(),
+		`DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION_total{gpu="0",UUID="fake0",pci_bus_id="",device="",modelName=""} 1000.0 # {trace_id="4bf92f3577b34da6"} 1000.0`)
+}
+
+// namedTransform writes its name to the owner attribute of every metric
+type namedTransform string
+
+func (n namedTransform) Name() string { return string(n) }
+
+func (n namedTransform) Process(metrics MetricsByCounter, _ SystemInfo) error {
+	for counter := range metrics {
+		for i := range metrics[counter] {
+			metrics[counter][i].Attributes["owner"] = string(n)
+		}
+	}
+	return nil
+}
+
+func TestOrderTransforms(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{
+			name: "When no order is given, the default order is kept",
+			want: []string{"podMapper", "slurmMapper", "hpcMapper", "trace"},
+		},
+		{
+			name:  "When an order is given, the named transforms are applied first",
+			order: []string{"hpcMapper", "podMapper"},
+			want:  []string{"hpcMapper", "podMapper", "slurmMapper", "trace"},
+		},
+		{
+			name:  "When a custom transform is ordered, it is moved too",
+			order: []string{"trace"},
+			want:  []string{"trace", "podMapper", "slurmMapper", "hpcMapper"},
+		},
+		{
+			name:  "When a transform isn't enabled, its name is ignored",
+			order: []string{"nodeLabelMapper", "slurmMapper"},
+			want:  []string{"slurmMapper", "podMapper", "hpcMapper", "trace"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			transformations := []Transform{
+				namedTransform("podMapper"), namedTransform("slurmMapper"), namedTransform("hpcMapper"),
+				namedTransform("trace"),
+			}
+
+			var got []string
+			for _, transform := range orderTransforms(transformations, tc.order) {
+				got = append(got, transform.Name())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestOrderTransforms_LastWriterWins(t *testing.T) {
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metrics := MetricsByCounter{counter: {{Counter: counter, Attributes: map[string]string{}}}}
+
+	transformations := orderTransforms([]Transform{namedTransform("podMapper"), namedTransform("hpcMapper")},
+		[]string{"hpcMapper"})
+	for _, transform := range transformations {
+		require.NoError(t, transform.Process(metrics, SystemInfo{}))
+	}
+
+	assert.Equal(t, "podMapper", metrics[counter][0].Attributes["owner"])
+}
+
+func TestValidateTransformOrder(t *testing.T) {
+	assert.NoError(t, ValidateTransformOrder(nil))
+	assert.NoError(t, ValidateTransformOrder([]string{"slurmMapper", "podMapper"}))
+	assert.ErrorContains(t, ValidateTransformOrder([]string{"pods"}), "unknown transform 'pods'")
+	assert.ErrorContains(t, ValidateTransformOrder([]string{"podMapper", "podMapper"}),
+		"transform 'podMapper' is ordered more than once")
+}
+
+func TestValidateMetricNamePrefix(t *testing.T) {
+	assert.NoError(t, ValidateMetricNamePrefix(""))
+	assert.NoError(t, ValidateMetricNamePrefix("gpu_"))
+	assert.NoError(t, ValidateMetricNamePrefix("cluster:gpu_"))
+	assert.Error(t, ValidateMetricNamePrefix("0gpu_"))
+	assert.Error(t, ValidateMetricNamePrefix("gpu-"))
+}
+
+func TestCollectOnce(t *testing.T) {
+	// The GPU is monitored but its collector could not be created, so only the health is reported
+	p := &MetricsPipeline{
+		config: &Config{CollectInterval: 1},
+		health: []entityHealth{{monitored: true}, {}, {}, {}, {}},
+	}
+
+	out, err := p.CollectOnce()
+	require.NoError(t, err)
+	assert.Contains(t, out, `dcgm_exporter_collector_up{entity="gpu"} 0`)
+
+	// Collections are serialized with the ones of Run
+	ch := make(chan string, 1)
+	stop := make(chan interface{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go p.Run(ch, stop, &wg)
+
+	var callers sync.WaitGroup
+	for range 10 {
+		callers.Add(1)
+		go func() {
+			defer callers.Done()
+			out, err := p.CollectOnce()
+			assert.NoError(t, err)
+			assert.Contains(t, out, `dcgm_exporter_collector_up{entity="gpu"} 0`)
+		}()
+	}
+	callers.Wait()
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestCollectWithTimeout(t *testing.T) {
+	collector := testGPUCollectorWithValues(t,
+		[]Counter{{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}},
+		dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(42)},
+	)
+
+	release := make(chan struct{})
+	latestValues := dcgmEntityGetLatestValuesHook
+	dcgmEntityGetLatestValuesHook = func(group dcgm.Field_Entity_Group, gpu uint, fields []dcgm.Short,
+	) ([]dcgm.FieldValue_v1, error) {
+		<-release
+		return latestValues(group, gpu, fields)
+	}
+
+	p := &MetricsPipeline{
+		config:           &Config{CollectInterval: 1, CollectTimeout: 50},
+		migMetricsFormat: migMetricsTemplate,
+		gpuCollector:     collector,
+		health:           []entityHealth{{monitored: true}, {}, {}, {}, {}},
+	}
+
+	// A stuck collector fails the tick instead of blocking it
+	_, err := p.CollectOnce()
+	require.ErrorContains(t, err, "did not complete within 50ms")
+	assert.False(t, p.health[gpuEntity].up)
+	assert.Equal(t, uint64(1), p.health[gpuEntity].errors)
+
+	// It isn't called again while its stuck call is running
+	_, err = p.CollectOnce()
+	require.ErrorContains(t, err, "previous collection did not return yet")
+
+	close(release)
+	require.Eventually(t, func() bool {
+		_, err := p.CollectOnce()
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	out, err := p.CollectOnce()
+	require.NoError(t, err)
+	assert.Contains(t, out, "DCGM_FI_DEV_GPU_TEMP{")
+	assert.Contains(t, out, `dcgm_exporter_collector_up{entity="gpu"} 1`)
 }
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// powerUsageRatioCounter is derived from the power draw of the GPUs, exported along with the power usage counter
+var powerUsageRatioCounter = Counter{
+	FieldID:   dcgm.DCGM_FI_DEV_POWER_USAGE,
+	FieldName: "dcgm_power_usage_ratio",
+	PromType:  "gauge",
+	Help:      "Power draw as a fraction of the power limit enforced by the GPU.",
+}
+
+// withPowerLimitField adds the enforced power limit to the device fields requesting the power usage, so the ratio
+// can be derived when the limit isn't exported itself
+func withPowerLimitField(deviceFields []dcgm.Short) []dcgm.Short {
+	if !slices.Contains(deviceFields, dcgm.DCGM_FI_DEV_POWER_USAGE) ||
+		slices.Contains(deviceFields, dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT) {
+		return deviceFields
+	}
+
+	return append(deviceFields, dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT)
+}
+
+// powerUsageRatio returns the power usage divided by the enforced power limit, false when either of them has no
+// value or the limit is 0
+func powerUsageRatio(values []dcgm.FieldValue_v1) (string, bool) {
+	usage, ok := floatFieldValue(values, dcgm.DCGM_FI_DEV_POWER_USAGE)
+	if !ok {
+		return "", false
+	}
+
+	limit, ok := floatFieldValue(values, dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT)
+	if !ok || limit <= 0 {
+		return "", false
+	}
+
+	return strconv.FormatFloat(usage/limit, 'f', -1, 64), true
+}
+
+// floatFieldValue returns the unscaled value of the field, false when the field is missing or blank
+func floatFieldValue(values []dcgm.FieldValue_v1, fieldID dcgm.Short) (float64, bool) {
+	i := slices.IndexFunc(values, func(val dcgm.FieldValue_v1) bool {
+		return dcgm.Short(val.FieldId) == fieldID
+	})
+	if i < 0 || values[i].Status != 0 || isBlank(values[i]) {
+		return 0, false
+	}
+
+	v, err := strconv.ParseFloat(ToString(values[i]), 64)
+	return v, err == nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPowerLimitField(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []dcgm.Short
+		want   []dcgm.Short
+	}{
+		{
+			name:   "When the power usage is requested, the power limit is added",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_POWER_USAGE},
+			want:   []dcgm.Short{dcgm.DCGM_FI_DEV_POWER_USAGE, dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT},
+		},
+		{
+			name:   "When the power limit is already requested, it isn't added twice",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT, dcgm.DCGM_FI_DEV_POWER_USAGE},
+			want:   []dcgm.Short{dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT, dcgm.DCGM_FI_DEV_POWER_USAGE},
+		},
+		{
+			name:   "When the power usage isn't requested, the fields are left unchanged",
+			fields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP},
+			want:   []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, withPowerLimitField(tc.fields))
+		})
+	}
+}
+
+func TestGPUCollector_GetMetricsPowerUsageRatio(t *testing.T) {
+	usage := Counter{FieldID: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge"}
+
+	tests := []struct {
+		name  string
+		limit float64
+		want  []string
+	}{
+		{
+			name:  "When the GPU reports its power limit, the ratio is derived",
+			limit: 300,
+			want:  []string{"0.5"},
+		},
+		{
+			name:  "When the power limit is blank, the ratio is skipped",
+			limit: dcgm.DCGM_FT_FP64_NOT_SUPPORTED,
+		},
+		{
+			name:  "When the power limit is 0, the ratio is skipped",
+			limit: 0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testGPUCollectorWithValues(t, []Counter{usage},
+				dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_POWER_USAGE, FieldType: dcgm.DCGM_FT_DOUBLE,
+					Value: float64FieldValue(150)},
+				dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT, FieldType: dcgm.DCGM_FT_DOUBLE,
+					Value: float64FieldValue(tc.limit)},
+			)
+			c.DeviceFields = withPowerLimitField(c.DeviceFields)
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+
+			// The power usage is exported either way, the limit only when it is in the counters
+			require.Len(t, metrics[usage], 1)
+			assert.Len(t, metrics, 1+len(tc.want))
+
+			var got []string
+			for _, metric := range metrics[powerUsageRatioCounter] {
+				assert.Equal(t, "GPU-00000000", metric.GPUUUID)
+				got = append(got, metric.Value)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+const (
+	pidLabel = "pid"
+
+	// unknownPod labels the processes that cannot be attributed to a single pod
+	unknownPod = "unknown"
+
+	// processWatchMaxKeepAge bounds how long DCGM keeps the samples used to compute the process stats
+	processWatchMaxKeepAge = time.Hour
+)
+
+var (
+	processSMUtilCounter = Counter{
+		FieldName: "DCGM_EXP_PROCESS_SM_UTIL",
+		PromType:  "gauge",
+		Help:      "SM utilization of the process (in %).",
+	}
+	processMemUtilCounter = Counter{
+		FieldName: "DCGM_EXP_PROCESS_MEM_UTIL",
+		PromType:  "gauge",
+		Help:      "Memory utilization of the process (in %).",
+	}
+	processMaxMemoryUsedCounter = Counter{
+		FieldName: "DCGM_EXP_PROCESS_MAX_MEMORY_USED",
+		PromType:  "gauge",
+		Help:      "Maximum framebuffer memory used by the process (in bytes).",
+	}
+	processEnergyConsumedCounter = Counter{
+		FieldName: "DCGM_EXP_PROCESS_ENERGY_CONSUMED",
+		PromType:  "counter",
+		Help:      "Energy consumed by the process on the GPU (in J).",
+	}
+	processMemUsedCounter = Counter{
+		FieldName: "DCGM_EXP_PROCESS_MEM_USED_BYTES",
+		PromType:  "gauge",
+		Help:      "Framebuffer memory used by the process (in bytes), read from NVML like nvidia-smi.",
+	}
+)
+
+var (
+	dcgmWatchPidFieldsHook       = dcgm.WatchPidFieldsEx
+	dcgmGetProcessInfoHook       = dcgm.GetProcessInfo
+	nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+	nvmlGetRunningProcessesHook  = nvmlprovider.GetRunningProcesses
+)
+
+// processCollector reports the DCGM accounting stats of the compute processes running on the monitored GPUs, and
+// their memory read from NVML with Config.EnableProcessMemoryMetrics. Process metrics have one series per PID, so the collector is
+// only created when Config.EnableProcessMetrics or Config.EnableProcessMemoryMetrics is set.
+type processCollector struct {
+	sysInfo  SystemInfo
+	hostname string
+	config   *Config
+	group    dcgm.GroupHandle
+	cleanups []func()
+
+	connection uint64 // Connection to DCGM of the cleanups, see staleConnection
+}
+
+func newProcessCollector(hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem,
+) (*processCollector, func(), error) {
+	collector := &processCollector{
+		sysInfo:    fieldEntityGroupTypeSystemInfo.SystemInfo,
+		hostname:   hostname,
+		config:     config,
+		connection: dcgmConnection.Load(),
+	}
+
+	var gpus []uint
+	for _, mi := range GetMonitoredEntities(collector.sysInfo) {
+		if !slices.Contains(gpus, mi.DeviceInfo.GPU) {
+			gpus = append(gpus, mi.DeviceInfo.GPU)
+		}
+	}
+
+	if len(gpus) == 0 {
+		return nil, func() {}, fmt.Errorf("no GPU to watch processes on")
+	}
+
+	// The memory of the processes is read from NVML, only the accounting stats are watched
+	if !config.EnableProcessMetrics {
+		return collector, func() { collector.Cleanup() }, nil
+	}
+
+	group, err := dcgmWatchPidFieldsHook(time.Duration(config.CollectInterval)*time.Millisecond,
+		processWatchMaxKeepAge, 0, gpus...)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	collector.group = group
+	collector.cleanups = append(collector.cleanups, func() {
+		err := dcgm.DestroyGroup(group)
+		if err != nil {
+			logrus.Warnf("Cannot destroy process watch group %v; err: %v", group, err)
+		}
+	})
+
+	return collector, func() { collector.Cleanup() }, nil
+}
+
+func (c *processCollector) Cleanup() {
+	if staleConnection(c.connection) {
+		return
+	}
+
+	for _, cleanup := range c.cleanups {
+		cleanup()
+	}
+}
+
+func (c *processCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	// Accounting stats are kept per physical GPU, GPU instances are reported by their parent
+	gpus := map[uint]MonitoringInfo{}
+	var pids []uint
+	metrics := make(MetricsByCounter)
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		if _, exists := gpus[mi.DeviceInfo.GPU]; exists {
+			continue
+		}
+
+		mi.InstanceInfo = nil
+		gpus[mi.DeviceInfo.GPU] = mi
+
+		if c.config.EnableProcessMemoryMetrics {
+			processes, err := nvmlGetRunningProcessesHook(mi.DeviceInfo.UUID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list the processes of GPU %d; err: %w", mi.DeviceInfo.GPU, err)
+			}
+
+			for _, process := range processes {
+				if process.Available {
+					c.appendMetric(metrics, processMemUsedCounter, mi, uuid, process.PID, fmt.Sprint(process.UsedMemory))
+				}
+			}
+		}
+
+		if !c.config.EnableProcessMetrics {
+			continue
+		}
+
+		running, err := nvmlGetRunningProcessIDsHook(mi.DeviceInfo.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the processes of GPU %d; err: %w", mi.DeviceInfo.GPU, err)
+		}
+
+		for _, pid := range running {
+			if !slices.Contains(pids, pid) {
+				pids = append(pids, pid)
+			}
+		}
+	}
+
+	for _, pid := range pids {
+		infos, err := dcgmGetProcessInfoHook(c.group, pid)
+		if err != nil {
+			// The process may have exited since it was listed
+			logrus.Debugf("Cannot get info of process %d; err: %v", pid, err)
+			continue
+		}
+
+		for _, info := range infos {
+			mi, exists := gpus[info.GPU]
+			if !exists {
+				continue
+			}
+
+			if info.ProcessUtilization.SmUtil != nil {
+				c.appendMetric(metrics, processSMUtilCounter, mi, uuid, pid, fmt.Sprint(*info.ProcessUtilization.SmUtil))
+			}
+
+			if info.ProcessUtilization.MemUtil != nil {
+				c.appendMetric(metrics, processMemUtilCounter, mi, uuid, pid, fmt.Sprint(*info.ProcessUtilization.MemUtil))
+			}
+
+			if !dcgm.IsInt64Blank(info.Memory.GlobalUsed) {
+				c.appendMetric(metrics, processMaxMemoryUsedCounter, mi, uuid, pid, fmt.Sprint(info.Memory.GlobalUsed))
+			}
+
+			if info.ProcessUtilization.EnergyConsumed != nil {
+				c.appendMetric(metrics, processEnergyConsumedCounter, mi, uuid, pid,
+					fmt.Sprint(*info.ProcessUtilization.EnergyConsumed))
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+func (c *processCollector) appendMetric(metrics MetricsByCounter,
+	counter Counter,
+	mi MonitoringInfo,
+	uuid string,
+	pid uint,
+	value string,
+) {
+	metrics[counter] = append(metrics[counter], Metric{
+		Counter:      counter,
+		Value:        value,
+		UUID:         uuid,
+		GPU:          fmt.Sprintf("%d", mi.DeviceInfo.GPU),
+		GPUUUID:      mi.DeviceInfo.UUID,
+		GPUDevice:    fmt.Sprintf("nvidia%d", mi.DeviceInfo.GPU),
+		GPUModelName: getGPUModel(mi.DeviceInfo, c.config.ReplaceBlanksInModelName),
+		GPUPCIBusID:  mi.DeviceInfo.PCI.BusID,
+		Hostname:     c.hostname,
+
+		Labels:     map[string]string{pidLabel: fmt.Sprint(pid)},
+		Attributes: map[string]string{},
+	})
+}
+
+// labelUnknownPods labels the memory of the processes that cannot be attributed to a single pod with the unknown pod.
+// The processes are attributed to the pods per GPU, not per PID: the pod a process belongs to is the one its GPU is
+// allocated to. So the processes of the GPUs allocated to no pod, or shared by several pods, are unknown.
+func labelUnknownPods(metrics MetricsByCounter, config *Config) {
+	pod, namespace, container := podAttribute, namespaceAttribute, containerAttribute
+	if config.UseOldNamespace {
+		pod, namespace, container = oldPodAttribute, oldNamespaceAttribute, oldContainerAttribute
+	}
+
+	for j, metric := range metrics[processMemUsedCounter] {
+		switch metric.Attributes[sharingStrategyAttribute] {
+		case SharingStrategyTimeSlicing, SharingStrategyMPS:
+		default:
+			if _, mapped := metric.Attributes[pod]; mapped {
+				continue
+			}
+		}
+
+		metrics[processMemUsedCounter][j].Attributes[pod] = unknownPod
+		metrics[processMemUsedCounter][j].Attributes[namespace] = unknownPod
+		if !config.KubernetesRemoveContainerLabel {
+			metrics[processMemUsedCounter][j].Attributes[container] = unknownPod
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestProcessCollector_GetMetrics(t *testing.T) {
+	smUtil, memUtil, energy := 42.5, 10.0, uint64(123)
+
+	nvmlGetRunningProcessIDsHook = func(uuid string) ([]uint, error) {
+		switch uuid {
+		case "GPU-0":
+			return []uint{100, 200}, nil
+		case "GPU-1":
+			return []uint{200, 300}, nil
+		}
+		return nil, nil
+	}
+	dcgmGetProcessInfoHook = func(_ dcgm.GroupHandle, pid uint) ([]dcgm.ProcessInfo, error) {
+		switch pid {
+		case 100:
+			return []dcgm.ProcessInfo{{
+				GPU: 0,
+				PID: pid,
+				ProcessUtilization: dcgm.ProcessUtilInfo{
+					SmUtil:         &smUtil,
+					MemUtil:        &memUtil,
+					EnergyConsumed: &energy,
+				},
+				Memory: dcgm.MemoryInfo{GlobalUsed: 1024},
+			}}, nil
+		case 200:
+			return []dcgm.ProcessInfo{
+				{GPU: 0, PID: pid, Memory: dcgm.MemoryInfo{GlobalUsed: 2048}},
+				{GPU: 1, PID: pid, Memory: dcgm.MemoryInfo{GlobalUsed: dcgm.DCGM_FT_INT64_BLANK}},
+			}, nil
+		}
+		// The process exited since it was listed
+		return nil, errors.New("no data for process")
+	}
+	defer func() {
+		nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+		dcgmGetProcessInfoHook = dcgm.GetProcessInfo
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	collector := &processCollector{sysInfo: sysInfo, hostname: "local-test", config: &Config{EnableProcessMetrics: true}}
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+
+	values := func(counter Counter) map[string]string {
+		res := map[string]string{}
+		for _, metric := range metrics[counter] {
+			assert.Equal(t, "local-test", metric.Hostname)
+			res[metric.GPU+"/"+metric.Labels[pidLabel]] = metric.Value
+		}
+		return res
+	}
+
+	assert.Equal(t, map[string]string{"0/100": "42.5"}, values(processSMUtilCounter))
+	assert.Equal(t, map[string]string{"0/100": "10"}, values(processMemUtilCounter))
+	assert.Equal(t, map[string]string{"0/100": "123"}, values(processEnergyConsumedCounter))
+	assert.Equal(t, map[string]string{"0/100": "1024", "0/200": "2048"}, values(processMaxMemoryUsedCounter))
+}
+
+func TestProcessCollector_GetMetricsMemory(t *testing.T) {
+	nvmlGetRunningProcessesHook = func(uuid string) ([]nvmlprovider.ProcessMemory, error) {
+		switch uuid {
+		case "GPU-0":
+			return []nvmlprovider.ProcessMemory{
+				{PID: 100, UsedMemory: 1 << 30, Available: true},
+				{PID: 200, UsedMemory: math.MaxUint64},
+			}, nil
+		case "GPU-1":
+			return []nvmlprovider.ProcessMemory{{PID: 100, UsedMemory: 512, Available: true}}, nil
+		}
+		return nil, nil
+	}
+	defer func() {
+		nvmlGetRunningProcessesHook = nvmlprovider.GetRunningProcesses
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	collector := &processCollector{sysInfo: sysInfo, config: &Config{EnableProcessMemoryMetrics: true}}
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+
+	assert.Equal(t, "DCGM_EXP_PROCESS_MEM_USED_BYTES", processMemUsedCounter.FieldName)
+
+	values := map[string]string{}
+	for _, metric := range metrics[processMemUsedCounter] {
+		values[metric.GPU+"/"+metric.Labels[pidLabel]] = metric.Value
+	}
+
+	assert.Equal(t, map[string]string{"0/100": "1073741824", "1/100": "512"}, values,
+		"the processes whose memory isn't available must be skipped")
+	assert.Len(t, metrics, 1, "the accounting stats must only be collected with the process metrics")
+}
+
+func TestLabelUnknownPods(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		attributes map[string]string
+		want       map[string]string
+	}{
+		{
+			name:       "When the GPU of the process is allocated to a pod, the pod is kept",
+			config:     &Config{},
+			attributes: map[string]string{podAttribute: "trainer", namespaceAttribute: "ml"},
+			want:       map[string]string{podAttribute: "trainer", namespaceAttribute: "ml"},
+		},
+		{
+			name:       "When the GPU of the process is allocated to no pod, the pod is unknown",
+			config:     &Config{},
+			attributes: map[string]string{},
+			want: map[string]string{
+				podAttribute: unknownPod, namespaceAttribute: unknownPod, containerAttribute: unknownPod,
+			},
+		},
+		{
+			name:   "When the GPU of the process is shared by several pods, the pod is unknown",
+			config: &Config{KubernetesRemoveContainerLabel: true},
+			attributes: map[string]string{
+				podAttribute: "trainer", namespaceAttribute: "ml", sharingStrategyAttribute: SharingStrategyTimeSlicing,
+			},
+			want: map[string]string{
+				podAttribute: unknownPod, namespaceAttribute: unknownPod, sharingStrategyAttribute: SharingStrategyTimeSlicing,
+			},
+		},
+		{
+			name:       "When the old namespace is used, the old attributes are unknown",
+			config:     &Config{UseOldNamespace: true},
+			attributes: map[string]string{},
+			want: map[string]string{
+				oldPodAttribute: unknownPod, oldNamespaceAttribute: unknownPod, oldContainerAttribute: unknownPod,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := MetricsByCounter{
+				processMemUsedCounter: {{Counter: processMemUsedCounter, Attributes: tc.attributes}},
+				processSMUtilCounter:  {{Counter: processSMUtilCounter, Attributes: map[string]string{}}},
+			}
+
+			labelUnknownPods(metrics, tc.config)
+
+			assert.Equal(t, tc.want, metrics[processMemUsedCounter][0].Attributes)
+			assert.Empty(t, metrics[processSMUtilCounter][0].Attributes, "only the process memory is labeled")
+		})
+	}
+}
+
+func TestProcessCollector_GetMetrics_ListError(t *testing.T) {
+	nvmlGetRunningProcessIDsHook = func(string) ([]uint, error) {
+		return nil, errors.New("boom")
+	}
+	defer func() {
+		nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 1,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+
+	collector := &processCollector{sysInfo: sysInfo, config: &Config{EnableProcessMetrics: true}}
+
+	_, err := collector.GetMetrics()
+	require.Error(t, err)
+}
+
+func TestNewProcessCollector(t *testing.T) {
+	var watched []uint
+	var updateFreq time.Duration
+	dcgmWatchPidFieldsHook = func(freq, _ time.Duration, _ int, gpus ...uint) (dcgm.GroupHandle, error) {
+		updateFreq = freq
+		watched = gpus
+		return dcgm.GroupHandle{}, nil
+	}
+	defer func() {
+		dcgmWatchPidFieldsHook = dcgm.WatchPidFieldsEx
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i}
+	}
+
+	collector, _, err := newProcessCollector("", &Config{CollectInterval: 5000, EnableProcessMetrics: true},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	require.NotNil(t, collector)
+
+	assert.Equal(t, []uint{0, 1}, watched)
+	assert.Equal(t, 5*time.Second, updateFreq)
+}
+
+func TestProcessMetricsFormat(t *testing.T) {
+	tmpl := processMetricsTemplate
+
+	metrics := MetricsByCounter{
+		processSMUtilCounter: {{
+			Counter:      processSMUtilCounter,
+			Value:        "42",
+			UUID:         "UUID",
+			GPU:          "0",
+			GPUUUID:      "GPU-0",
+			GPUDevice:    "nvidia0",
+			GPUModelName: "NVIDIA T400 4GB",
+			GPUPCIBusID:  "00000000:0000:0000.0",
+			Hostname:     "local-test",
+			Labels:       map[string]string{pidLabel: "100"},
+			Attributes:   map[string]string{podAttribute: "pod-a"},
+		}},
+	}
+
+	out, err := FormatMetrics(tmpl, metrics)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Join([]string{
+		"# HELP DCGM_EXP_PROCESS_SM_UTIL SM utilization of the process (in %).",
+		"# TYPE DCGM_EXP_PROCESS_SM_UTIL gauge",
+		`DCGM_EXP_PROCESS_SM_UTIL{gpu="0",UUID="GPU-0",pci_bus_id="00000000:0000:0000.0",device="nvidia0",` +
+			`modelName="NVIDIA T400 4GB",Hostname="local-test",pid="100",pod="pod-a"} 42`,
+		"",
+	}, "\n"), out)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+func isProfilingField(fieldID uint) bool {
+	return fieldID >= dcpFieldsStart && fieldID < cpuFieldsStart
+}
+
+// activeMetricGroups returns the profiling metric groups to watch for the counters. DCGM watches a single group
+// per major ID at a time and multiplexes the others, which yields zeros, so for every major ID only the group
+// with the most requested fields is kept. On a tie the first group returned by DCGM wins.
+func activeMetricGroups(counters []Counter, c *Config) []dcgm.MetricGroup {
+	if !c.CollectDCP {
+		return nil
+	}
+
+	requested := map[uint]bool{}
+	for _, counter := range counters {
+		if isProfilingField(uint(counter.FieldID)) {
+			requested[uint(counter.FieldID)] = true
+		}
+	}
+
+	var (
+		res    []dcgm.MetricGroup
+		counts []int
+	)
+	for _, group := range c.MetricGroups {
+		count := 0
+		for _, fieldID := range group.FieldIds {
+			if requested[fieldID] {
+				count++
+			}
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		i := slices.IndexFunc(res, func(g dcgm.MetricGroup) bool { return g.Major == group.Major })
+		switch {
+		case i < 0:
+			res = append(res, group)
+			counts = append(counts, count)
+		case count > counts[i]:
+			res[i] = group
+			counts[i] = count
+		}
+	}
+
+	return res
+}
+
+// filterProfilingCounters drops the profiling counters that no active metric group provides
+func filterProfilingCounters(counters []Counter, c *Config) []Counter {
+	groups := activeMetricGroups(counters, c)
+
+	res := make([]Counter, 0, len(counters))
+	for _, counter := range counters {
+		fieldID := uint(counter.FieldID)
+		if isProfilingField(fieldID) && !slices.ContainsFunc(groups, func(g dcgm.MetricGroup) bool {
+			return slices.Contains(g.FieldIds, fieldID)
+		}) {
+			logrus.Warnf("Skipping profiling metric %s: it cannot be watched together with the other profiling metrics",
+				counter.FieldName)
+			continue
+		}
+
+		res = append(res, counter)
+	}
+
+	for _, group := range groups {
+		logrus.Infof("Watching profiling metric group %d.%d", group.Major, group.Minor)
+	}
+
+	return res
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterProfilingCounters(t *testing.T) {
+	smClock := Counter{FieldID: 100, FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "gauge"}
+	smActive := Counter{FieldID: 1002, FieldName: "DCGM_FI_PROF_SM_ACTIVE", PromType: "gauge"}
+	smOccupancy := Counter{FieldID: 1003, FieldName: "DCGM_FI_PROF_SM_OCCUPANCY", PromType: "gauge"}
+	tensorActive := Counter{FieldID: 1004, FieldName: "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE", PromType: "gauge"}
+	dramActive := Counter{FieldID: 1005, FieldName: "DCGM_FI_PROF_DRAM_ACTIVE", PromType: "gauge"}
+
+	groups := []dcgm.MetricGroup{
+		{Major: 1, Minor: 0, FieldIds: []uint{1002, 1003}},
+		{Major: 1, Minor: 1, FieldIds: []uint{1004}},
+		{Major: 2, Minor: 0, FieldIds: []uint{1005}},
+	}
+
+	tests := []struct {
+		name       string
+		config     *Config
+		counters   []Counter
+		wantGroups []dcgm.MetricGroup
+		want       []Counter
+	}{
+		{
+			name:       "When the profiling fields belong to different major IDs, they are all kept",
+			config:     &Config{CollectDCP: true, MetricGroups: groups},
+			counters:   []Counter{smClock, smActive, dramActive},
+			wantGroups: []dcgm.MetricGroup{groups[0], groups[2]},
+			want:       []Counter{smClock, smActive, dramActive},
+		},
+		{
+			name:       "When the profiling fields belong to groups with the same major ID, the largest group is kept",
+			config:     &Config{CollectDCP: true, MetricGroups: groups},
+			counters:   []Counter{smClock, tensorActive, smActive, smOccupancy},
+			wantGroups: []dcgm.MetricGroup{groups[0]},
+			want:       []Counter{smClock, smActive, smOccupancy},
+		},
+		{
+			name:       "When the groups with the same major ID provide as many fields, the first one is kept",
+			config:     &Config{CollectDCP: true, MetricGroups: groups},
+			counters:   []Counter{tensorActive, smActive},
+			wantGroups: []dcgm.MetricGroup{groups[0]},
+			want:       []Counter{smActive},
+		},
+		{
+			name:       "When no profiling field is requested, no group is active",
+			config:     &Config{CollectDCP: true, MetricGroups: groups},
+			counters:   []Counter{smClock},
+			wantGroups: nil,
+			want:       []Counter{smClock},
+		},
+		{
+			name:       "When DCP isn't collected, no group is active",
+			config:     &Config{CollectDCP: false, MetricGroups: groups},
+			counters:   []Counter{smClock},
+			wantGroups: nil,
+			want:       []Counter{smClock},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := filterProfilingCounters(tc.counters, tc.config)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantGroups, activeMetricGroups(tc.counters, tc.config))
+			assert.Equal(t, tc.wantGroups, activeMetricGroups(got, tc.config), "the kept counters select the same groups")
+		})
+	}
+}
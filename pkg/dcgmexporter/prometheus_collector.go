@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// PrometheusCollector exposes the metrics of a MetricsPipeline as a prometheus.Collector, for the processes
+// registering them with their own registry instead of serving the text output. Every scrape collects the metrics
+// of all entities, they get the names, help and labels of the text output. The internal metrics of the exporter
+// aren't exposed.
+type PrometheusCollector struct {
+	pipeline *MetricsPipeline
+	prefix   string
+}
+
+var _ prometheus.Collector = (*PrometheusCollector)(nil)
+
+func NewPrometheusCollector(pipeline *MetricsPipeline) *PrometheusCollector {
+	return &PrometheusCollector{
+		pipeline: pipeline,
+		prefix:   pipeline.config.MetricNamePrefix,
+	}
+}
+
+// Describe sends nothing, the counters of the pipeline can change on reload so the collector is unchecked
+func (c *PrometheusCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics, err := c.pipeline.CollectMetrics()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewInvalidDesc(err), err)
+		return
+	}
+
+	for i, entityMetrics := range metrics {
+		for _, group := range sortMetrics(prefixMetricNames(entityMetrics, c.prefix)) {
+			for _, metric := range group.Metrics {
+				m, err := toPrometheusMetric(i, group.Counter, metric)
+				if err != nil {
+					logrus.Debugf("Skipping %s for the Prometheus collector; err: %v", group.Counter.FieldName, err)
+					continue
+				}
+
+				if m != nil {
+					ch <- m
+				}
+			}
+		}
+	}
+}
+
+// toPrometheusMetric converts a metric of the entity at index i, labels yield nil since they have no sample
+func toPrometheusMetric(i int, counter Counter, metric Metric) (prometheus.Metric, error) {
+	labels := entityLabels(i, metric)
+	for k, v := range metric.Labels {
+		labels[k] = v
+	}
+	for k, v := range metric.Attributes {
+		labels[k] = v
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	values := make([]string, len(names))
+	for j, name := range names {
+		values[j] = labels[name]
+	}
+
+	desc := prometheus.NewDesc(counter.FieldName, counter.Help, names, nil)
+
+	var res prometheus.Metric
+	switch counter.PromType {
+	case "label":
+		return nil, nil
+	case histogramType:
+		h := metric.Histogram
+		if h == nil {
+			return nil, fmt.Errorf("no distribution observed")
+		}
+
+		buckets := make(map[float64]uint64, len(h.Bounds))
+		for j, bound := range h.Bounds {
+			buckets[bound] = h.Counts[j]
+		}
+
+		m, err := prometheus.NewConstHistogram(desc, h.Count, h.Sum, buckets, values...)
+		if err != nil {
+			return nil, err
+		}
+		res = m
+	default:
+		value, err := strconv.ParseFloat(metric.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("non-numeric value '%s'", metric.Value)
+		}
+
+		m, err := prometheus.NewConstMetric(desc, prometheusValueType(counter.PromType), value, values...)
+		if err != nil {
+			return nil, err
+		}
+		res = m
+
+		if metric.Exemplar != nil && counter.PromType == "counter" {
+			res, err = withExemplar(res, metric.Exemplar)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if metric.Timestamp != "" {
+		ts, err := strconv.ParseInt(metric.Timestamp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed timestamp '%s'", metric.Timestamp)
+		}
+		res = prometheus.NewMetricWithTimestamp(time.UnixMilli(ts), res)
+	}
+
+	return res, nil
+}
+
+func prometheusValueType(promType string) prometheus.ValueType {
+	switch promType {
+	case "counter":
+		return prometheus.CounterValue
+	case "gauge":
+		return prometheus.GaugeValue
+	default:
+		return prometheus.UntypedValue
+	}
+}
+
+// withExemplar attaches the exemplar to a counter, like the OpenMetrics output
+func withExemplar(m prometheus.Metric, exemplar *Exemplar) (prometheus.Metric, error) {
+	value, err := strconv.ParseFloat(exemplar.Value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("non-numeric exemplar value '%s'", exemplar.Value)
+	}
+
+	e := prometheus.Exemplar{Value: value, Labels: exemplar.Labels}
+	if exemplar.Timestamp != "" {
+		ts, err := strconv.ParseInt(exemplar.Timestamp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed exemplar timestamp '%s'", exemplar.Timestamp)
+		}
+		e.Timestamp = time.UnixMilli(ts)
+	}
+
+	return prometheus.NewMetricWithExemplars(m, e)
+}
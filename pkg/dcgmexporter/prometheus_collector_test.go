@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	dcgmEntityGetLatestValuesHook = func(_ dcgm.Field_Entity_Group, gpu uint, _ []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		return []dcgm.FieldValue_v1{
+			{FieldId: uint(dcgm.DCGM_FI_DEV_GPU_TEMP), FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(int64(40 + gpu))},
+			{FieldId: uint(dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION), FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(1000)},
+		}, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		InfoType: dcgm.FE_GPU,
+		gOpt:     DeviceOptions{MajorRange: []int{-1}, MinorRange: []int{}},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: "GPU-0000000" + string(rune('0'+i))}
+	}
+
+	collector := &DCGMCollector{
+		Counters: []Counter{
+			{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature."},
+			{FieldID: dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", PromType: "counter", Help: "Energy."},
+		},
+		DeviceFields: []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP, dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION},
+		SysInfo:      sysInfo,
+		Hostname:     "node",
+	}
+
+	pipeline, cleanup, err := NewMetricsPipelineWithGPUCollector(&Config{
+		MetricNamePrefix: "gpu_",
+		StaticLabels:     map[string]string{"cluster": "a"},
+	}, collector)
+	require.NoError(t, err)
+	defer cleanup()
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(NewPrometheusCollector(pipeline)))
+
+	got, err := registry.Gather()
+	require.NoError(t, err)
+
+	// The families are the ones of the text output, internal metrics aside
+	text, err := pipeline.CollectOnce()
+	require.NoError(t, err)
+	want, err := new(expfmt.TextParser).TextToMetricFamilies(strings.NewReader(text))
+	require.NoError(t, err)
+
+	require.Len(t, got, 2)
+	for _, family := range got {
+		wantFamily, exists := want[family.GetName()]
+		require.True(t, exists, family.GetName())
+
+		assert.Equal(t, wantFamily.GetHelp(), family.GetHelp())
+		assert.Equal(t, wantFamily.GetType(), family.GetType())
+		require.Len(t, family.GetMetric(), 2)
+
+		for j, metric := range family.GetMetric() {
+			assert.Equal(t, labelPairs(wantFamily.GetMetric()[j]), labelPairs(metric), family.GetName())
+		}
+	}
+
+	// The families are sorted by name, the series by labels
+	assert.Equal(t, "gpu_DCGM_FI_DEV_GPU_TEMP", got[0].GetName())
+	assert.Equal(t, 41.0, got[0].GetMetric()[1].GetGauge().GetValue())
+	assert.Equal(t, 1000.0, got[1].GetMetric()[0].GetCounter().GetValue())
+}
+
+func labelPairs(metric *dto.Metric) map[string]string {
+	res := map[string]string{}
+	for _, pair := range metric.GetLabel() {
+		res[pair.GetName()] = pair.GetValue()
+	}
+
+	return res
+}
+
+func TestToPrometheusMetric(t *testing.T) {
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature."}
+	label := Counter{FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label", Help: "Driver."}
+	histogram := Counter{FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: histogramType, Help: "Clock.", Buckets: "300;600"}
+
+	m, err := toPrometheusMetric(gpuEntity, gauge, Metric{Value: "42", GPU: "0", UUID: "UUID", Timestamp: "1700000000000"})
+	require.NoError(t, err)
+	var out dto.Metric
+	require.NoError(t, m.Write(&out))
+	assert.Equal(t, 42.0, out.GetGauge().GetValue())
+	assert.Equal(t, int64(1700000000000), out.GetTimestampMs())
+
+	m, err = toPrometheusMetric(gpuEntity, label, Metric{Value: "550.54.15"})
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	_, err = toPrometheusMetric(gpuEntity, gauge, Metric{Value: "N/A"})
+	assert.Error(t, err)
+
+	m, err = toPrometheusMetric(gpuEntity, histogram, Metric{
+		GPU:       "0",
+		UUID:      "UUID",
+		Histogram: &Histogram{Bounds: []float64{300, 600}, Counts: []uint64{1, 3}, Sum: 1500, Count: 4},
+	})
+	require.NoError(t, err)
+	out.Reset()
+	require.NoError(t, m.Write(&out))
+	assert.Equal(t, uint64(4), out.GetHistogram().GetSampleCount())
+	assert.Equal(t, 1500.0, out.GetHistogram().GetSampleSum())
+	require.Len(t, out.GetHistogram().GetBucket(), 2)
+	assert.Equal(t, uint64(3), out.GetHistogram().GetBucket()[1].GetCumulativeCount())
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pushBatch holds the metrics of the entities refreshed by a collection
+type pushBatch struct {
+	entities []int
+	metrics  []MetricsByCounter // Indexed by pipeline entity
+	time     time.Time
+}
+
+// pusher sends the collected metrics to an external system
+type pusher interface {
+	push(ctx context.Context, batch pushBatch) error
+	target() string
+}
+
+// pushQueue hands the batches of the pipeline to a pusher.
+// Only the latest batch is kept while a push is in flight, so a slow endpoint never delays the collection.
+type pushQueue struct {
+	pusher  pusher
+	pending chan pushBatch
+	filter  *deltaFilter // Drops the unchanged gauges before they are pushed, nil unless Config.PushSuppressUnchanged
+}
+
+func newPushQueue(p pusher) *pushQueue {
+	return &pushQueue{
+		pusher:  p,
+		pending: make(chan pushBatch, 1),
+	}
+}
+
+// enqueue hands a batch to run, replacing the batch that is still waiting to be pushed if any
+func (q *pushQueue) enqueue(batch pushBatch) {
+	if len(batch.entities) == 0 {
+		return
+	}
+
+	select {
+	case q.pending <- batch:
+	default:
+		select {
+		case <-q.pending:
+			logrus.Warnf("Push to '%s' is falling behind; dropping the oldest unsent metrics", q.pusher.target())
+		default:
+		}
+		q.pending <- batch
+	}
+}
+
+// run pushes the enqueued batches until stop is closed
+func (q *pushQueue) run(stop chan interface{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case batch := <-q.pending:
+			var pushed map[string]pushedValue
+			if q.filter != nil {
+				batch, pushed = q.filter.filter(batch)
+			}
+
+			if err := q.pusher.push(context.Background(), batch); err != nil {
+				logrus.Errorf("Failed to push metrics to '%s'; err: %v", q.pusher.target(), err)
+				continue
+			}
+
+			if q.filter != nil {
+				q.filter.commit(pushed, batch.time)
+			}
+		}
+	}
+}
+
+// pushedValue is the last value pushed for a gauge series
+type pushedValue struct {
+	value float64
+	time  time.Time
+}
+
+// deltaFilter drops the gauges whose value is within epsilon of the value last pushed, until maxAge elapsed since that
+// push so that the series never go stale on the receiving end. The other types are always pushed. A deltaFilter
+// belongs to a single pushQueue, it isn't safe for concurrent use.
+type deltaFilter struct {
+	epsilon float64
+	maxAge  time.Duration
+	last    map[string]pushedValue // Indexed by pushSeriesKey
+}
+
+func newDeltaFilter(c *Config) *deltaFilter {
+	return &deltaFilter{
+		epsilon: c.PushSuppressEpsilon,
+		maxAge:  time.Duration(c.PushMaxSuppression) * time.Millisecond,
+		last:    map[string]pushedValue{},
+	}
+}
+
+// filter returns a copy of the batch without the unchanged gauges, and the values it holds for commit. The metrics
+// of the batch are shared with the pipeline, they are left untouched.
+func (f *deltaFilter) filter(batch pushBatch) (pushBatch, map[string]pushedValue) {
+	res := pushBatch{
+		entities: batch.entities,
+		metrics:  make([]MetricsByCounter, len(batch.metrics)),
+		time:     batch.time,
+	}
+	pushed := map[string]pushedValue{}
+
+	for _, i := range batch.entities {
+		filtered := make(MetricsByCounter, len(batch.metrics[i]))
+		for counter, metrics := range batch.metrics[i] {
+			if counter.PromType != "gauge" {
+				filtered[counter] = metrics
+				continue
+			}
+
+			var kept []Metric
+			for _, metric := range metrics {
+				value, err := strconv.ParseFloat(metric.Value, 64)
+				if err != nil {
+					kept = append(kept, metric)
+					continue
+				}
+
+				key := pushSeriesKey(i, counter, metric)
+				if last, ok := f.last[key]; ok && batch.time.Sub(last.time) < f.maxAge &&
+					math.Abs(value-last.value) <= f.epsilon {
+					continue
+				}
+
+				pushed[key] = pushedValue{value: value, time: batch.time}
+				kept = append(kept, metric)
+			}
+
+			if len(kept) > 0 {
+				filtered[counter] = kept
+			}
+		}
+
+		res.metrics[i] = filtered
+	}
+
+	return res, pushed
+}
+
+// commit records the values of a successful push, and forgets the series not pushed for maxAge. These are pushed
+// again whatever their value, which also drops the series that disappeared.
+func (f *deltaFilter) commit(pushed map[string]pushedValue, now time.Time) {
+	for key, value := range pushed {
+		f.last[key] = value
+	}
+
+	for key, value := range f.last {
+		if now.Sub(value.time) >= f.maxAge {
+			delete(f.last, key)
+		}
+	}
+}
+
+// pushSeriesKey identifies the pushed series of a metric, the maps are printed in key order
+func pushSeriesKey(i int, counter Counter, metric Metric) string {
+	return fmt.Sprint(i, counter.FieldName, entityLabels(i, metric), metric.Labels, metric.Attributes)
+}
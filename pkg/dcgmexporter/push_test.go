@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePusher struct {
+	pushed chan pushBatch
+}
+
+func (p *fakePusher) push(_ context.Context, batch pushBatch) error {
+	p.pushed <- batch
+	return nil
+}
+
+func (p *fakePusher) target() string {
+	return "fake"
+}
+
+func TestPushQueue_Enqueue(t *testing.T) {
+	q := newPushQueue(&fakePusher{})
+
+	first := pushBatch{entities: []int{gpuEntity}, time: time.UnixMilli(1)}
+	second := pushBatch{entities: []int{gpuEntity}, time: time.UnixMilli(2)}
+
+	q.enqueue(first)
+	q.enqueue(second)
+	q.enqueue(pushBatch{})
+
+	// Only the latest batch is kept while nothing consumes them
+	require.Len(t, q.pending, 1)
+	assert.Equal(t, second, <-q.pending)
+}
+
+func TestPushQueue_Run(t *testing.T) {
+	p := &fakePusher{pushed: make(chan pushBatch, 1)}
+	q := newPushQueue(p)
+
+	stop := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		q.run(stop)
+		close(done)
+	}()
+
+	batch := pushBatch{entities: []int{gpuEntity}, time: time.UnixMilli(1)}
+	q.enqueue(batch)
+
+	select {
+	case got := <-p.pushed:
+		assert.Equal(t, batch, got)
+	case <-time.After(time.Second):
+		t.Fatal("batch was not pushed")
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestDeltaFilter(t *testing.T) {
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	counter := Counter{FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", PromType: "counter"}
+
+	batchAt := func(ms int64, temp0, temp1 string) pushBatch {
+		metrics := MetricsByCounter{
+			gauge: {
+				{Counter: gauge, Value: temp0, GPU: "0", GPUUUID: "GPU-0", Attributes: map[string]string{}},
+				{Counter: gauge, Value: temp1, GPU: "1", GPUUUID: "GPU-1", Attributes: map[string]string{}},
+			},
+			counter: {{Counter: counter, Value: "1000", GPU: "0", GPUUUID: "GPU-0", Attributes: map[string]string{}}},
+		}
+		return pushBatch{entities: []int{gpuEntity}, metrics: []MetricsByCounter{metrics}, time: time.UnixMilli(ms)}
+	}
+
+	pushedGauges := func(batch pushBatch) []string {
+		var res []string
+		for _, metric := range batch.metrics[gpuEntity][gauge] {
+			res = append(res, metric.GPU+"="+metric.Value)
+		}
+		return res
+	}
+
+	f := newDeltaFilter(&Config{PushSuppressEpsilon: 0.5, PushMaxSuppression: 60000})
+
+	first := batchAt(0, "40", "50")
+	got, pushed := f.filter(first)
+	assert.Equal(t, []string{"0=40", "1=50"}, pushedGauges(got), "the first values are always pushed")
+	f.commit(pushed, got.time)
+
+	got, pushed = f.filter(batchAt(10000, "40.4", "52"))
+	assert.Equal(t, []string{"1=52"}, pushedGauges(got), "the values within epsilon are suppressed")
+	assert.Len(t, got.metrics[gpuEntity][counter], 1, "the counters are never suppressed")
+	f.commit(pushed, got.time)
+
+	got, pushed = f.filter(batchAt(60000, "40", "52"))
+	assert.Equal(t, []string{"0=40"}, pushedGauges(got), "the unchanged values are pushed again after the window")
+	f.commit(pushed, got.time)
+
+	assert.Len(t, first.metrics[gpuEntity][gauge], 2, "the batch of the pipeline must be left untouched")
+}
+
+func TestDeltaFilter_FailedPush(t *testing.T) {
+	gauge := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	batch := pushBatch{
+		entities: []int{gpuEntity},
+		metrics: []MetricsByCounter{{
+			gauge: {{Counter: gauge, Value: "40", GPU: "0", Attributes: map[string]string{}}},
+		}},
+		time: time.UnixMilli(0),
+	}
+
+	f := newDeltaFilter(&Config{PushMaxSuppression: 60000})
+
+	// The values of a failed push aren't committed, so they are sent again
+	f.filter(batch)
+	got, _ := f.filter(batch)
+	assert.Len(t, got.metrics[gpuEntity][gauge], 1)
+}
@@ -17,6 +17,7 @@
 package dcgmexporter
 
 import (
+	"slices"
 	"sync"
 
 	"golang.org/x/sync/errgroup"
@@ -24,6 +25,7 @@ import (
 
 type Registry struct {
 	collectors []Collector
+	counters   []Counter // Exporter counters of the registered collectors, see SetCounters
 	mtx        sync.RWMutex
 }
 
@@ -38,6 +40,19 @@ func (r *Registry) Register(c Collector) {
 	r.collectors = append(r.collectors, c)
 }
 
+// SetCounters records the exporter counters the registered collectors were created for, see Counters
+func (r *Registry) SetCounters(counters []Counter) {
+	r.counters = counters
+}
+
+// Counters returns the exporter counters of the registered collectors
+func (r *Registry) Counters() []Counter {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return slices.Clone(r.counters)
+}
+
 // Gather gathers metrics from all registered collectors.
 func (r *Registry) Gather() (MetricsByCounter, error) {
 	r.mtx.Lock()
@@ -84,6 +99,19 @@ func (r *Registry) Gather() (MetricsByCounter, error) {
 	return output, nil
 }
 
+// Replace swaps the registered collectors for the ones registered with next and cleans up the previous ones.
+func (r *Registry) Replace(next *Registry) {
+	r.mtx.Lock()
+	previous := r.collectors
+	r.collectors = next.collectors
+	r.counters = next.counters
+	r.mtx.Unlock()
+
+	for _, c := range previous {
+		c.Cleanup()
+	}
+}
+
 // Cleanup resources of registered collectors
 func (r *Registry) Cleanup() {
 	for _, c := range r.collectors {
@@ -106,3 +106,27 @@ func TestRegistry_Gather(t *testing.T) {
 
 	}
 }
+
+func TestRegistry_Replace(t *testing.T) {
+	previous := new(mockCollector)
+	previous.On("Cleanup").Return()
+
+	next := new(mockCollector)
+	next.On("GetMetrics").Return(MetricsByCounter{}, nil)
+
+	reg := NewRegistry()
+	reg.Register(previous)
+
+	nextReg := NewRegistry()
+	nextReg.Register(next)
+
+	reg.Replace(nextReg)
+
+	previous.AssertCalled(t, "Cleanup")
+	require.Equal(t, []Collector{next}, reg.collectors)
+
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	previous.AssertNotCalled(t, "GetMetrics")
+	next.AssertCalled(t, "GetMetrics")
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	remoteWriteContentType = "application/x-protobuf"
+	remoteWriteVersion     = "0.1.0"
+	remoteWriteUserAgent   = "dcgm-exporter"
+)
+
+// remoteWriteLabel and remoteWriteSeries mirror the prompb.Label and prompb.TimeSeries messages
+// of the Prometheus remote-write protocol, with a single sample per series.
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64 // Unix time in ms
+}
+
+// remoteWriter pushes the collected metrics to a Prometheus remote-write endpoint
+type remoteWriter struct {
+	url         string
+	username    string
+	password    string
+	bearerToken string
+	client      *http.Client
+}
+
+func newRemoteWriter(c *Config) *remoteWriter {
+	return &remoteWriter{
+		url:         c.RemoteWriteURL,
+		username:    c.RemoteWriteUsername,
+		password:    c.RemoteWritePassword,
+		bearerToken: c.RemoteWriteBearerToken,
+		client:      &http.Client{Timeout: time.Duration(c.CollectInterval) * time.Millisecond},
+	}
+}
+
+func (w *remoteWriter) target() string {
+	return w.url
+}
+
+func (w *remoteWriter) push(ctx context.Context, batch pushBatch) error {
+	var series []remoteWriteSeries
+	for _, i := range batch.entities {
+		series = append(series, toRemoteWriteSeries(i, batch.metrics[i], batch.time)...)
+	}
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	return w.write(ctx, series)
+}
+
+func (w *remoteWriter) write(ctx context.Context, series []remoteWriteSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", remoteWriteContentType)
+	req.Header.Set("User-Agent", remoteWriteUserAgent)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	} else if w.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write endpoint returned '%s': %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// encodeWriteRequest serializes the series as a prompb.WriteRequest message
+func encodeWriteRequest(series []remoteWriteSeries) []byte {
+	var req []byte
+
+	for _, s := range series {
+		var ts []byte
+
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return req
+}
+
+// toRemoteWriteSeries converts the metrics of the entity at index i into remote-write series.
+// The labels are the ones rendered by the text template of the entity, sorted by name as the protocol requires.
+// Metrics without a sample timestamp are stamped with now.
+func toRemoteWriteSeries(i int, metrics MetricsByCounter, now time.Time) []remoteWriteSeries {
+	var res []remoteWriteSeries
+
+	for counter, values := range metrics {
+		for _, metric := range values {
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				logrus.Debugf("Skipping non-numeric value '%s' of %s for remote write", metric.Value, counter.FieldName)
+				continue
+			}
+
+			timestamp := now.UnixMilli()
+			if metric.Timestamp != "" {
+				if ts, err := strconv.ParseInt(metric.Timestamp, 10, 64); err == nil {
+					timestamp = ts
+				}
+			}
+
+			labels := map[string]string{"__name__": counter.FieldName}
+			for k, v := range entityLabels(i, metric) {
+				labels[k] = v
+			}
+			for k, v := range metric.Labels {
+				labels[k] = v
+			}
+			for k, v := range metric.Attributes {
+				labels[k] = v
+			}
+
+			series := remoteWriteSeries{value: value, timestamp: timestamp}
+			for k, v := range labels {
+				series.labels = append(series.labels, remoteWriteLabel{name: k, value: v})
+			}
+			sort.Slice(series.labels, func(a, b int) bool {
+				return series.labels[a].name < series.labels[b].name
+			})
+
+			res = append(res, series)
+		}
+	}
+
+	return res
+}
+
+// entityLabels returns the identifying labels that the template of the entity at index i renders for a metric
+func entityLabels(i int, metric Metric) map[string]string {
+	labels := map[string]string{}
+
+	switch PipelineEntities[i] {
+	case "gpu":
+		labels["gpu"] = metric.GPU
+		labels[metric.UUID] = metric.GPUUUID
+		labels["pci_bus_id"] = metric.GPUPCIBusID
+		if metric.GPUNUMANode != "" {
+			labels["numa_node"] = metric.GPUNUMANode
+		}
+		labels["device"] = metric.GPUDevice
+		labels["modelName"] = metric.GPUModelName
+		if metric.GPUDriverVersion != "" {
+			labels["driver_version"] = metric.GPUDriverVersion
+		}
+		if metric.GPUVBIOSVersion != "" {
+			labels["vbios_version"] = metric.GPUVBIOSVersion
+		}
+		if metric.GPUCPUAffinity != "" {
+			labels["cpu_affinity"] = metric.GPUCPUAffinity
+		}
+		if metric.MigProfile != "" {
+			labels["GPU_I_PROFILE"] = metric.MigProfile
+			labels["GPU_I_ID"] = metric.GPUInstanceID
+			if metric.GPUInstanceMemoryMB != "" {
+				labels["GPU_I_MEM_MB"] = metric.GPUInstanceMemoryMB
+			}
+			if metric.GPUComputeInstanceID != "" {
+				labels["GPU_CI_ID"] = metric.GPUComputeInstanceID
+			}
+		}
+		if metric.VGPUInstance != "" {
+			labels["vgpu_instance"] = metric.VGPUInstance
+		}
+	case "switch":
+		labels["nvswitch"] = metric.GPU
+		if metric.SwitchPhysID != "" {
+			labels["nvswitch_phys_id"] = metric.SwitchPhysID
+		}
+	case "link":
+		labels["nvlink"] = metric.GPU
+		labels["nvswitch"] = metric.GPUDevice
+		if metric.SwitchPhysID != "" {
+			labels["nvswitch_phys_id"] = metric.SwitchPhysID
+		}
+	case "cpu":
+		labels["cpu"] = metric.GPU
+	case "core":
+		labels["cpucore"] = metric.GPU
+		labels["cpu"] = metric.GPUDevice
+	}
+
+	if metric.Hostname != "" {
+		labels["Hostname"] = metric.Hostname
+	}
+
+	return labels
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest parses a prompb.WriteRequest message produced by encodeWriteRequest
+func decodeWriteRequest(t *testing.T, b []byte) []remoteWriteSeries {
+	t.Helper()
+
+	// fields calls fn with the number and raw value of every field of a message
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			require.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, typ, b[:n])
+			b = b[n:]
+		}
+	}
+
+	bytesValue := func(v []byte) []byte {
+		res, n := protowire.ConsumeBytes(v)
+		require.GreaterOrEqual(t, n, 0)
+		return res
+	}
+
+	var res []remoteWriteSeries
+	fields(b, func(_ protowire.Number, _ protowire.Type, v []byte) {
+		var series remoteWriteSeries
+		fields(bytesValue(v), func(num protowire.Number, _ protowire.Type, v []byte) {
+			switch num {
+			case 1:
+				var label remoteWriteLabel
+				fields(bytesValue(v), func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == 1 {
+						label.name = string(bytesValue(v))
+					} else {
+						label.value = string(bytesValue(v))
+					}
+				})
+				series.labels = append(series.labels, label)
+			case 2:
+				fields(bytesValue(v), func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == 1 {
+						bits, _ := protowire.ConsumeFixed64(v)
+						series.value = math.Float64frombits(bits)
+					} else {
+						ts, _ := protowire.ConsumeVarint(v)
+						series.timestamp = int64(ts)
+					}
+				})
+			}
+		})
+		res = append(res, series)
+	})
+
+	return res
+}
+
+func TestToRemoteWriteSeries(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	metrics := MetricsByCounter{
+		counter: {
+			{
+				Counter:      counter,
+				Value:        "42",
+				UUID:         "UUID",
+				GPU:          "0",
+				GPUUUID:      "GPU-0",
+				GPUDevice:    "nvidia0",
+				GPUModelName: "NVIDIA T400 4GB",
+				GPUPCIBusID:  "00000000:0000:0000.0",
+				Hostname:     "local-test",
+				Labels:       map[string]string{"cluster": "prod"},
+				Attributes:   map[string]string{podAttribute: "pod-a"},
+			},
+			{
+				Counter:   counter,
+				Value:     "43",
+				UUID:      "UUID",
+				GPU:       "1",
+				Timestamp: "1600000000000",
+			},
+			{
+				Counter: counter,
+				Value:   "N/A",
+			},
+		},
+	}
+
+	series := toRemoteWriteSeries(gpuEntity, metrics, now)
+	require.Len(t, series, 2)
+
+	assert.Equal(t, remoteWriteSeries{
+		labels: []remoteWriteLabel{
+			{name: "Hostname", value: "local-test"},
+			{name: "UUID", value: "GPU-0"},
+			{name: "__name__", value: "DCGM_FI_DEV_GPU_TEMP"},
+			{name: "cluster", value: "prod"},
+			{name: "device", value: "nvidia0"},
+			{name: "gpu", value: "0"},
+			{name: "modelName", value: "NVIDIA T400 4GB"},
+			{name: "pci_bus_id", value: "00000000:0000:0000.0"},
+			{name: podAttribute, value: "pod-a"},
+		},
+		value:     42,
+		timestamp: now.UnixMilli(),
+	}, series[0])
+
+	// The sample timestamp is kept when it is exported
+	assert.Equal(t, float64(43), series[1].value)
+	assert.Equal(t, int64(1600000000000), series[1].timestamp)
+}
+
+func TestRemoteWriter_Push(t *testing.T) {
+	series := []remoteWriteSeries{
+		{
+			labels:    []remoteWriteLabel{{name: "__name__", value: "DCGM_FI_DEV_GPU_TEMP"}, {name: "gpu", value: "0"}},
+			value:     42.5,
+			timestamp: 1700000000000,
+		},
+		{
+			labels:    []remoteWriteLabel{{name: "__name__", value: "DCGM_FI_DEV_GPU_TEMP"}, {name: "gpu", value: "1"}},
+			value:     43,
+			timestamp: 1700000000000,
+		},
+	}
+
+	tests := []struct {
+		name          string
+		config        Config
+		authorization string
+		status        int
+		wantErr       bool
+	}{
+		{
+			name:   "When no authentication is configured",
+			status: http.StatusNoContent,
+		},
+		{
+			name:          "When basic authentication is configured",
+			config:        Config{RemoteWriteUsername: "user", RemoteWritePassword: "pass"},
+			authorization: "Basic dXNlcjpwYXNz",
+			status:        http.StatusOK,
+		},
+		{
+			name:          "When a bearer token is configured",
+			config:        Config{RemoteWriteBearerToken: "token"},
+			authorization: "Bearer token",
+			status:        http.StatusOK,
+		},
+		{
+			name:    "When the endpoint rejects the request",
+			status:  http.StatusBadRequest,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []remoteWriteSeries
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+				assert.Equal(t, remoteWriteContentType, r.Header.Get("Content-Type"))
+				assert.Equal(t, remoteWriteVersion, r.Header.Get("X-Prometheus-Remote-Write-Version"))
+				assert.Equal(t, tt.authorization, r.Header.Get("Authorization"))
+
+				compressed, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				body, err := snappy.Decode(nil, compressed)
+				require.NoError(t, err)
+				got = decodeWriteRequest(t, body)
+
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			config := tt.config
+			config.RemoteWriteURL = server.URL
+			config.CollectInterval = 1000
+
+			err := newRemoteWriter(&config).write(context.Background(), series)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, series, got)
+		})
+	}
+}
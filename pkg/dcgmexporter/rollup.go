@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// Rollups are node-level gauges derived from the GPU metrics of a collection, see Config.EnableRollups. They aren't
+// DCGM fields, their FieldID is the one of the field they are derived from.
+var (
+	gpuUtilizationMeanCounter = Counter{
+		FieldID:   dcgm.DCGM_FI_DEV_GPU_UTIL,
+		FieldName: "dcgm_node_gpu_utilization_mean",
+		PromType:  "gauge",
+		Help:      "Mean utilization of the GPUs of the node (in %), derived by dcgm-exporter from DCGM_FI_DEV_GPU_UTIL.",
+	}
+	gpuUtilizationMaxCounter = Counter{
+		FieldID:   dcgm.DCGM_FI_DEV_GPU_UTIL,
+		FieldName: "dcgm_node_gpu_utilization_max",
+		PromType:  "gauge",
+		Help:      "Utilization of the busiest GPU of the node (in %), derived by dcgm-exporter from DCGM_FI_DEV_GPU_UTIL.",
+	}
+	gpuUtilizationSumCounter = Counter{
+		FieldID:   dcgm.DCGM_FI_DEV_GPU_UTIL,
+		FieldName: "dcgm_node_gpu_utilization_sum",
+		PromType:  "gauge",
+		Help:      "Sum of the utilization of the GPUs of the node (in %), derived by dcgm-exporter from DCGM_FI_DEV_GPU_UTIL.",
+	}
+	fbUsedSumCounter = Counter{
+		FieldID:   dcgm.DCGM_FI_DEV_FB_USED,
+		FieldName: "dcgm_node_fb_used",
+		PromType:  "gauge",
+		Help:      "Framebuffer memory used by the GPUs of the node (in MiB), derived by dcgm-exporter from DCGM_FI_DEV_FB_USED.",
+	}
+)
+
+// rollupMetrics derives the rollups from the GPU metrics. Only the gauges of whole GPUs are aggregated, each GPU
+// once, and the rollups of a field are skipped when no GPU reported it. The rollups are labeled with the hostname
+// of the GPU metrics only.
+func rollupMetrics(metrics MetricsByCounter) MetricsByCounter {
+	utilization := gpuValues(metrics, dcgm.DCGM_FI_DEV_GPU_UTIL)
+	fbUsed := gpuValues(metrics, dcgm.DCGM_FI_DEV_FB_USED)
+
+	hostname := ""
+	for _, values := range metrics {
+		if len(values) > 0 {
+			hostname = values[0].Hostname
+			break
+		}
+	}
+
+	res := MetricsByCounter{}
+	add := func(counter Counter, value float64) {
+		attributes := map[string]string{}
+		if hostname != "" {
+			attributes["Hostname"] = hostname
+		}
+
+		res[counter] = []Metric{{
+			Counter:    counter,
+			Value:      strconv.FormatFloat(value, 'f', -1, 64),
+			Labels:     map[string]string{},
+			Attributes: attributes,
+		}}
+	}
+
+	if len(utilization) > 0 {
+		sum, maxValue := 0.0, math.Inf(-1)
+		for _, v := range utilization {
+			sum += v
+			maxValue = max(maxValue, v)
+		}
+
+		add(gpuUtilizationMeanCounter, sum/float64(len(utilization)))
+		add(gpuUtilizationMaxCounter, maxValue)
+		add(gpuUtilizationSumCounter, sum)
+	}
+
+	if len(fbUsed) > 0 {
+		sum := 0.0
+		for _, v := range fbUsed {
+			sum += v
+		}
+
+		add(fbUsedSumCounter, sum)
+	}
+
+	return res
+}
+
+// gpuValues returns the values of the field by GPU UUID. The metrics of the GPU instances, the counters that aren't
+// gauges and the values that aren't numbers are left out.
+func gpuValues(metrics MetricsByCounter, fieldID dcgm.Short) map[string]float64 {
+	res := map[string]float64{}
+	for counter, values := range metrics {
+		if counter.FieldID != fieldID || counter.PromType != "gauge" {
+			continue
+		}
+
+		for _, metric := range values {
+			if metric.GPUInstanceID != "" {
+				continue
+			}
+
+			if _, exists := res[metric.GPUUUID]; exists {
+				continue
+			}
+
+			v, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil || math.IsNaN(v) {
+				continue
+			}
+
+			res[metric.GPUUUID] = v
+		}
+	}
+
+	return res
+}
+
+// collectRollups derives the rollups from the GPU metrics, which already carry the static and remapped labels,
+// and formats them, callers must hold mtx
+func (m *MetricsPipeline) collectRollups(metrics MetricsByCounter) (MetricsByCounter, string, error) {
+	rollups := rollupMetrics(metrics)
+	if len(rollups) == 0 {
+		return rollups, "", nil
+	}
+
+	m.remapLabels(rollups)
+	m.addStaticLabels(rollups)
+	sanitizeLabelNames(rollups)
+
+	prefixed := prefixMetricNames(rollups, m.config.MetricNamePrefix)
+
+	var formatted string
+	var err error
+	if m.config.Format == FormatJSON {
+		formatted, err = FormatMetricsJSON(prefixed)
+	} else {
+		formatted, err = FormatMetrics(internalMetricsTemplate, prefixed)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to format rollups; err: %w", err)
+	}
+
+	return rollups, formatted, nil
+}
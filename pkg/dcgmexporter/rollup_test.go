@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollupMetrics(t *testing.T) {
+	utilCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	fbCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_FB_USED, FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge"}
+
+	gpuMetric := func(counter Counter, uuid, value string) Metric {
+		return Metric{Counter: counter, GPUUUID: uuid, Value: value, Hostname: "node-1"}
+	}
+
+	tests := []struct {
+		name    string
+		metrics MetricsByCounter
+		want    map[string]string
+	}{
+		{
+			name:    "When no GPU reports the fields, no rollup is derived",
+			metrics: MetricsByCounter{},
+			want:    map[string]string{},
+		},
+		{
+			name: "When the GPUs report the fields, the rollups are derived",
+			metrics: MetricsByCounter{
+				utilCounter: {gpuMetric(utilCounter, "GPU-0", "20"), gpuMetric(utilCounter, "GPU-1", "70")},
+				fbCounter:   {gpuMetric(fbCounter, "GPU-0", "1024"), gpuMetric(fbCounter, "GPU-1", "512")},
+			},
+			want: map[string]string{
+				"dcgm_node_gpu_utilization_mean": "45",
+				"dcgm_node_gpu_utilization_max":  "70",
+				"dcgm_node_gpu_utilization_sum":  "90",
+				"dcgm_node_fb_used":              "1536",
+			},
+		},
+		{
+			name: "When the GPU instances report the fields, they are not counted twice",
+			metrics: MetricsByCounter{
+				fbCounter: {
+					gpuMetric(fbCounter, "GPU-0", "1024"),
+					{Counter: fbCounter, GPUUUID: "GPU-0", GPUInstanceID: "1", Value: "256"},
+				},
+			},
+			want: map[string]string{"dcgm_node_fb_used": "1024"},
+		},
+		{
+			name: "When a GPU has no value, it is left out",
+			metrics: MetricsByCounter{
+				utilCounter: {gpuMetric(utilCounter, "GPU-0", "NaN"), gpuMetric(utilCounter, "GPU-1", "30")},
+			},
+			want: map[string]string{
+				"dcgm_node_gpu_utilization_mean": "30",
+				"dcgm_node_gpu_utilization_max":  "30",
+				"dcgm_node_gpu_utilization_sum":  "30",
+			},
+		},
+		{
+			name: "When the field is exported as a histogram, it is left out",
+			metrics: MetricsByCounter{
+				{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "histogram"}: {
+					gpuMetric(utilCounter, "GPU-0", "20"),
+				},
+			},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := map[string]string{}
+			for counter, metrics := range rollupMetrics(tc.metrics) {
+				require.Len(t, metrics, 1)
+				assert.Equal(t, "node-1", metrics[0].Attributes["Hostname"])
+				got[counter.FieldName] = metrics[0].Value
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestCollectRollups(t *testing.T) {
+	fbCounter := Counter{FieldID: dcgm.DCGM_FI_DEV_FB_USED, FieldName: "DCGM_FI_DEV_FB_USED", PromType: "gauge"}
+	metrics := MetricsByCounter{
+		fbCounter: {{Counter: fbCounter, GPUUUID: "GPU-0", Value: "1024", Hostname: "node-1"}},
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+		want   string
+	}{
+		{
+			name:   "When the format is Prometheus, the rollups are labeled with the hostname and static labels",
+			config: &Config{StaticLabels: map[string]string{"cluster": "a"}},
+			want: `# HELP dcgm_node_fb_used Framebuffer memory used by the GPUs of the node (in MiB), derived by dcgm-exporter from DCGM_FI_DEV_FB_USED.
+# TYPE dcgm_node_fb_used gauge
+dcgm_node_fb_used{Hostname="node-1",cluster="a"} 1024
+`,
+		},
+		{
+			name:   "When a metric name prefix is set, the rollups are prefixed",
+			config: &Config{MetricNamePrefix: "site_"},
+			want: `# HELP site_dcgm_node_fb_used Framebuffer memory used by the GPUs of the node (in MiB), derived by dcgm-exporter from DCGM_FI_DEV_FB_USED.
+# TYPE site_dcgm_node_fb_used gauge
+site_dcgm_node_fb_used{Hostname="node-1"} 1024
+`,
+		},
+		{
+			name:   "When the format is JSON, a JSON array is emitted",
+			config: &Config{Format: FormatJSON},
+			want:   `[{"name":"dcgm_node_fb_used","value":1024,"gpu":"","attributes":{"Hostname":"node-1"}}]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &MetricsPipeline{config: tc.config}
+
+			rollups, formatted, err := p.collectRollups(metrics)
+			require.NoError(t, err)
+			assert.Len(t, rollups, 1)
+			assert.Equal(t, tc.want, formatted)
+		})
+	}
+}
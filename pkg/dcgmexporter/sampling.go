@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+const aggregationSeparator = ";"
+
+// aggregations are the statistics of the samples a counter can export, each as a `_<aggregation>` gauge
+var aggregations = []string{"min", "avg", "max"}
+
+// aggregationHelp prefixes the help of the gauges of the aggregations
+var aggregationHelp = map[string]string{
+	"min": "Minimum",
+	"avg": "Average",
+	"max": "Maximum",
+}
+
+// dcgmGetValuesSinceHook returns the samples of the fields of the group taken since the given time, and the time to
+// read the next samples from
+var dcgmGetValuesSinceHook = dcgm.GetValuesSince
+
+// samplingWatch watches the fields of the sampled counters at Config.SamplingInterval and keeps their samples until
+// the next collection
+type samplingWatch struct {
+	group      dcgm.GroupHandle
+	fieldGroup dcgm.FieldHandle
+	since      time.Time // Time of the first sample not read yet
+}
+
+// parseAggregations parses the ';' separated statistics of the samples of a counter
+func parseAggregations(spec string) ([]string, error) {
+	var res []string
+
+	for _, s := range strings.Split(spec, aggregationSeparator) {
+		aggregation := strings.TrimSpace(s)
+		if !slices.Contains(aggregations, aggregation) {
+			return nil, fmt.Errorf("invalid aggregation '%s', expected one of %s", s,
+				strings.Join(aggregations, ", "))
+		}
+
+		if slices.Contains(res, aggregation) {
+			return nil, fmt.Errorf("aggregation '%s' is repeated", aggregation)
+		}
+
+		res = append(res, aggregation)
+	}
+
+	return res, nil
+}
+
+// validateAggregations checks that the aggregations of the counter are valid, only gauges can be sampled
+func validateAggregations(fieldName, promType, spec string) error {
+	if spec == "" {
+		return nil
+	}
+
+	if promType != "gauge" {
+		return fmt.Errorf("counter '%s' has aggregations but is of type '%s', expected gauge", fieldName, promType)
+	}
+
+	if _, err := parseAggregations(spec); err != nil {
+		return fmt.Errorf("counter '%s' has malformed aggregations; err: %w", fieldName, err)
+	}
+
+	return nil
+}
+
+// aggregationCounter returns the gauge of the aggregation of the samples of the counter
+func aggregationCounter(counter Counter, aggregation string) Counter {
+	return Counter{
+		FieldID:   counter.FieldID,
+		FieldName: counter.FieldName + "_" + aggregation,
+		PromType:  "gauge",
+		Help:      fmt.Sprintf("%s over the collect interval of: %s", aggregationHelp[aggregation], counter.Help),
+	}
+}
+
+// sampledFields returns the device fields of the counters with aggregations
+func sampledFields(counters []Counter, deviceFields []dcgm.Short) []dcgm.Short {
+	var res []dcgm.Short
+	for _, counter := range counters {
+		if counter.Aggregations != "" && slices.Contains(deviceFields, counter.FieldID) &&
+			!slices.Contains(res, counter.FieldID) {
+			res = append(res, counter.FieldID)
+		}
+	}
+
+	return res
+}
+
+// watchSampledFields watches the fields on the monitored entities, keeping every sample taken over twice the collect
+// interval so that none is discarded before the next collection reads it
+func watchSampledFields(fields []dcgm.Short, sysInfo SystemInfo, config *Config) (*samplingWatch, []func(), error) {
+	var cleanups []func()
+
+	group, cleanup, err := createGroupFromMonitoringInfo(GetMonitoredEntities(sysInfo))
+	cleanups = append(cleanups, cleanup)
+	if err != nil {
+		return nil, cleanups, err
+	}
+
+	fieldGroup, cleanup, err := NewFieldGroup(fields)
+	if err != nil {
+		return nil, cleanups, err
+	}
+	cleanups = append(cleanups, cleanup)
+
+	maxKeepAge := 2 * float64(collectInterval(config, sysInfo.InfoType)) / 1000
+	err = WatchFieldGroup(group, fieldGroup, int64(config.SamplingInterval)*1000, maxKeepAge, 0)
+	if err != nil {
+		return nil, cleanups, err
+	}
+
+	return &samplingWatch{group: group, fieldGroup: fieldGroup, since: time.Now()}, cleanups, nil
+}
+
+// sampleKey identifies the samples of a field of an entity
+func sampleKey(entityGroup dcgm.Field_Entity_Group, entityID uint, fieldID uint) string {
+	return fmt.Sprintf("%d/%d/%d", entityGroup, entityID, fieldID)
+}
+
+// readSamples returns the values of the samples taken since the previous collection by sampleKey. The aggregations
+// fall back to the latest values when they can't be read.
+func (c *DCGMCollector) readSamples() map[string][]float64 {
+	values, next, err := dcgmGetValuesSinceHook(c.sampling.group, c.sampling.fieldGroup, c.sampling.since)
+	if err != nil {
+		logrus.Warnf("Failed to read the samples of the sampled counters; err: %v", err)
+		return nil
+	}
+	c.sampling.since = next
+
+	samples := map[string][]float64{}
+	for _, val := range values {
+		v1 := dcgm.FieldValue_v1{FieldId: val.FieldId, FieldType: val.FieldType, Status: val.Status, Ts: val.Ts,
+			Value: val.Value}
+		if v1.Status != 0 || isBlank(v1) {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(ToString(v1), 64)
+		if err != nil {
+			continue
+		}
+
+		key := sampleKey(val.EntityGroupId, val.EntityId, val.FieldId)
+		samples[key] = append(samples[key], v)
+	}
+
+	return samples
+}
+
+// sampledCounts returns the number of metrics of each sampled counter, so the ones collected next are told apart
+func (c *DCGMCollector) sampledCounts(metrics MetricsByCounter) map[Counter]int {
+	if c.sampling == nil {
+		return nil
+	}
+
+	counts := map[Counter]int{}
+	for _, counter := range c.Counters {
+		if counter.Aggregations != "" {
+			counts[counter] = len(metrics[counter])
+		}
+	}
+
+	return counts
+}
+
+// appendAggregations adds the aggregations of the samples of the entity to the metrics, as copies of the metrics of
+// the sampled counters collected since counts. When DCGM took no sample since the previous collection, the
+// aggregations are those of the latest value.
+func (c *DCGMCollector) appendAggregations(metrics MetricsByCounter, counts map[Counter]int, entity dcgm.GroupEntityPair,
+	samples map[string][]float64,
+) {
+	for counter, count := range counts {
+		// The aggregations were validated when the counters were parsed
+		names, _ := parseAggregations(counter.Aggregations)
+
+		for _, source := range metrics[counter][count:] {
+			values := samples[sampleKey(entity.EntityGroupId, entity.EntityId, uint(counter.FieldID))]
+			if counter.Scale != 0 {
+				values = slices.Clone(values)
+				for i := range values {
+					values[i] *= counter.Scale
+				}
+			}
+
+			if len(values) == 0 {
+				latest, err := strconv.ParseFloat(source.Value, 64)
+				if err != nil {
+					continue
+				}
+				values = []float64{latest}
+			}
+
+			for _, name := range names {
+				derived := source
+				derived.Labels = maps.Clone(source.Labels)
+				derived.Attributes = maps.Clone(source.Attributes)
+				derived.Counter = aggregationCounter(counter, name)
+				derived.Value = strconv.FormatFloat(aggregate(values, name), 'f', -1, 64)
+				metrics[derived.Counter] = append(metrics[derived.Counter], derived)
+			}
+		}
+	}
+}
+
+// aggregate returns the aggregation of the values, which aren't empty
+func aggregate(values []float64, aggregation string) float64 {
+	switch aggregation {
+	case "min":
+		return slices.Min(values)
+	case "max":
+		return slices.Max(values)
+	default:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
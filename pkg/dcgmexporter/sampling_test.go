@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAggregations(t *testing.T) {
+	tests := []struct {
+		name     string
+		promType string
+		spec     string
+		wantErr  bool
+	}{
+		{name: "When the counter has no aggregation", promType: "counter", spec: ""},
+		{name: "When the aggregations are valid", promType: "gauge", spec: "min;avg;max"},
+		{name: "When the aggregations are spaced", promType: "gauge", spec: "max; min"},
+		{name: "When an aggregation is unknown", promType: "gauge", spec: "min;p99", wantErr: true},
+		{name: "When an aggregation is repeated", promType: "gauge", spec: "max;max", wantErr: true},
+		{name: "When the aggregations are empty", promType: "gauge", spec: ";", wantErr: true},
+		{name: "When the counter is not a gauge", promType: "counter", spec: "max", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAggregations("DCGM_FI_DEV_GPU_UTIL", tt.promType, tt.spec)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestExtractCountersAggregations(t *testing.T) {
+	records := [][]string{{"DCGM_FI_DEV_GPU_UTIL", "gauge", "GPU utilization (in %).", "", "", "", "", "min;avg;max"}}
+
+	counters, err := extractCounters(records, nil, &Config{})
+	require.NoError(t, err)
+	require.Len(t, counters.DCGMCounters, 1)
+	assert.Equal(t, "min;avg;max", counters.DCGMCounters[0].Aggregations)
+
+	records = [][]string{{"DCGM_EXP_XID_ERRORS_COUNT", "gauge", "xid", "", "", "", "", "max"}}
+	_, err = extractCounters(records, nil, &Config{})
+	require.ErrorContains(t, err, "cannot be sampled")
+}
+
+func TestAppendAggregationsClonesLabels(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge",
+		Aggregations: "min;max"}
+	metrics := MetricsByCounter{counter: {{
+		Counter:    counter,
+		Value:      "50",
+		Labels:     map[string]string{"DCGM_FI_DRIVER_VERSION": "550.54.15"},
+		Attributes: map[string]string{"pod": "gpu-pod"},
+	}}}
+
+	c := &DCGMCollector{}
+	c.appendAggregations(metrics, map[Counter]int{counter: 0}, dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU}, nil)
+
+	// Transformations update the labels of each series in place, the derived series must not share them
+	minimum := metrics[aggregationCounter(counter, "min")]
+	require.Len(t, minimum, 1)
+	minimum[0].Labels["DCGM_FI_DRIVER_VERSION"] = "changed"
+	minimum[0].Attributes["pod"] = "changed"
+
+	assert.Equal(t, "550.54.15", metrics[counter][0].Labels["DCGM_FI_DRIVER_VERSION"])
+	assert.Equal(t, "gpu-pod", metrics[counter][0].Attributes["pod"])
+	assert.Equal(t, "550.54.15", metrics[aggregationCounter(counter, "max")][0].Labels["DCGM_FI_DRIVER_VERSION"])
+}
+
+func TestGPUCollector_GetMetricsAggregations(t *testing.T) {
+	sample := func(gpu uint, v int64) dcgm.FieldValue_v2 {
+		return dcgm.FieldValue_v2{
+			EntityGroupId: dcgm.FE_GPU,
+			EntityId:      gpu,
+			FieldId:       dcgm.DCGM_FI_DEV_GPU_UTIL,
+			FieldType:     dcgm.DCGM_FT_INT64,
+			Value:         int64FieldValue(v),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		samples []dcgm.FieldValue_v2
+		scale   float64
+		want    map[string]string
+	}{
+		{
+			name: "When DCGM took several samples, they are aggregated",
+			samples: []dcgm.FieldValue_v2{
+				sample(0, 20), sample(0, 80), sample(0, dcgm.DCGM_FT_INT32_BLANK), sample(1, 100), sample(0, 50),
+			},
+			want: map[string]string{"min": "20", "avg": "50", "max": "80"},
+		},
+		{
+			name:    "When the counter is scaled, so are the samples",
+			samples: []dcgm.FieldValue_v2{sample(0, 20), sample(0, 80)},
+			scale:   0.01,
+			want:    map[string]string{"min": "0.2", "avg": "0.5", "max": "0.8"},
+		},
+		{
+			name: "When DCGM took no sample, the latest value is aggregated",
+			want: map[string]string{"min": "50", "avg": "50", "max": "50"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := time.Unix(1700000000, 0)
+			dcgmGetValuesSinceHook = func(dcgm.GroupHandle, dcgm.FieldHandle, time.Time) ([]dcgm.FieldValue_v2, time.Time, error) {
+				return tt.samples, next, nil
+			}
+			defer func() {
+				dcgmGetValuesSinceHook = dcgm.GetValuesSince
+			}()
+
+			counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge",
+				Help: "GPU utilization (in %).", Scale: tt.scale, Aggregations: "min;avg;max"}
+			c := testGPUCollectorWithValues(t, []Counter{counter},
+				dcgm.FieldValue_v1{FieldId: dcgm.DCGM_FI_DEV_GPU_UTIL, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(50)},
+			)
+			c.sampling = &samplingWatch{}
+
+			metrics, err := c.GetMetrics()
+			require.NoError(t, err)
+			require.Len(t, metrics[counter], 1)
+
+			for aggregation, want := range tt.want {
+				derived := aggregationCounter(counter, aggregation)
+				require.Len(t, metrics[derived], 1, aggregation)
+				assert.Equal(t, "DCGM_FI_DEV_GPU_UTIL_"+aggregation, derived.FieldName)
+				assert.Equal(t, want, metrics[derived][0].Value, aggregation)
+				assert.Equal(t, "GPU-00000000", metrics[derived][0].GPUUUID)
+			}
+			assert.Equal(t, next, c.sampling.since)
+		})
+	}
+}
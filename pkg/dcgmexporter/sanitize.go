@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+)
+
+// templateFuncs are the functions available to the metric templates
+var templateFuncs = template.FuncMap{
+	"escape": escapeLabelValue,
+}
+
+// labelValueEscaper escapes the characters that the Prometheus text format doesn't allow as is in label values
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes the backslashes, double quotes and line feeds of a label value, the other characters
+// are valid UTF-8 in the text format and are kept as is
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// sanitizeLabelName rewrites the characters that aren't valid in a Prometheus label name to '_', and prepends '_'
+// to a name starting with a digit
+func sanitizeLabelName(name string) string {
+	if labelNameRegex.MatchString(name) {
+		return name
+	}
+
+	sanitized := []byte(name)
+	for i, c := range sanitized {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			sanitized[i] = '_'
+		}
+	}
+
+	if len(sanitized) == 0 || sanitized[0] >= '0' && sanitized[0] <= '9' {
+		return "_" + string(sanitized)
+	}
+
+	return string(sanitized)
+}
+
+// sanitizeLabelNames rewrites the names of the labels and attributes of every metric into valid Prometheus label
+// names, so a single bad name doesn't break the whole exposition. A label keeps its value when a sanitized name
+// collides with it.
+func sanitizeLabelNames(metrics MetricsByCounter) {
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			metrics[counter][j].Labels = sanitizeLabels(metrics[counter][j].Labels)
+			metrics[counter][j].Attributes = sanitizeLabels(metrics[counter][j].Attributes)
+		}
+	}
+}
+
+// sanitizeLabels returns the labels with sanitized names, as a copy when a name is rewritten since the collectors
+// share label maps between metrics
+func sanitizeLabels(labels map[string]string) map[string]string {
+	valid := true
+	for name := range labels {
+		if !labelNameRegex.MatchString(name) {
+			valid = false
+			break
+		}
+	}
+
+	if valid {
+		return labels
+	}
+
+	res := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if labelNameRegex.MatchString(name) {
+			res[name] = value
+		}
+	}
+
+	for name, value := range labels {
+		sanitized := sanitizeLabelName(name)
+		if sanitized == name {
+			continue
+		}
+
+		if _, exists := res[sanitized]; exists {
+			logrus.Debugf("Dropping label '%s', its sanitized name '%s' is already used", name, sanitized)
+			continue
+		}
+
+		res[sanitized] = value
+	}
+
+	return res
+}
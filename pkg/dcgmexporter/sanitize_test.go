@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		name  string
+		label string
+		want  string
+	}{
+		{
+			name:  "When the name is valid, it is kept",
+			label: "pod_name",
+			want:  "pod_name",
+		},
+		{
+			name:  "When the name has invalid characters, they are replaced",
+			label: "app.kubernetes.io/name",
+			want:  "app_kubernetes_io_name",
+		},
+		{
+			name:  "When the name starts with a digit, it is prefixed",
+			label: "1st-gpu",
+			want:  "_1st_gpu",
+		},
+		{
+			name:  "When the name is empty, it is replaced",
+			label: "",
+			want:  "_",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, sanitizeLabelName(tc.label))
+		})
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `a \"quoted\" C:\\path\nnext`, escapeLabelValue("a \"quoted\" C:\\path\nnext"))
+	assert.Equal(t, "pod-7f9c-ü", escapeLabelValue("pod-7f9c-ü"))
+}
+
+func TestSanitizeLabelNames(t *testing.T) {
+	shared := map[string]string{"team.name": "ml", "team_name": "infra", "valid": "yes"}
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+
+	metrics := MetricsByCounter{
+		counter: {
+			{GPU: "0", Value: "42", Labels: shared, Attributes: map[string]string{"pod": "p\"0\""}},
+		},
+	}
+
+	sanitizeLabelNames(metrics)
+
+	// The valid name keeps its value on a collision, and the shared map is left untouched
+	assert.Equal(t, map[string]string{"team_name": "infra", "valid": "yes"}, metrics[counter][0].Labels)
+	assert.Len(t, shared, 3)
+
+	out, err := FormatMetrics(migMetricsTemplate, metrics)
+	require.NoError(t, err)
+	assert.Contains(t, out, `team_name="infra"`)
+	assert.Contains(t, out, `pod="p\"0\""`)
+}
+
+func TestFormatMetrics_AdversarialLabelValues(t *testing.T) {
+	const adversarial = "a \"quoted\" C:\\path\\\nnext}, x=\"y"
+
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metric := Metric{
+		Counter:          counter,
+		Value:            "42",
+		GPU:              "0",
+		GPUUUID:          "GPU-" + adversarial,
+		UUID:             "UUID",
+		GPUDevice:        "nvidia0",
+		GPUModelName:     adversarial,
+		GPUPCIBusID:      "00000000:07:00.0",
+		GPUDriverVersion: adversarial,
+		GPUVBIOSVersion:  adversarial,
+		MigProfile:       adversarial,
+		GPUInstanceID:    "1",
+		VGPUInstance:     "3",
+		Hostname:         adversarial,
+		Labels:           map[string]string{"team": adversarial},
+		Attributes:       map[string]string{"pod": adversarial},
+	}
+
+	templates := map[string]*template.Template{
+		"mig":     migMetricsTemplate,
+		"switch":  switchMetricsTemplate,
+		"link":    linkMetricsTemplate,
+		"cpu":     cpuMetricsTemplate,
+		"cpuCore": cpuCoreMetricsTemplate,
+		"process": processMetricsTemplate,
+		"vgpu":    vgpuMetricsTemplate,
+		"exp":     getExpMetricTemplate(),
+	}
+
+	for name, tmpl := range templates {
+		t.Run("When the values of the "+name+" metrics are adversarial, the output still parses", func(t *testing.T) {
+			formatted, err := FormatMetrics(tmpl, MetricsByCounter{counter: {metric}})
+			require.NoError(t, err)
+
+			var parser expfmt.TextParser
+			families, err := parser.TextToMetricFamilies(strings.NewReader(formatted))
+			require.NoError(t, err, formatted)
+			require.Contains(t, families, counter.FieldName)
+			require.Len(t, families[counter.FieldName].GetMetric(), 1)
+
+			labels := map[string]string{}
+			for _, label := range families[counter.FieldName].GetMetric()[0].GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			assert.Equal(t, adversarial, labels["Hostname"])
+			assert.Equal(t, adversarial, labels["team"])
+			assert.NotContains(t, labels, "x", "a value must not inject a label")
+			if _, ok := labels["pod"]; ok {
+				assert.Equal(t, adversarial, labels["pod"])
+			}
+			if _, ok := labels["modelName"]; ok {
+				assert.Equal(t, adversarial, labels["modelName"])
+				assert.Equal(t, "GPU-"+adversarial, labels["UUID"])
+			}
+			if _, ok := labels["GPU_I_PROFILE"]; ok {
+				assert.Equal(t, adversarial, labels["GPU_I_PROFILE"])
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// parseScale parses the multiplier of the counter, an empty multiplier leaves the values unchanged and yields 0
+func parseScale(fieldName, promType, scale string) (float64, error) {
+	if scale == "" {
+		return 0, nil
+	}
+
+	if promType == "label" {
+		return 0, fmt.Errorf("counter '%s' is a label and cannot be scaled", fieldName)
+	}
+
+	res, err := strconv.ParseFloat(scale, 64)
+	if err != nil {
+		return 0, fmt.Errorf("counter '%s' has a malformed multiplier '%s'; err: %w", fieldName, scale, err)
+	}
+
+	if res == 0 || math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, fmt.Errorf("counter '%s' has multiplier '%s', expected a non-zero finite number", fieldName, scale)
+	}
+
+	return res, nil
+}
+
+// scaleValue multiplies the numeric value by the multiplier of the counter
+func scaleValue(value string, counter Counter) string {
+	if counter.Scale == 0 || counter.Scale == 1 {
+		return value
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+
+	return strconv.FormatFloat(v*counter.Scale, 'f', -1, 64)
+}
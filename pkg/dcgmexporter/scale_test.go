@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScale(t *testing.T) {
+	tests := []struct {
+		name     string
+		promType string
+		scale    string
+		want     float64
+		wantErr  bool
+	}{
+		{name: "When the multiplier is empty", promType: "gauge", scale: "", want: 0},
+		{name: "When the multiplier is a decimal", promType: "gauge", scale: "0.001", want: 0.001},
+		{name: "When the multiplier uses an exponent", promType: "gauge", scale: "9.5367431640625e-07", want: 1.0 / (1 << 20)},
+		{name: "When the multiplier is not a number", promType: "gauge", scale: "milli", wantErr: true},
+		{name: "When the multiplier is zero", promType: "gauge", scale: "0", wantErr: true},
+		{name: "When the multiplier is infinite", promType: "gauge", scale: "Inf", wantErr: true},
+		{name: "When the counter is a label", promType: "label", scale: "2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScale("DCGM_FI_DEV_POWER_USAGE", tt.promType, tt.scale)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFieldValueWithScale(t *testing.T) {
+	var doubleValue [4096]byte
+	binary.LittleEndian.PutUint64(doubleValue[:], math.Float64bits(250.5))
+
+	var stringValue [4096]byte
+	copy(stringValue[:], "535.104.05")
+
+	power := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_DOUBLE, Value: doubleValue}
+	memory := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(3 << 20)}
+	driver := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_STRING, Value: stringValue}
+	blank := dcgm.FieldValue_v1{FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)}
+
+	tests := []struct {
+		name    string
+		val     dcgm.FieldValue_v1
+		counter Counter
+		want    string
+	}{
+		{
+			name:    "When the counter has no multiplier, the value is unchanged",
+			val:     power,
+			counter: Counter{PromType: "gauge"},
+			want:    "250.5",
+		},
+		{
+			name:    "When a double is scaled",
+			val:     power,
+			counter: Counter{PromType: "gauge", Scale: 0.001},
+			want:    "0.2505",
+		},
+		{
+			name:    "When an integer is scaled",
+			val:     memory,
+			counter: Counter{PromType: "gauge", Scale: 1.0 / (1 << 20)},
+			want:    "3",
+		},
+		{
+			name:    "When a string is scaled, it is unchanged",
+			val:     driver,
+			counter: Counter{PromType: "gauge", Scale: 2},
+			want:    "535.104.05",
+		},
+		{
+			name:    "When a blank value is replaced, the missing value is not scaled",
+			val:     blank,
+			counter: Counter{PromType: "gauge", Scale: 2},
+			want:    "-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := fieldValue(tt.val, tt.counter, "-1")
+			require.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
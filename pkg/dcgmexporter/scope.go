@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	gpuScope = "gpu"
+	migScope = "mig"
+)
+
+// counterScopes maps the scopes of the counters file to the entity collecting them. The gpu and mig scopes are
+// both collected with the GPUs, the former for the GPUs monitored as a whole and the latter for their MIG instances.
+var counterScopes = map[string]dcgm.Field_Entity_Group{
+	gpuScope: dcgm.FE_GPU,
+	migScope: dcgm.FE_GPU,
+	"switch": dcgm.FE_SWITCH,
+	"link":   dcgm.FE_LINK,
+	"cpu":    dcgm.FE_CPU,
+	"core":   dcgm.FE_CPU_CORE,
+}
+
+// validateScope checks that the scope of the counter is known, an empty scope routes the counter by the entity
+// level of its field
+func validateScope(fieldName, scope string) error {
+	if scope == "" {
+		return nil
+	}
+
+	if _, exists := counterScopes[scope]; !exists {
+		scopes := make([]string, 0, len(counterScopes))
+		for s := range counterScopes {
+			scopes = append(scopes, s)
+		}
+		slices.Sort(scopes)
+
+		return fmt.Errorf("counter '%s' has unknown scope '%s', expected one of %s", fieldName, scope,
+			strings.Join(scopes, ", "))
+	}
+
+	return nil
+}
+
+// inScope reports whether the counter is collected for the GPU, GPU instance or compute instance
+func (c Counter) inScope(metadata gpuMetadata) bool {
+	switch c.Scope {
+	case gpuScope:
+		return metadata.GPUInstanceID == ""
+	case migScope:
+		return metadata.GPUInstanceID != ""
+	default:
+		return true
+	}
+}
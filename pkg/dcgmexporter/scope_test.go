@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScope(t *testing.T) {
+	assert.NoError(t, validateScope("DCGM_FI_DEV_GPU_TEMP", ""))
+	assert.NoError(t, validateScope("DCGM_FI_DEV_GPU_TEMP", "mig"))
+	assert.NoError(t, validateScope("DCGM_FI_DEV_CPU_TEMP_CURRENT", "core"))
+	assert.ErrorContains(t, validateScope("DCGM_FI_DEV_GPU_TEMP", "MIG"), "expected one of core, cpu, gpu, link, mig, switch")
+}
+
+func TestToMetricWithScope(t *testing.T) {
+	fieldValue := [4096]byte{}
+	fieldValue[0] = 42
+
+	counters := []Counter{
+		{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+		{FieldID: 155, FieldName: "DCGM_FI_DEV_POWER_USAGE", PromType: "gauge", Scope: "gpu"},
+		{FieldID: 1002, FieldName: "DCGM_FI_PROF_SM_ACTIVE", PromType: "gauge", Scope: "mig"},
+	}
+
+	var values []dcgm.FieldValue_v1
+	for _, counter := range counters {
+		values = append(values, dcgm.FieldValue_v1{FieldId: uint(counter.FieldID), FieldType: dcgm.DCGM_FT_INT64, Value: fieldValue})
+	}
+
+	tests := []struct {
+		name         string
+		instanceInfo *GPUInstanceInfo
+		want         []string
+	}{
+		{
+			name: "When the entity is a GPU",
+			want: []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_DEV_POWER_USAGE"},
+		},
+		{
+			name:         "When the entity is a MIG instance",
+			instanceInfo: &GPUInstanceInfo{Info: dcgm.MigEntityInfo{NvmlInstanceId: 1}, ProfileName: "1g.10gb"},
+			want:         []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_PROF_SM_ACTIVE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := MetricsByCounter{}
+			ToMetric(metrics, values, counters, dcgm.Device{UUID: "fake0"}, tt.instanceInfo, nil, MetricOptions{})
+
+			var got []string
+			for counter := range metrics {
+				got = append(got, counter.FieldName)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewDeviceFieldsWithScope(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", Scope: "mig"},
+		{FieldID: dcgm.DCGM_FI_DEV_CPU_TEMP_CURRENT, FieldName: "DCGM_FI_DEV_CPU_TEMP_CURRENT", Scope: "core"},
+	}
+
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_GPU_TEMP}, NewDeviceFields(counters, dcgm.FE_GPU))
+	assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_CPU_TEMP_CURRENT}, NewDeviceFields(counters, dcgm.FE_CPU_CORE))
+	assert.Empty(t, NewDeviceFields(counters, dcgm.FE_CPU))
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// limitSeries drops the series of the entity that exceed Config.MaxSeries once added to the latest series of the
+// other entities, callers must hold mtx and clear the latest metrics of the entity beforehand. The series are kept in
+// the order of the counter names, so the same series are dropped from one collection to the next.
+func (m *MetricsPipeline) limitSeries(entity string, metrics MetricsByCounter) {
+	if m.config.MaxSeries <= 0 {
+		return
+	}
+
+	budget := m.config.MaxSeries
+	for _, latest := range m.latest {
+		budget -= countSeries(latest)
+	}
+
+	dropped := truncateSeries(metrics, max(budget, 0))
+	if dropped == 0 {
+		return
+	}
+
+	m.droppedSeries += uint64(dropped)
+	logrus.Warnf("Dropped %d %s series exceeding the limit of %d series", dropped, entity, m.config.MaxSeries)
+}
+
+func countSeries(metrics MetricsByCounter) int {
+	count := 0
+	for _, values := range metrics {
+		count += len(values)
+	}
+
+	return count
+}
+
+// truncateSeries keeps the first limit series of the metrics, by counter name, and returns the number of series dropped
+func truncateSeries(metrics MetricsByCounter, limit int) int {
+	total := countSeries(metrics)
+	if total <= limit {
+		return 0
+	}
+
+	counters := make([]Counter, 0, len(metrics))
+	for counter := range metrics {
+		counters = append(counters, counter)
+	}
+	slices.SortFunc(counters, func(a, b Counter) int {
+		return cmp.Compare(a.FieldName, b.FieldName)
+	})
+
+	for _, counter := range counters {
+		values := metrics[counter]
+		if len(values) > limit {
+			values = values[:limit]
+		}
+		limit -= len(values)
+
+		if len(values) == 0 {
+			delete(metrics, counter)
+			continue
+		}
+		metrics[counter] = values
+	}
+
+	return total - countSeries(metrics)
+}
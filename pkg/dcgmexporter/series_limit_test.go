@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsPipeline_LimitSeries(t *testing.T) {
+	temp := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP"}
+	util := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL"}
+	power := Counter{FieldName: "DCGM_FI_DEV_POWER_USAGE"}
+
+	series := func(gpus ...string) []Metric {
+		var res []Metric
+		for _, gpu := range gpus {
+			res = append(res, Metric{GPU: gpu, Value: "1"})
+		}
+		return res
+	}
+
+	tests := []struct {
+		name        string
+		maxSeries   int
+		latest      []MetricsByCounter
+		metrics     MetricsByCounter
+		want        map[string][]string
+		wantDropped uint64
+	}{
+		{
+			name:      "When the limit is disabled, every series is kept",
+			maxSeries: 0,
+			metrics:   MetricsByCounter{temp: series("0", "1"), util: series("0", "1")},
+			want: map[string][]string{
+				"DCGM_FI_DEV_GPU_TEMP": {"0", "1"},
+				"DCGM_FI_DEV_GPU_UTIL": {"0", "1"},
+			},
+		},
+		{
+			name:      "When the series are under the limit, every series is kept",
+			maxSeries: 4,
+			metrics:   MetricsByCounter{temp: series("0", "1"), util: series("0", "1")},
+			want: map[string][]string{
+				"DCGM_FI_DEV_GPU_TEMP": {"0", "1"},
+				"DCGM_FI_DEV_GPU_UTIL": {"0", "1"},
+			},
+		},
+		{
+			name:      "When the series exceed the limit, the last ones by counter name are dropped",
+			maxSeries: 3,
+			metrics:   MetricsByCounter{util: series("0", "1"), temp: series("0", "1"), power: series("0", "1")},
+			want: map[string][]string{
+				"DCGM_FI_DEV_GPU_TEMP": {"0", "1"},
+				"DCGM_FI_DEV_GPU_UTIL": {"0"},
+			},
+			wantDropped: 3,
+		},
+		{
+			name:      "When the other entities use the limit, the series of the entity are dropped",
+			maxSeries: 3,
+			latest:    []MetricsByCounter{nil, {temp: series("0", "1")}},
+			metrics:   MetricsByCounter{temp: series("0", "1")},
+			want: map[string][]string{
+				"DCGM_FI_DEV_GPU_TEMP": {"0"},
+			},
+			wantDropped: 1,
+		},
+		{
+			name:        "When the other entities exceed the limit, every series of the entity is dropped",
+			maxSeries:   1,
+			latest:      []MetricsByCounter{nil, {temp: series("0", "1")}},
+			metrics:     MetricsByCounter{temp: series("0", "1")},
+			want:        map[string][]string{},
+			wantDropped: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &MetricsPipeline{
+				config: &Config{MaxSeries: tt.maxSeries},
+				latest: tt.latest,
+			}
+
+			p.limitSeries("gpu", tt.metrics)
+
+			got := map[string][]string{}
+			for counter, values := range tt.metrics {
+				for _, metric := range values {
+					got[counter.FieldName] = append(got[counter.FieldName], metric.GPU)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantDropped, p.droppedSeries)
+		})
+	}
+}
@@ -17,19 +17,47 @@
 package dcgmexporter
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/go-kit/log"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/sirupsen/logrus"
 
 	"github.com/NVIDIA/dcgm-exporter/internal/pkg/logging"
 )
 
-func NewMetricsServer(c *Config, metrics chan string, registry *Registry) (*MetricsServer, func(), error) {
+// compressionThreshold is the size in bytes below which responses are not compressed
+const compressionThreshold = 1024
+
+func NewMetricsServer(
+	c *Config, metrics chan string, registry *Registry, pipeline *MetricsPipeline,
+) (*MetricsServer, func(), error) {
+	buildInfo, err := formatBuildInfo(c)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("failed to format the build info; err: %w", err)
+	}
+
+	tlsConfig, certificates, err := newServerTLSConfig(c)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
 	router := mux.NewRouter()
 	serverv1 := &MetricsServer{
 		server: &http.Server{
@@ -37,15 +65,23 @@ func NewMetricsServer(c *Config, metrics chan string, registry *Registry) (*Metr
 			Handler:      router,
 			ReadTimeout:  10 * time.Second,
 			WriteTimeout: 10 * time.Second,
+			TLSConfig:    tlsConfig,
 		},
+		certificates: certificates,
 		webConfig: &web.FlagConfig{
 			WebListenAddresses: &[]string{c.Address},
 			WebSystemdSocket:   &c.WebSystemdSocket,
 			WebConfigFile:      &c.WebConfigFile,
 		},
-		metricsChan: metrics,
-		metrics:     "",
-		registry:    registry,
+		metricsChan:       metrics,
+		metrics:           "",
+		buildInfo:         buildInfo,
+		registry:          registry,
+		pipeline:          pipeline,
+		format:            c.Format,
+		metricNamePrefix:  c.MetricNamePrefix,
+		gpuLabelStrategy:  c.GPULabelStrategy,
+		enableCompression: c.EnableCompression,
 	}
 
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -65,12 +101,54 @@ func NewMetricsServer(c *Config, metrics chan string, registry *Registry) (*Metr
 		}
 	})
 
-	router.HandleFunc("/health", serverv1.Health)
-	router.HandleFunc("/metrics", serverv1.Metrics)
+	router.HandleFunc("/metrics", newAuthenticator(c).wrap(serverv1.Metrics))
+
+	if c.AdminListenAddress == "" {
+		router.HandleFunc("/health", serverv1.Health)
+		router.HandleFunc("/ready", serverv1.Ready)
+		router.HandleFunc("/counters", newAuthenticator(c).wrap(serverv1.Counters))
+
+		if c.EnablePprof {
+			registerPprof(router, newAuthenticator(c))
+		}
+
+		return serverv1, func() {}, nil
+	}
+
+	// The admin listener is meant to be reachable from the node only, it serves plain HTTP. Its endpoints are
+	// protected by the same credentials as on the scrape port, the probes stay open. The scrape port keeps the
+	// metrics of the devices only.
+	serverv1.adminBuildInfo, serverv1.buildInfo = serverv1.buildInfo, ""
+
+	adminRouter := mux.NewRouter()
+	adminRouter.HandleFunc("/health", serverv1.Health)
+	adminRouter.HandleFunc("/ready", serverv1.Ready)
+	adminRouter.HandleFunc("/counters", newAuthenticator(c).wrap(serverv1.Counters))
+	adminRouter.HandleFunc("/metrics", newAuthenticator(c).wrap(serverv1.AdminMetrics))
+	if c.EnablePprof {
+		registerPprof(adminRouter, newAuthenticator(c))
+	}
+
+	serverv1.adminServer = &http.Server{
+		Addr:        c.AdminListenAddress,
+		Handler:     adminRouter,
+		ReadTimeout: 10 * time.Second,
+	}
 
 	return serverv1, func() {}, nil
 }
 
+// registerPprof serves the Go runtime profiles under /debug/pprof. On the scrape port, the write timeout of the
+// server bounds the duration of the CPU profiles and traces.
+func registerPprof(router *mux.Router, auth authenticator) {
+	router.HandleFunc("/debug/pprof/cmdline", auth.wrap(pprof.Cmdline))
+	router.HandleFunc("/debug/pprof/profile", auth.wrap(pprof.Profile))
+	router.HandleFunc("/debug/pprof/symbol", auth.wrap(pprof.Symbol))
+	router.HandleFunc("/debug/pprof/trace", auth.wrap(pprof.Trace))
+	// Index also serves the named profiles, like /debug/pprof/heap
+	router.PathPrefix("/debug/pprof/").HandlerFunc(auth.wrap(pprof.Index))
+}
+
 func (s *MetricsServer) Run(stop chan interface{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 	// Wrap the logrus logger with the LogrusAdapter
@@ -80,74 +158,382 @@ func (s *MetricsServer) Run(stop chan interface{}, wg *sync.WaitGroup) {
 	httpwg.Add(1)
 	go func() {
 		defer httpwg.Done()
-		logrus.Info("Starting webserver")
-		if err := web.ListenAndServe(s.server, s.webConfig, logger); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.server.TLSConfig != nil {
+			logrus.Info("Starting webserver with TLS")
+			err = s.listenAndServeTLS(logger)
+		} else {
+			logrus.Info("Starting webserver")
+			err = web.ListenAndServe(s.server, s.webConfig, logger)
+		}
+
+		if err != nil && err != http.ErrServerClosed {
 			logrus.WithError(err).Fatal("Failed to Listen and Server HTTP server.")
 		}
 	}()
 
-	httpwg.Add(1)
-	go func() {
-		defer httpwg.Done()
-		for {
-			select {
-			case <-stop:
-				return
-			case m := <-s.metricsChan:
-				s.updateMetrics(m)
+	if s.adminServer != nil {
+		httpwg.Add(1)
+		go func() {
+			defer httpwg.Done()
+			logrus.Infof("Starting admin webserver on %s", s.adminServer.Addr)
+			err := s.adminServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				logrus.WithError(err).Fatal("Failed to Listen and Server admin HTTP server.")
 			}
-		}
+		}()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		s.readMetrics(stop)
 	}()
 
 	<-stop
+	// The last payload the pipeline flushes on stop is served until the servers shut down
+	<-drained
 	if err := s.server.Shutdown(context.Background()); err != nil {
 		logrus.WithError(err).Fatal("Failed to shutdown HTTP server.")
 	}
 
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(context.Background()); err != nil {
+			logrus.WithError(err).Fatal("Failed to shutdown admin HTTP server.")
+		}
+	}
+
 	if err := WaitWithTimeout(&httpwg, 3*time.Second); err != nil {
 		logrus.WithError(err).Fatal("Failed waiting for HTTP server to shutdown.")
 	}
 }
 
+// listenAndServeTLS serves the metrics over TLS with the TLS config of the server, on the address or on the systemd
+// activated sockets like web.ListenAndServe. The TLS flags exclude a web config file, which would configure TLS too.
+func (s *MetricsServer) listenAndServeTLS(logger log.Logger) error {
+	var listeners []net.Listener
+	if *s.webConfig.WebSystemdSocket {
+		var err error
+		listeners, err = activation.Listeners()
+		if err != nil {
+			return fmt.Errorf("failed to get the systemd activated sockets; err: %w", err)
+		}
+		if len(listeners) == 0 {
+			return errors.New("no socket activation file descriptors found")
+		}
+	} else {
+		for _, address := range *s.webConfig.WebListenAddresses {
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				return err
+			}
+			defer listener.Close()
+			listeners = append(listeners, listener)
+		}
+	}
+
+	return s.serveTLS(listeners, logger)
+}
+
+// serveTLS serves the metrics on the listeners through exporter-toolkit, once wrapped with the TLS config of the
+// server. The certificate is served by TLSConfig.GetCertificate, so it can be reloaded.
+func (s *MetricsServer) serveTLS(listeners []net.Listener, logger log.Logger) error {
+	for i, listener := range listeners {
+		listeners[i] = tls.NewListener(listener, s.server.TLSConfig)
+	}
+
+	return web.ServeMultiple(listeners, s.server, s.webConfig, logger)
+}
+
+// readMetrics updates the served metrics with the payloads of the pipeline. On stop, it keeps reading until the
+// pipeline closes the channel after flushing its last payload, or drainTimeout passes.
+func (s *MetricsServer) readMetrics(stop chan interface{}) {
+	for {
+		select {
+		case <-stop:
+			timeout := time.After(drainTimeout)
+			for {
+				select {
+				case m, ok := <-s.metricsChan:
+					if !ok {
+						return
+					}
+					s.updateMetrics(m)
+				case <-timeout:
+					logrus.Warnf("Pipeline did not stop within %s; serving the metrics read so far", drainTimeout)
+					return
+				}
+			}
+		case m, ok := <-s.metricsChan:
+			if !ok {
+				return
+			}
+			s.updateMetrics(m)
+		}
+	}
+}
+
+// ReloadTLS loads the certificate of the server again, it does nothing when the server doesn't use TLS
+func (s *MetricsServer) ReloadTLS() error {
+	if s.certificates == nil {
+		return nil
+	}
+
+	return s.certificates.reload()
+}
+
 func (s *MetricsServer) Metrics(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte(s.getMetrics()))
+	if s.format == FormatJSON {
+		s.jsonMetrics(w, r)
+		return
+	}
+
+	metrics, err := s.registry.Gather()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+		return
+	}
+	relabelGPUs(metrics, s.gpuLabelStrategy)
+	sanitizeLabelNames(metrics)
+	metrics = prefixMetricNames(metrics, s.metricNamePrefix)
+
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	if format.FormatType() == expfmt.TypeOpenMetrics {
+		s.openMetrics(w, r, metrics, format)
+		return
+	}
+
+	// The text format is streamed to the client: the output of the pipeline, rendered once per collection, isn't
+	// copied into a response buffer and the registry metrics are rendered straight to the response with
+	// FormatMetricsTo. The response is committed once streaming starts, so the errors that follow can only be logged.
+	cached := s.getMetrics()
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	out, closeOut := s.startMetrics(w, r, len(cached)+len(s.buildInfo))
+
+	_, err = io.WriteString(out, cached)
+	if err == nil {
+		_, err = io.WriteString(out, s.buildInfo)
+	}
+	if err == nil {
+		err = encodeExpMetrics(out, metrics)
+	}
+	if err == nil {
+		err = closeOut()
+	}
+
 	if err != nil {
 		logrus.WithError(err).Error("Failed to write response.")
+	}
+}
+
+// WriteMetrics collects the metrics of the pipeline and of the registry once and writes them to w like the metrics
+// endpoint, in the Prometheus text format or in JSON. It doesn't need a running pipeline nor server.
+func WriteMetrics(w io.Writer, c *Config, registry *Registry, pipeline *MetricsPipeline) error {
+	buildInfo, err := formatBuildInfo(c)
+	if err != nil {
+		return fmt.Errorf("failed to format the build info; err: %w", err)
+	}
+
+	cached, err := pipeline.CollectOnce()
+	if err != nil {
+		return fmt.Errorf("failed to collect the metrics; err: %w", err)
+	}
+
+	metrics, err := registry.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to collect the exporter metrics; err: %w", err)
+	}
+	relabelGPUs(metrics, c.GPULabelStrategy)
+	sanitizeLabelNames(metrics)
+	metrics = prefixMetricNames(metrics, c.MetricNamePrefix)
+
+	if c.Format == FormatJSON {
+		expMetrics, err := FormatMetricsJSON(metrics)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, joinJSONArrays(cached, buildInfo, expMetrics))
+		return err
+	}
+
+	_, err = io.WriteString(w, cached)
+	if err == nil {
+		_, err = io.WriteString(w, buildInfo)
+	}
+	if err == nil {
+		err = encodeExpMetrics(w, metrics)
+	}
+
+	return err
+}
+
+// openMetrics converts the metrics to the OpenMetrics format, which needs the whole text output to attach the
+// exemplars, before writing them
+func (s *MetricsServer) openMetrics(w http.ResponseWriter, r *http.Request, metrics MetricsByCounter,
+	format expfmt.Format,
+) {
+	var buf bytes.Buffer
+	buf.WriteString(s.getMetrics())
+	buf.WriteString(s.buildInfo)
+
+	err := encodeExpMetrics(&buf, metrics)
+	if err != nil {
 		http.Error(w, "failed to write response", http.StatusInternalServerError)
 		return
 	}
+
+	var omBuf bytes.Buffer
+	err = FormatOpenMetrics(&omBuf, buf.String())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to format OpenMetrics response.")
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(format))
+	s.writeMetrics(w, r, omBuf.Bytes())
+}
+
+func (s *MetricsServer) jsonMetrics(w http.ResponseWriter, r *http.Request) {
 	metrics, err := s.registry.Gather()
 	if err != nil {
 		logrus.WithError(err).Error("Failed to write response.")
 		http.Error(w, "failed to write response", http.StatusInternalServerError)
 		return
 	}
-	err = encodeExpMetrics(w, metrics)
+	relabelGPUs(metrics, s.gpuLabelStrategy)
+	sanitizeLabelNames(metrics)
+
+	expMetrics, err := FormatMetricsJSON(prefixMetricNames(metrics, s.metricNamePrefix))
 	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
 		http.Error(w, "failed to write response", http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	s.writeMetrics(w, r, []byte(joinJSONArrays(s.getMetrics(), s.buildInfo, expMetrics)))
 }
 
-func (s *MetricsServer) Health(w http.ResponseWriter, r *http.Request) {
-	if s.getMetrics() == "" {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		_, err := w.Write([]byte("KO"))
-		if err != nil {
-			logrus.WithError(err).Error("Failed to write response.")
-			http.Error(w, "failed to write response", http.StatusInternalServerError)
+// writeMetrics writes the formatted metrics, see startMetrics
+func (s *MetricsServer) writeMetrics(w http.ResponseWriter, r *http.Request, body []byte) {
+	out, closeOut := s.startMetrics(w, r, len(body))
+
+	_, err := out.Write(body)
+	if err == nil {
+		err = closeOut()
+	}
+
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
+	}
+}
+
+// startMetrics writes the headers of a successful response and returns the writer of its body, gzip-compressed when
+// compression is enabled, accepted by the client and the size of the payload is large enough to benefit from it.
+// The returned function flushes the body.
+func (s *MetricsServer) startMetrics(w http.ResponseWriter, r *http.Request, size int) (io.Writer, func() error) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if s.enableCompression {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if size >= compressionThreshold && acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusOK)
+
+			gz := gzip.NewWriter(w)
+			return gz, gz.Close
 		}
-	} else {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.WriteHeader(http.StatusOK)
-		_, err := w.Write([]byte("OK"))
-		if err != nil {
-			logrus.WithError(err).Error("Failed to write response.")
-			http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	return w, func() error { return nil }
+}
+
+// acceptsGzip reports whether the Accept-Encoding header value allows a gzip response
+func acceptsGzip(acceptEncoding string) bool {
+	for _, encoding := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
 		}
+
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+
+	return false
+}
+
+// AdminMetrics serves the self-metrics of dcgm-exporter, the health of the collectors and the build info, on the
+// admin server
+func (s *MetricsServer) AdminMetrics(w http.ResponseWriter, r *http.Request) {
+	internal := ""
+	if s.pipeline != nil && s.pipeline.config != nil {
+		internal = s.pipeline.internalMetrics()
+	}
+
+	if s.format == FormatJSON {
+		w.Header().Set("Content-Type", jsonContentType)
+		s.writeMetrics(w, r, []byte(joinJSONArrays(internal, s.adminBuildInfo)))
+		return
+	}
+
+	s.writeMetrics(w, r, []byte(internal+s.adminBuildInfo))
+}
+
+// Health reports that the process is alive, it does not depend on the state of the collectors
+func (s *MetricsServer) Health(w http.ResponseWriter, r *http.Request) {
+	s.writeProbeResponse(w, true)
+}
+
+// Counters serves the counters collected by the pipeline followed by the exporter counters, as JSON. They reflect
+// the last reload of the counters.
+func (s *MetricsServer) Counters(w http.ResponseWriter, r *http.Request) {
+	var counters []Counter
+	if s.pipeline != nil {
+		counters = append(counters, s.pipeline.Counters()...)
+	}
+	if s.registry != nil {
+		counters = append(counters, s.registry.Counters()...)
+	}
+
+	body, err := formatCountersJSON(counters)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	s.writeMetrics(w, r, body)
+}
+
+// Ready reports whether the pipeline collected metrics recently, see MetricsPipeline.Ready
+func (s *MetricsServer) Ready(w http.ResponseWriter, r *http.Request) {
+	s.writeProbeResponse(w, s.pipeline.Ready())
+}
+
+func (s *MetricsServer) writeProbeResponse(w http.ResponseWriter, ok bool) {
+	status, body := http.StatusOK, "OK"
+	if !ok {
+		status, body = http.StatusServiceUnavailable, "KO"
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, err := w.Write([]byte(body))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to write response.")
 	}
 }
 
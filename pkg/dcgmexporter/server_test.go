@@ -0,0 +1,480 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsServer_Probes(t *testing.T) {
+	pipeline := &MetricsPipeline{config: &Config{CollectInterval: 10000}}
+	server, cleanup, err := NewMetricsServer(&Config{}, make(chan string), NewRegistry(), pipeline)
+	require.NoError(t, err)
+	defer cleanup()
+
+	probe := func(path string) int {
+		recorder := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, probe("/health"))
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/ready"))
+
+	pipeline.lastSuccess.Store(time.Now().UnixNano())
+
+	assert.Equal(t, http.StatusOK, probe("/health"))
+	assert.Equal(t, http.StatusOK, probe("/ready"))
+}
+
+func TestMetricsServer_Compression(t *testing.T) {
+	large := strings.Repeat("DCGM_FI_DEV_GPU_TEMP{gpu=\"0\"} 42\n", 100)
+	small := "DCGM_FI_DEV_GPU_TEMP{gpu=\"0\"} 42\n"
+
+	tests := []struct {
+		name              string
+		enableCompression bool
+		acceptEncoding    string
+		metrics           string
+		wantGzip          bool
+	}{
+		{
+			name:              "When client accepts gzip, large payload is compressed",
+			enableCompression: true,
+			acceptEncoding:    "gzip, deflate",
+			metrics:           large,
+			wantGzip:          true,
+		},
+		{
+			name:              "When payload is below the threshold, it is not compressed",
+			enableCompression: true,
+			acceptEncoding:    "gzip",
+			metrics:           small,
+		},
+		{
+			name:              "When client does not accept gzip, payload is not compressed",
+			enableCompression: true,
+			metrics:           large,
+		},
+		{
+			name:              "When compression is disabled, payload is not compressed",
+			enableCompression: false,
+			acceptEncoding:    "gzip",
+			metrics:           large,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, cleanup, err := NewMetricsServer(&Config{EnableCompression: tc.enableCompression},
+				make(chan string), NewRegistry(), &MetricsPipeline{config: &Config{}})
+			require.NoError(t, err)
+			defer cleanup()
+			server.updateMetrics(tc.metrics)
+
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, string(expfmt.FmtText), recorder.Header().Get("Content-Type"))
+
+			body := recorder.Body.Bytes()
+			if tc.wantGzip {
+				require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+				reader, err := gzip.NewReader(recorder.Body)
+				require.NoError(t, err)
+				body, err = io.ReadAll(reader)
+				require.NoError(t, err)
+			} else {
+				require.Empty(t, recorder.Header().Get("Content-Encoding"))
+			}
+
+			assert.Equal(t, tc.metrics+server.buildInfo, string(body))
+		})
+	}
+}
+
+// discardResponseWriter drops the response, so that the benchmarks only measure the handler
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header { return w.header }
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+func BenchmarkMetricsServer_Metrics(b *testing.B) {
+	server, cleanup, err := NewMetricsServer(&Config{}, make(chan string), NewRegistry(),
+		&MetricsPipeline{config: &Config{}})
+	require.NoError(b, err)
+	defer cleanup()
+
+	metrics, err := FormatMetrics(migMetricsTemplate, benchmarkMetrics(64, 50))
+	require.NoError(b, err)
+	server.updateMetrics(metrics)
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		server.Metrics(&discardResponseWriter{header: http.Header{}}, request)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{acceptEncoding: "", want: false},
+		{acceptEncoding: "gzip", want: true},
+		{acceptEncoding: "deflate, gzip;q=0.5", want: true},
+		{acceptEncoding: "gzip;q=0", want: false},
+		{acceptEncoding: "identity", want: false},
+		{acceptEncoding: "x-gzip", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, tc.want, acceptsGzip(tc.acceptEncoding))
+		})
+	}
+}
+
+func TestMetricsServer_ReadMetricsOnStop(t *testing.T) {
+	originalDrainTimeout := drainTimeout
+	drainTimeout = 100 * time.Millisecond
+	defer func() {
+		drainTimeout = originalDrainTimeout
+	}()
+
+	tests := []struct {
+		name     string
+		pipeline bool
+		want     string
+	}{
+		{
+			name:     "When the pipeline flushes its last payload on stop, it is served",
+			pipeline: true,
+			want:     "last",
+		},
+		{
+			name: "When the pipeline doesn't stop, reading gives up after the drain timeout",
+			want: "first",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := make(chan string)
+			server, cleanup, err := NewMetricsServer(&Config{}, metrics, NewRegistry(),
+				&MetricsPipeline{config: &Config{}})
+			require.NoError(t, err)
+			defer cleanup()
+
+			stop := make(chan interface{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				server.readMetrics(stop)
+			}()
+
+			metrics <- "first"
+			close(stop)
+			if tc.pipeline {
+				metrics <- "last"
+				close(metrics)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Reading the metrics did not stop")
+			}
+			assert.Equal(t, tc.want, server.getMetrics())
+		})
+	}
+}
+
+func TestMetricsServer_BuildInfo(t *testing.T) {
+	server, cleanup, err := NewMetricsServer(&Config{Version: "3.3.5-3.4.0"}, make(chan string), NewRegistry(),
+		&MetricsPipeline{config: &Config{}})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// No collector has produced metrics yet
+	recorder := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Contains(t, recorder.Body.String(), `dcgm_exporter_build_info{dcgm_version="",go_version="`)
+	assert.Contains(t, recorder.Body.String(), `version="3.3.5-3.4.0"} 1`)
+}
+
+func TestMetricsServer_Pprof(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *Config
+		wantMain  int
+		wantAdmin int // 0 when no admin server is expected
+	}{
+		{
+			name:     "When pprof is disabled, the profiles aren't served",
+			config:   &Config{},
+			wantMain: http.StatusNotFound,
+		},
+		{
+			name:     "When pprof is enabled without an admin address, the scrape port serves the profiles",
+			config:   &Config{EnablePprof: true},
+			wantMain: http.StatusOK,
+		},
+		{
+			name:     "When pprof is enabled with authentication, the profiles require the credentials",
+			config:   &Config{EnablePprof: true, AuthBearerToken: "secret"},
+			wantMain: http.StatusUnauthorized,
+		},
+		{
+			name:      "When pprof is enabled with an admin address, only the admin server serves the profiles",
+			config:    &Config{EnablePprof: true, AdminListenAddress: "localhost:9401"},
+			wantMain:  http.StatusNotFound,
+			wantAdmin: http.StatusOK,
+		},
+		{
+			name:      "When pprof is enabled with an admin address and authentication, the profiles require the credentials",
+			config:    &Config{EnablePprof: true, AdminListenAddress: "localhost:9401", AuthBearerToken: "secret"},
+			wantMain:  http.StatusNotFound,
+			wantAdmin: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, cleanup, err := NewMetricsServer(tc.config, make(chan string), NewRegistry(), &MetricsPipeline{})
+			require.NoError(t, err)
+			defer cleanup()
+
+			get := func(handler http.Handler, path string) int {
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+				return recorder.Code
+			}
+
+			assert.Equal(t, tc.wantMain, get(server.server.Handler, "/debug/pprof/"))
+			assert.Equal(t, tc.wantMain, get(server.server.Handler, "/debug/pprof/heap"))
+
+			if tc.wantAdmin == 0 {
+				assert.Nil(t, server.adminServer)
+				return
+			}
+
+			require.NotNil(t, server.adminServer)
+			assert.Equal(t, tc.config.AdminListenAddress, server.adminServer.Addr)
+			assert.Equal(t, tc.wantAdmin, get(server.adminServer.Handler, "/debug/pprof/"))
+			assert.Equal(t, tc.wantAdmin, get(server.adminServer.Handler, "/debug/pprof/cmdline"))
+		})
+	}
+}
+
+func TestMetricsServer_AdminListenAddress(t *testing.T) {
+	get := func(handler http.Handler, path string) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	tests := []struct {
+		name      string
+		config    *Config
+		wantMain  int
+		wantAdmin bool
+	}{
+		{
+			name:     "When no admin address is set, the scrape port serves every endpoint",
+			config:   &Config{Version: "3.3.5-3.4.0", CollectInterval: 10000},
+			wantMain: http.StatusOK,
+		},
+		{
+			name:      "When an admin address is set, the admin server serves the operational endpoints",
+			config:    &Config{Version: "3.3.5-3.4.0", CollectInterval: 10000, AdminListenAddress: "127.0.0.1:9401"},
+			wantMain:  http.StatusNotFound,
+			wantAdmin: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline := &MetricsPipeline{config: tc.config}
+			pipeline.lastSuccess.Store(time.Now().UnixNano())
+			server, cleanup, err := NewMetricsServer(tc.config, make(chan string), NewRegistry(), pipeline)
+			require.NoError(t, err)
+			defer cleanup()
+
+			for _, path := range []string{"/health", "/ready", "/counters"} {
+				code, _ := get(server.server.Handler, path)
+				assert.Equal(t, tc.wantMain, code, path)
+			}
+
+			code, body := get(server.server.Handler, "/metrics")
+			require.Equal(t, http.StatusOK, code)
+			assert.Equal(t, !tc.wantAdmin, strings.Contains(body, "dcgm_exporter_build_info"),
+				"the self-metrics are only served by the scrape port without admin server")
+
+			if !tc.wantAdmin {
+				assert.Nil(t, server.adminServer)
+				return
+			}
+
+			require.NotNil(t, server.adminServer)
+			assert.Equal(t, tc.config.AdminListenAddress, server.adminServer.Addr)
+			for _, path := range []string{"/health", "/ready", "/counters"} {
+				code, _ := get(server.adminServer.Handler, path)
+				assert.Equal(t, http.StatusOK, code, path)
+			}
+
+			code, body = get(server.adminServer.Handler, "/metrics")
+			require.Equal(t, http.StatusOK, code)
+			assert.Contains(t, body, `version="3.3.5-3.4.0"} 1`)
+		})
+	}
+}
+
+func TestMetricsServer_Counters(t *testing.T) {
+	pipeline := &MetricsPipeline{counters: []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION, FieldName: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION",
+			PromType: "counter", Help: "Total energy consumption (in J).", Scale: 0.001},
+	}}
+	registry := NewRegistry()
+	registry.SetCounters([]Counter{
+		{FieldID: dcgm.Short(DCGMGPUHealth), FieldName: dcgmExpGPUHealth, PromType: "gauge", Help: "Health"},
+	})
+
+	tests := []struct {
+		name     string
+		config   *Config
+		header   string
+		wantCode int
+	}{
+		{
+			name:     "When authentication is disabled, the counters are served",
+			config:   &Config{},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "When authentication is enabled, the counters require the credentials",
+			config:   &Config{AuthBearerToken: "secret"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "When the credentials are given, the counters are served",
+			config:   &Config{AuthBearerToken: "secret"},
+			header:   "Bearer secret",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, cleanup, err := NewMetricsServer(tc.config, make(chan string), registry, pipeline)
+			require.NoError(t, err)
+			defer cleanup()
+
+			req := httptest.NewRequest(http.MethodGet, "/counters", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			recorder := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(recorder, req)
+
+			require.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, jsonContentType, recorder.Header().Get("Content-Type"))
+			assert.JSONEq(t, `[
+				{"field_id": 156, "field_name": "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", "type": "counter",
+				 "help": "Total energy consumption (in J).", "scale": 0.001},
+				{"field_id": 9003, "field_name": "DCGM_EXP_GPU_HEALTH", "type": "gauge", "help": "Health"}
+			]`, recorder.Body.String())
+		})
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	counter := Counter{FieldName: "DCGM_EXP_XID_ERRORS_COUNT", PromType: "gauge", Help: "Count of XID Errors."}
+
+	tests := []struct {
+		name   string
+		config *Config
+		want   []string
+	}{
+		{
+			name:   "When the format is Prometheus, the build info and the exporter metrics are written",
+			config: &Config{},
+			want: []string{
+				"# TYPE dcgm_exporter_build_info gauge",
+				"# TYPE DCGM_EXP_XID_ERRORS_COUNT gauge",
+				`DCGM_EXP_XID_ERRORS_COUNT{gpu="0",UUID="GPU-0"`,
+			},
+		},
+		{
+			name:   "When a metric name prefix is set, the exporter metrics are prefixed",
+			config: &Config{MetricNamePrefix: "site_"},
+			want:   []string{"# TYPE site_DCGM_EXP_XID_ERRORS_COUNT gauge"},
+		},
+		{
+			name:   "When the format is JSON, a JSON array is written",
+			config: &Config{Format: FormatJSON},
+			want:   []string{`[{"name":"dcgm_exporter_build_info"`, `"name":"DCGM_EXP_XID_ERRORS_COUNT","value":1`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			collector := new(mockCollector)
+			collector.On("GetMetrics").Return(MetricsByCounter{
+				counter: {{Counter: counter, GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", Value: "1"}},
+			}, nil)
+			registry := NewRegistry()
+			registry.Register(collector)
+
+			var out strings.Builder
+			err := WriteMetrics(&out, tc.config, registry, &MetricsPipeline{config: tc.config})
+			require.NoError(t, err)
+
+			for _, want := range tc.want {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bufio"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slurmCgroupJobRegex matches the job of the cgroup paths created by the SLURM cgroup plugins, e.g.
+// /slurm/uid_1000/job_42/step_0 (v1) or /system.slice/slurmstepd.scope/job_42/step_0/user/task_0 (v2)
+var slurmCgroupJobRegex = regexp.MustCompile(`/job_(\d+)(/|$)`)
+
+// slurmJob is the SLURM job a process running on a GPU belongs to
+type slurmJob struct {
+	ID   string
+	User string
+}
+
+// slurmMapper labels the GPU metrics with the SLURM jobs of the processes running on the GPU. The job is read from
+// the cgroup of the processes, so the exporter has to run in the host PID namespace.
+type slurmMapper struct {
+	procRoot string
+}
+
+func newSlurmMapper() *slurmMapper {
+	logrus.Info("SLURM job mapping is enabled")
+	return &slurmMapper{
+		procRoot: "/proc",
+	}
+}
+
+func (p *slurmMapper) Name() string {
+	return "slurmMapper"
+}
+
+func (p *slurmMapper) Process(metrics MetricsByCounter, sysInfo SystemInfo) error {
+	gpuToJobs := map[string][]slurmJob{}
+	for _, mi := range GetMonitoredEntities(sysInfo) {
+		uuid := mi.DeviceInfo.UUID
+		if _, exists := gpuToJobs[uuid]; exists {
+			continue
+		}
+
+		pids, err := nvmlGetRunningProcessIDsHook(uuid)
+		if err != nil {
+			return fmt.Errorf("failed to list the processes of GPU %d; err: %w", mi.DeviceInfo.GPU, err)
+		}
+
+		gpuToJobs[uuid] = p.jobs(pids)
+	}
+
+	logrus.Debugf("GPU to SLURM job mapping: %+v", gpuToJobs)
+
+	for counter := range metrics {
+		var modifiedMetrics []Metric
+		for _, metric := range metrics[counter] {
+			jobs := gpuToJobs[metric.GPUUUID]
+			if len(jobs) == 0 {
+				modifiedMetrics = append(modifiedMetrics, metric)
+				continue
+			}
+
+			for _, job := range jobs {
+				modifiedMetric, err := deepCopy(metric)
+				if err != nil {
+					logrus.WithError(err).Errorf("Can not create deepCopy for the value: %v", metric)
+					continue
+				}
+				modifiedMetric.Attributes[slurmJobIDAttribute] = job.ID
+				modifiedMetric.Attributes[slurmUserAttribute] = job.User
+				modifiedMetrics = append(modifiedMetrics, modifiedMetric)
+			}
+		}
+		metrics[counter] = modifiedMetrics
+	}
+
+	return nil
+}
+
+// jobs returns the distinct SLURM jobs of the processes, sorted by ID. The processes outside a SLURM job, or that
+// exited in the meantime, are skipped.
+func (p *slurmMapper) jobs(pids []uint) []slurmJob {
+	var jobs []slurmJob
+	for _, pid := range pids {
+		job, err := p.job(pid)
+		if err != nil {
+			logrus.WithError(err).Debugf("Process %d isn't mapped to a SLURM job", pid)
+			continue
+		}
+
+		if !slices.Contains(jobs, job) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	slices.SortFunc(jobs, func(a, b slurmJob) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return jobs
+}
+
+// job returns the SLURM job of the process, read from its cgroup, and the name of the user running the process
+func (p *slurmMapper) job(pid uint) (slurmJob, error) {
+	dir := filepath.Join(p.procRoot, strconv.FormatUint(uint64(pid), 10))
+
+	var job slurmJob
+	err := scanLines(filepath.Join(dir, "cgroup"), func(line string) bool {
+		// Each line is hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			return false
+		}
+
+		match := slurmCgroupJobRegex.FindStringSubmatch(parts[2])
+		if match == nil {
+			return false
+		}
+
+		job.ID = match[1]
+		return true
+	})
+	if err != nil {
+		return slurmJob{}, err
+	}
+
+	if job.ID == "" {
+		return slurmJob{}, fmt.Errorf("no SLURM job in the cgroup of process %d", pid)
+	}
+
+	var uid string
+	err = scanLines(filepath.Join(dir, "status"), func(line string) bool {
+		// Uid: real effective saved filesystem
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "Uid:" {
+			return false
+		}
+
+		uid = fields[1]
+		return true
+	})
+	if err != nil {
+		return slurmJob{}, err
+	}
+
+	job.User = uid
+	if u, err := user.LookupId(uid); err == nil {
+		job.User = u.Username
+	}
+
+	return job, nil
+}
+
+// scanLines calls fn on each line of the file until it returns true
+func scanLines(path string, fn func(line string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fn(scanner.Text()) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
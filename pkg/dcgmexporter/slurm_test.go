@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	sysOS "os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/nvmlprovider"
+)
+
+func TestSlurmMapper_Process(t *testing.T) {
+	procRoot := t.TempDir()
+	writeProc := func(pid int, cgroup, uid string) {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		require.NoError(t, sysOS.MkdirAll(dir, 0o755))
+		require.NoError(t, sysOS.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0o644))
+		require.NoError(t, sysOS.WriteFile(filepath.Join(dir, "status"),
+			[]byte(fmt.Sprintf("Name:\tpython\nUid:\t%s\t%s\t%s\t%s\n", uid, uid, uid, uid)), 0o644))
+	}
+
+	// The UIDs are chosen not to exist, so the users are reported by UID
+	writeProc(100, "0::/system.slice/slurmstepd.scope/job_42/step_0/user/task_0\n", "424242")
+	writeProc(101, "0::/system.slice/slurmstepd.scope/job_42/step_1/user/task_0\n", "424242")
+	writeProc(200, "12:devices:/slurm/uid_434343/job_7/step_0\n11:memory:/slurm/uid_434343/job_7/step_0\n", "434343")
+	writeProc(300, "0::/user.slice/user-1000.slice/session-1.scope\n", "1000")
+
+	nvmlGetRunningProcessIDsHook = func(uuid string) ([]uint, error) {
+		switch uuid {
+		case "GPU-0":
+			return []uint{100, 101}, nil
+		case "GPU-1":
+			return []uint{100, 200}, nil
+		case "GPU-2":
+			// 300 isn't in a SLURM job and 400 exited since it was listed
+			return []uint{300, 400}, nil
+		}
+		return nil, nil
+	}
+	defer func() {
+		nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 4,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_UTIL", PromType: "gauge"}
+	metrics := MetricsByCounter{counter: {}}
+	for i := 0; i < 4; i++ {
+		metrics[counter] = append(metrics[counter], Metric{
+			GPU:        strconv.Itoa(i),
+			GPUUUID:    fmt.Sprintf("GPU-%d", i),
+			Value:      "1",
+			Attributes: map[string]string{},
+		})
+	}
+
+	mapper := &slurmMapper{procRoot: procRoot}
+	require.NoError(t, mapper.Process(metrics, sysInfo))
+
+	var got []string
+	for _, metric := range metrics[counter] {
+		got = append(got, fmt.Sprintf("%s/%s/%s", metric.GPU,
+			metric.Attributes[slurmJobIDAttribute], metric.Attributes[slurmUserAttribute]))
+	}
+
+	assert.Equal(t, []string{
+		"0/42/424242",
+		"1/42/424242",
+		"1/7/434343",
+		"2//",
+		"3//",
+	}, got)
+}
+
+func TestSlurmMapper_ProcessWhenTheProcessesCannotBeListed(t *testing.T) {
+	nvmlGetRunningProcessIDsHook = func(string) ([]uint, error) {
+		return nil, fmt.Errorf("boom")
+	}
+	defer func() {
+		nvmlGetRunningProcessIDsHook = nvmlprovider.GetRunningProcessIDs
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 1,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, UUID: "GPU-0"}
+
+	mapper := &slurmMapper{procRoot: t.TempDir()}
+	assert.Error(t, mapper.Process(MetricsByCounter{}, sysInfo))
+}
+
+func TestSlurmMapper_Name(t *testing.T) {
+	assert.Equal(t, "slurmMapper", newSlurmMapper().Name())
+}
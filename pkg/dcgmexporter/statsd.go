@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Formats of the tags of the StatsD lines
+const (
+	StatsDTagFormatDogStatsD = "dogstatsd" // name:value|g|#label:value,...
+	StatsDTagFormatInflux    = "influx"    // name,label=value,...:value|g, as parsed by Telegraf
+	StatsDTagFormatNone      = "none"      // name:value|g, plain StatsD without tags
+)
+
+const (
+	// statsDUDPPacketSize keeps the datagrams under the MTU of most networks, a UDS datagram can be larger
+	statsDUDPPacketSize = 1432
+	statsDUDSPacketSize = 8192
+)
+
+var statsDTagReplacer = map[string]*strings.Replacer{
+	StatsDTagFormatDogStatsD: strings.NewReplacer(",", "_", "|", "_", ":", "_", "\n", "_"),
+	StatsDTagFormatInflux:    strings.NewReplacer(",", "_", "=", "_", " ", "_", ":", "_", "|", "_", "\n", "_"),
+}
+
+// statsDWriter sends the collected metrics as StatsD gauges to a UDP or Unix datagram socket
+type statsDWriter struct {
+	address    string
+	tagFormat  string
+	packetSize int
+	timeout    time.Duration
+	conn       net.Conn
+}
+
+// ParseStatsDAddress returns the network and the address of a StatsD endpoint specified as <HOST>:<PORT>,
+// udp://<HOST>:<PORT> or unix://<PATH>
+func ParseStatsDAddress(address string) (string, string, error) {
+	if !strings.Contains(address, "://") {
+		address = "udp://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch u.Scheme {
+	case "udp":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", "", err
+		}
+		return "udp", u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("no socket path in '%s'", address)
+		}
+		return "unixgram", u.Path, nil
+	}
+
+	return "", "", fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+}
+
+func newStatsDWriter(c *Config) (*statsDWriter, func(), error) {
+	network, address, err := ParseStatsDAddress(c.StatsDAddress)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("invalid StatsD address '%s'; err: %w", c.StatsDAddress, err)
+	}
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("cannot connect to StatsD '%s'; err: %w", c.StatsDAddress, err)
+	}
+
+	packetSize := statsDUDPPacketSize
+	if network == "unixgram" {
+		packetSize = statsDUDSPacketSize
+	}
+
+	tagFormat := c.StatsDTagFormat
+	if tagFormat == "" {
+		tagFormat = StatsDTagFormatDogStatsD
+	}
+
+	w := &statsDWriter{
+		address:    c.StatsDAddress,
+		tagFormat:  tagFormat,
+		packetSize: packetSize,
+		timeout:    time.Duration(c.CollectInterval) * time.Millisecond,
+		conn:       conn,
+	}
+
+	return w, func() {
+		if err := conn.Close(); err != nil {
+			logrus.Warnf("Failed to close the StatsD connection; err: %v", err)
+		}
+	}, nil
+}
+
+func (w *statsDWriter) target() string {
+	return w.address
+}
+
+func (w *statsDWriter) push(_ context.Context, batch pushBatch) error {
+	var lines []string
+	for _, i := range batch.entities {
+		lines = append(lines, toStatsDLines(i, batch.metrics[i], w.tagFormat)...)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+		return err
+	}
+
+	for _, packet := range statsDPackets(lines, w.packetSize) {
+		if _, err := w.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statsDPackets joins the lines with line feeds into datagrams of at most size bytes.
+// A line longer than size is sent alone.
+func statsDPackets(lines []string, size int) [][]byte {
+	var packets [][]byte
+	var packet bytes.Buffer
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > size {
+			packets = append(packets, bytes.Clone(packet.Bytes()))
+			packet.Reset()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		packets = append(packets, packet.Bytes())
+	}
+
+	return packets
+}
+
+// toStatsDLines converts the metrics of the entity at index i into StatsD gauges, tagged with the labels rendered by
+// the text template of the entity in the given format. Non-numeric values are skipped.
+func toStatsDLines(i int, metrics MetricsByCounter, tagFormat string) []string {
+	var res []string
+
+	for counter, values := range metrics {
+		for _, metric := range values {
+			value, err := strconv.ParseFloat(metric.Value, 64)
+			if err != nil {
+				logrus.Debugf("Skipping non-numeric value '%s' of %s for StatsD", metric.Value, counter.FieldName)
+				continue
+			}
+
+			formatted := strconv.FormatFloat(value, 'f', -1, 64)
+			if tagFormat == StatsDTagFormatNone {
+				res = append(res, fmt.Sprintf("%s:%s|g", counter.FieldName, formatted))
+				continue
+			}
+
+			labels := entityLabels(i, metric)
+			for k, v := range metric.Labels {
+				labels[k] = v
+			}
+			for k, v := range metric.Attributes {
+				labels[k] = v
+			}
+
+			names := make([]string, 0, len(labels))
+			for k := range labels {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+
+			replacer := statsDTagReplacer[tagFormat]
+			tags := make([]string, 0, len(names))
+			for _, k := range names {
+				switch tagFormat {
+				case StatsDTagFormatDogStatsD:
+					tags = append(tags, replacer.Replace(k)+":"+replacer.Replace(labels[k]))
+				case StatsDTagFormatInflux:
+					tags = append(tags, replacer.Replace(k)+"="+replacer.Replace(labels[k]))
+				}
+			}
+
+			switch tagFormat {
+			case StatsDTagFormatDogStatsD:
+				res = append(res, fmt.Sprintf("%s:%s|g|#%s", counter.FieldName, formatted, strings.Join(tags, ",")))
+			case StatsDTagFormatInflux:
+				res = append(res, fmt.Sprintf("%s,%s:%s|g", counter.FieldName, strings.Join(tags, ","), formatted))
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsDAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     string
+		wantNetwork string
+		wantAddress string
+		wantErr     bool
+	}{
+		{
+			name:        "When the address has no scheme, it is UDP",
+			address:     "localhost:8125",
+			wantNetwork: "udp",
+			wantAddress: "localhost:8125",
+		},
+		{
+			name:        "When the scheme is udp",
+			address:     "udp://10.0.0.1:8125",
+			wantNetwork: "udp",
+			wantAddress: "10.0.0.1:8125",
+		},
+		{
+			name:        "When the scheme is unix",
+			address:     "unix:///var/run/datadog/dsd.socket",
+			wantNetwork: "unixgram",
+			wantAddress: "/var/run/datadog/dsd.socket",
+		},
+		{
+			name:    "When the UDP address has no port",
+			address: "udp://localhost",
+			wantErr: true,
+		},
+		{
+			name:    "When the unix address has no path",
+			address: "unix://",
+			wantErr: true,
+		},
+		{
+			name:    "When the scheme is unsupported",
+			address: "tcp://localhost:8125",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, address, err := ParseStatsDAddress(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNetwork, network)
+			assert.Equal(t, tt.wantAddress, address)
+		})
+	}
+}
+
+func TestToStatsDLines(t *testing.T) {
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	metrics := MetricsByCounter{
+		counter: {
+			{
+				GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", GPUDevice: "nvidia0", GPUModelName: "NVIDIA A100",
+				GPUPCIBusID: "00000000:01:00.0", Hostname: "node-1", Value: "42.5",
+				Labels:     map[string]string{"team": "a,b"},
+				Attributes: map[string]string{},
+			},
+			{GPU: "1", Value: "N/A"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		tagFormat string
+		want      []string
+	}{
+		{
+			name:      "When the tags are in the DogStatsD format",
+			tagFormat: StatsDTagFormatDogStatsD,
+			want: []string{
+				"DCGM_FI_DEV_GPU_TEMP:42.5|g|#Hostname:node-1,UUID:GPU-0,device:nvidia0,gpu:0," +
+					"modelName:NVIDIA A100,pci_bus_id:00000000_01_00.0,team:a_b",
+			},
+		},
+		{
+			name:      "When the tags are in the InfluxDB format",
+			tagFormat: StatsDTagFormatInflux,
+			want: []string{
+				"DCGM_FI_DEV_GPU_TEMP,Hostname=node-1,UUID=GPU-0,device=nvidia0,gpu=0," +
+					"modelName=NVIDIA_A100,pci_bus_id=00000000_01_00.0,team=a_b:42.5|g",
+			},
+		},
+		{
+			name:      "When the metrics aren't tagged",
+			tagFormat: StatsDTagFormatNone,
+			want:      []string{"DCGM_FI_DEV_GPU_TEMP:42.5|g"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, toStatsDLines(0, metrics, tt.tagFormat))
+		})
+	}
+}
+
+func TestStatsDPackets(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		size  int
+		want  []string
+	}{
+		{
+			name:  "When the lines fit in a packet",
+			lines: []string{"a:1|g", "b:2|g"},
+			size:  16,
+			want:  []string{"a:1|g\nb:2|g"},
+		},
+		{
+			name:  "When the lines exceed the packet size",
+			lines: []string{"a:1|g", "b:2|g", "c:3|g"},
+			size:  11,
+			want:  []string{"a:1|g\nb:2|g", "c:3|g"},
+		},
+		{
+			name:  "When a line is longer than the packet size, it is sent alone",
+			lines: []string{"a:1|g", "long_name:2|g", "c:3|g"},
+			size:  8,
+			want:  []string{"a:1|g", "long_name:2|g", "c:3|g"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, packet := range statsDPackets(tt.lines, tt.size) {
+				got = append(got, string(packet))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStatsDWriter_Push(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer udp.Close()
+
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+	uds, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer uds.Close()
+
+	tests := []struct {
+		name     string
+		address  string
+		listener net.PacketConn
+	}{
+		{
+			name:     "When the endpoint is UDP",
+			address:  udp.LocalAddr().String(),
+			listener: udp,
+		},
+		{
+			name:     "When the endpoint is a Unix socket",
+			address:  "unix://" + socket,
+			listener: uds,
+		},
+	}
+
+	counter := Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}
+	batch := pushBatch{
+		entities: []int{0},
+		metrics:  []MetricsByCounter{{counter: {{GPU: "0", GPUUUID: "GPU-0", UUID: "UUID", Value: "42"}}}},
+		time:     time.Now(),
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, cleanup, err := newStatsDWriter(&Config{StatsDAddress: tt.address, CollectInterval: 1000})
+			require.NoError(t, err)
+			defer cleanup()
+
+			require.NoError(t, writer.push(context.Background(), batch))
+
+			buf := make([]byte, statsDUDSPacketSize)
+			require.NoError(t, tt.listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+			n, _, err := tt.listener.ReadFrom(buf)
+			require.NoError(t, err)
+
+			got := string(buf[:n])
+			assert.True(t, strings.HasPrefix(got, "DCGM_FI_DEV_GPU_TEMP:42|g|#"), got)
+			assert.Contains(t, got, "UUID:GPU-0")
+		})
+	}
+}
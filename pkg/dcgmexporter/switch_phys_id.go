@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"strconv"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+// populateSwitchPhysIDs reads the physical ID of the switches once, the entity IDs DCGM assigns to the switches can
+// change across reboots while the physical IDs identify the same switch. The switches whose physical ID cannot be
+// read keep an empty one.
+func populateSwitchPhysIDs(sysInfo *SystemInfo) {
+	if len(sysInfo.Switches) == 0 {
+		return
+	}
+
+	entities := make([]dcgm.GroupEntityPair, 0, len(sysInfo.Switches))
+	for _, sw := range sysInfo.Switches {
+		entities = append(entities, dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_SWITCH, EntityId: sw.EntityId})
+	}
+
+	values, err := dcgmEntitiesGetLatestValues(entities, []dcgm.Short{dcgm.DCGM_FI_DEV_NVSWITCH_PHYS_ID},
+		dcgm.DCGM_FV_FLAG_LIVE_DATA)
+	if err != nil {
+		logrus.Warnf("Failed to read the physical ID of the switches; err: %v", err)
+		return
+	}
+
+	for _, v := range values {
+		if v.Status != 0 || v.FieldType != dcgm.DCGM_FT_INT64 || v.Int64() >= dcgm.DCGM_FT_INT64_BLANK {
+			continue
+		}
+
+		for i := range sysInfo.Switches {
+			if sysInfo.Switches[i].EntityId == v.EntityId {
+				sysInfo.Switches[i].PhysID = strconv.FormatInt(v.Int64(), 10)
+			}
+		}
+	}
+}
+
+// setSwitchPhysIDs labels the switch and link metrics with the physical ID of their switch, which is the entity of
+// the switch metrics and the parent of the link metrics
+func setSwitchPhysIDs(metrics MetricsByCounter, sysInfo SystemInfo) {
+	physIDs := make(map[string]string, len(sysInfo.Switches))
+	for _, sw := range sysInfo.Switches {
+		if sw.PhysID != "" {
+			physIDs[strconv.FormatUint(uint64(sw.EntityId), 10)] = sw.PhysID
+		}
+	}
+
+	if len(physIDs) == 0 {
+		return
+	}
+
+	for counter := range metrics {
+		for j := range metrics[counter] {
+			switchID := metrics[counter][j].GPU
+			if sysInfo.InfoType == dcgm.FE_LINK {
+				switchID = metrics[counter][j].GPUDevice
+			}
+			metrics[counter][j].SwitchPhysID = physIDs[switchID]
+		}
+	}
+}
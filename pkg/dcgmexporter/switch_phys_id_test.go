@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopulateSwitchPhysIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []dcgm.FieldValue_v2
+		err    error
+		want   []string
+	}{
+		{
+			name: "When DCGM reports the physical IDs, they are set",
+			values: []dcgm.FieldValue_v2{
+				{EntityId: 0, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(9)},
+				{EntityId: 1, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(8)},
+			},
+			want: []string{"9", "8"},
+		},
+		{
+			name: "When a physical ID is blank, it is left empty",
+			values: []dcgm.FieldValue_v2{
+				{EntityId: 0, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(9)},
+				{EntityId: 1, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)},
+			},
+			want: []string{"9", ""},
+		},
+		{
+			name: "When the physical IDs cannot be read, they are left empty",
+			err:  errors.New("boom"),
+			want: []string{"", ""},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dcgmEntitiesGetLatestValues = func(entities []dcgm.GroupEntityPair, fields []dcgm.Short, _ uint,
+			) ([]dcgm.FieldValue_v2, error) {
+				assert.Len(t, entities, 2)
+				assert.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_NVSWITCH_PHYS_ID}, fields)
+				return tc.values, tc.err
+			}
+			defer func() {
+				dcgmEntitiesGetLatestValues = dcgm.EntitiesGetLatestValues
+			}()
+
+			sysInfo := SpoofSwitchSystemInfo()
+			populateSwitchPhysIDs(&sysInfo)
+
+			require.Len(t, sysInfo.Switches, len(tc.want))
+			for i, want := range tc.want {
+				assert.Equal(t, want, sysInfo.Switches[i].PhysID)
+			}
+		})
+	}
+}
+
+func TestSetSwitchPhysIDs(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS,
+		FieldName: "DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS", PromType: "counter"}
+	values := []dcgm.FieldValue_v1{
+		{FieldId: dcgm.DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS, FieldType: dcgm.DCGM_FT_INT64, Value: int64FieldValue(3)},
+	}
+
+	sysInfo := SpoofSwitchSystemInfo()
+	sysInfo.Switches[1].PhysID = "8"
+
+	tests := []struct {
+		name     string
+		infoType dcgm.Field_Entity_Group
+		mi       MonitoringInfo
+		want     string
+	}{
+		{
+			name:     "When the entity is a switch, it is labeled with its physical ID",
+			infoType: dcgm.FE_SWITCH,
+			mi: MonitoringInfo{
+				Entity:   dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_SWITCH, EntityId: 1},
+				ParentId: PARENT_ID_IGNORED,
+			},
+			want: `DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS{nvswitch="1",nvswitch_phys_id="8"} 3`,
+		},
+		{
+			name:     "When the entity is a link, it is labeled with the physical ID of its switch",
+			infoType: dcgm.FE_LINK,
+			mi: MonitoringInfo{
+				Entity:   dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_LINK, EntityId: 5},
+				ParentId: 1,
+			},
+			want: `DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS{nvlink="5",nvswitch="1",nvswitch_phys_id="8"} 3`,
+		},
+		{
+			name:     "When the physical ID of the switch is unknown, the label is left out",
+			infoType: dcgm.FE_SWITCH,
+			mi: MonitoringInfo{
+				Entity:   dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_SWITCH, EntityId: 0},
+				ParentId: PARENT_ID_IGNORED,
+			},
+			want: `DCGM_FI_DEV_NVSWITCH_LINK_CRC_ERRORS{nvswitch="0"} 3`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sysInfo.InfoType = tc.infoType
+			metrics := MetricsByCounter{}
+			ToSwitchMetric(metrics, values, []Counter{counter}, tc.mi, MetricOptions{})
+			setSwitchPhysIDs(metrics, sysInfo)
+
+			tmpl := switchMetricsTemplate
+			if tc.infoType == dcgm.FE_LINK {
+				tmpl = linkMetricsTemplate
+			}
+			out, err := FormatMetrics(tmpl, metrics)
+			require.NoError(t, err)
+			assert.Contains(t, out, tc.want)
+		})
+	}
+}
@@ -34,6 +34,7 @@ var (
 	dcgmAddEntityToGroup        = dcgm.AddEntityToGroup
 	dcgmCreateGroup             = dcgm.CreateGroup
 	dcgmGetCpuHierarchy         = dcgm.GetCpuHierarchy
+	dcgmEntitiesGetLatestValues = dcgm.EntitiesGetLatestValues
 )
 
 type ComputeInstanceInfo struct {
@@ -45,6 +46,8 @@ type ComputeInstanceInfo struct {
 type GPUInstanceInfo struct {
 	Info             dcgm.MigEntityInfo
 	ProfileName      string
+	MemoryMB         int64  // Total framebuffer of the instance in MiB, 0 when DCGM doesn't report it
+	UUID             string // UUID of the MIG device of the instance, empty when DCGM doesn't report it
 	EntityId         uint
 	ComputeInstances []ComputeInstanceInfo
 }
@@ -58,6 +61,7 @@ type GPUInfo struct {
 type SwitchInfo struct {
 	EntityId uint
 	NvLinks  []dcgm.NvLinkStatus
+	PhysID   string // Physical ID of the switch, stable across reboots unlike EntityId. Empty when DCGM doesn't report it.
 }
 
 type CPUInfo struct {
@@ -74,13 +78,16 @@ type SystemInfo struct {
 	InfoType dcgm.Field_Entity_Group
 	Switches []SwitchInfo
 	CPUs     []CPUInfo
+
+	monitorComputeInstances bool // GPU instances are monitored through their compute instances
 }
 
 type MonitoringInfo struct {
-	Entity       dcgm.GroupEntityPair
-	DeviceInfo   dcgm.Device
-	InstanceInfo *GPUInstanceInfo
-	ParentId     uint
+	Entity              dcgm.GroupEntityPair
+	DeviceInfo          dcgm.Device
+	InstanceInfo        *GPUInstanceInfo
+	ParentId            uint
+	ComputeInstanceInfo *ComputeInstanceInfo // Set when a compute instance of the GPU instance is monitored
 }
 
 func SetGPUInstanceProfileName(sysInfo *SystemInfo, entityId uint, profileName string) bool {
@@ -96,12 +103,67 @@ func SetGPUInstanceProfileName(sysInfo *SystemInfo, entityId uint, profileName s
 	return false
 }
 
+// SetGPUInstanceMemory sets the total framebuffer of the GPU instance, in MiB
+func SetGPUInstanceMemory(sysInfo *SystemInfo, entityId uint, memoryMB int64) bool {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		for j := range sysInfo.GPUs[i].GPUInstances {
+			if sysInfo.GPUs[i].GPUInstances[j].EntityId == entityId {
+				sysInfo.GPUs[i].GPUInstances[j].MemoryMB = memoryMB
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// SetGPUInstanceUUID sets the UUID of the MIG device of the GPU instance
+func SetGPUInstanceUUID(sysInfo *SystemInfo, entityId uint, uuid string) bool {
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		for j := range sysInfo.GPUs[i].GPUInstances {
+			if sysInfo.GPUs[i].GPUInstances[j].EntityId == entityId {
+				sysInfo.GPUs[i].GPUInstances[j].UUID = uuid
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func SetMigProfileNames(sysInfo *SystemInfo, values []dcgm.FieldValue_v2) error {
 	var err error
 	var errFound bool
 	errStr := "cannot find match for entities:"
 
 	for _, v := range values {
+		if v.FieldId == dcgm.DCGM_FI_DEV_FB_TOTAL {
+			// The memory of the instance is only a label, it is left out when DCGM doesn't report it
+			if v.Status != 0 || v.FieldType != dcgm.DCGM_FT_INT64 || v.Int64() >= dcgm.DCGM_FT_INT64_BLANK {
+				continue
+			}
+
+			if !SetGPUInstanceMemory(sysInfo, v.EntityId, v.Int64()) {
+				errStr = fmt.Sprintf("%s group %d, id %d", errStr, v.EntityGroupId, v.EntityId)
+				errFound = true
+			}
+			continue
+		}
+
+		if v.FieldId == dcgm.DCGM_FI_DEV_UUID {
+			// So is the UUID of the instance, DCGM reports a blank string when it doesn't know it
+			if v.Status != 0 || v.FieldType != dcgm.DCGM_FT_STRING || v.StringValue == nil ||
+				!strings.HasPrefix(*v.StringValue, MIG_UUID_PREFIX) {
+				continue
+			}
+
+			if !SetGPUInstanceUUID(sysInfo, v.EntityId, *v.StringValue) {
+				errStr = fmt.Sprintf("%s group %d, id %d", errStr, v.EntityGroupId, v.EntityId)
+				errFound = true
+			}
+			continue
+		}
+
 		if !SetGPUInstanceProfileName(sysInfo, v.EntityId, dcgm.Fv2_String(v)) {
 			errStr = fmt.Sprintf("%s group %d, id %d", errStr, v.EntityGroupId, v.EntityId)
 			errFound = true
@@ -122,7 +184,8 @@ func PopulateMigProfileNames(sysInfo *SystemInfo, entities []dcgm.GroupEntityPai
 	}
 
 	var fields []dcgm.Short
-	fields = append(fields, dcgm.DCGM_FI_DEV_NAME)
+	// The memory and UUID of the instances don't change while they exist, they are read once with their profile
+	fields = append(fields, dcgm.DCGM_FI_DEV_NAME, dcgm.DCGM_FI_DEV_FB_TOTAL, dcgm.DCGM_FI_DEV_UUID)
 	flags := dcgm.DCGM_FV_FLAG_LIVE_DATA
 	values, err := dcgm.EntitiesGetLatestValues(entities, fields, flags)
 
@@ -268,21 +331,13 @@ func VerifyDevicePresence(sysInfo *SystemInfo, gOpt DeviceOptions) error {
 	return nil
 }
 
+// getCoreArray returns the cores set in the bitmask reported by DCGM, however many cores it holds
 func getCoreArray(bitmask []uint64) []uint {
-
 	var cores []uint
-	bits := make([]uint64, dcgm.MAX_CPU_CORE_BITMASK_COUNT)
-
-	for i := 0; i < len(bitmask); i++ {
-		bits[i] = uint64(bitmask[i])
-	}
-
-	b := bitset.From(bits)
 
-	for i := uint(0); i < dcgm.MAX_NUM_CPU_CORES; i++ {
-		if b.Test(i) {
-			cores = append(cores, uint(i))
-		}
+	b := bitset.From(bitmask)
+	for i, found := b.NextSet(0); found; i, found = b.NextSet(i + 1) {
+		cores = append(cores, i)
 	}
 
 	return cores
@@ -343,13 +398,15 @@ func InitializeNvSwitchInfo(sysInfo SystemInfo, sOpt DeviceOptions) (SystemInfo,
 		}
 
 		sw := SwitchInfo{
-			switches[i],
-			matchingLinks,
+			EntityId: switches[i],
+			NvLinks:  matchingLinks,
 		}
 
 		sysInfo.Switches = append(sysInfo.Switches, sw)
 	}
 
+	populateSwitchPhysIDs(&sysInfo)
+
 	sysInfo.sOpt = sOpt
 	err = VerifySwitchDevicePresence(&sysInfo, sOpt)
 	if err == nil {
@@ -359,7 +416,7 @@ func InitializeNvSwitchInfo(sysInfo SystemInfo, sOpt DeviceOptions) (SystemInfo,
 	return sysInfo, err
 }
 
-func InitializeGPUInfo(sysInfo SystemInfo, gOpt DeviceOptions, useFakeGPUs bool) (SystemInfo, error) {
+func InitializeGPUInfo(sysInfo SystemInfo, gOpt DeviceOptions, filter DeviceFilter, useFakeGPUs bool) (SystemInfo, error) {
 	gpuCount, err := dcgmGetAllDeviceCount()
 	if err != nil {
 		return sysInfo, err
@@ -419,6 +476,11 @@ func InitializeGPUInfo(sysInfo SystemInfo, gOpt DeviceOptions, useFakeGPUs bool)
 		}
 	}
 
+	err = filterGPUs(&sysInfo, filter)
+	if err != nil {
+		return sysInfo, err
+	}
+
 	sysInfo.gOpt = gOpt
 	err = VerifyDevicePresence(&sysInfo, gOpt)
 	if err == nil {
@@ -427,8 +489,50 @@ func InitializeGPUInfo(sysInfo SystemInfo, gOpt DeviceOptions, useFakeGPUs bool)
 	return sysInfo, err
 }
 
+// filterGPUs removes the GPUs that don't match the filter, so they are never added to a DCGM group.
+// Every index and UUID of the filter must match a GPU.
+func filterGPUs(sysInfo *SystemInfo, filter DeviceFilter) error {
+	if len(filter.Indices) == 0 && len(filter.UUIDs) == 0 {
+		return nil
+	}
+
+	for _, gpuID := range filter.Indices {
+		if !GPUIdExists(sysInfo, gpuID) {
+			return fmt.Errorf("couldn't find GPU ID '%d' of the device filter", gpuID)
+		}
+	}
+
+	for _, uuid := range filter.UUIDs {
+		if !slices.ContainsFunc(sysInfo.GPUs[:sysInfo.GPUCount], func(gpu GPUInfo) bool {
+			return gpu.DeviceInfo.UUID == uuid
+		}) {
+			return fmt.Errorf("couldn't find GPU UUID '%s' of the device filter", uuid)
+		}
+	}
+
+	var gpus [dcgm.MAX_NUM_DEVICES]GPUInfo
+	count := uint(0)
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		gpu := sysInfo.GPUs[i]
+		if slices.Contains(filter.Indices, int(gpu.DeviceInfo.GPU)) || slices.Contains(filter.UUIDs, gpu.DeviceInfo.UUID) {
+			gpus[count] = gpu
+			count++
+		}
+	}
+
+	sysInfo.GPUs = gpus
+	sysInfo.GPUCount = count
+
+	return nil
+}
+
 func InitializeSystemInfo(
-	gOpt DeviceOptions, sOpt DeviceOptions, cOpt DeviceOptions, useFakeGPUs bool, entityType dcgm.Field_Entity_Group,
+	gOpt DeviceOptions,
+	sOpt DeviceOptions,
+	cOpt DeviceOptions,
+	filter DeviceFilter,
+	useFakeGPUs bool,
+	entityType dcgm.Field_Entity_Group,
 ) (SystemInfo, error) {
 	sysInfo := SystemInfo{}
 
@@ -442,7 +546,7 @@ func InitializeSystemInfo(
 		return InitializeNvSwitchInfo(sysInfo, sOpt)
 	case dcgm.FE_GPU:
 		sysInfo.InfoType = dcgm.FE_GPU
-		return InitializeGPUInfo(sysInfo, gOpt, useFakeGPUs)
+		return InitializeGPUInfo(sysInfo, gOpt, filter, useFakeGPUs)
 	case dcgm.FE_CPU:
 		sysInfo.InfoType = dcgm.FE_CPU
 		return InitializeCPUInfo(sysInfo, cOpt)
@@ -550,7 +654,11 @@ func CreateLinkGroupsFromSystemInfo(sysInfo SystemInfo) ([]dcgm.GroupHandle, []f
 }
 
 func CreateGroupFromSystemInfo(sysInfo SystemInfo) (dcgm.GroupHandle, func(), error) {
-	monitoringInfo := GetMonitoredEntities(sysInfo)
+	return createGroupFromMonitoringInfo(GetMonitoredEntities(sysInfo))
+}
+
+// createGroupFromMonitoringInfo creates a group of the entities
+func createGroupFromMonitoringInfo(monitoringInfo []MonitoringInfo) (dcgm.GroupHandle, func(), error) {
 	groupID, err := dcgmCreateGroup(fmt.Sprintf("gpu-collector-group-%d", rand.Uint64()))
 	if err != nil {
 		return dcgm.GroupHandle{}, func() {}, err
@@ -591,6 +699,7 @@ func AddAllGPUs(sysInfo SystemInfo) []MonitoringInfo {
 			sysInfo.GPUs[i].DeviceInfo,
 			nil,
 			PARENT_ID_IGNORED,
+			nil,
 		}
 		monitoring = append(monitoring, mi)
 	}
@@ -611,6 +720,7 @@ func AddAllSwitches(sysInfo SystemInfo) []MonitoringInfo {
 			dcgm.Device{},
 			nil,
 			PARENT_ID_IGNORED,
+			nil,
 		}
 		monitoring = append(monitoring, mi)
 	}
@@ -640,6 +750,7 @@ func AddAllLinks(sysInfo SystemInfo) []MonitoringInfo {
 				dcgm.Device{},
 				nil,
 				link.ParentId,
+				nil,
 			}
 			monitoring = append(monitoring, mi)
 		}
@@ -746,6 +857,7 @@ func AddAllCPUs(sysInfo SystemInfo) []MonitoringInfo {
 			dcgm.Device{},
 			nil,
 			PARENT_ID_IGNORED,
+			nil,
 		}
 		monitoring = append(monitoring, mi)
 	}
@@ -771,6 +883,7 @@ func AddAllCPUCores(sysInfo SystemInfo) []MonitoringInfo {
 				dcgm.Device{},
 				nil,
 				cpu.EntityId,
+				nil,
 			}
 			monitoring = append(monitoring, mi)
 		}
@@ -789,6 +902,7 @@ func AddAllGPUInstances(sysInfo SystemInfo, addFlexibly bool) []MonitoringInfo {
 				sysInfo.GPUs[i].DeviceInfo,
 				nil,
 				PARENT_ID_IGNORED,
+				nil,
 			}
 			monitoring = append(monitoring, mi)
 		} else {
@@ -801,8 +915,9 @@ func AddAllGPUInstances(sysInfo SystemInfo, addFlexibly bool) []MonitoringInfo {
 					sysInfo.GPUs[i].DeviceInfo,
 					&sysInfo.GPUs[i].GPUInstances[j],
 					PARENT_ID_IGNORED,
+					nil,
 				}
-				monitoring = append(monitoring, mi)
+				monitoring = append(monitoring, withComputeInstances(sysInfo, mi)...)
 			}
 		}
 	}
@@ -810,6 +925,27 @@ func AddAllGPUInstances(sysInfo SystemInfo, addFlexibly bool) []MonitoringInfo {
 	return monitoring
 }
 
+// withComputeInstances replaces a monitored GPU instance by its compute instances when they are monitored.
+// GPU instances without compute instance are monitored as is.
+func withComputeInstances(sysInfo SystemInfo, mi MonitoringInfo) []MonitoringInfo {
+	if !sysInfo.monitorComputeInstances || mi.InstanceInfo == nil || len(mi.InstanceInfo.ComputeInstances) == 0 {
+		return []MonitoringInfo{mi}
+	}
+
+	var monitoring []MonitoringInfo
+	for i := range mi.InstanceInfo.ComputeInstances {
+		ci := mi
+		ci.Entity = dcgm.GroupEntityPair{
+			EntityGroupId: dcgm.FE_GPU_CI,
+			EntityId:      mi.InstanceInfo.ComputeInstances[i].EntityId,
+		}
+		ci.ComputeInstanceInfo = &mi.InstanceInfo.ComputeInstances[i]
+		monitoring = append(monitoring, ci)
+	}
+
+	return monitoring
+}
+
 func GetMonitoringInfoForGPU(sysInfo SystemInfo, gpuID int) *MonitoringInfo {
 	for i := uint(0); i < sysInfo.GPUCount; i++ {
 		if sysInfo.GPUs[i].DeviceInfo.GPU == uint(gpuID) {
@@ -818,6 +954,7 @@ func GetMonitoringInfoForGPU(sysInfo SystemInfo, gpuID int) *MonitoringInfo {
 				sysInfo.GPUs[i].DeviceInfo,
 				nil,
 				PARENT_ID_IGNORED,
+				nil,
 			}
 		}
 	}
@@ -834,6 +971,7 @@ func GetMonitoringInfoForGPUInstance(sysInfo SystemInfo, gpuInstanceID int) *Mon
 					sysInfo.GPUs[i].DeviceInfo,
 					&instance,
 					PARENT_ID_IGNORED,
+					nil,
 				}
 			}
 		}
@@ -870,7 +1008,8 @@ func GetMonitoredEntities(sysInfo SystemInfo) []MonitoringInfo {
 		} else {
 			for _, gpuInstanceID := range sysInfo.gOpt.MinorRange {
 				// We've already verified that everything in the options list exists
-				monitoring = append(monitoring, *GetMonitoringInfoForGPUInstance(sysInfo, gpuInstanceID))
+				mi := GetMonitoringInfoForGPUInstance(sysInfo, gpuInstanceID)
+				monitoring = append(monitoring, withComputeInstances(sysInfo, *mi)...)
 			}
 		}
 	}
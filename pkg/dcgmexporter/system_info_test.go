@@ -139,6 +139,38 @@ func TestMonitoredEntities(t *testing.T) {
 	}
 }
 
+func TestMonitoredComputeInstances(t *testing.T) {
+	sysInfo := SpoofSystemInfo()
+	sysInfo.gOpt.Flex = true
+	sysInfo.GPUs[0].GPUInstances[0].ComputeInstances = []ComputeInstanceInfo{
+		{InstanceInfo: dcgm.MigEntityInfo{NvmlComputeInstanceId: 0}, EntityId: 20},
+		{InstanceInfo: dcgm.MigEntityInfo{NvmlComputeInstanceId: 1}, EntityId: 21},
+	}
+
+	// Compute instances are ignored unless they are monitored
+	monitoring := GetMonitoredEntities(sysInfo)
+	require.Len(t, monitoring, 2)
+	for _, mi := range monitoring {
+		assert.Equal(t, dcgm.FE_GPU_I, mi.Entity.EntityGroupId)
+		assert.Nil(t, mi.ComputeInstanceInfo)
+	}
+
+	sysInfo.monitorComputeInstances = true
+	monitoring = GetMonitoredEntities(sysInfo)
+	require.Len(t, monitoring, 3)
+
+	for i, entityID := range []uint{20, 21} {
+		assert.Equal(t, dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU_CI, EntityId: entityID}, monitoring[i].Entity)
+		assert.Equal(t, uint(0), monitoring[i].InstanceInfo.EntityId)
+		require.NotNil(t, monitoring[i].ComputeInstanceInfo)
+		assert.Equal(t, entityID, monitoring[i].ComputeInstanceInfo.EntityId)
+	}
+
+	// GPU instances without compute instances are monitored as is
+	assert.Equal(t, dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU_I, EntityId: 14}, monitoring[2].Entity)
+	assert.Nil(t, monitoring[2].ComputeInstanceInfo)
+}
+
 func TestVerifyDevicePresence(t *testing.T) {
 	sysInfo := SpoofSystemInfo()
 	var dOpt DeviceOptions
@@ -170,6 +202,37 @@ func TestVerifyDevicePresence(t *testing.T) {
 	require.Equal(t, err, nil, "Expected to have no error, but found %s", err)
 }
 
+func TestFilterGPUs(t *testing.T) {
+	newSysInfo := func() SystemInfo {
+		sysInfo := SpoofSystemInfo()
+		sysInfo.GPUs[0].DeviceInfo.UUID = "GPU-0"
+		sysInfo.GPUs[1].DeviceInfo.UUID = "GPU-1"
+		return sysInfo
+	}
+
+	sysInfo := newSysInfo()
+	require.NoError(t, filterGPUs(&sysInfo, DeviceFilter{}))
+	require.Equal(t, uint(2), sysInfo.GPUCount)
+
+	sysInfo = newSysInfo()
+	require.NoError(t, filterGPUs(&sysInfo, DeviceFilter{Indices: []int{1}}))
+	require.Equal(t, uint(1), sysInfo.GPUCount)
+	require.Equal(t, uint(1), sysInfo.GPUs[0].DeviceInfo.GPU)
+	require.Len(t, sysInfo.GPUs[0].GPUInstances, 1, "GPU instances should be kept with their GPU")
+
+	sysInfo = newSysInfo()
+	require.NoError(t, filterGPUs(&sysInfo, DeviceFilter{UUIDs: []string{"GPU-0"}}))
+	require.Equal(t, uint(1), sysInfo.GPUCount)
+	require.Equal(t, "GPU-0", sysInfo.GPUs[0].DeviceInfo.UUID)
+
+	sysInfo = newSysInfo()
+	require.Error(t, filterGPUs(&sysInfo, DeviceFilter{Indices: []int{0, 10}}), "Expected an error for a non-existent GPU")
+
+	sysInfo = newSysInfo()
+	require.Error(t, filterGPUs(&sysInfo, DeviceFilter{UUIDs: []string{"GPU-10"}}),
+		"Expected an error for a non-existent GPU UUID")
+}
+
 func TestMonitoredSwitches(t *testing.T) {
 	sysInfo := SpoofSwitchSystemInfo()
 
@@ -519,6 +582,87 @@ func TestIsCoreWatched(t *testing.T) {
 	}
 }
 
+func TestGetCoreArray(t *testing.T) {
+	tests := []struct {
+		name    string
+		bitmask []uint64
+		want    []uint
+	}{
+		{
+			name:    "When no core is set",
+			bitmask: []uint64{0, 0},
+			want:    nil,
+		},
+		{
+			name:    "When cores span several words",
+			bitmask: []uint64{0b101, 0, 1 << 63},
+			want:    []uint{0, 2, 191},
+		},
+		{
+			name:    "When the bitmask holds more words than the DCGM maximum",
+			bitmask: append(make([]uint64, dcgm.MAX_CPU_CORE_BITMASK_COUNT), 1),
+			want:    []uint{dcgm.MAX_CPU_CORE_BITMASK_COUNT * 64},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, getCoreArray(tt.bitmask))
+		})
+	}
+}
+
+func TestSetMigProfileNamesWithMemory(t *testing.T) {
+	sysInfo := SystemInfo{GPUCount: 1}
+	sysInfo.GPUs[0].GPUInstances = []GPUInstanceInfo{{EntityId: 1}, {EntityId: 2}}
+
+	memory := int64FieldValue(9856)
+	blank := int64FieldValue(dcgm.DCGM_FT_INT64_BLANK)
+
+	values := []dcgm.FieldValue_v2{
+		{EntityId: 1, FieldId: dcgm.DCGM_FI_DEV_NAME, FieldType: dcgm.DCGM_FT_STRING, StringValue: &fakeProfileName},
+		{EntityId: 1, FieldId: dcgm.DCGM_FI_DEV_FB_TOTAL, FieldType: dcgm.DCGM_FT_INT64, Value: memory},
+		{EntityId: 2, FieldId: dcgm.DCGM_FI_DEV_NAME, FieldType: dcgm.DCGM_FT_STRING, StringValue: &fakeProfileName},
+		{EntityId: 2, FieldId: dcgm.DCGM_FI_DEV_FB_TOTAL, FieldType: dcgm.DCGM_FT_INT64, Value: blank},
+	}
+
+	require.NoError(t, SetMigProfileNames(&sysInfo, values))
+	assert.Equal(t, fakeProfileName, sysInfo.GPUs[0].GPUInstances[0].ProfileName)
+	assert.Equal(t, int64(9856), sysInfo.GPUs[0].GPUInstances[0].MemoryMB)
+	assert.Equal(t, fakeProfileName, sysInfo.GPUs[0].GPUInstances[1].ProfileName)
+	assert.Zero(t, sysInfo.GPUs[0].GPUInstances[1].MemoryMB, "blank values are left out")
+
+	// The memory of an unknown GPU instance is an error, like its profile name
+	values = []dcgm.FieldValue_v2{
+		{EntityId: 3, FieldId: dcgm.DCGM_FI_DEV_FB_TOTAL, FieldType: dcgm.DCGM_FT_INT64, Value: memory},
+	}
+	assert.Error(t, SetMigProfileNames(&sysInfo, values))
+}
+
+func TestSetMigProfileNamesWithUUID(t *testing.T) {
+	sysInfo := SystemInfo{GPUCount: 1}
+	sysInfo.GPUs[0].GPUInstances = []GPUInstanceInfo{{EntityId: 1}, {EntityId: 2}}
+
+	migUUID := "MIG-22222222"
+	blank := dcgm.DCGM_FT_STR_BLANK
+
+	values := []dcgm.FieldValue_v2{
+		{EntityId: 1, FieldId: dcgm.DCGM_FI_DEV_NAME, FieldType: dcgm.DCGM_FT_STRING, StringValue: &fakeProfileName},
+		{EntityId: 1, FieldId: dcgm.DCGM_FI_DEV_UUID, FieldType: dcgm.DCGM_FT_STRING, StringValue: &migUUID},
+		{EntityId: 2, FieldId: dcgm.DCGM_FI_DEV_NAME, FieldType: dcgm.DCGM_FT_STRING, StringValue: &fakeProfileName},
+		{EntityId: 2, FieldId: dcgm.DCGM_FI_DEV_UUID, FieldType: dcgm.DCGM_FT_STRING, StringValue: &blank},
+	}
+
+	require.NoError(t, SetMigProfileNames(&sysInfo, values))
+	assert.Equal(t, migUUID, sysInfo.GPUs[0].GPUInstances[0].UUID)
+	assert.Equal(t, fakeProfileName, sysInfo.GPUs[0].GPUInstances[1].ProfileName)
+	assert.Empty(t, sysInfo.GPUs[0].GPUInstances[1].UUID, "blank values are left out")
+
+	metadata := newGPUMetadata(dcgm.Device{UUID: "GPU-11111111"}, &sysInfo.GPUs[0].GPUInstances[0], nil, false)
+	assert.Equal(t, "GPU-11111111", metadata.UUID)
+	assert.Equal(t, migUUID, metadata.MigUUID)
+}
+
 func TestSetMigProfileNames(t *testing.T) {
 	tests := []struct {
 		name    string
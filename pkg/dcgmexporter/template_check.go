@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"text/template"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// Keys of the fixtures returned by TemplateFixtures
+const (
+	FixtureGPU    = "gpu"
+	FixtureMIG    = "mig"
+	FixtureSwitch = "switch"
+	FixtureCPU    = "cpu"
+)
+
+// RenderTemplate parses the metrics template like the built-in ones, with the same functions and the exemplar
+// sub-template unless the template defines its own, and renders it with the metrics of the fixture. The metrics are
+// grouped by their Counter, as the collectors return them. The errors of parsing and of rendering are returned, so
+// that custom templates can be checked against sample metrics without deploying them, see TemplateFixtures.
+func RenderTemplate(format string, fixture [][]Metric) (string, error) {
+	t, err := template.New("custom").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the template; err: %w", err)
+	}
+
+	if t.Lookup("exemplar") == nil {
+		t = template.Must(t.Parse(exemplarFormat))
+	}
+
+	metrics := MetricsByCounter{}
+	for _, counterMetrics := range fixture {
+		for _, metric := range counterMetrics {
+			metrics[metric.Counter] = append(metrics[metric.Counter], metric)
+		}
+	}
+
+	out, err := FormatMetrics(t, metrics)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the template; err: %w", err)
+	}
+
+	return out, nil
+}
+
+// TemplateFixtures returns representative metrics of a GPU, of a MIG instance, of a switch and of a CPU, by
+// FixtureGPU, FixtureMIG, FixtureSwitch and FixtureCPU, shaped like the metrics of their collectors. They are built
+// on every call, so they can be modified by the caller.
+func TemplateFixtures() map[string][][]Metric {
+	gpuTemp := Counter{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge",
+		Help: "GPU temperature (in C)."}
+	xidErrors := Counter{FieldID: dcgm.DCGM_FI_DEV_XID_ERRORS, FieldName: "DCGM_FI_DEV_XID_ERRORS", PromType: "gauge",
+		Help: "Value of the last XID error encountered."}
+	smActive := Counter{FieldID: dcgm.DCGM_FI_PROF_SM_ACTIVE, FieldName: "DCGM_FI_PROF_SM_ACTIVE", PromType: "gauge",
+		Help: "Ratio of cycles an SM has at least 1 warp assigned."}
+	switchTemp := Counter{FieldID: dcgm.DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT,
+		FieldName: "DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT", PromType: "gauge", Help: "NVSwitch temperature (in C)."}
+	cpuUtil := Counter{FieldID: dcgm.DCGM_FI_DEV_CPU_UTIL_TOTAL, FieldName: "DCGM_FI_DEV_CPU_UTIL_TOTAL",
+		PromType: "gauge", Help: "Total CPU utilization."}
+
+	gpu := func(counter Counter, value string) Metric {
+		return Metric{
+			Counter:          counter,
+			Value:            value,
+			UUID:             "UUID",
+			GPU:              "0",
+			GPUUUID:          "GPU-00000000-0000-0000-0000-000000000000",
+			GPUDevice:        "nvidia0",
+			GPUModelName:     "NVIDIA A100-SXM4-80GB",
+			GPUPCIBusID:      "00000000:07:00.0",
+			GPUDriverVersion: "550.54.15",
+			Hostname:         "node-a",
+			Labels:           map[string]string{},
+			Attributes:       map[string]string{},
+		}
+	}
+
+	xid := gpu(xidErrors, "79")
+	xid.Attributes = map[string]string{"err_code": "79", "err_msg": xidErrCodeToText[79]}
+
+	mig := gpu(smActive, "0.25")
+	mig.MigProfile = "1g.10gb"
+	mig.GPUInstanceID = "7"
+	mig.MigUUID = "MIG-00000000-0000-0000-0000-000000000007"
+	mig.GPUInstanceMemoryMB = "9856"
+	mig.Labels = map[string]string{"pod": "trainer-0", "namespace": "default", "container": "main"}
+
+	return map[string][][]Metric{
+		FixtureGPU: {{gpu(gpuTemp, "42")}, {xid}},
+		FixtureMIG: {{mig}},
+		FixtureSwitch: {{{
+			Counter:      switchTemp,
+			Value:        "37",
+			UUID:         "UUID",
+			GPU:          "0",
+			GPUDevice:    "0",
+			SwitchPhysID: "8",
+			Hostname:     "node-a",
+			Labels:       map[string]string{},
+		}}},
+		FixtureCPU: {{{
+			Counter:  cpuUtil,
+			Value:    "0.5",
+			UUID:     "UUID",
+			GPU:      "0",
+			Hostname: "node-a",
+			Labels:   map[string]string{},
+		}}},
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	fixtures := TemplateFixtures()
+
+	tests := []struct {
+		name    string
+		format  string
+		fixture [][]Metric
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "When the GPU template renders a GPU",
+			format:  migMetricsFormat,
+			fixture: fixtures[FixtureGPU],
+			want: []string{
+				"# TYPE DCGM_FI_DEV_GPU_TEMP gauge",
+				`DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="GPU-00000000-0000-0000-0000-000000000000"`,
+				`err_code="79"`,
+			},
+		},
+		{
+			name:    "When the GPU template renders a MIG instance",
+			format:  migMetricsFormat,
+			fixture: fixtures[FixtureMIG],
+			want:    []string{`GPU_I_PROFILE="1g.10gb",GPU_I_ID="7"`, `pod="trainer-0"`},
+		},
+		{
+			name:    "When the switch template renders a switch",
+			format:  switchMetricsFormat,
+			fixture: fixtures[FixtureSwitch],
+			want:    []string{`DCGM_FI_DEV_NVSWITCH_TEMPERATURE_CURRENT{nvswitch="0",nvswitch_phys_id="8"`},
+		},
+		{
+			name:    "When the CPU template renders a CPU",
+			format:  cpuMetricsFormat,
+			fixture: fixtures[FixtureCPU],
+			want:    []string{`DCGM_FI_DEV_CPU_UTIL_TOTAL{cpu="0",Hostname="node-a"} 0.5`},
+		},
+		{
+			name:    "When the template defines its own exemplar, it is kept",
+			format:  `{{ define "exemplar" }}!{{ end }}{{ range . }}{{ range .Metrics }}{{ template "exemplar" . }}{{ end }}{{ end }}`,
+			fixture: fixtures[FixtureCPU],
+			want:    []string{"!"},
+		},
+		{
+			name:    "When the template is malformed, the parse error is returned",
+			format:  `{{ range . }}`,
+			fixture: fixtures[FixtureGPU],
+			wantErr: "failed to parse the template",
+		},
+		{
+			name:    "When the template uses an unknown field, the render error is returned",
+			format:  `{{ range . }}{{ range .Metrics }}{{ .PodName }}{{ end }}{{ end }}`,
+			fixture: fixtures[FixtureGPU],
+			wantErr: "failed to render the template",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := RenderTemplate(tc.format, tc.fixture)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			for _, want := range tc.want {
+				assert.Contains(t, out, want)
+			}
+		})
+	}
+}
+
+func TestTemplateFixtures(t *testing.T) {
+	fixtures := TemplateFixtures()
+	for _, key := range []string{FixtureGPU, FixtureMIG, FixtureSwitch, FixtureCPU} {
+		assert.NotEmpty(t, fixtures[key], key)
+	}
+
+	// The fixtures are built on every call
+	fixtures[FixtureGPU][0][0].Value = "0"
+	assert.Equal(t, "42", TemplateFixtures()[FixtureGPU][0][0].Value)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// certificateReloader serves the certificate of the metrics server, it can be reloaded without restarting the server
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// reload loads the certificate files again, the current certificate is kept if they are invalid
+func (r *certificateReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate; err: %w", err)
+	}
+
+	r.cert.Store(&cert)
+	return nil
+}
+
+func (r *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// newServerTLSConfig returns the TLS config of the metrics server, or nil when Config.TLSCertFile is unset.
+// Clients must present a certificate signed by Config.TLSClientCAFile when it is set. Config.WebConfigFile can't be
+// set along, the server would serve TLS twice.
+func newServerTLSConfig(c *Config) (*tls.Config, *certificateReloader, error) {
+	if c.TLSCertFile == "" {
+		return nil, nil, nil
+	}
+
+	if c.WebConfigFile != "" {
+		return nil, nil, errors.New("the TLS certificate and the web config file cannot be used together")
+	}
+
+	reloader, err := newCertificateReloader(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if c.TLSClientCAFile != "" {
+		pem, err := readCAFile(c.TLSClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read TLS client CA file; err: %w", err)
+		}
+
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificate found in TLS client CA file '%s'", c.TLSClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, reloader, nil
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	sysOS "os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/dcgm-exporter/internal/pkg/logging"
+)
+
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCertificate writes a certificate signed by parent, or self-signed when parent is nil, to dir
+func newTestCertificate(t *testing.T, dir, name string, parent *testCertificate) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	res := &testCertificate{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, sysOS.WriteFile(res.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, sysOS.WriteFile(res.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return res
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	server := newTestCertificate(t, dir, "server", ca)
+
+	tlsConfig, reloader, err := newServerTLSConfig(&Config{})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+	assert.Nil(t, reloader)
+
+	tlsConfig, _, err = newServerTLSConfig(&Config{TLSCertFile: server.certFile, TLSKeyFile: server.keyFile})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	tlsConfig, _, err = newServerTLSConfig(&Config{
+		TLSCertFile:     server.certFile,
+		TLSKeyFile:      server.keyFile,
+		TLSClientCAFile: ca.certFile,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	_, _, err = newServerTLSConfig(&Config{TLSCertFile: server.certFile, TLSKeyFile: ca.keyFile})
+	assert.Error(t, err)
+
+	_, _, err = newServerTLSConfig(&Config{TLSCertFile: server.certFile, TLSKeyFile: server.keyFile,
+		TLSClientCAFile: server.keyFile})
+	assert.Error(t, err)
+
+	// The web config file would configure TLS too
+	_, _, err = newServerTLSConfig(&Config{TLSCertFile: server.certFile, TLSKeyFile: server.keyFile,
+		WebConfigFile: "web-config.yml"})
+	assert.Error(t, err)
+}
+
+func TestMetricsServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca)
+	clientCert := newTestCertificate(t, dir, "client", ca)
+
+	server, cleanup, err := NewMetricsServer(&Config{
+		TLSCertFile:     serverCert.certFile,
+		TLSKeyFile:      serverCert.keyFile,
+		TLSClientCAFile: ca.certFile,
+	}, make(chan string), NewRegistry(), &MetricsPipeline{config: &Config{}})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// Served like Run does, the certificate comes from the TLS config
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.serveTLS([]net.Listener{listener}, logging.NewLogrusAdapter(logrus.StandardLogger()))
+	}()
+	defer server.server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certificates,
+		}}}
+		return client.Get("https://" + listener.Addr().String() + "/metrics")
+	}
+
+	// The client must present a certificate
+	_, err = get()
+	require.Error(t, err)
+
+	keyPair, err := tls.LoadX509KeyPair(clientCert.certFile, clientCert.keyFile)
+	require.NoError(t, err)
+
+	resp, err := get(keyPair)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMetricsServer_ReloadTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	first := newTestCertificate(t, dir, "first", ca)
+	second := newTestCertificate(t, dir, "second", ca)
+
+	server, cleanup, err := NewMetricsServer(&Config{TLSCertFile: first.certFile, TLSKeyFile: first.keyFile},
+		make(chan string), NewRegistry(), &MetricsPipeline{config: &Config{}})
+	require.NoError(t, err)
+	defer cleanup()
+
+	served := func() string {
+		cert, err := server.server.TLSConfig.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", served())
+
+	// Invalid files keep the current certificate
+	require.NoError(t, sysOS.WriteFile(first.certFile, []byte("garbage"), 0o600))
+	assert.Error(t, server.ReloadTLS())
+	assert.Equal(t, "first", served())
+
+	require.NoError(t, sysOS.Rename(second.certFile, first.certFile))
+	require.NoError(t, sysOS.Rename(second.keyFile, first.keyFile))
+	require.NoError(t, server.ReloadTLS())
+	assert.Equal(t, "second", served())
+
+	// Servers without TLS have nothing to reload
+	plain, cleanup, err := NewMetricsServer(&Config{}, make(chan string), NewRegistry(), &MetricsPipeline{config: &Config{}})
+	require.NoError(t, err)
+	defer cleanup()
+	assert.NoError(t, plain.ReloadTLS())
+}
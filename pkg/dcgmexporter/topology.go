@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pciDevicesPath is the sysfs directory of the PCI devices
+var pciDevicesPath = "/sys/bus/pci/devices"
+
+// getNUMANodes returns the NUMA node of every GPU of the system info, keyed by GPU ID.
+// GPUs that are not attached to a NUMA node, or whose node cannot be read, are left out.
+func getNUMANodes(sysInfo SystemInfo) map[string]string {
+	res := map[string]string{}
+
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		d := sysInfo.GPUs[i].DeviceInfo
+
+		node, err := getNUMANode(d.PCI.BusID)
+		if err != nil {
+			logrus.Warnf("Cannot get the NUMA node of GPU %d; err: %v", d.GPU, err)
+			continue
+		}
+
+		if node != "" {
+			res[fmt.Sprintf("%d", d.GPU)] = node
+		}
+	}
+
+	return res
+}
+
+// getNUMANode reads the NUMA node of a PCI device, it is empty when the platform has no NUMA
+func getNUMANode(busID string) (string, error) {
+	f, err := os.Open(filepath.Join(pciDevicesPath, sysfsBusID(busID), "numa_node"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	node, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return "", err
+	}
+
+	if node < 0 {
+		return "", nil
+	}
+
+	return strconv.Itoa(node), nil
+}
+
+// cpuList converts the CPU affinity reported by DCGM, a set such as {0,1,2,3,8}, into the compact list format of
+// the kernel, such as 0-3,8. It is empty when DCGM couldn't read the affinity, reported as N/A.
+func cpuList(affinity string) string {
+	set := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(affinity), "{"), "}")
+	if set == "" {
+		return ""
+	}
+
+	var ranges []string
+	start, prev := -1, -1
+	for _, field := range strings.Split(set, ",") {
+		cpu, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || cpu <= prev {
+			return ""
+		}
+
+		if cpu != prev+1 || start < 0 {
+			if start >= 0 {
+				ranges = append(ranges, cpuRange(start, prev))
+			}
+			start = cpu
+		}
+		prev = cpu
+	}
+
+	return strings.Join(append(ranges, cpuRange(start, prev)), ",")
+}
+
+func cpuRange(start, end int) string {
+	if start == end {
+		return strconv.Itoa(start)
+	}
+
+	return fmt.Sprintf("%d-%d", start, end)
+}
+
+// sysfsBusID converts a DCGM PCI bus ID, such as 00000000:3B:00.0, into the sysfs form 0000:3b:00.0
+func sysfsBusID(busID string) string {
+	busID = strings.ToLower(busID)
+
+	domain, rest, found := strings.Cut(busID, ":")
+	if found && len(domain) > 4 {
+		busID = domain[len(domain)-4:] + ":" + rest
+	}
+
+	return busID
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysfsBusID(t *testing.T) {
+	assert.Equal(t, "0000:3b:00.0", sysfsBusID("00000000:3B:00.0"))
+	assert.Equal(t, "0000:3b:00.0", sysfsBusID("0000:3B:00.0"))
+	assert.Equal(t, "", sysfsBusID(""))
+}
+
+func TestCPUList(t *testing.T) {
+	tests := []struct {
+		name     string
+		affinity string
+		want     string
+	}{
+		{
+			name:     "When the CPUs are contiguous, they are a range",
+			affinity: "{0,1,2,3}",
+			want:     "0-3",
+		},
+		{
+			name:     "When the CPUs are split, they are a list of ranges",
+			affinity: "{0,1,2,8,10,11}",
+			want:     "0-2,8,10-11",
+		},
+		{
+			name:     "When a single CPU is local, it is the list",
+			affinity: "{5}",
+			want:     "5",
+		},
+		{
+			name:     "When DCGM couldn't read the affinity, it is empty",
+			affinity: "N/A",
+			want:     "",
+		},
+		{
+			name:     "When no CPU is local, it is empty",
+			affinity: "{}",
+			want:     "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, cpuList(tc.affinity))
+		})
+	}
+}
+
+func TestGetNUMANodes(t *testing.T) {
+	dir := t.TempDir()
+	for busID, node := range map[string]string{"0000:3b:00.0": "1\n", "0000:86:00.0": "-1\n"} {
+		require.NoError(t, sysOS.MkdirAll(filepath.Join(dir, busID), 0o755))
+		require.NoError(t, sysOS.WriteFile(filepath.Join(dir, busID, "numa_node"), []byte(node), 0o600))
+	}
+
+	defer func(path string) {
+		pciDevicesPath = path
+	}(pciDevicesPath)
+	pciDevicesPath = dir
+
+	sysInfo := SystemInfo{GPUCount: 3, InfoType: dcgm.FE_GPU}
+	sysInfo.GPUs[0].DeviceInfo = dcgm.Device{GPU: 0, PCI: dcgm.PCIInfo{BusID: "00000000:3B:00.0"}}
+	sysInfo.GPUs[1].DeviceInfo = dcgm.Device{GPU: 1, PCI: dcgm.PCIInfo{BusID: "00000000:86:00.0"}}
+	sysInfo.GPUs[2].DeviceInfo = dcgm.Device{GPU: 2, PCI: dcgm.PCIInfo{BusID: "00000000:AF:00.0"}}
+
+	// GPU 1 has no NUMA node and the sysfs entry of GPU 2 is missing
+	assert.Equal(t, map[string]string{"0": "1"}, getNUMANodes(sysInfo))
+}
+
+func TestFormatMetricsWithNUMANode(t *testing.T) {
+	counter := Counter{FieldID: 150, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge", Help: "Temperature Help info"}
+
+	metric := Metric{
+		Counter:     counter,
+		Value:       "42",
+		GPU:         "0",
+		UUID:        "UUID",
+		GPUUUID:     "fake0",
+		GPUDevice:   "nvidia0",
+		GPUPCIBusID: "00000000:3B:00.0",
+		GPUNUMANode: "1",
+	}
+
+	tmpl := migMetricsTemplate
+
+	out, err := FormatMetrics(tmpl, MetricsByCounter{counter: {metric}})
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP DCGM_FI_DEV_GPU_TEMP Temperature Help info
+# TYPE DCGM_FI_DEV_GPU_TEMP gauge
+DCGM_FI_DEV_GPU_TEMP{gpu="0",UUID="fake0",pci_bus_id="00000000:3B:00.0",numa_node="1",device="nvidia0",modelName=""} 42
+`, out)
+}
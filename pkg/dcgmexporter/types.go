@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
 
 	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
 	"github.com/prometheus/exporter-toolkit/web"
@@ -39,8 +41,13 @@ var (
 	namespaceAttribute = "namespace"
 	containerAttribute = "container"
 
+	sharingStrategyAttribute = "sharing_strategy"
+
 	hpcJobAttribute = "hpc_job"
 
+	slurmJobIDAttribute = "slurm_job_id"
+	slurmUserAttribute  = "slurm_user"
+
 	oldPodAttribute       = "pod_name"
 	oldNamespaceAttribute = "pod_namespace"
 	oldContainerAttribute = "container_name"
@@ -53,6 +60,16 @@ type Transform interface {
 	Name() string
 }
 
+// EntityCollector collects the metrics of the entities of one type for the MetricsPipeline, which transforms and
+// formats them the same way whatever the backend. DCGMCollector is the default implementation, other backends plug
+// into the pipeline with a CollectorConstructor or AddCollector. Implementations must be comparable, like pointers.
+type EntityCollector interface {
+	Collector
+
+	// SystemInfo returns the entities the metrics are collected from, the transformations map the metrics with it
+	SystemInfo() SystemInfo
+}
+
 type MetricsPipeline struct {
 	config *Config
 
@@ -62,23 +79,79 @@ type MetricsPipeline struct {
 	linkMetricsFormat    *template.Template
 	cpuMetricsFormat     *template.Template
 	cpuCoreMetricsFormat *template.Template
+	processMetricsFormat *template.Template
+	vgpuMetricsFormat    *template.Template
 
 	counters        []Counter
-	gpuCollector    *DCGMCollector
-	switchCollector *DCGMCollector
-	linkCollector   *DCGMCollector
-	cpuCollector    *DCGMCollector
-	coreCollector   *DCGMCollector
+	gpuCollector    EntityCollector
+	switchCollector EntityCollector
+	linkCollector   EntityCollector
+	cpuCollector    EntityCollector
+	coreCollector   EntityCollector
+
+	additionalCollectors map[int][]EntityCollector // Merged with the collector of their entity by index, see AddCollector
+
+	processCollector *processCollector // Collected with the GPUs, nil unless Config.EnableProcessMetrics or EnableProcessMemoryMetrics is set
+	vgpuCollector    *vgpuCollector    // Collected with the GPUs, nil unless Config.EnableVGPU is set
+
+	metricGroups []dcgm.MetricGroup // Profiling metric groups watched for the counters
+
+	pushQueues []*pushQueue // Remote write and OTLP, fed with every successful collection
+
+	hostengine *Hostengine // Connection to the remote nv-hostengines, nil when DCGM is embedded, see SetHostengine
+
+	mtx      sync.Mutex         // Serializes collections with Reload, which swaps the collectors
+	cache    []string           // Most recent formatted output, indexed by pipeline entity
+	latest   []MetricsByCounter // Most recent metrics, indexed by pipeline entity
+	health   []entityHealth     // Collector health, indexed by pipeline entity
+	inFlight sync.Map           // Collectors whose GetMetrics call hasn't returned yet, only tracked with Config.CollectTimeout
+
+	collectionDuration time.Duration // Duration of the collections of the last tick, they run concurrently
+	droppedSeries      uint64        // Number of series dropped to respect Config.MaxSeries
+
+	lastSuccess    atomic.Int64  // Unix time in ns of the last successful collection, 0 if none
+	coalescedTicks atomic.Uint64 // Number of payloads replaced by a newer one before they were read
 }
 
 type DCGMCollector struct {
 	Counters                 []Counter
 	DeviceFields             []dcgm.Short
 	Cleanups                 []func()
+	Connection               uint64 // Connection to DCGM of the cleanups, see staleConnection
 	UseOldNamespace          bool
 	SysInfo                  SystemInfo
 	Hostname                 string
 	ReplaceBlanksInModelName bool
+	UseSampleTimestamp       bool
+	NUMANodes                map[string]string // NUMA node by GPU ID, nil unless Config.EnableTopologyLabels is set
+	DriverLabels             bool              // Labels the GPU metrics with the driver and VBIOS versions
+	CPUAffinityLabel         bool              // Labels the GPU metrics with the CPUs local to the GPU
+	MissingValue             string            // Reported for the blank values of numeric fields, empty skips them
+	NVLinkBandwidth          float64           // Bandwidth of a link in each direction in bytes/s, 0 when unknown
+
+	// GPUs watching the fields requested only by counters restricted to a subset of the GPUs, nil if there are none
+	FieldDevices map[dcgm.Short][]uint
+
+	histograms       map[string]*Histogram             // Cumulative distribution by series of the histogram counters
+	sampling         *samplingWatch                    // Watch of the fields of the sampled counters, nil if none
+	entities         []monitoredEntity                 // Derived from SysInfo once, see monitoredEntities
+	nvlinkThroughput map[string]nvlinkThroughputSample // Last throughput sample by link and direction
+}
+
+// MetricOptions controls how ToMetric, ToSwitchMetric and ToCPUMetric convert the field values into metrics
+type MetricOptions struct {
+	UseOldNamespace          bool   // Labels the metrics with "uuid" rather than "UUID", like dcgm-exporter 1.x
+	Hostname                 string // Value of the Hostname label
+	ReplaceBlanksInModelName bool   // Replaces the blanks of the GPU model names with dashes, only used by ToMetric
+	UseSampleTimestamp       bool   // Timestamps the metrics with the time DCGM sampled their values
+	MissingValue             string // Reported for the blank values of numeric fields, empty skips them
+}
+
+// monitoredEntity is an entity monitored by a DCGMCollector, with the static metadata of GPU entities
+type monitoredEntity struct {
+	MonitoringInfo
+	metadata gpuMetadata
+	fields   []dcgm.Short // Device fields watched on the entity, nil when it watches all of them
 }
 
 type Counter struct {
@@ -86,26 +159,54 @@ type Counter struct {
 	FieldName string
 	PromType  string
 	Help      string
+	Buckets   string  // Upper bounds of the histogram buckets separated by ';', empty unless PromType is histogram
+	Scope     string  // Entity collecting the counter, empty to route it by the entity level of its field
+	Scale     float64 // Multiplies the collected values, 0 leaves them unchanged like 1
+	Devices   string  // GPUs collecting the counter, see parseDevices, empty to collect it on every GPU
+
+	// Statistics of the samples taken between two collections separated by ';', see parseAggregations
+	Aggregations string
 }
 
 type Metric struct {
-	Counter Counter
-	Value   string
+	Counter   Counter
+	Value     string
+	Timestamp string // DCGM sample timestamp in ms, empty when not exported
 
-	GPU          string
-	GPUUUID      string
-	GPUDevice    string
-	GPUModelName string
-	GPUPCIBusID  string
+	GPU              string
+	GPUUUID          string
+	GPUDevice        string
+	GPUModelName     string
+	GPUPCIBusID      string
+	GPUNUMANode      string
+	GPUDriverVersion string // Empty unless Config.EnableDriverLabels is set
+	GPUVBIOSVersion  string // Empty unless Config.EnableDriverLabels is set
+	GPUCPUAffinity   string // Empty unless Config.EnableCPUAffinityLabel is set
 
 	UUID string
 
-	MigProfile    string
-	GPUInstanceID string
-	Hostname      string
+	MigProfile           string
+	GPUInstanceID        string
+	MigUUID              string // UUID of the MIG device of the GPU instance, empty for the GPUs or when unknown
+	GPUInstanceMemoryMB  string // Total framebuffer of the GPU instance in MiB, empty when unknown
+	GPUComputeInstanceID string // Only set when the compute instances are monitored
+	VGPUInstance         string // ID of the vGPU instance of the metrics of the vGPU collector
+	SwitchPhysID         string // Physical ID of the switch of the switch and link metrics, empty when unknown
+	Hostname             string
 
 	Labels     map[string]string
 	Attributes map[string]string
+
+	Histogram *Histogram // Distribution of the observed values, only set for histogram counters
+	Suffix    string     // Appended to the counter name by the series of a histogram
+	Exemplar  *Exemplar  // Attached by a transformation, only rendered in the OpenMetrics output of counters
+}
+
+// Exemplar links a metric to a trace, like the one of the workload running on the GPU
+type Exemplar struct {
+	Labels    map[string]string // Identify the trace, like trace_id
+	Value     string
+	Timestamp string // In ms, optional
 }
 
 func (m Metric) getIDOfType(idType KubernetesGPUIDType) (string, error) {
@@ -133,21 +234,34 @@ var promMetricType = map[string]bool{
 type MetricsServer struct {
 	sync.Mutex
 
-	server      *http.Server
-	webConfig   *web.FlagConfig
-	metrics     string
-	metricsChan chan string
-	registry    *Registry
+	server            *http.Server
+	adminServer       *http.Server // Serves the operational endpoints when Config.AdminListenAddress is set, nil otherwise
+	webConfig         *web.FlagConfig
+	certificates      *certificateReloader // Set when the server uses TLS
+	metrics           string
+	buildInfo         string // Formatted once, it is the same for every scrape
+	adminBuildInfo    string // Replaces buildInfo when the self-metrics are served by the admin server
+	metricsChan       chan string
+	registry          *Registry
+	pipeline          *MetricsPipeline
+	format            string
+	metricNamePrefix  string
+	gpuLabelStrategy  string
+	enableCompression bool
 }
 
 type PodMapper struct {
-	Config *Config
+	Config       *Config
+	podResources podResourcesLister
+	failures     atomic.Uint64 // Number of Process calls that could not list the pods
 }
 
 type PodInfo struct {
 	Name      string
 	Namespace string
 	Container string
+
+	SharingStrategy string
 }
 
 // MetricsByCounter represents a map where each Counter is associated with a slice of Metric objects
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+// ValidateCounters reads the counters of Config.CollectorsFile like GetCounterSet, but reports every invalid
+// counter instead of stopping at the first one. It doesn't call DCGM, so it runs on machines without GPU.
+// Whether a profiling field is supported depends on the GPU, so they are all accepted.
+func ValidateCounters(c *Config) (*CounterSet, []error) {
+	records, positions, err := ReadCSVFiles(c.CollectorsFile)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	profilingFields := dcgm.MetricGroup{}
+	for fieldID := uint(dcpFieldsStart); fieldID < cpuFieldsStart; fieldID++ {
+		profilingFields.FieldIds = append(profilingFields.FieldIds, fieldID)
+	}
+
+	config := *c
+	config.CollectDCP = true
+	config.MetricGroups = []dcgm.MetricGroup{profilingFields}
+
+	var errs []error
+	res := &CounterSet{}
+	for i, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+
+		cs, err := extractCounters([][]string{record}, positions[i:i+1], &config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid counter '%s'; err: %w", record[0], err))
+			continue
+		}
+
+		res.ExporterCounters = append(res.ExporterCounters, cs.ExporterCounters...)
+		res.DCGMCounters = append(res.DCGMCounters, cs.DCGMCounters...)
+	}
+
+	if len(errs) > 0 {
+		return res, errs
+	}
+
+	res, err = filterCounters(res, &config)
+	if err != nil {
+		return res, []error{err}
+	}
+
+	return res, nil
+}
+
+// SeriesNames returns the names of the series exported for the counter, labels export none
+func SeriesNames(counter Counter) []string {
+	switch counter.PromType {
+	case "label":
+		return nil
+	case histogramType:
+		return []string{
+			counter.FieldName + bucketSuffix,
+			counter.FieldName + histogramSumSuffix,
+			counter.FieldName + histogramCntSuffix,
+		}
+	default:
+		return []string{counter.FieldName}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	sysOS "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCounters(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantNames []string
+		wantErrs  []string
+	}{
+		{
+			name: "When every counter is valid they are returned",
+			content: "DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n" +
+				"DCGM_FI_PROF_GR_ENGINE_ACTIVE, gauge, Ratio of time the graphics engine is active.\n" +
+				"DCGM_EXP_XID_ERRORS_COUNT, gauge, Count of XID Errors.\n",
+			wantNames: []string{"DCGM_FI_DEV_GPU_TEMP", "DCGM_FI_PROF_GR_ENGINE_ACTIVE", "DCGM_EXP_XID_ERRORS_COUNT"},
+		},
+		{
+			name: "When counters are invalid each of them is reported",
+			content: "DCGM_FI_DEV_GPU_TEMP, gauge, GPU temperature (in C).\n" +
+				"DCGM_FI_DEV_UNKNOWN, gauge, Unknown field.\n" +
+				"DCGM_FI_DEV_POWER_USAGE, gaugee, Power draw (in W).\n" +
+				"DCGM_EXP_XID_ERRORS_COUNT, countr, Count of XID Errors.\n",
+			wantErrs: []string{"DCGM_FI_DEV_UNKNOWN", "gaugee", "countr"},
+		},
+		{
+			name: "When a counter is invalid its file and physical line are reported",
+			content: "# Temperature\n" +
+				"\n" +
+				"DCGM_FI_DEV_GPU_TEMP, gaugee, GPU temperature (in C).\n",
+			wantErrs: []string{"counters.csv:3"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "counters.csv")
+			require.NoError(t, sysOS.WriteFile(path, []byte(tc.content), 0o600))
+
+			cs, errs := ValidateCounters(&Config{CollectorsFile: path})
+			require.Len(t, errs, len(tc.wantErrs))
+			for i, want := range tc.wantErrs {
+				assert.Contains(t, errs[i].Error(), want)
+			}
+
+			if len(tc.wantErrs) > 0 {
+				return
+			}
+
+			var names []string
+			for _, counter := range append(cs.DCGMCounters, cs.ExporterCounters...) {
+				names = append(names, counter.FieldName)
+			}
+			assert.ElementsMatch(t, tc.wantNames, names)
+		})
+	}
+}
+
+func TestSeriesNames(t *testing.T) {
+	assert.Equal(t, []string{"DCGM_FI_DEV_GPU_TEMP"},
+		SeriesNames(Counter{FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"}))
+	assert.Equal(t, []string{"DCGM_FI_DEV_SM_CLOCK_bucket", "DCGM_FI_DEV_SM_CLOCK_sum", "DCGM_FI_DEV_SM_CLOCK_count"},
+		SeriesNames(Counter{FieldName: "DCGM_FI_DEV_SM_CLOCK", PromType: "histogram", Buckets: "500;1000"}))
+	assert.Empty(t, SeriesNames(Counter{FieldName: "DCGM_FI_DRIVER_VERSION", PromType: "label"}))
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+var watchEntityFieldsHook = watchEntityFields
+
+// isVGPUField reports whether the field is reported per vGPU instance rather than per GPU
+func isVGPUField(fieldID dcgm.Short) bool {
+	return fieldID >= dcgm.DCGM_FI_DEV_VGPU_VM_ID && fieldID <= dcgm.DCGM_FI_DEV_VGPU_VM_GPU_INSTANCE_ID
+}
+
+// vgpuCollector reports the vGPU fields of the vGPU instances running on the monitored GPUs, labeled with the
+// vgpu_instance label. The instances come and go with their VMs, so they are listed on every collection and
+// the watch of the fields follows them. The collector is only created when Config.EnableVGPU is set.
+type vgpuCollector struct {
+	counters []Counter
+	fields   []dcgm.Short
+	sysInfo  SystemInfo
+	hostname string
+	config   *Config
+	gpus     []MonitoringInfo // GPUs the vGPU instances are listed on
+
+	instances     []MonitoringInfo // vGPU instances whose fields are watched
+	watchCleanups []func()         // Clean up the watch of the instances
+	cleanups      []func()
+	connection    uint64 // Connection to DCGM of the cleanups, see staleConnection
+}
+
+func newVGPUCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem,
+) (*vgpuCollector, func(), error) {
+	collector := &vgpuCollector{
+		counters:   counters,
+		sysInfo:    fieldEntityGroupTypeSystemInfo.SystemInfo,
+		hostname:   hostname,
+		config:     config,
+		connection: dcgmConnection.Load(),
+	}
+
+	for _, counter := range counters {
+		if isVGPUField(counter.FieldID) {
+			collector.fields = append(collector.fields, counter.FieldID)
+		}
+	}
+
+	if len(collector.fields) == 0 {
+		return nil, func() {}, fmt.Errorf("no vGPU field to collect")
+	}
+
+	// The vGPU instances run on the physical GPUs, GPU instances are listed through their parent
+	for _, mi := range GetMonitoredEntities(collector.sysInfo) {
+		if slices.ContainsFunc(collector.gpus, func(gpu MonitoringInfo) bool {
+			return gpu.DeviceInfo.GPU == mi.DeviceInfo.GPU
+		}) {
+			continue
+		}
+
+		collector.gpus = append(collector.gpus, MonitoringInfo{
+			Entity:     dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: mi.DeviceInfo.GPU},
+			DeviceInfo: mi.DeviceInfo,
+			ParentId:   PARENT_ID_IGNORED,
+		})
+	}
+
+	if len(collector.gpus) == 0 {
+		return nil, func() {}, fmt.Errorf("no GPU to list vGPU instances on")
+	}
+
+	cleanups, err := watchEntityFieldsHook(collector.gpus, []dcgm.Short{dcgm.DCGM_FI_DEV_VGPU_INSTANCE_IDS}, config)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("failed to watch the vGPU instances; err: %w", err)
+	}
+	collector.cleanups = cleanups
+
+	return collector, func() { collector.Cleanup() }, nil
+}
+
+func (c *vgpuCollector) Cleanup() {
+	if staleConnection(c.connection) {
+		return
+	}
+
+	for _, cleanup := range c.watchCleanups {
+		cleanup()
+	}
+
+	for _, cleanup := range c.cleanups {
+		cleanup()
+	}
+}
+
+func (c *vgpuCollector) GetMetrics() (MetricsByCounter, error) {
+	instances, err := c.vgpuInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.EqualFunc(instances, c.instances, func(a, b MonitoringInfo) bool { return a.Entity == b.Entity }) {
+		c.watch(instances)
+	}
+
+	metrics := make(MetricsByCounter)
+	for _, mi := range c.instances {
+		vals, err := dcgmEntityGetLatestValuesHook(dcgm.FE_VGPU, mi.Entity.EntityId, c.fields)
+		if err != nil {
+			if isConnectionLost(err) {
+				return nil, fmt.Errorf("lost the connection to the hostengine; err: %w", err)
+			}
+
+			// The VM may have stopped since its instance was listed
+			logrus.Debugf("Cannot get the fields of vGPU instance %d; err: %v", mi.Entity.EntityId, err)
+			continue
+		}
+
+		instanceMetrics := make(MetricsByCounter)
+		toGPUMetric(instanceMetrics, vals, c.counters,
+			newGPUMetadata(mi.DeviceInfo, nil, nil, c.config.ReplaceBlanksInModelName), MetricOptions{
+				UseOldNamespace:    c.config.UseOldNamespace,
+				Hostname:           c.hostname,
+				UseSampleTimestamp: c.config.UseSampleTimestamp,
+				MissingValue:       missingValue(c.config),
+			})
+
+		for counter, values := range instanceMetrics {
+			for j := range values {
+				values[j].VGPUInstance = fmt.Sprintf("%d", mi.Entity.EntityId)
+			}
+			metrics[counter] = append(metrics[counter], values...)
+		}
+	}
+
+	return metrics, nil
+}
+
+// vgpuInstances lists the vGPU instances running on the GPUs of the collector
+func (c *vgpuCollector) vgpuInstances() ([]MonitoringInfo, error) {
+	var instances []MonitoringInfo
+	for _, gpu := range c.gpus {
+		vals, err := dcgmEntityGetLatestValuesHook(dcgm.FE_GPU, gpu.DeviceInfo.GPU,
+			[]dcgm.Short{dcgm.DCGM_FI_DEV_VGPU_INSTANCE_IDS})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the vGPU instances of GPU %d; err: %w", gpu.DeviceInfo.GPU, err)
+		}
+
+		for _, val := range vals {
+			if val.Status != dcgm.DCGM_ST_OK || val.FieldType != dcgm.DCGM_FT_BINARY {
+				continue
+			}
+
+			for _, id := range parseVGPUInstanceIDs(val.Value[:]) {
+				instances = append(instances, MonitoringInfo{
+					Entity:     dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_VGPU, EntityId: id},
+					DeviceInfo: gpu.DeviceInfo,
+					ParentId:   gpu.DeviceInfo.GPU,
+				})
+			}
+		}
+	}
+
+	return instances, nil
+}
+
+// watch replaces the watched vGPU instances. The previous instances stay watched when the new watch fails, it is
+// retried on the next collection.
+func (c *vgpuCollector) watch(instances []MonitoringInfo) {
+	var cleanups []func()
+	if len(instances) > 0 {
+		var err error
+		cleanups, err = watchEntityFieldsHook(instances, c.fields, c.config)
+		if err != nil {
+			logrus.Warnf("Cannot watch the fields of the vGPU instances; err: %v", err)
+			return
+		}
+	}
+
+	for _, cleanup := range c.watchCleanups {
+		cleanup()
+	}
+
+	logrus.Debugf("Watching %d vGPU instances", len(instances))
+	c.instances = instances
+	c.watchCleanups = cleanups
+}
+
+// parseVGPUInstanceIDs decodes the value of DCGM_FI_DEV_VGPU_INSTANCE_IDS, the number of instances followed by
+// their IDs as 32-bit integers
+func parseVGPUInstanceIDs(blob []byte) []uint {
+	if len(blob) < 4 {
+		return nil
+	}
+
+	count := int(binary.LittleEndian.Uint32(blob))
+	count = min(count, len(blob)/4-1)
+
+	ids := make([]uint, 0, count)
+	for i := 1; i <= count; i++ {
+		ids = append(ids, uint(binary.LittleEndian.Uint32(blob[i*4:])))
+	}
+
+	return ids
+}
+
+// watchEntityFields watches the fields on a group of the entities, at the collect interval of the GPUs
+func watchEntityFields(entities []MonitoringInfo, fields []dcgm.Short, config *Config) ([]func(), error) {
+	group, groupCleanup, err := createGroupFromMonitoringInfo(entities)
+	if err != nil {
+		groupCleanup()
+		return nil, err
+	}
+
+	fieldGroup, fieldGroupCleanup, err := NewFieldGroup(fields)
+	if err != nil {
+		groupCleanup()
+		return nil, err
+	}
+
+	updateFreq, maxKeepAge := watchParams(config, dcgm.FE_GPU)
+	err = WatchFieldGroup(group, fieldGroup, updateFreq, maxKeepAge, 1)
+	if err != nil {
+		fieldGroupCleanup()
+		groupCleanup()
+		return nil, err
+	}
+
+	return []func(){fieldGroupCleanup, groupCleanup}, nil
+}
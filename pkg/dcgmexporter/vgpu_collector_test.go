@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func vgpuInstanceIDsValue(ids ...uint32) [4096]byte {
+	var b [4096]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(ids)))
+	for i, id := range ids {
+		binary.LittleEndian.PutUint32(b[(i+1)*4:], id)
+	}
+	return b
+}
+
+func TestParseVGPUInstanceIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		blob []byte
+		want []uint
+	}{
+		{
+			name: "When the GPU runs vGPU instances, their IDs are returned",
+			blob: func() []byte { b := vgpuInstanceIDsValue(3, 7); return b[:] }(),
+			want: []uint{3, 7},
+		},
+		{
+			name: "When the GPU runs no vGPU instance, no ID is returned",
+			blob: func() []byte { b := vgpuInstanceIDsValue(); return b[:] }(),
+			want: []uint{},
+		},
+		{
+			name: "When the count exceeds the value, the IDs are bounded by the value",
+			blob: []byte{9, 0, 0, 0, 4, 0, 0, 0},
+			want: []uint{4},
+		},
+		{
+			name: "When the value is truncated, no ID is returned",
+			blob: []byte{1, 0},
+			want: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseVGPUInstanceIDs(tc.blob))
+		})
+	}
+}
+
+func TestVGPUCollector_GetMetrics(t *testing.T) {
+	instancesByGPU := map[uint][]uint32{0: {3, 7}, 1: {}}
+	dcgmEntityGetLatestValuesHook = func(entityGroup dcgm.Field_Entity_Group, entityID uint, fields []dcgm.Short,
+	) ([]dcgm.FieldValue_v1, error) {
+		if entityGroup == dcgm.FE_GPU {
+			return []dcgm.FieldValue_v1{{
+				FieldId:   uint(dcgm.DCGM_FI_DEV_VGPU_INSTANCE_IDS),
+				FieldType: dcgm.DCGM_FT_BINARY,
+				Value:     vgpuInstanceIDsValue(instancesByGPU[entityID]...),
+			}}, nil
+		}
+
+		require.Equal(t, dcgm.FE_VGPU, entityGroup)
+		require.Equal(t, []dcgm.Short{dcgm.DCGM_FI_DEV_VGPU_MEMORY_USAGE}, fields)
+		return []dcgm.FieldValue_v1{{
+			FieldId:   uint(dcgm.DCGM_FI_DEV_VGPU_MEMORY_USAGE),
+			FieldType: dcgm.DCGM_FT_INT64,
+			Value:     int64FieldValue(int64(entityID * 100)),
+		}}, nil
+	}
+
+	var watched [][]dcgm.GroupEntityPair
+	watchEntityFieldsHook = func(entities []MonitoringInfo, _ []dcgm.Short, _ *Config) ([]func(), error) {
+		var pairs []dcgm.GroupEntityPair
+		for _, mi := range entities {
+			pairs = append(pairs, mi.Entity)
+		}
+		watched = append(watched, pairs)
+		return nil, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+		watchEntityFieldsHook = watchEntityFields
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 2,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+		{FieldID: dcgm.DCGM_FI_DEV_VGPU_MEMORY_USAGE, FieldName: "DCGM_FI_DEV_VGPU_MEMORY_USAGE", PromType: "gauge"},
+	}
+	collector, cleanup, err := newVGPUCollector(counters, "local-test", &Config{},
+		FieldEntityGroupTypeSystemInfoItem{SystemInfo: sysInfo})
+	require.NoError(t, err)
+	defer cleanup()
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+
+	values := map[string]string{}
+	for _, metric := range metrics[counters[1]] {
+		assert.Equal(t, "GPU-0", metric.GPUUUID)
+		values[metric.VGPUInstance] = metric.Value
+	}
+	assert.Equal(t, map[string]string{"3": "300", "7": "700"}, values)
+
+	// The GPUs are watched for their instances, then the instances for their fields
+	require.Len(t, watched, 2)
+	assert.Equal(t, []dcgm.GroupEntityPair{
+		{EntityGroupId: dcgm.FE_VGPU, EntityId: 3},
+		{EntityGroupId: dcgm.FE_VGPU, EntityId: 7},
+	}, watched[1])
+
+	// The watch only changes with the instances
+	_, err = collector.GetMetrics()
+	require.NoError(t, err)
+	assert.Len(t, watched, 2)
+
+	instancesByGPU[0] = []uint32{3}
+	metrics, err = collector.GetMetrics()
+	require.NoError(t, err)
+	require.Len(t, watched, 3)
+	require.Len(t, metrics[counters[1]], 1)
+	assert.Equal(t, "3", metrics[counters[1]][0].VGPUInstance)
+}
+
+func TestNewVGPUCollectorWithoutVGPUField(t *testing.T) {
+	counters := []Counter{
+		{FieldID: dcgm.DCGM_FI_DEV_GPU_TEMP, FieldName: "DCGM_FI_DEV_GPU_TEMP", PromType: "gauge"},
+	}
+
+	_, _, err := newVGPUCollector(counters, "", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.ErrorContains(t, err, "no vGPU field to collect")
+}
+
+func TestVGPUMetricsFormat(t *testing.T) {
+	counter := Counter{FieldID: dcgm.DCGM_FI_DEV_VGPU_MEMORY_USAGE, FieldName: "DCGM_FI_DEV_VGPU_MEMORY_USAGE",
+		PromType: "gauge", Help: "vGPU memory usage (in MiB)."}
+	metrics := MetricsByCounter{counter: {{
+		Counter:      counter,
+		Value:        "300",
+		GPU:          "0",
+		GPUUUID:      "GPU-0",
+		GPUDevice:    "nvidia0",
+		GPUModelName: "NVIDIA A10",
+		UUID:         "UUID",
+		VGPUInstance: "3",
+		Hostname:     "local-test",
+	}}}
+
+	got, err := FormatMetrics(vgpuMetricsTemplate, metrics)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(got,
+		`DCGM_FI_DEV_VGPU_MEMORY_USAGE{gpu="0",UUID="GPU-0",pci_bus_id="",device="nvidia0",modelName="NVIDIA A10",`+
+			`vgpu_instance="3",Hostname="local-test"} 300`), got)
+}
@@ -52,7 +52,7 @@ func TestXIDCollector_Gather_Encode(t *testing.T) {
 		{"DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
 	}
 
-	cc, err := extractCounters(records, config)
+	cc, err := extractCounters(records, nil, config)
 	require.NoError(t, err)
 	require.Len(t, cc.ExporterCounters, 1)
 	require.Len(t, cc.DCGMCounters, 1)
@@ -274,7 +274,7 @@ func TestXIDCollector_NewXIDCollector(t *testing.T) {
 		records := [][]string{
 			{"DCGM_FI_DRIVER_VERSION", "label", "Driver Version"},
 		}
-		cc, err := extractCounters(records, config)
+		cc, err := extractCounters(records, nil, config)
 		require.NoError(t, err)
 		require.Len(t, cc.ExporterCounters, 0)
 		require.Len(t, cc.DCGMCounters, 1)
@@ -298,7 +298,7 @@ func TestXIDCollector_NewXIDCollector(t *testing.T) {
 			{"DCGM_EXP_XID_ERRORS_COUNT", "gauge", "Count of XID Errors within user-specified time window (see xid-count-window-size param)."},
 			{"DCGM_EXP_XID_ERRORS_COUNT", "gauge", "Count of XID Errors within user-specified time window (see xid-count-window-size param)."},
 		}
-		cc, err := extractCounters(records, config)
+		cc, err := extractCounters(records, nil, config)
 		require.NoError(t, err)
 		for i := range cc.DCGMCounters {
 			if cc.DCGMCounters[i].PromType == "label" {
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	dcgmListenForXIDViolationsHook = listenForXIDViolations
+	dcgmEntityGetLatestValuesHook  = dcgm.EntityGetLatestValues
+)
+
+// listenForXIDViolations subscribes to the XID notifications of every GPU
+func listenForXIDViolations(ctx context.Context) (<-chan dcgm.PolicyViolation, error) {
+	return dcgm.ListenForPolicyViolations(ctx, dcgm.XidPolicy)
+}
+
+// IsDCGMExpXIDErrorsTotalEnabled checks if the DCGM_EXP_XID_ERRORS_TOTAL counter exists
+func IsDCGMExpXIDErrorsTotalEnabled(counters []Counter) bool {
+	return slices.ContainsFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpXIDErrorsTotal
+	})
+}
+
+// xidEventsCollector counts the XID errors notified by the DCGM policy manager since the exporter started.
+// Notifications are handled in the background; GetMetrics only reads the counts, so a burst of XIDs
+// never holds up a collection.
+type xidEventsCollector struct {
+	expCollector
+
+	mtx     sync.Mutex
+	counts  map[uint]map[uint]uint64 // Number of XIDs by GPU and XID number
+	counted map[uint]int64           // Timestamp of the last XID sample counted by GPU, in us
+}
+
+// xidSubscription is the subscription of the exporter to the XID notifications, it is shared by the collectors.
+// go-dcgm unregisters the XID policy in the background once a subscription is cancelled, which would remove it for
+// the subscription replacing it on reload, and it hands each notification to a single one of its subscriptions.
+// The subscription is never cancelled: the collectors attach to it and detach on cleanup.
+type xidSubscription struct {
+	mtx        sync.Mutex
+	subscribed bool
+	connection uint64 // Connection to DCGM the XID policy is registered on, see staleConnection
+	collectors []*xidEventsCollector
+}
+
+var xidEvents xidSubscription
+
+// attach subscribes to the XID notifications on first use, or again once DCGM reconnected since the policy went
+// away with the previous connection, and hands them to the collector until detach
+func (s *xidSubscription) attach(c *xidEventsCollector) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.subscribed || staleConnection(s.connection) {
+		violations, err := dcgmListenForXIDViolationsHook(context.Background())
+		if err != nil {
+			return err
+		}
+
+		s.subscribed = true
+		s.connection = dcgmConnection.Load()
+		go s.dispatch(violations)
+	}
+
+	s.collectors = append(s.collectors, c)
+
+	return nil
+}
+
+func (s *xidSubscription) detach(c *xidEventsCollector) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.collectors = slices.DeleteFunc(s.collectors, func(attached *xidEventsCollector) bool {
+		return attached == c
+	})
+}
+
+func (s *xidSubscription) dispatch(violations <-chan dcgm.PolicyViolation) {
+	for violation := range violations {
+		if violation.Condition != dcgm.XidPolicy {
+			logrus.Debugf("Ignoring policy violation without XID: %+v", violation)
+			continue
+		}
+
+		s.mtx.Lock()
+		for _, c := range s.collectors {
+			c.record(violation.Timestamp)
+		}
+		s.mtx.Unlock()
+	}
+}
+
+func NewXIDEventsCollector(counters []Counter,
+	hostname string,
+	config *Config,
+	fieldEntityGroupTypeSystemInfo FieldEntityGroupTypeSystemInfoItem,
+) (Collector, error) {
+	if !IsDCGMExpXIDErrorsTotalEnabled(counters) {
+		logrus.Error(dcgmExpXIDErrorsTotal + " collector is disabled")
+		return nil, fmt.Errorf(dcgmExpXIDErrorsTotal + " collector is disabled")
+	}
+
+	collector := &xidEventsCollector{counts: map[uint]map[uint]uint64{}, counted: map[uint]int64{}}
+
+	// The XID field is watched to find out which GPU a notification comes from and the number of the XID
+	collector.expCollector = newExpCollector(counters,
+		hostname,
+		[]dcgm.Short{dcgm.DCGM_FI_DEV_XID_ERRORS},
+		config,
+		fieldEntityGroupTypeSystemInfo)
+
+	collector.counter = counters[slices.IndexFunc(counters, func(c Counter) bool {
+		return c.FieldName == dcgmExpXIDErrorsTotal
+	})]
+
+	if err := xidEvents.attach(collector); err != nil {
+		collector.Cleanup()
+		return nil, fmt.Errorf("failed to subscribe to XID notifications; err: %w", err)
+	}
+
+	// The collector stops counting the notifications before the field watches are removed
+	collector.cleanups = append([]func(){func() {
+		xidEvents.detach(collector)
+	}}, collector.cleanups...)
+
+	return collector, nil
+}
+
+// record counts the XIDs the GPUs reported since a notification raised at the given time. DCGM policy notifications
+// carry neither the GPU ID nor, through go-dcgm, a typed XID number, so the notification is matched against the
+// DCGM_FI_DEV_XID_ERRORS samples recorded no earlier than the second it was raised in. Each sample is counted once.
+func (c *xidEventsCollector) record(timestamp time.Time) {
+	var reported bool
+	var checked []uint
+
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		gpu := mi.DeviceInfo.GPU
+		if slices.Contains(checked, gpu) {
+			continue
+		}
+		checked = append(checked, gpu)
+
+		values, err := dcgmEntityGetLatestValuesHook(dcgm.FE_GPU, gpu, []dcgm.Short{dcgm.DCGM_FI_DEV_XID_ERRORS})
+		if err != nil || len(values) == 0 {
+			logrus.Debugf("Cannot read the last XID of GPU %d; err: %v", gpu, err)
+			continue
+		}
+
+		value := values[0]
+		if value.Status != 0 || value.Int64() <= 0 {
+			continue
+		}
+
+		if time.UnixMicro(value.Ts).Before(timestamp.Truncate(time.Second)) {
+			continue
+		}
+
+		c.mtx.Lock()
+		if c.counted[gpu] != value.Ts {
+			c.counted[gpu] = value.Ts
+			if _, exists := c.counts[gpu]; !exists {
+				c.counts[gpu] = map[uint]uint64{}
+			}
+			c.counts[gpu][uint(value.Int64())]++
+		}
+		c.mtx.Unlock()
+
+		reported = true
+	}
+
+	if !reported {
+		logrus.Warnf("Cannot find the GPU that reported the XID notified at %s", timestamp)
+	}
+}
+
+func (c *xidEventsCollector) GetMetrics() (MetricsByCounter, error) {
+	uuid := "UUID"
+	if c.config.UseOldNamespace {
+		uuid = "uuid"
+	}
+
+	metrics := make(MetricsByCounter)
+	var reported []uint
+
+	c.mtx.Lock()
+	for _, mi := range GetMonitoredEntities(c.sysInfo) {
+		// XIDs are counted per physical GPU, GPU instances are reported by their parent
+		gpu := mi.DeviceInfo.GPU
+		if slices.Contains(reported, gpu) {
+			continue
+		}
+		reported = append(reported, gpu)
+
+		mi.InstanceInfo = nil
+		for xid, count := range c.counts[gpu] {
+			m := c.createMetric(map[string]string{"xid": fmt.Sprint(xid)}, mi, uuid, int(count))
+			metrics[c.counter] = append(metrics[c.counter], m)
+		}
+	}
+	c.mtx.Unlock()
+
+	for _, transform := range c.transformations {
+		err := transform.Process(metrics, c.sysInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metrics for transform '%s'; err: %v", transform.Name(), err)
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2024, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dcgmexporter
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXIDEventsCollector_Record(t *testing.T) {
+	now := time.Now()
+
+	// GPU 0 reports XID 79 at every notification, GPU 1 reported XID 79 an hour ago and GPU 2 reported XID 13 once
+	var mtx sync.Mutex
+	lastXIDs := map[uint]struct {
+		xid int64
+		ts  time.Time
+	}{
+		0: {xid: 79, ts: now},
+		1: {xid: 79, ts: now.Add(-time.Hour)},
+		2: {xid: 13, ts: now},
+	}
+
+	dcgmEntityGetLatestValuesHook = func(_ dcgm.Field_Entity_Group, gpu uint, _ []dcgm.Short) ([]dcgm.FieldValue_v1, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		value := [4096]byte{}
+		binary.LittleEndian.PutUint64(value[:], uint64(lastXIDs[gpu].xid))
+		return []dcgm.FieldValue_v1{{
+			FieldId:   uint(dcgm.DCGM_FI_DEV_XID_ERRORS),
+			FieldType: dcgm.DCGM_FT_INT64,
+			Ts:        lastXIDs[gpu].ts.UnixMicro(),
+			Value:     value,
+		}}, nil
+	}
+	defer func() {
+		dcgmEntityGetLatestValuesHook = dcgm.EntityGetLatestValues
+	}()
+
+	sysInfo := SystemInfo{
+		GPUCount: 3,
+		gOpt: DeviceOptions{
+			MajorRange: []int{-1},
+			MinorRange: []int{},
+		},
+	}
+	for i := uint(0); i < sysInfo.GPUCount; i++ {
+		sysInfo.GPUs[i].DeviceInfo = dcgm.Device{GPU: i, UUID: fmt.Sprintf("GPU-%d", i)}
+	}
+
+	counter := Counter{FieldID: dcgm.Short(DCGMXIDErrorsTotal), FieldName: dcgmExpXIDErrorsTotal, PromType: "counter"}
+	collector := &xidEventsCollector{
+		expCollector: expCollector{
+			sysInfo:  sysInfo,
+			counter:  counter,
+			hostname: "local-test",
+			config:   &Config{},
+		},
+		counts:  map[uint]map[uint]uint64{},
+		counted: map[uint]int64{},
+	}
+
+	subscription := &xidSubscription{collectors: []*xidEventsCollector{collector}}
+
+	// A burst larger than the channel is consumed while metrics are gathered
+	violations := make(chan dcgm.PolicyViolation)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		subscription.dispatch(violations)
+	}()
+
+	for i := 0; i < 100; i++ {
+		mtx.Lock()
+		lastXIDs[0] = struct {
+			xid int64
+			ts  time.Time
+		}{xid: 79, ts: now.Add(time.Duration(i) * time.Millisecond)}
+		mtx.Unlock()
+
+		violations <- dcgm.PolicyViolation{Condition: dcgm.XidPolicy, Timestamp: now}
+		// Not an XID, it is received once the XID was handled
+		violations <- dcgm.PolicyViolation{Condition: dcgm.DbePolicy, Timestamp: now}
+
+		_, err := collector.GetMetrics()
+		require.NoError(t, err)
+	}
+	close(violations)
+	<-done
+
+	metrics, err := collector.GetMetrics()
+	require.NoError(t, err)
+
+	values := map[string]string{}
+	for _, metric := range metrics[counter] {
+		assert.Equal(t, "local-test", metric.Hostname)
+		values[metric.GPU+"/"+metric.Labels["xid"]] = metric.Value
+	}
+
+	// Each sample is counted once, however many notifications it matches
+	assert.Equal(t, map[string]string{"0/79": "100", "2/13": "1"}, values)
+}
+
+func TestXIDSubscription_Attach(t *testing.T) {
+	var listens int
+	dcgmListenForXIDViolationsHook = func(context.Context) (<-chan dcgm.PolicyViolation, error) {
+		listens++
+		return make(chan dcgm.PolicyViolation), nil
+	}
+	defer func() {
+		dcgmListenForXIDViolationsHook = listenForXIDViolations
+	}()
+
+	var subscription xidSubscription
+	previous, next := &xidEventsCollector{}, &xidEventsCollector{}
+
+	// A reload attaches the new collector before the previous one is cleaned up, the subscription is kept
+	require.NoError(t, subscription.attach(previous))
+	require.NoError(t, subscription.attach(next))
+	subscription.detach(previous)
+	assert.Equal(t, 1, listens)
+	assert.Equal(t, []*xidEventsCollector{next}, subscription.collectors)
+
+	// The policy is registered again once DCGM reconnected
+	dcgmConnection.Add(1)
+	require.NoError(t, subscription.attach(previous))
+	assert.Equal(t, 2, listens)
+}
+
+func TestNewXIDEventsCollector_Disabled(t *testing.T) {
+	_, err := NewXIDEventsCollector([]Counter{}, "", &Config{}, FieldEntityGroupTypeSystemInfoItem{})
+	require.Error(t, err)
+}